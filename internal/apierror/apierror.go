@@ -0,0 +1,52 @@
+// Package apierror writes the JSON error responses shared by all HTTP
+// handlers and middleware: {"error": {"code": "...", "message": "..."}}.
+// Codes are stable for clients to branch on; messages are for people.
+package apierror
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Error codes
+const (
+	// The body is not valid JSON or form data
+	CodeInvalidPayload = "invalid_payload"
+	// The body parses but a field is missing or invalid
+	CodeInvalidRequest = "invalid_request"
+	// The request signature or API key is missing or wrong
+	CodeUnauthorized = "unauthorized"
+	// The endpoint is disabled by configuration
+	CodeForbidden       = "forbidden"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodePayloadTooLarge = "payload_too_large"
+	// The client exceeded its request rate; retry later
+	CodeRateLimited = "rate_limited"
+	// Too many requests are in flight; retry after the Retry-After header
+	CodeOverloaded = "overloaded"
+	// A dependency (OpenAI, the chat model, search) failed
+	CodeUpstreamError = "upstream_error"
+	CodeInternalError = "internal_error"
+)
+
+// Response is the body of an error response
+type Response struct {
+	Error Detail `json:"error"`
+}
+
+type Detail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Respond writes an error response with the status, code and message
+func Respond(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(Response{Error: Detail{Code: code, Message: message}}); err != nil {
+		slog.Error("Failed to encode error response", "error", err)
+	}
+}
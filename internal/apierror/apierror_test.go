@@ -0,0 +1,29 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Respond(rec, http.StatusBadRequest, CodeInvalidRequest, "Query cannot be empty")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected a JSON content type, got %q", ct)
+	}
+
+	var body map[string]map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	expected := map[string]string{"code": "invalid_request", "message": "Query cannot be empty"}
+	if len(body) != 1 || len(body["error"]) != 2 || body["error"]["code"] != expected["code"] || body["error"]["message"] != expected["message"] {
+		t.Errorf("Expected %v under error, got %v", expected, body)
+	}
+}
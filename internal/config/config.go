@@ -1,9 +1,19 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"knowthis/internal/metrics"
 )
 
 type Config struct {
@@ -14,6 +24,239 @@ type Config struct {
 	LogLevel          string
 	LogFormat         string
 	Environment       string
+	AdminAPIKey       string
+
+	// Keys ("name:key" or bare) accepted as bearer tokens by the query API;
+	// empty leaves it open
+	APIKeys []string
+
+	// Connection pool of each database handle; 0 open connections means
+	// unlimited and 0 lifetime keeps connections open indefinitely
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	// Verifies that requests to the Slack endpoints come from Slack
+	SlackSigningSecret string
+
+	// Discord thread collection, enabled with a bot token; the application's
+	// public key verifies interactions, and outside threads the messages
+	// around the target message are collected
+	DiscordBotToken        string
+	DiscordPublicKey       string
+	DiscordContextMessages int
+
+	// Notion page ingestion, enabled with an integration token; webhook
+	// events are verified with the subscription's verification token
+	NotionAPIToken      string
+	NotionWebhookSecret string
+
+	// Teams thread collection, enabled with an Azure AD application's client
+	// ID; threads are read through Microsoft Graph and outgoing webhook
+	// activities verified with the webhook's security token
+	TeamsTenantID      string
+	TeamsClientID      string
+	TeamsClientSecret  string
+	TeamsWebhookSecret string
+
+	// Slack channels allowed for collection; runtime overrides are stored in the database
+	SlackChannelAllowlist []string
+
+	// Retrieval granularity: "thread" returns whole matched threads, "chunk" only the matched chunk
+	RetrievalGranularity string
+
+	// How far (0-1) a best keyword match lifts a hybrid search score toward 1
+	SearchKeywordWeight float64
+
+	// Store authors' Slack profile title (and team, from a custom profile field) with messages
+	ProfileEnrichment bool
+	ProfileTeamField  string
+
+	// Copy Slack threads stored in the documents table by the legacy handler into slack_messages on startup
+	BackfillSlackDocuments bool
+
+	// Store a channel's bookmarked canvases as documents when a thread from it is collected
+	CanvasIngestion bool
+
+	// Collected Slack threads with more messages than this are also stored as
+	// summaries of SlackThreadSummarySegment messages each; 0 disables them
+	SlackThreadSummaryThreshold int
+	SlackThreadSummarySegment   int
+
+	// Retry policy for user-facing Slack notifications
+	SlackNotifyMaxAttempts int
+	SlackNotifyRetryDelay  time.Duration
+
+	// How often a Slack API call waits out a rate limit before failing
+	SlackRateLimitRetries int
+
+	// Search each source's vector index separately and merge by weight
+	PerSourceIndexes bool
+	SourceWeights    map[string]float64
+
+	// OpenAI-compatible chat API used for answers (defaults to OpenAI)
+	ChatBaseURL           string
+	ChatAPIKey            string
+	ChatModel             string
+	ChatValidateOnStartup bool
+
+	// Additional chat models a query may request instead of ChatModel
+	ChatModelAllowlist []string
+
+	// USD per million tokens by model, for estimating OpenAI spend
+	TokenPrices map[string]metrics.TokenPrice
+
+	// OTLP/HTTP collector that traces are exported to; empty disables tracing
+	OTLPEndpoint    string
+	OTELServiceName string
+
+	// Bounds for the embedding processor's adaptive interval
+	EmbeddingIntervalMin time.Duration
+	EmbeddingIntervalMax time.Duration
+
+	// Slack threads embedded at once, and the embedding requests per second
+	// allowed across them (0 for no limit)
+	EmbeddingConcurrency       int
+	EmbeddingRequestsPerSecond float64
+
+	// Log what the embedding processors would embed instead of calling OpenAI
+	EmbeddingDryRun bool
+
+	// Drop blockquoted lines from Slack messages before embedding
+	TrimQuotedContent bool
+
+	// Words per Slack thread chunk, and the trailing words of a chunk
+	// repeated at the start of the next
+	ChunkMaxWords     int
+	ChunkOverlapWords int
+
+	// Embedding model; the output size must match the VECTOR(1536) columns
+	EmbeddingModel      string
+	EmbeddingDimensions int
+
+	// Embedding model for content and queries detected to be in a language
+	// other than English; empty embeds everything with EmbeddingModel
+	MultilingualEmbeddingModel string
+
+	// Refuse to start while a vector column in the database has another size
+	EmbeddingDimensionCheck bool
+
+	// Retry policy for transient embedding API failures, with a per-attempt
+	// timeout (0 allows 10s for one text and 30s for a batch)
+	EmbeddingMaxAttempts int
+	EmbeddingRetryDelay  time.Duration
+	EmbeddingTimeout     time.Duration
+
+	// Bounds on answering a query as a whole, on generating its answer and on
+	// rewriting a follow-up; each only shortens the caller's deadline
+	QueryTimeout      time.Duration
+	CompletionTimeout time.Duration
+	CondenseTimeout   time.Duration
+
+	// Tighter retry policy for embedding user queries, bounding query latency
+	QueryEmbeddingMaxAttempts int
+	QueryEmbeddingRetryDelay  time.Duration
+	QueryEmbeddingTimeout     time.Duration
+
+	// Number of query embeddings kept for repeated questions (0 disables
+	// caching), and how long each is kept (0 until evicted)
+	QueryEmbeddingCacheSize int
+	QueryEmbeddingCacheTTL  time.Duration
+
+	// Minimum size of content used as a source (code and links are exempt).
+	// RAG_MIN_CONTENT_LEN, if set, overrides QUALITY_MIN_CHARS.
+	QualityMinChars int
+	QualityMinWords int
+
+	// Phrases whose sources are filtered out, matched as whole words; empty
+	// uses the default bot acknowledgement and placeholder phrases
+	QualityBlockedPhrases []string
+
+	// Default minimum similarity for query sources, and the lower threshold
+	// tried when no source passes it
+	RAGPrimaryThreshold  float64
+	RAGFallbackThreshold float64
+
+	// Header, set by a trusted auth proxy, listing the channel IDs the caller may read.
+	// When set, queries without it see no sources.
+	AccessScopeHeader string
+
+	// Drop sources whose content is contained in another cited source
+	DedupContainedSources bool
+
+	// Answer with the most relevant sources when the chat model fails
+	AnswerSourceFallback bool
+
+	// Follow citations in answers with the cited thread's date
+	InlineCitationDates bool
+
+	// Most tokens in the prompt sent for an answer; the least similar sources are dropped to fit. 0 disables
+	PromptTokenBudget int
+
+	// System prompt answers are generated with; empty uses the built-in prompt
+	SystemPrompt string
+
+	// Skip storing documents whose content is already stored for the same source under another source ID
+	DedupAcrossSourceID bool
+
+	// Characters of the parent post prepended to Slab comments before embedding; 0 disables
+	CommentParentContextChars int
+
+	// How often documents with a placeholder embedding but now embeddable content are requeued; 0 disables
+	PlaceholderSweepInterval time.Duration
+
+	// Under a backlog the document embedding batch grows up to this size
+	// (0 disables) and the interval shrinks down to the minimum
+	DocumentEmbeddingMaxBatchSize int
+	DocumentEmbeddingMinInterval  time.Duration
+
+	// Chunks embedded per document; the rest of a longer document is dropped with a warning
+	EmbeddingMaxChunksPerDocument int
+
+	// How long an idle conversation's turns are remembered for follow-up
+	// questions (0 disables), and how many recent turns are used
+	ConversationTTL      time.Duration
+	ConversationMaxTurns int
+
+	// Check dependencies before serving; failures only warn unless required
+	WarmupTimeout  time.Duration
+	WarmupRequired bool
+
+	// How long an answer is reused for an identical query; zero disables caching
+	AnswerCacheTTL time.Duration
+	// Most answers cached, least recently used evicted first
+	AnswerCacheSize int
+
+	// Per-IP request rates (per second) and bursts for API and webhook endpoints
+	APIRateLimit     float64
+	APIBurst         int
+	WebhookRateLimit float64
+	WebhookBurst     int
+
+	// Per-IP rate limiters idle longer than this are evicted
+	RateLimitIdleTTL time.Duration
+
+	// IPs and CIDRs (e.g. webhook senders, monitoring) exempt from per-IP rate limiting
+	RateLimitBypass []string
+
+	// Browser origins allowed to call /api (empty disables CORS) and what
+	// their requests may use
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// Webhook requests processed at once (0 disables the limit); excess
+	// requests are told to retry after WebhookRetryAfter
+	WebhookMaxConcurrent int
+	WebhookRetryAfter    time.Duration
+
+	// Largest webhook request body accepted, in bytes
+	WebhookMaxBodyBytes int64
+
+	// Fraction (0-1) of queries whose prompt context and answer are stored for evaluation
+	QuerySampleRate float64
 }
 
 func Load() *Config {
@@ -25,6 +268,141 @@ func Load() *Config {
 		LogLevel:          os.Getenv("LOG_LEVEL"),
 		LogFormat:         os.Getenv("LOG_FORMAT"),
 		Environment:       os.Getenv("ENVIRONMENT"),
+		AdminAPIKey:       os.Getenv("ADMIN_API_KEY"),
+		APIKeys:           getEnvList("API_KEYS"),
+
+		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 20),
+		DBMaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+
+		SlackSigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+
+		DiscordBotToken:        os.Getenv("DISCORD_BOT_TOKEN"),
+		DiscordPublicKey:       os.Getenv("DISCORD_PUBLIC_KEY"),
+		DiscordContextMessages: getEnvInt("DISCORD_CONTEXT_MESSAGES", 25),
+
+		NotionAPIToken:      os.Getenv("NOTION_API_TOKEN"),
+		NotionWebhookSecret: os.Getenv("NOTION_WEBHOOK_SECRET"),
+
+		TeamsTenantID:      os.Getenv("TEAMS_TENANT_ID"),
+		TeamsClientID:      os.Getenv("TEAMS_CLIENT_ID"),
+		TeamsClientSecret:  os.Getenv("TEAMS_CLIENT_SECRET"),
+		TeamsWebhookSecret: os.Getenv("TEAMS_WEBHOOK_SECRET"),
+
+		SlackChannelAllowlist: getEnvList("SLACK_CHANNEL_ALLOWLIST"),
+
+		RetrievalGranularity: getEnvOrDefault("RETRIEVAL_GRANULARITY", "thread"),
+		SearchKeywordWeight:  getEnvFloat("SEARCH_KEYWORD_WEIGHT", 0.3),
+
+		ProfileEnrichment: getEnvBool("PROFILE_ENRICHMENT", false),
+		ProfileTeamField:  os.Getenv("SLACK_PROFILE_TEAM_FIELD"),
+
+		CanvasIngestion: getEnvBool("SLACK_CANVAS_INGESTION", false),
+
+		BackfillSlackDocuments: getEnvBool("BACKFILL_SLACK_DOCUMENTS", false),
+
+		SlackThreadSummaryThreshold: getEnvInt("SLACK_THREAD_SUMMARY_THRESHOLD", 0),
+		SlackThreadSummarySegment:   getEnvInt("SLACK_THREAD_SUMMARY_SEGMENT", 100),
+
+		SlackNotifyMaxAttempts: getEnvInt("SLACK_NOTIFY_MAX_ATTEMPTS", 3),
+		SlackNotifyRetryDelay:  getEnvDuration("SLACK_NOTIFY_RETRY_DELAY", time.Second),
+		SlackRateLimitRetries:  getEnvInt("SLACK_RATE_LIMIT_RETRIES", 5),
+
+		PerSourceIndexes: getEnvBool("PER_SOURCE_INDEXES", false),
+		SourceWeights:    getEnvWeights("SOURCE_WEIGHTS", "slack=1,slab=1"),
+
+		ChatBaseURL:           os.Getenv("CHAT_BASE_URL"),
+		ChatAPIKey:            getEnvOrDefault("CHAT_API_KEY", os.Getenv("OPENAI_API_KEY")),
+		ChatModel:             getEnvOrDefault("CHAT_MODEL", "gpt-4o-mini"),
+		ChatValidateOnStartup: getEnvBool("CHAT_VALIDATE_ON_STARTUP", false),
+		ChatModelAllowlist:    getEnvList("CHAT_MODEL_ALLOWLIST"),
+		TokenPrices:           getEnvTokenPrices("OPENAI_TOKEN_PRICES"),
+
+		OTLPEndpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTELServiceName: getEnvOrDefault("OTEL_SERVICE_NAME", "knowthis"),
+
+		EmbeddingIntervalMin: getEnvDuration("EMBEDDING_INTERVAL_MIN", 5*time.Second),
+		EmbeddingIntervalMax: getEnvDuration("EMBEDDING_INTERVAL_MAX", 5*time.Minute),
+		TrimQuotedContent:    getEnvBool("TRIM_QUOTED_CONTENT", false),
+		ChunkMaxWords:        getEnvInt("CHUNK_MAX_WORDS", 7000),
+		ChunkOverlapWords:    getEnvInt("CHUNK_OVERLAP_WORDS", 0),
+
+		EmbeddingConcurrency:       getEnvInt("EMBEDDING_CONCURRENCY", 1),
+		EmbeddingRequestsPerSecond: getEnvFloat("EMBEDDING_REQUESTS_PER_SECOND", 0),
+		EmbeddingDryRun:            getEnvBool("EMBEDDING_DRY_RUN", false),
+
+		EmbeddingModel:          getEnvOrDefault("EMBEDDING_MODEL", "text-embedding-ada-002"),
+		EmbeddingDimensions:     getEnvInt("EMBEDDING_DIMENSIONS", 0),
+		EmbeddingDimensionCheck: getEnvBool("EMBEDDING_DIMENSION_CHECK", true),
+
+		MultilingualEmbeddingModel: os.Getenv("MULTILINGUAL_EMBEDDING_MODEL"),
+
+		EmbeddingMaxAttempts: getEnvInt("EMBEDDING_MAX_ATTEMPTS", 3),
+		EmbeddingRetryDelay:  getEnvDuration("EMBEDDING_RETRY_DELAY", 500*time.Millisecond),
+		EmbeddingTimeout:     getEnvDuration("EMBEDDING_TIMEOUT", 0),
+
+		QueryTimeout:      getEnvDuration("QUERY_TIMEOUT", 30*time.Second),
+		CompletionTimeout: getEnvDuration("COMPLETION_TIMEOUT", 30*time.Second),
+		CondenseTimeout:   getEnvDuration("CONDENSE_TIMEOUT", 10*time.Second),
+
+		QueryEmbeddingMaxAttempts: getEnvInt("QUERY_EMBEDDING_MAX_ATTEMPTS", 2),
+		QueryEmbeddingRetryDelay:  getEnvDuration("QUERY_EMBEDDING_RETRY_DELAY", 200*time.Millisecond),
+		QueryEmbeddingTimeout:     getEnvDuration("QUERY_EMBEDDING_TIMEOUT", 4*time.Second),
+		QueryEmbeddingCacheSize:   getEnvInt("QUERY_EMBEDDING_CACHE_SIZE", 0),
+		QueryEmbeddingCacheTTL:    getEnvDuration("QUERY_EMBEDDING_CACHE_TTL", 0),
+
+		QualityMinChars:       getEnvInt("RAG_MIN_CONTENT_LEN", getEnvInt("QUALITY_MIN_CHARS", 10)),
+		QualityMinWords:       getEnvInt("QUALITY_MIN_WORDS", 2),
+		QualityBlockedPhrases: getEnvList("QUALITY_BLOCKED_PHRASES"),
+
+		RAGPrimaryThreshold:  getEnvFloat("RAG_PRIMARY_THRESHOLD", 0.75),
+		RAGFallbackThreshold: getEnvFloat("RAG_FALLBACK_THRESHOLD", 0.6),
+
+		AccessScopeHeader: os.Getenv("ACCESS_SCOPE_HEADER"),
+
+		DedupContainedSources: getEnvBool("DEDUP_CONTAINED_SOURCES", false),
+		AnswerSourceFallback:  getEnvBool("ANSWER_SOURCE_FALLBACK", true),
+		InlineCitationDates:   getEnvBool("INLINE_CITATION_DATES", false),
+		PromptTokenBudget:     getEnvInt("PROMPT_TOKEN_BUDGET", 16000),
+		DedupAcrossSourceID:   getEnvBool("DEDUP_ACROSS_SOURCE_ID", false),
+
+		SystemPrompt: strings.TrimSpace(os.Getenv("SYSTEM_PROMPT")),
+
+		CommentParentContextChars: getEnvInt("COMMENT_PARENT_CONTEXT_CHARS", 0),
+		PlaceholderSweepInterval:  getEnvDuration("PLACEHOLDER_SWEEP_INTERVAL", time.Hour),
+
+		DocumentEmbeddingMaxBatchSize: getEnvInt("DOCUMENT_EMBEDDING_MAX_BATCH_SIZE", 0),
+		DocumentEmbeddingMinInterval:  getEnvDuration("DOCUMENT_EMBEDDING_MIN_INTERVAL", 10*time.Second),
+
+		EmbeddingMaxChunksPerDocument: getEnvInt("EMBEDDING_MAX_CHUNKS_PER_DOCUMENT", 20),
+
+		ConversationTTL:      getEnvDuration("CONVERSATION_TTL", 30*time.Minute),
+		ConversationMaxTurns: getEnvInt("CONVERSATION_MAX_TURNS", 5),
+
+		WarmupTimeout:  getEnvDuration("WARMUP_TIMEOUT", 10*time.Second),
+		WarmupRequired: getEnvBool("WARMUP_REQUIRED", false),
+
+		AnswerCacheTTL:  getEnvDuration("ANSWER_CACHE_TTL", 0),
+		AnswerCacheSize: getEnvInt("ANSWER_CACHE_SIZE", 1000),
+
+		APIRateLimit:     getEnvFloat("API_RATE_LIMIT", 10),
+		APIBurst:         getEnvInt("API_BURST", 20),
+		WebhookRateLimit: getEnvFloat("WEBHOOK_RATE_LIMIT", 100),
+		WebhookBurst:     getEnvInt("WEBHOOK_BURST", 200),
+		RateLimitIdleTTL: getEnvDuration("RATE_LIMIT_IDLE_TTL", 10*time.Minute),
+		RateLimitBypass:  getEnvList("RATE_LIMIT_BYPASS"),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods:   getEnvListOrDefault("CORS_ALLOWED_METHODS", []string{"GET", "POST"}),
+		CORSAllowedHeaders:   getEnvListOrDefault("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization"}),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+
+		WebhookMaxConcurrent: getEnvInt("WEBHOOK_MAX_CONCURRENT", 20),
+		WebhookRetryAfter:    getEnvDuration("WEBHOOK_RETRY_AFTER", 5*time.Second),
+		WebhookMaxBodyBytes:  int64(getEnvInt("WEBHOOK_MAX_BODY_BYTES", 1<<20)),
+
+		QuerySampleRate: getEnvFloat("QUERY_SAMPLE_RATE", 0),
 	}
 }
 
@@ -39,6 +417,28 @@ func (c *Config) Validate() error {
 		errors = append(errors, "SLACK_BOT_TOKEN is required")
 	}
 
+	if c.SlackSigningSecret == "" {
+		errors = append(errors, "SLACK_SIGNING_SECRET is required")
+	}
+
+	if c.DiscordBotToken != "" {
+		if key, err := hex.DecodeString(c.DiscordPublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			errors = append(errors, "DISCORD_PUBLIC_KEY must be the application's hex-encoded public key when DISCORD_BOT_TOKEN is set")
+		}
+		if c.DiscordContextMessages < 1 || c.DiscordContextMessages > 100 {
+			errors = append(errors, "DISCORD_CONTEXT_MESSAGES must be between 1 and 100")
+		}
+	}
+
+	if c.TeamsClientID != "" {
+		if c.TeamsTenantID == "" || c.TeamsClientSecret == "" {
+			errors = append(errors, "TEAMS_TENANT_ID and TEAMS_CLIENT_SECRET are required when TEAMS_CLIENT_ID is set")
+		}
+		if key, err := base64.StdEncoding.DecodeString(c.TeamsWebhookSecret); err != nil || len(key) == 0 {
+			errors = append(errors, "TEAMS_WEBHOOK_SECRET must be the outgoing webhook's base64 security token when TEAMS_CLIENT_ID is set")
+		}
+	}
+
 
 	if c.OpenAIAPIKey == "" {
 		errors = append(errors, "OPENAI_API_KEY is required")
@@ -48,6 +448,20 @@ func (c *Config) Validate() error {
 		errors = append(errors, "DATABASE_URL is required")
 	}
 
+	if c.DBMaxOpenConns < 0 {
+		errors = append(errors, "DB_MAX_OPEN_CONNS cannot be negative")
+	}
+
+	if c.DBMaxIdleConns < 0 {
+		errors = append(errors, "DB_MAX_IDLE_CONNS cannot be negative")
+	} else if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errors = append(errors, "DB_MAX_IDLE_CONNS cannot exceed DB_MAX_OPEN_CONNS")
+	}
+
+	if c.DBConnMaxLifetime < 0 {
+		errors = append(errors, "DB_CONN_MAX_LIFETIME cannot be negative")
+	}
+
 	if c.LogLevel == "" {
 		errors = append(errors, "LOG_LEVEL is required")
 	}
@@ -80,6 +494,232 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	validGranularities := []string{"thread", "chunk"}
+	if !contains(validGranularities, c.RetrievalGranularity) {
+		errors = append(errors, "RETRIEVAL_GRANULARITY must be one of: thread, chunk")
+	}
+
+	if c.SearchKeywordWeight < 0 || c.SearchKeywordWeight > 1 {
+		errors = append(errors, "SEARCH_KEYWORD_WEIGHT must be between 0 and 1")
+	}
+
+	if c.SlackThreadSummaryThreshold < 0 {
+		errors = append(errors, "SLACK_THREAD_SUMMARY_THRESHOLD cannot be negative")
+	}
+
+	if c.SlackThreadSummarySegment < 1 {
+		errors = append(errors, "SLACK_THREAD_SUMMARY_SEGMENT must be at least 1")
+	}
+
+	if c.SlackNotifyMaxAttempts < 1 {
+		errors = append(errors, "SLACK_NOTIFY_MAX_ATTEMPTS must be at least 1")
+	}
+
+	if c.SlackNotifyRetryDelay < 0 {
+		errors = append(errors, "SLACK_NOTIFY_RETRY_DELAY cannot be negative")
+	}
+
+	if c.SlackRateLimitRetries < 0 {
+		errors = append(errors, "SLACK_RATE_LIMIT_RETRIES cannot be negative")
+	}
+
+	if c.PerSourceIndexes && c.SourceWeights == nil {
+		errors = append(errors, "SOURCE_WEIGHTS must be a list of source=weight pairs with positive weights")
+	}
+
+	if c.TokenPrices == nil {
+		errors = append(errors, "OPENAI_TOKEN_PRICES must be a list of model=prompt_price:completion_price pairs with non-negative prices")
+	}
+
+	if c.OTLPEndpoint != "" && !strings.HasPrefix(c.OTLPEndpoint, "http://") && !strings.HasPrefix(c.OTLPEndpoint, "https://") {
+		errors = append(errors, "OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL")
+	}
+
+	if c.ChatBaseURL != "" && !strings.HasPrefix(c.ChatBaseURL, "http://") && !strings.HasPrefix(c.ChatBaseURL, "https://") {
+		errors = append(errors, "CHAT_BASE_URL must be an http(s) URL")
+	}
+
+	if c.EmbeddingIntervalMin <= 0 || c.EmbeddingIntervalMax < c.EmbeddingIntervalMin {
+		errors = append(errors, "EMBEDDING_INTERVAL_MIN must be positive and not above EMBEDDING_INTERVAL_MAX")
+	}
+
+	if c.EmbeddingConcurrency < 1 {
+		errors = append(errors, "EMBEDDING_CONCURRENCY must be at least 1")
+	}
+	if c.EmbeddingRequestsPerSecond < 0 {
+		errors = append(errors, "EMBEDDING_REQUESTS_PER_SECOND cannot be negative")
+	}
+
+	if c.ChunkMaxWords < 1 || c.ChunkMaxWords > 7000 {
+		errors = append(errors, "CHUNK_MAX_WORDS must be between 1 and 7000")
+	}
+	if c.ChunkOverlapWords < 0 || c.ChunkOverlapWords >= c.ChunkMaxWords {
+		errors = append(errors, "CHUNK_OVERLAP_WORDS must be at least 0 and below CHUNK_MAX_WORDS")
+	}
+
+	if c.EmbeddingDimensions < 0 {
+		errors = append(errors, "EMBEDDING_DIMENSIONS cannot be negative")
+	}
+
+	if c.MultilingualEmbeddingModel != "" && c.MultilingualEmbeddingModel == c.EmbeddingModel {
+		errors = append(errors, "MULTILINGUAL_EMBEDDING_MODEL must differ from EMBEDDING_MODEL")
+	}
+
+	if c.EmbeddingMaxAttempts < 1 {
+		errors = append(errors, "EMBEDDING_MAX_ATTEMPTS must be at least 1")
+	}
+
+	if c.EmbeddingRetryDelay < 0 {
+		errors = append(errors, "EMBEDDING_RETRY_DELAY cannot be negative")
+	}
+
+	if c.PromptTokenBudget < 0 {
+		errors = append(errors, "PROMPT_TOKEN_BUDGET cannot be negative")
+	}
+
+	// services.MaxSystemPromptChars; the RAG service would ignore a longer prompt
+	if utf8.RuneCountInString(c.SystemPrompt) > 4000 {
+		errors = append(errors, "SYSTEM_PROMPT must be at most 4000 characters")
+	}
+
+	if c.CommentParentContextChars < 0 {
+		errors = append(errors, "COMMENT_PARENT_CONTEXT_CHARS cannot be negative")
+	}
+
+	if c.PlaceholderSweepInterval < 0 {
+		errors = append(errors, "PLACEHOLDER_SWEEP_INTERVAL cannot be negative")
+	}
+
+	// The document embedding processor's batch size of 10 and 60s interval
+	// are the baseline adaptive batching returns to
+	if c.DocumentEmbeddingMaxBatchSize != 0 && (c.DocumentEmbeddingMaxBatchSize <= 10 || c.DocumentEmbeddingMaxBatchSize > 1000) {
+		errors = append(errors, "DOCUMENT_EMBEDDING_MAX_BATCH_SIZE must be 0 or between 11 and 1000")
+	}
+
+	if c.DocumentEmbeddingMaxBatchSize != 0 && (c.DocumentEmbeddingMinInterval <= 0 || c.DocumentEmbeddingMinInterval > time.Minute) {
+		errors = append(errors, "DOCUMENT_EMBEDDING_MIN_INTERVAL must be positive and at most 1m")
+	}
+
+	if c.EmbeddingMaxChunksPerDocument < 1 {
+		errors = append(errors, "EMBEDDING_MAX_CHUNKS_PER_DOCUMENT must be at least 1")
+	}
+
+	if c.QueryEmbeddingMaxAttempts < 1 {
+		errors = append(errors, "QUERY_EMBEDDING_MAX_ATTEMPTS must be at least 1")
+	}
+
+	if c.QueryEmbeddingRetryDelay < 0 {
+		errors = append(errors, "QUERY_EMBEDDING_RETRY_DELAY cannot be negative")
+	}
+
+	if c.EmbeddingTimeout < 0 {
+		errors = append(errors, "EMBEDDING_TIMEOUT cannot be negative")
+	}
+
+	if c.QueryTimeout <= 0 || c.CompletionTimeout <= 0 || c.CondenseTimeout <= 0 {
+		errors = append(errors, "QUERY_TIMEOUT, COMPLETION_TIMEOUT and CONDENSE_TIMEOUT must be positive")
+	}
+
+	if c.QueryEmbeddingTimeout <= 0 {
+		errors = append(errors, "QUERY_EMBEDDING_TIMEOUT must be positive")
+	}
+
+	if c.QueryEmbeddingCacheSize < 0 || c.QueryEmbeddingCacheTTL < 0 {
+		errors = append(errors, "QUERY_EMBEDDING_CACHE_SIZE and QUERY_EMBEDDING_CACHE_TTL cannot be negative")
+	}
+
+	if c.QualityMinChars < 0 || c.QualityMinWords < 0 {
+		errors = append(errors, "QUALITY_MIN_CHARS (or RAG_MIN_CONTENT_LEN) and QUALITY_MIN_WORDS cannot be negative")
+	}
+
+	if c.RAGFallbackThreshold < 0 || c.RAGFallbackThreshold > c.RAGPrimaryThreshold || c.RAGPrimaryThreshold > 1 {
+		errors = append(errors, "RAG_FALLBACK_THRESHOLD and RAG_PRIMARY_THRESHOLD must satisfy 0 <= fallback <= primary <= 1")
+	}
+
+	if c.WarmupTimeout <= 0 {
+		errors = append(errors, "WARMUP_TIMEOUT must be positive")
+	}
+
+	if c.ConversationTTL < 0 {
+		errors = append(errors, "CONVERSATION_TTL cannot be negative")
+	}
+
+	if c.ConversationMaxTurns < 1 {
+		errors = append(errors, "CONVERSATION_MAX_TURNS must be at least 1")
+	}
+
+	if c.AnswerCacheTTL < 0 {
+		errors = append(errors, "ANSWER_CACHE_TTL cannot be negative")
+	}
+	if c.AnswerCacheTTL > 0 && c.AnswerCacheSize < 1 {
+		errors = append(errors, "ANSWER_CACHE_SIZE must be at least 1")
+	}
+
+	if c.APIRateLimit <= 0 {
+		errors = append(errors, "API_RATE_LIMIT must be positive")
+	}
+
+	if c.APIBurst < 1 {
+		errors = append(errors, "API_BURST must be at least 1")
+	}
+
+	if c.WebhookRateLimit <= 0 {
+		errors = append(errors, "WEBHOOK_RATE_LIMIT must be positive")
+	}
+
+	if c.WebhookBurst < 1 {
+		errors = append(errors, "WEBHOOK_BURST must be at least 1")
+	}
+
+	if c.RateLimitIdleTTL <= 0 {
+		errors = append(errors, "RATE_LIMIT_IDLE_TTL must be positive")
+	}
+
+	for _, entry := range c.RateLimitBypass {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			errors = append(errors, fmt.Sprintf("RATE_LIMIT_BYPASS entry %q is not an IP or CIDR", entry))
+		}
+	}
+
+	for _, entry := range c.APIKeys {
+		if name, key, named := strings.Cut(entry, ":"); named && (strings.TrimSpace(name) == "" || strings.TrimSpace(key) == "") {
+			errors = append(errors, "API_KEYS entries must be name:key or a key")
+			break
+		}
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			if c.CORSAllowCredentials {
+				errors = append(errors, "CORS_ALLOWED_ORIGINS cannot be * when CORS_ALLOW_CREDENTIALS is set")
+			}
+			continue
+		}
+		if parsed, err := url.Parse(origin); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.TrimSuffix(parsed.Path, "/") != "" {
+			errors = append(errors, fmt.Sprintf("CORS_ALLOWED_ORIGINS entry %q must be * or a scheme and host like https://search.example.com", origin))
+		}
+	}
+
+	if c.CORSMaxAge < 0 {
+		errors = append(errors, "CORS_MAX_AGE cannot be negative")
+	}
+
+	if c.WebhookMaxConcurrent < 0 {
+		errors = append(errors, "WEBHOOK_MAX_CONCURRENT cannot be negative")
+	}
+
+	if c.WebhookMaxBodyBytes <= 0 {
+		errors = append(errors, "WEBHOOK_MAX_BODY_BYTES must be positive")
+	}
+
+	if c.WebhookRetryAfter < time.Second {
+		errors = append(errors, "WEBHOOK_RETRY_AFTER must be at least 1s")
+	}
+
+	if c.QuerySampleRate < 0 || c.QuerySampleRate > 1 {
+		errors = append(errors, "QUERY_SAMPLE_RATE must be between 0 and 1")
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("%s", errors[0])
 	}
@@ -102,6 +742,94 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvWeights parses "name=weight" pairs, returning nil if any pair is invalid
+func getEnvWeights(key, defaultValue string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(getEnvOrDefault(key, defaultValue), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !found || strings.TrimSpace(name) == "" || err != nil || weight <= 0 {
+			return nil
+		}
+		weights[strings.TrimSpace(name)] = weight
+	}
+	return weights
+}
+
+// getEnvTokenPrices parses "model=prompt:completion" prices over the default
+// prices, returning nil if any entry is invalid. The completion price may be
+// left out for embedding models.
+func getEnvTokenPrices(key string) map[string]metrics.TokenPrice {
+	prices := make(map[string]metrics.TokenPrice, len(metrics.DefaultTokenPrices))
+	for model, price := range metrics.DefaultTokenPrices {
+		prices[model] = price
+	}
+
+	for _, entry := range getEnvList(key) {
+		model, value, found := strings.Cut(entry, "=")
+		prompt, completion, hasCompletion := strings.Cut(value, ":")
+		if !hasCompletion {
+			completion = "0"
+		}
+		promptPrice, err := strconv.ParseFloat(strings.TrimSpace(prompt), 64)
+		if err != nil {
+			return nil
+		}
+		completionPrice, err := strconv.ParseFloat(strings.TrimSpace(completion), 64)
+		if !found || strings.TrimSpace(model) == "" || err != nil || promptPrice < 0 || completionPrice < 0 {
+			return nil
+		}
+		prices[strings.TrimSpace(model)] = metrics.TokenPrice{Prompt: promptPrice, Completion: completionPrice}
+	}
+	return prices
+}
+
+// getEnvListOrDefault is getEnvList with defaultValue when the variable is unset or empty
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	if values := getEnvList(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// exportPageSize is the number of documents read from storage per export page
+	exportPageSize = 500
+
+	// maxImportLineSize bounds a single JSONL line, which may carry an embedding
+	maxImportLineSize = 10 * 1024 * 1024
+
+	// maxImportErrors bounds how many line errors are reported back
+	maxImportErrors = 100
+)
+
+// DocumentArchive pages through and bulk-loads stored documents
+type DocumentArchive interface {
+	ListDocuments(ctx context.Context, filter storage.DocumentFilter, afterID string, limit int, includeEmbeddings bool) ([]*storage.Document, error)
+	ImportDocument(ctx context.Context, doc *storage.Document) (bool, error)
+}
+
+// AnswerCacheFlusher clears cached query answers
+type AnswerCacheFlusher interface {
+	Flush() int
+}
+
+// WebhookVerifier checks a webhook signature over the request body, as the
+// provider's webhook endpoint would; timestamp is the signed request
+// timestamp for providers that sign one
+type WebhookVerifier func(signature, timestamp string, body []byte) error
+
+// AdminHandler serves administrative endpoints
+type AdminHandler struct {
+	allowlist *slack.ChannelAllowlist
+	documents DocumentArchive
+
+	// Cleared by the flush endpoint; nil when answer caching is disabled
+	answerCache AnswerCacheFlusher
+
+	// Signature checks by webhook provider, for the verify endpoint
+	webhookVerifiers map[string]WebhookVerifier
+}
+
+type ChannelRequest struct {
+	ChannelID string `json:"channel_id"`
+}
+
+type ChannelAllowlistResponse struct {
+	Restricted bool     `json:"restricted"`
+	Channels   []string `json:"channels"`
+	Blocked    []string `json:"blocked"`
+}
+
+type ImportResponse struct {
+	Created            int           `json:"created"`
+	Updated            int           `json:"updated"`
+	Failed             int           `json:"failed"`
+	QueuedForEmbedding int           `json:"queued_for_embedding"`
+	Errors             []ImportError `json:"errors,omitempty"`
+}
+
+type FlushCacheResponse struct {
+	Flushed int `json:"flushed"`
+}
+
+type WebhookVerifyRequest struct {
+	Provider  string `json:"provider"`
+	Body      string `json:"body"`
+	Signature string `json:"signature"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type WebhookVerifyResponse struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+func NewAdminHandler(allowlist *slack.ChannelAllowlist, documents DocumentArchive) *AdminHandler {
+	return &AdminHandler{
+		allowlist: allowlist,
+		documents: documents,
+	}
+}
+
+// SetAnswerCache sets the answer cache cleared by the flush endpoint
+func (h *AdminHandler) SetAnswerCache(cache AnswerCacheFlusher) {
+	h.answerCache = cache
+}
+
+// SetWebhookVerifier registers the signature check for a webhook provider
+func (h *AdminHandler) SetWebhookVerifier(provider string, verifier WebhookVerifier) {
+	if h.webhookVerifiers == nil {
+		h.webhookVerifiers = make(map[string]WebhookVerifier)
+	}
+	h.webhookVerifiers[provider] = verifier
+}
+
+// HandleListChannels returns the effective channel allowlist
+func (h *AdminHandler) HandleListChannels(w http.ResponseWriter, r *http.Request) {
+	h.writeAllowlist(w)
+}
+
+// HandleAddChannel allows a channel for collection
+func (h *AdminHandler) HandleAddChannel(w http.ResponseWriter, r *http.Request) {
+	var req ChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.Error("Error decoding channel request", "error", err)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
+		return
+	}
+
+	if req.ChannelID == "" {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "channel_id cannot be empty")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.allowlist.Add(ctx, req.ChannelID); err != nil {
+		slog.Error("Failed to add channel to allowlist", "error", err, "channel_id", req.ChannelID)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+
+	h.writeAllowlist(w)
+}
+
+// HandleRemoveChannel blocks a channel from collection
+func (h *AdminHandler) HandleRemoveChannel(w http.ResponseWriter, r *http.Request) {
+	channelID := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.allowlist.Remove(ctx, channelID); err != nil {
+		slog.Error("Failed to remove channel from allowlist", "error", err, "channel_id", channelID)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+
+	h.writeAllowlist(w)
+}
+
+func (h *AdminHandler) writeAllowlist(w http.ResponseWriter) {
+	response := ChannelAllowlistResponse{
+		Restricted: h.allowlist.Restricted(),
+		Channels:   h.allowlist.Channels(),
+		Blocked:    h.allowlist.Blocked(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding allowlist response", "error", err)
+	}
+}
+
+// HandleFlushCache drops every cached answer, so queries reflect newly
+// ingested content immediately instead of once cached answers expire
+func (h *AdminHandler) HandleFlushCache(w http.ResponseWriter, r *http.Request) {
+	response := FlushCacheResponse{}
+	if h.answerCache != nil {
+		response.Flushed = h.answerCache.Flush()
+	}
+	slog.Info("Flushed answer cache", "flushed", response.Flushed)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding flush response", "error", err)
+	}
+}
+
+// HandleVerifyWebhook reports whether a webhook body and signature would pass
+// the provider's verification with the configured secret, without processing
+// the payload, for debugging webhook setup
+func (h *AdminHandler) HandleVerifyWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.Error("Error decoding webhook verify request", "error", err)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
+		return
+	}
+
+	verifier, ok := h.webhookVerifiers[req.Provider]
+	if !ok {
+		providers := make([]string, 0, len(h.webhookVerifiers))
+		for provider := range h.webhookVerifiers {
+			providers = append(providers, provider)
+		}
+		sort.Strings(providers)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("Unsupported provider, expected one of: %s", strings.Join(providers, ", ")))
+		return
+	}
+
+	if req.Signature == "" {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "signature cannot be empty")
+		return
+	}
+
+	response := WebhookVerifyResponse{Valid: true}
+	if err := verifier(req.Signature, req.Timestamp, []byte(req.Body)); err != nil {
+		response = WebhookVerifyResponse{Error: err.Error()}
+	}
+	slog.Info("Verified webhook signature", "provider", req.Provider, "valid", response.Valid)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding webhook verify response", "error", err)
+	}
+}
+
+// HandleExport streams every document matching the filters as JSONL.
+// Query parameters: source, after, before (RFC3339 or YYYY-MM-DD) and
+// include_embeddings=true.
+func (h *AdminHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDocumentFilter(r)
+	if err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	includeEmbeddings := r.URL.Query().Get("include_embeddings") == "true"
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="knowthis-export-%s.jsonl"`, time.Now().UTC().Format("20060102-150405")))
+
+	// Large exports outlive the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Export is bound by the server's write timeout", "error", err)
+	}
+
+	encoder := json.NewEncoder(w)
+	exported := 0
+	afterID := ""
+
+	for {
+		documents, err := h.documents.ListDocuments(r.Context(), filter, afterID, exportPageSize, includeEmbeddings)
+		if err != nil {
+			slog.Error("Failed to list documents for export", "error", err, "exported", exported)
+			if exported == 0 {
+				apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+			}
+			return
+		}
+
+		for _, doc := range documents {
+			if err := encoder.Encode(doc); err != nil {
+				slog.Error("Failed to write export line", "error", err, "document_id", doc.ID)
+				return
+			}
+			exported++
+		}
+
+		if err := controller.Flush(); err != nil {
+			slog.Error("Failed to flush export", "error", err, "exported", exported)
+			return
+		}
+
+		if len(documents) < exportPageSize {
+			break
+		}
+		afterID = documents[len(documents)-1].ID
+	}
+
+	slog.Info("Knowledge base export completed", "documents", exported, "source", filter.Source)
+}
+
+// HandleImport upserts documents from a streamed JSONL body, one document per
+// line as produced by HandleExport. Invalid lines are counted and reported
+// without aborting the import.
+func (h *AdminHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	// Large imports outlive the server's read and write timeouts
+	controller := http.NewResponseController(w)
+	if err := controller.SetReadDeadline(time.Time{}); err != nil {
+		slog.Warn("Import is bound by the server's read timeout", "error", err)
+	}
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Import is bound by the server's write timeout", "error", err)
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+
+	var response ImportResponse
+	fail := func(line int, err error) {
+		response.Failed++
+		if len(response.Errors) < maxImportErrors {
+			response.Errors = append(response.Errors, ImportError{Line: line, Error: err.Error()})
+		}
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var doc storage.Document
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			fail(line, fmt.Errorf("malformed JSON: %w", err))
+			continue
+		}
+		if err := prepareImportDocument(&doc); err != nil {
+			fail(line, err)
+			continue
+		}
+
+		created, err := h.documents.ImportDocument(r.Context(), &doc)
+		if err != nil {
+			slog.Error("Failed to import document", "error", err, "document_id", doc.ID, "line", line)
+			fail(line, fmt.Errorf("failed to store document %s", doc.ID))
+			continue
+		}
+
+		if created {
+			response.Created++
+		} else {
+			response.Updated++
+		}
+		if len(doc.Embedding) == 0 {
+			response.QueuedForEmbedding++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		// The remainder of the body is unreadable (e.g. an oversized line); report what was imported
+		slog.Error("Failed to read import body", "error", err, "line", line+1)
+		fail(line+1, fmt.Errorf("failed to read input: %w", err))
+	}
+
+	slog.Info("Knowledge base import completed",
+		"created", response.Created,
+		"updated", response.Updated,
+		"failed", response.Failed,
+		"queued_for_embedding", response.QueuedForEmbedding)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding import response", "error", err)
+	}
+}
+
+// prepareImportDocument validates an imported document and fills derived fields
+func prepareImportDocument(doc *storage.Document) error {
+	switch {
+	case doc.ID == "":
+		return fmt.Errorf("id is required")
+	case strings.TrimSpace(doc.Content) == "":
+		return fmt.Errorf("content is required")
+	case doc.Source == "":
+		return fmt.Errorf("source is required")
+	case doc.SourceID == "":
+		return fmt.Errorf("source_id is required")
+	}
+
+	if len(doc.Embedding) > 0 && len(doc.Embedding) != storage.EmbeddingDimensions {
+		return fmt.Errorf("embedding has %d dimensions, expected %d", len(doc.Embedding), storage.EmbeddingDimensions)
+	}
+
+	// Never trust an imported hash; deduplication depends on it matching the content
+	doc.ContentHash = storage.HashContent(doc.Content)
+	if doc.Timestamp.IsZero() {
+		doc.Timestamp = time.Now()
+	}
+
+	return nil
+}
+
+// parseDocumentFilter reads the source, after and before query parameters
+func parseDocumentFilter(r *http.Request) (storage.DocumentFilter, error) {
+	query := r.URL.Query()
+	filter := storage.DocumentFilter{Source: query.Get("source")}
+
+	var err error
+	if filter.After, err = parseTimeParam(query.Get("after")); err != nil {
+		return filter, fmt.Errorf("invalid after: %w", err)
+	}
+	if filter.Before, err = parseTimeParam(query.Get("before")); err != nil {
+		return filter, fmt.Errorf("invalid before: %w", err)
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam parses an RFC3339 timestamp or a YYYY-MM-DD date; empty is the zero time
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
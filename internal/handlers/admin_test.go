@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/middleware"
+	"knowthis/internal/services"
+	"knowthis/internal/storage"
+)
+
+// Mock document archive that pages by ID like PostgresStore.ListDocuments
+type mockDocumentArchive struct {
+	documents   []*storage.Document
+	calls       int
+	lastFilter  storage.DocumentFilter
+	lastInclude bool
+	imported    map[string]*storage.Document
+	delay       time.Duration // per page, to outlast server timeouts
+}
+
+func (m *mockDocumentArchive) ListDocuments(ctx context.Context, filter storage.DocumentFilter, afterID string, limit int, includeEmbeddings bool) ([]*storage.Document, error) {
+	m.calls++
+	m.lastFilter = filter
+	m.lastInclude = includeEmbeddings
+	time.Sleep(m.delay)
+
+	var page []*storage.Document
+	for _, doc := range m.documents {
+		if doc.ID > afterID && len(page) < limit {
+			page = append(page, doc)
+		}
+	}
+	return page, nil
+}
+
+func (m *mockDocumentArchive) ImportDocument(ctx context.Context, doc *storage.Document) (bool, error) {
+	if m.imported == nil {
+		m.imported = make(map[string]*storage.Document)
+	}
+	_, exists := m.imported[doc.ID]
+	m.imported[doc.ID] = doc
+	return !exists, nil
+}
+
+func TestAdminHandler_ExportStreamsJSONL(t *testing.T) {
+	lister := &mockDocumentArchive{}
+	for i := 0; i < exportPageSize+3; i++ {
+		lister.documents = append(lister.documents, &storage.Document{
+			ID:      fmt.Sprintf("doc_%04d", i),
+			Content: fmt.Sprintf("Document %d content", i),
+			Source:  "slab",
+		})
+	}
+	handler := NewAdminHandler(nil, lister)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/export?source=slab&after=2024-01-01", nil)
+	rec := httptest.NewRecorder()
+	handler.HandleExport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected JSONL content type, got %s", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("Expected attachment disposition, got %s", cd)
+	}
+
+	scanner := bufio.NewScanner(rec.Body)
+	lines := 0
+	for scanner.Scan() {
+		var doc storage.Document
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v", lines+1, err)
+		}
+		if doc.ID != lister.documents[lines].ID {
+			t.Errorf("Line %d: expected %s, got %s", lines+1, lister.documents[lines].ID, doc.ID)
+		}
+		lines++
+	}
+
+	if lines != len(lister.documents) {
+		t.Errorf("Expected %d exported documents, got %d", len(lister.documents), lines)
+	}
+	if lister.calls != 2 {
+		t.Errorf("Expected export to read 2 pages, got %d", lister.calls)
+	}
+	if lister.lastFilter.Source != "slab" || !lister.lastFilter.After.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected filters to be passed to storage, got %+v", lister.lastFilter)
+	}
+	if lister.lastInclude {
+		t.Errorf("Expected embeddings to be excluded by default")
+	}
+}
+
+// serveWithMiddleware serves handler through the server's middleware chain,
+// with read and write timeouts short enough for a slow test request to outlast
+func serveWithMiddleware(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(middleware.TracingMiddleware(middleware.LoggingMiddleware(middleware.MetricsMiddleware(handler))))
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAdminHandler_ExportOutlastsWriteTimeout(t *testing.T) {
+	lister := &mockDocumentArchive{delay: 150 * time.Millisecond}
+	for i := 0; i < exportPageSize+3; i++ {
+		lister.documents = append(lister.documents, &storage.Document{
+			ID:      fmt.Sprintf("doc_%04d", i),
+			Content: fmt.Sprintf("Document %d content", i),
+			Source:  "slab",
+		})
+	}
+	handler := NewAdminHandler(nil, lister)
+	server := serveWithMiddleware(t, handler.HandleExport)
+
+	resp, err := http.Get(server.URL + "/admin/export")
+	if err != nil {
+		t.Fatalf("Export request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Export was cut off after %d lines: %v", lines, err)
+	}
+	if lines != len(lister.documents) {
+		t.Errorf("Expected %d exported documents, got %d", len(lister.documents), lines)
+	}
+}
+
+func TestAdminHandler_ExportInvalidDate(t *testing.T) {
+	handler := NewAdminHandler(nil, &mockDocumentArchive{})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/export?before=yesterday", nil)
+	rec := httptest.NewRecorder()
+	handler.HandleExport(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid date, got %d", rec.Code)
+	}
+}
+
+func TestAdminHandler_Import(t *testing.T) {
+	embedding := make([]float32, storage.EmbeddingDimensions)
+	embedding[0] = 0.5
+	withEmbedding, _ := json.Marshal(storage.Document{
+		ID:        "doc_1",
+		Content:   "How to deploy: run make deploy",
+		Source:    "slab",
+		SourceID:  "post_1",
+		Timestamp: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Embedding: embedding,
+	})
+	withoutEmbedding, _ := json.Marshal(storage.Document{
+		ID:       "doc_2",
+		Content:  "Restart the ingress controller",
+		Source:   "slack",
+		SourceID: "1700000000.000100",
+	})
+	updated, _ := json.Marshal(storage.Document{
+		ID:       "doc_2",
+		Content:  "Restart the ingress controller, then check the logs",
+		Source:   "slack",
+		SourceID: "1700000000.000100",
+	})
+	shortEmbedding, _ := json.Marshal(storage.Document{
+		ID:        "doc_3",
+		Content:   "Wrong dimensions",
+		Source:    "slab",
+		SourceID:  "post_3",
+		Embedding: []float32{0.1, 0.2},
+	})
+
+	body := strings.Join([]string{
+		string(withEmbedding),
+		string(withoutEmbedding),
+		`{"id": "doc_bad", "content": `,
+		"",
+		string(updated),
+		`{"id": "doc_4", "source": "slab", "source_id": "post_4"}`,
+		string(shortEmbedding),
+	}, "\n")
+
+	archive := &mockDocumentArchive{}
+	handler := NewAdminHandler(nil, archive)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.HandleImport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response ImportResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Created != 2 || response.Updated != 1 || response.Failed != 3 {
+		t.Errorf("Expected 2 created, 1 updated, 3 failed, got %+v", response)
+	}
+	if response.QueuedForEmbedding != 2 {
+		t.Errorf("Expected 2 documents queued for embedding, got %d", response.QueuedForEmbedding)
+	}
+
+	failedLines := []int{}
+	for _, e := range response.Errors {
+		failedLines = append(failedLines, e.Line)
+	}
+	if fmt.Sprint(failedLines) != "[3 6 7]" {
+		t.Errorf("Expected failures on lines 3, 6 and 7, got %v", failedLines)
+	}
+
+	doc1 := archive.imported["doc_1"]
+	if doc1 == nil || len(doc1.Embedding) != storage.EmbeddingDimensions || doc1.Embedding[0] != 0.5 {
+		t.Errorf("Expected doc_1 to keep its embedding")
+	}
+	if doc1 != nil && doc1.ContentHash != storage.HashContent(doc1.Content) {
+		t.Errorf("Expected content hash to be derived from content")
+	}
+
+	doc2 := archive.imported["doc_2"]
+	if doc2 == nil || len(doc2.Embedding) != 0 {
+		t.Errorf("Expected doc_2 to be stored without an embedding")
+	}
+	if doc2 != nil && doc2.Timestamp.IsZero() {
+		t.Errorf("Expected missing timestamp to be filled")
+	}
+}
+
+func TestAdminHandler_FlushCache(t *testing.T) {
+	cache := services.NewAnswerCache(time.Hour, 100)
+	cache.Put("key", &services.QueryResult{Answer: "Rotate the deploy key"})
+
+	handler := NewAdminHandler(nil, &mockDocumentArchive{})
+	handler.SetAnswerCache(cache)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/flush", nil)
+	rec := httptest.NewRecorder()
+	handler.HandleFlushCache(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response FlushCacheResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Flushed != 1 {
+		t.Errorf("Expected 1 flushed entry, got %d", response.Flushed)
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("Expected cached answer to be cleared")
+	}
+}
+
+func TestAdminHandler_VerifyWebhook(t *testing.T) {
+	const secret = "slack-secret"
+	body := `{"type": "event_callback"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	slackSignature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	handler := NewAdminHandler(nil, &mockDocumentArchive{})
+	handler.SetWebhookVerifier("slack", func(signature, timestamp string, body []byte) error {
+		return middleware.VerifySlackRequest(secret, signature, timestamp, body)
+	})
+	handler.SetWebhookVerifier("github", func(signature, timestamp string, body []byte) error {
+		if signature != "sha256=expected" {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	})
+
+	testCases := []struct {
+		name           string
+		request        WebhookVerifyRequest
+		expectedStatus int
+		expectedValid  bool
+		expectedError  string
+	}{
+		{
+			name:           "valid slack signature",
+			request:        WebhookVerifyRequest{Provider: "slack", Body: body, Signature: slackSignature, Timestamp: timestamp},
+			expectedStatus: http.StatusOK,
+			expectedValid:  true,
+		},
+		{
+			name:           "slack signature over another body",
+			request:        WebhookVerifyRequest{Provider: "slack", Body: `{"type": "url_verification"}`, Signature: slackSignature, Timestamp: timestamp},
+			expectedStatus: http.StatusOK,
+			expectedError:  "signature mismatch",
+		},
+		{
+			name:           "slack signature without timestamp",
+			request:        WebhookVerifyRequest{Provider: "slack", Body: body, Signature: slackSignature},
+			expectedStatus: http.StatusOK,
+			expectedError:  `invalid request timestamp ""`,
+		},
+		{
+			name:           "valid signature for another provider",
+			request:        WebhookVerifyRequest{Provider: "github", Body: body, Signature: "sha256=expected"},
+			expectedStatus: http.StatusOK,
+			expectedValid:  true,
+		},
+		{
+			name:           "slack signature checked as another provider",
+			request:        WebhookVerifyRequest{Provider: "github", Body: body, Signature: slackSignature, Timestamp: timestamp},
+			expectedStatus: http.StatusOK,
+			expectedError:  "signature mismatch",
+		},
+		{
+			name:           "unsupported provider",
+			request:        WebhookVerifyRequest{Provider: "notion", Body: body, Signature: "sig"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing signature",
+			request:        WebhookVerifyRequest{Provider: "slack", Body: body, Timestamp: timestamp},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, _ := json.Marshal(tc.request)
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhook/verify", strings.NewReader(string(payload)))
+			rec := httptest.NewRecorder()
+			handler.HandleVerifyWebhook(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response WebhookVerifyResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Valid != tc.expectedValid || response.Error != tc.expectedError {
+				t.Errorf("Expected valid=%t error=%q, got %+v", tc.expectedValid, tc.expectedError, response)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_ImportOutlastsReadTimeout(t *testing.T) {
+	archive := &mockDocumentArchive{}
+	handler := NewAdminHandler(nil, archive)
+	server := serveWithMiddleware(t, handler.HandleImport)
+
+	// Stream the body slower than the server's read and write timeouts
+	body, writer := io.Pipe()
+	go func() {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(writer, `{"id": "doc_%d", "content": "Document %d", "source": "slab", "source_id": "post_%d"}`+"\n", i, i, i)
+			time.Sleep(100 * time.Millisecond)
+		}
+		writer.Close()
+	}()
+
+	resp, err := http.Post(server.URL+"/admin/import", "application/x-ndjson", body)
+	if err != nil {
+		t.Fatalf("Import request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var response ImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Created != 3 || response.Failed != 0 {
+		t.Errorf("Expected all 3 documents imported, got %+v", response)
+	}
+}
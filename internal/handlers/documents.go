@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// DocumentGetter is the part of the document store used to fetch documents
+type DocumentGetter interface {
+	GetDocument(ctx context.Context, id string) (*storage.Document, error)
+}
+
+type DocumentHandler struct {
+	documents DocumentGetter
+}
+
+func NewDocumentHandler(documents DocumentGetter) *DocumentHandler {
+	return &DocumentHandler{documents: documents}
+}
+
+// HandleGetDocument returns the full stored document, without its embedding
+func (h *DocumentHandler) HandleGetDocument(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	doc, err := h.documents.GetDocument(ctx, id)
+	if errors.Is(err, storage.ErrDocumentNotFound) {
+		apierror.Respond(w, http.StatusNotFound, apierror.CodeNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get document", "error", err, "document_id", id)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+
+	// Never expose the raw vector
+	doc.Embedding = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		slog.Error("Failed to encode document", "error", err, "document_id", id)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"knowthis/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// Mock document getter backed by a map
+type mockDocumentGetter struct {
+	documents map[string]*storage.Document
+}
+
+func (m *mockDocumentGetter) GetDocument(ctx context.Context, id string) (*storage.Document, error) {
+	doc, ok := m.documents[id]
+	if !ok {
+		return nil, storage.ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+func TestDocumentHandler_GetDocument(t *testing.T) {
+	fullContent := strings.Repeat("Step-by-step rollback procedure for the payments service. ", 50)
+	getter := &mockDocumentGetter{documents: map[string]*storage.Document{
+		"doc_1": {
+			ID:        "doc_1",
+			Content:   fullContent,
+			Source:    "slab",
+			SourceID:  "post_1",
+			Title:     "Payments rollback runbook",
+			Embedding: []float32{0.1, 0.2, 0.3},
+		},
+	}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/documents/{id}", NewDocumentHandler(getter).HandleGetDocument).Methods("GET")
+
+	testCases := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{name: "found", id: "doc_1", expectedStatus: http.StatusOK},
+		{name: "not found", id: "doc_missing", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/documents/"+tc.id, nil))
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body["content"] != fullContent {
+				t.Errorf("Expected the full document content")
+			}
+			if body["title"] != "Payments rollback runbook" {
+				t.Errorf("Expected document title, got %v", body["title"])
+			}
+			if _, ok := body["embedding"]; ok {
+				t.Errorf("Expected the embedding to be omitted")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/metrics"
+	"knowthis/internal/storage"
+)
+
+const (
+	// maxFeedbackComment bounds the free-text comment on a rating
+	maxFeedbackComment = 2000
+
+	// maxFeedbackSources bounds the source IDs recorded with a rating
+	maxFeedbackSources = 50
+)
+
+// FeedbackStore records answer ratings and counts them
+type FeedbackStore interface {
+	StoreFeedback(ctx context.Context, feedback *storage.QueryFeedback) error
+	GetFeedbackStats(ctx context.Context) (*storage.FeedbackStats, error)
+}
+
+// FeedbackRequest rates an answer returned by /api/query. The answer itself
+// isn't stored, only its hash.
+type FeedbackRequest struct {
+	Query     string   `json:"query"`
+	Answer    string   `json:"answer"`
+	SourceIDs []string `json:"source_ids,omitempty"`
+	Rating    *int     `json:"rating"`
+	Comment   string   `json:"comment,omitempty"`
+}
+
+type FeedbackHandler struct {
+	store FeedbackStore
+}
+
+func NewFeedbackHandler(store FeedbackStore) *FeedbackHandler {
+	return &FeedbackHandler{store: store}
+}
+
+// HandleFeedback stores a thumbs up (+1), neutral (0) or thumbs down (-1)
+// rating of an answer
+func (h *FeedbackHandler) HandleFeedback(w http.ResponseWriter, r *http.Request) {
+	var req FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
+		return
+	}
+
+	req.Query = strings.TrimSpace(req.Query)
+	switch {
+	case req.Query == "":
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "query cannot be empty")
+		return
+	case req.Rating == nil || *req.Rating < -1 || *req.Rating > 1:
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "rating must be -1, 0 or 1")
+		return
+	case utf8.RuneCountInString(req.Comment) > maxFeedbackComment:
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "comment is too long")
+		return
+	case len(req.SourceIDs) > maxFeedbackSources:
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "too many source_ids")
+		return
+	}
+
+	feedback := &storage.QueryFeedback{
+		Query:      req.Query,
+		AnswerHash: storage.HashContent(req.Answer),
+		SourceIDs:  req.SourceIDs,
+		Rating:     *req.Rating,
+		Comment:    strings.TrimSpace(req.Comment),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.store.StoreFeedback(ctx, feedback); err != nil {
+		slog.Error("Failed to store query feedback", "error", err)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+	metrics.QueryFeedback.WithLabelValues(ratingLabel(feedback.Rating)).Inc()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFeedbackStats returns how many answers were rated up, neutral and down
+func (h *FeedbackHandler) HandleFeedbackStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	stats, err := h.store.GetFeedbackStats(ctx)
+	if err != nil {
+		slog.Error("Failed to get feedback stats", "error", err)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		slog.Error("Failed to encode feedback stats", "error", err)
+	}
+}
+
+// ratingLabel names a rating for the feedback metric
+func ratingLabel(rating int) string {
+	switch rating {
+	case 1:
+		return "positive"
+	case -1:
+		return "negative"
+	default:
+		return "neutral"
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"knowthis/internal/storage"
+)
+
+type mockFeedbackStore struct {
+	stored []*storage.QueryFeedback
+}
+
+func (m *mockFeedbackStore) StoreFeedback(ctx context.Context, feedback *storage.QueryFeedback) error {
+	m.stored = append(m.stored, feedback)
+	return nil
+}
+
+func (m *mockFeedbackStore) GetFeedbackStats(ctx context.Context) (*storage.FeedbackStats, error) {
+	stats := &storage.FeedbackStats{}
+	for _, feedback := range m.stored {
+		switch feedback.Rating {
+		case 1:
+			stats.Positive++
+		case -1:
+			stats.Negative++
+		default:
+			stats.Neutral++
+		}
+	}
+	return stats, nil
+}
+
+func TestFeedbackHandler_HandleFeedback(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "thumbs up",
+			body:           `{"query": "how do I roll back?", "answer": "Run make rollback", "source_ids": ["m1", "m2"], "rating": 1}`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "thumbs down with comment",
+			body:           `{"query": "how do I roll back?", "answer": "Run make rollback", "rating": -1, "comment": "outdated"}`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "neutral",
+			body:           `{"query": "how do I roll back?", "answer": "Run make rollback", "rating": 0}`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "missing rating",
+			body:           `{"query": "how do I roll back?", "answer": "Run make rollback"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "rating out of range",
+			body:           `{"query": "how do I roll back?", "answer": "Run make rollback", "rating": 5}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty query",
+			body:           `{"query": "  ", "rating": 1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "comment too long",
+			body:           `{"query": "how do I roll back?", "rating": -1, "comment": "` + strings.Repeat("x", maxFeedbackComment+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockFeedbackStore{}
+			handler := NewFeedbackHandler(store)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/query/feedback", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.HandleFeedback(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			expectedStored := 0
+			if tc.expectedStatus == http.StatusNoContent {
+				expectedStored = 1
+			}
+			if len(store.stored) != expectedStored {
+				t.Fatalf("Expected %d stored ratings, got %d", expectedStored, len(store.stored))
+			}
+			if expectedStored == 1 && store.stored[0].AnswerHash != storage.HashContent("Run make rollback") {
+				t.Errorf("Expected the answer's hash to be stored, got %q", store.stored[0].AnswerHash)
+			}
+		})
+	}
+}
+
+func TestFeedbackHandler_HandleFeedbackStats(t *testing.T) {
+	store := &mockFeedbackStore{stored: []*storage.QueryFeedback{{Rating: 1}, {Rating: 1}, {Rating: -1}}}
+	handler := NewFeedbackHandler(store)
+
+	rec := httptest.NewRecorder()
+	handler.HandleFeedbackStats(rec, httptest.NewRequest(http.MethodGet, "/api/query/feedback/stats", nil))
+
+	var stats storage.FeedbackStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Positive != 2 || stats.Neutral != 0 || stats.Negative != 1 {
+		t.Errorf("Expected 2 positive and 1 negative, got %+v", stats)
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/integrations/slack"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ChannelIngester collects the threads of a Slack channel
+type ChannelIngester interface {
+	IngestChannel(ctx context.Context, channelID string, oldest, latest time.Time, report func(slack.ChannelIngestProgress)) (slack.ChannelIngestProgress, error)
+}
+
+// maxIngestJobs is how many ingestion jobs are remembered for status checks
+const maxIngestJobs = 50
+
+// ChannelIngestRequest selects a channel and, optionally, the time range of
+// the threads to collect
+type ChannelIngestRequest struct {
+	ChannelID string `json:"channel_id"`
+	After     string `json:"after,omitempty"`
+	Before    string `json:"before,omitempty"`
+}
+
+// ChannelIngestJob is the status of a channel ingestion
+type ChannelIngestJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"` // running, completed or failed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	slack.ChannelIngestProgress
+}
+
+type ChannelIngestHandler struct {
+	ingester ChannelIngester
+
+	mu   sync.Mutex
+	jobs map[string]*ChannelIngestJob
+	// Job IDs in start order, for dropping the oldest
+	order []string
+}
+
+func NewChannelIngestHandler(ingester ChannelIngester) *ChannelIngestHandler {
+	return &ChannelIngestHandler{
+		ingester: ingester,
+		jobs:     make(map[string]*ChannelIngestJob),
+	}
+}
+
+// HandleIngestChannel starts collecting every thread in a channel in the
+// background, e.g. when onboarding a channel, and returns the job to poll
+// for progress. A channel is ingested by one job at a time.
+func (h *ChannelIngestHandler) HandleIngestChannel(w http.ResponseWriter, r *http.Request) {
+	var req ChannelIngestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
+		return
+	}
+	if req.ChannelID == "" {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "channel_id is required")
+		return
+	}
+
+	oldest, err := parseTimeParam(req.After)
+	if err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid after: use RFC3339 or YYYY-MM-DD")
+		return
+	}
+	latest, err := parseTimeParam(req.Before)
+	if err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid before: use RFC3339 or YYYY-MM-DD")
+		return
+	}
+	if !oldest.IsZero() && !latest.IsZero() && !oldest.Before(latest) {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "after must be before before")
+		return
+	}
+
+	job, ok := h.startJob(req.ChannelID)
+	if !ok {
+		apierror.Respond(w, http.StatusConflict, apierror.CodeConflict, "Channel is already being ingested")
+		return
+	}
+	slog.Info("Started channel ingestion", "job_id", job.ID, "channel", req.ChannelID, "after", req.After, "before", req.Before)
+
+	go h.run(job.ID, req.ChannelID, oldest, latest)
+
+	writeIngestJob(w, http.StatusAccepted, job)
+}
+
+// HandleIngestStatus returns the progress of an ingestion job
+func (h *ChannelIngestHandler) HandleIngestStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.job(mux.Vars(r)["id"])
+	if !ok {
+		apierror.Respond(w, http.StatusNotFound, apierror.CodeNotFound, "Ingestion job not found")
+		return
+	}
+	writeIngestJob(w, http.StatusOK, job)
+}
+
+// startJob registers a running job for the channel unless one is running
+func (h *ChannelIngestHandler) startJob(channelID string) (ChannelIngestJob, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, job := range h.jobs {
+		if job.ChannelID == channelID && job.Status == "running" {
+			return ChannelIngestJob{}, false
+		}
+	}
+
+	job := &ChannelIngestJob{
+		ID:                    uuid.New().String(),
+		Status:                "running",
+		StartedAt:             time.Now(),
+		ChannelIngestProgress: slack.ChannelIngestProgress{ChannelID: channelID},
+	}
+	h.jobs[job.ID] = job
+	h.order = append(h.order, job.ID)
+
+	// Forget the oldest finished jobs
+	for i := 0; len(h.jobs) > maxIngestJobs && i < len(h.order); {
+		if old := h.jobs[h.order[i]]; old.Status != "running" {
+			delete(h.jobs, h.order[i])
+			h.order = append(h.order[:i], h.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+
+	return *job, true
+}
+
+// run ingests the channel, recording progress on the job as it goes
+func (h *ChannelIngestHandler) run(jobID, channelID string, oldest, latest time.Time) {
+	progress, err := h.ingester.IngestChannel(context.Background(), channelID, oldest, latest, func(progress slack.ChannelIngestProgress) {
+		h.update(jobID, func(job *ChannelIngestJob) { job.ChannelIngestProgress = progress })
+	})
+
+	h.update(jobID, func(job *ChannelIngestJob) {
+		finished := time.Now()
+		job.FinishedAt = &finished
+		job.ChannelIngestProgress = progress
+		job.Status = "completed"
+		if err != nil {
+			job.Status = "failed"
+			job.Error = err.Error()
+		}
+	})
+
+	if err != nil && !errors.Is(err, slack.ErrChannelNotAllowed) {
+		slog.Error("Channel ingestion failed", "error", err, "job_id", jobID, "channel", channelID)
+	}
+}
+
+func (h *ChannelIngestHandler) update(jobID string, apply func(job *ChannelIngestJob)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if job, ok := h.jobs[jobID]; ok {
+		apply(job)
+	}
+}
+
+func (h *ChannelIngestHandler) job(jobID string) (ChannelIngestJob, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job, ok := h.jobs[jobID]
+	if !ok {
+		return ChannelIngestJob{}, false
+	}
+	return *job, true
+}
+
+func writeIngestJob(w http.ResponseWriter, status int, job ChannelIngestJob) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		slog.Error("Failed to encode ingestion job", "error", err)
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/integrations/slack"
+
+	"github.com/gorilla/mux"
+)
+
+// mockChannelIngester reports one thread of progress, then waits for release
+type mockChannelIngester struct {
+	release chan struct{}
+	err     error
+
+	channelID      string
+	oldest, latest time.Time
+}
+
+func (m *mockChannelIngester) IngestChannel(ctx context.Context, channelID string, oldest, latest time.Time, report func(slack.ChannelIngestProgress)) (slack.ChannelIngestProgress, error) {
+	m.channelID, m.oldest, m.latest = channelID, oldest, latest
+
+	progress := slack.ChannelIngestProgress{ChannelID: channelID, Pages: 1, Threads: 1, Messages: 3, Stored: 3}
+	report(progress)
+	<-m.release
+
+	progress.Threads, progress.Messages, progress.Stored = 2, 4, 4
+	return progress, m.err
+}
+
+func ingestStatus(t *testing.T, handler *ChannelIngestHandler, jobID string) (int, ChannelIngestJob) {
+	t.Helper()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/slack/ingest-channel/"+jobID, nil), map[string]string{"id": jobID})
+	rec := httptest.NewRecorder()
+	handler.HandleIngestStatus(rec, req)
+
+	var job ChannelIngestJob
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+	}
+	return rec.Code, job
+}
+
+// waitForIngestJob polls the job until check passes
+func waitForIngestJob(t *testing.T, handler *ChannelIngestHandler, jobID string, check func(ChannelIngestJob) bool) ChannelIngestJob {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, job := ingestStatus(t, handler, jobID)
+		if check(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for job, last status %+v", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestChannelIngestHandler_ReportsProgress(t *testing.T) {
+	ingester := &mockChannelIngester{release: make(chan struct{})}
+	handler := NewChannelIngestHandler(ingester)
+
+	body := `{"channel_id": "C1", "after": "2024-01-01", "before": "2024-06-01T00:00:00Z"}`
+	rec := httptest.NewRecorder()
+	handler.HandleIngestChannel(rec, httptest.NewRequest(http.MethodPost, "/slack/ingest-channel", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var started ChannelIngestJob
+	if err := json.NewDecoder(rec.Body).Decode(&started); err != nil {
+		t.Fatalf("Failed to decode job: %v", err)
+	}
+	if started.ID == "" || started.Status != "running" || started.ChannelID != "C1" {
+		t.Errorf("Unexpected job: %+v", started)
+	}
+
+	running := waitForIngestJob(t, handler, started.ID, func(job ChannelIngestJob) bool { return job.Threads == 1 })
+	if running.Status != "running" || running.Messages != 3 || running.FinishedAt != nil {
+		t.Errorf("Expected progress of the running job, got %+v", running)
+	}
+	if !ingester.oldest.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !ingester.latest.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected time range %v - %v", ingester.oldest, ingester.latest)
+	}
+
+	// The channel can't be ingested twice at once
+	rec = httptest.NewRecorder()
+	handler.HandleIngestChannel(rec, httptest.NewRequest(http.MethodPost, "/slack/ingest-channel", strings.NewReader(`{"channel_id": "C1"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a channel being ingested, got %d", rec.Code)
+	}
+
+	close(ingester.release)
+	done := waitForIngestJob(t, handler, started.ID, func(job ChannelIngestJob) bool { return job.Status != "running" })
+	if done.Status != "completed" || done.Threads != 2 || done.Stored != 4 || done.FinishedAt == nil || done.Error != "" {
+		t.Errorf("Expected a completed job, got %+v", done)
+	}
+
+	if code, _ := ingestStatus(t, handler, "missing"); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", code)
+	}
+}
+
+func TestChannelIngestHandler_Failure(t *testing.T) {
+	ingester := &mockChannelIngester{release: make(chan struct{}), err: errors.New("failed to get channel history: channel_not_found")}
+	close(ingester.release)
+	handler := NewChannelIngestHandler(ingester)
+
+	rec := httptest.NewRecorder()
+	handler.HandleIngestChannel(rec, httptest.NewRequest(http.MethodPost, "/slack/ingest-channel", strings.NewReader(`{"channel_id": "C404"}`)))
+	var started ChannelIngestJob
+	json.NewDecoder(rec.Body).Decode(&started)
+
+	failed := waitForIngestJob(t, handler, started.ID, func(job ChannelIngestJob) bool { return job.Status != "running" })
+	if failed.Status != "failed" || !strings.Contains(failed.Error, "channel_not_found") {
+		t.Errorf("Expected a failed job with its error, got %+v", failed)
+	}
+}
+
+func TestChannelIngestHandler_InvalidRequests(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", `{`},
+		{"missing channel", `{"after": "2024-01-01"}`},
+		{"invalid after", `{"channel_id": "C1", "after": "last week"}`},
+		{"invalid before", `{"channel_id": "C1", "before": "01/06/2024"}`},
+		{"empty range", `{"channel_id": "C1", "after": "2024-06-01", "before": "2024-01-01"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewChannelIngestHandler(&mockChannelIngester{})
+			rec := httptest.NewRecorder()
+			handler.HandleIngestChannel(rec, httptest.NewRequest(http.MethodPost, "/slack/ingest-channel", strings.NewReader(tc.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
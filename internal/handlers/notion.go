@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/integrations/notion"
+	"knowthis/internal/middleware"
+	"knowthis/internal/storage"
+)
+
+// notionSyncTimeout bounds fetching and storing a page after its event is acked
+const notionSyncTimeout = 60 * time.Second
+
+// NotionPageReader fetches Notion pages and their content
+type NotionPageReader interface {
+	GetPage(ctx context.Context, pageID string) (*notion.Page, error)
+	GetBlockChildren(ctx context.Context, blockID string) ([]notion.Block, error)
+}
+
+// NotionDocumentStore upserts and soft-deletes ingested pages
+type NotionDocumentStore interface {
+	ImportDocument(ctx context.Context, doc *storage.Document) (bool, error)
+	SoftDeleteDocument(ctx context.Context, id string) error
+}
+
+// NotionHandler ingests Notion pages as documents when webhook events report
+// them created or updated. Events only name the page, so it is fetched after
+// the event is acked.
+type NotionHandler struct {
+	pages     NotionPageReader
+	documents NotionDocumentStore
+}
+
+func NewNotionHandler(apiToken string, documents NotionDocumentStore) *NotionHandler {
+	return &NotionHandler{pages: notion.NewClient(apiToken), documents: documents}
+}
+
+// HandleWebhook handles Notion webhook events. Requests must already be
+// verified by NotionSignatureMiddleware.
+func (h *NotionHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	var event notion.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
+		return
+	}
+
+	status := "ignored"
+	switch {
+	case event.VerificationToken != "":
+		// Pasted into the subscription to verify it, then configured to
+		// verify the events it signs
+		slog.Warn("Received Notion webhook verification token; set NOTION_WEBHOOK_SECRET to it",
+			"verification_token", event.VerificationToken)
+		status = "verification_received"
+
+	case isNotionPageChange(event):
+		release := middleware.HoldConcurrencySlot(r.Context())
+		go func() {
+			defer release()
+			h.syncInBackground(event.Entity.ID)
+		}()
+		status = "accepted"
+
+	default:
+		slog.Debug("Ignoring Notion event", "type", event.Type, "entity_type", event.Entity.Type)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// isNotionPageChange reports whether the event creates or updates a page
+func isNotionPageChange(event notion.Event) bool {
+	if event.Entity.Type != "page" || event.Entity.ID == "" {
+		return false
+	}
+	switch event.Type {
+	case notion.EventPageCreated, notion.EventPageContentUpdated, notion.EventPagePropertiesUpdated:
+		return true
+	}
+	return false
+}
+
+func (h *NotionHandler) syncInBackground(pageID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), notionSyncTimeout)
+	defer cancel()
+
+	if err := h.SyncPage(ctx, pageID); err != nil {
+		slog.Error("Failed to ingest Notion page", "error", err, "page_id", pageID)
+	}
+}
+
+// SyncPage fetches a page and stores it as one document, replacing the
+// previous version. Archived and empty pages are removed instead.
+func (h *NotionHandler) SyncPage(ctx context.Context, pageID string) error {
+	page, err := h.pages.GetPage(ctx, pageID)
+	if err != nil {
+		return err
+	}
+
+	docID := notionDocumentID(pageID)
+	if page.Archived || page.InTrash {
+		return h.removePage(ctx, docID)
+	}
+
+	blocks, err := notion.FetchBlocks(ctx, h.pages, pageID)
+	if err != nil {
+		return err
+	}
+
+	doc := notionPageToDocument(page, blocks)
+	if doc == nil {
+		return h.removePage(ctx, docID)
+	}
+
+	if _, err := h.documents.ImportDocument(ctx, doc); err != nil {
+		return fmt.Errorf("failed to store page document: %w", err)
+	}
+
+	slog.Info("Stored Notion page", "page_id", pageID, "document_id", doc.ID)
+	return nil
+}
+
+func (h *NotionHandler) removePage(ctx context.Context, docID string) error {
+	err := h.documents.SoftDeleteDocument(ctx, docID)
+	if err != nil && !errors.Is(err, storage.ErrDocumentNotFound) {
+		return err
+	}
+	return nil
+}
+
+func notionDocumentID(pageID string) string {
+	return "notion_page_" + pageID
+}
+
+// notionPageToDocument converts a page into a document headed by its title,
+// or nil when the page has no text
+func notionPageToDocument(page *notion.Page, blocks []notion.Block) *storage.Document {
+	body := notion.FlattenBlocks(blocks)
+	if body == "" {
+		return nil
+	}
+
+	title := strings.TrimSpace(page.Title())
+	content := body
+	if title != "" {
+		content = title + "\n\n" + body
+	}
+
+	return &storage.Document{
+		ID:          notionDocumentID(page.ID),
+		Content:     content,
+		Source:      notion.Source,
+		SourceID:    page.ID,
+		Title:       title,
+		UserID:      page.LastEditedBy.ID,
+		Timestamp:   page.LastEditedTime,
+		ContentHash: storage.HashContent(content),
+	}
+}
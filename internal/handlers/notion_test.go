@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"knowthis/internal/integrations/notion"
+	"knowthis/internal/storage"
+)
+
+type mockNotionPages struct {
+	pages  map[string]*notion.Page
+	blocks map[string][]notion.Block
+}
+
+func (m *mockNotionPages) GetPage(ctx context.Context, pageID string) (*notion.Page, error) {
+	if page, ok := m.pages[pageID]; ok {
+		return page, nil
+	}
+	return nil, errors.New("object_not_found")
+}
+
+func (m *mockNotionPages) GetBlockChildren(ctx context.Context, blockID string) ([]notion.Block, error) {
+	return m.blocks[blockID], nil
+}
+
+type mockNotionDocuments struct {
+	mu      sync.Mutex
+	docs    map[string]*storage.Document
+	deleted []string
+}
+
+func (m *mockNotionDocuments) ImportDocument(ctx context.Context, doc *storage.Document) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.docs[doc.ID]
+	m.docs[doc.ID] = doc
+	return !exists, nil
+}
+
+func (m *mockNotionDocuments) SoftDeleteDocument(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleted = append(m.deleted, id)
+	if _, ok := m.docs[id]; !ok {
+		return storage.ErrDocumentNotFound
+	}
+	delete(m.docs, id)
+	return nil
+}
+
+func (m *mockNotionDocuments) get(id string) *storage.Document {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.docs[id]
+}
+
+func notionPage(id, title string) *notion.Page {
+	page := &notion.Page{ID: id, LastEditedTime: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)}
+	page.LastEditedBy.ID = "user-1"
+	page.Properties = map[string]struct {
+		Type  string            `json:"type"`
+		Title []notion.RichText `json:"title,omitempty"`
+	}{
+		"Name": {Type: "title", Title: []notion.RichText{{PlainText: title}}},
+	}
+	return page
+}
+
+func newTestNotionHandler() (*NotionHandler, *mockNotionPages, *mockNotionDocuments) {
+	pages := &mockNotionPages{
+		pages: map[string]*notion.Page{"page-1": notionPage("page-1", "Rotating credentials")},
+		blocks: map[string][]notion.Block{
+			"page-1": {{Type: "paragraph", Paragraph: &notion.TextBlock{RichText: []notion.RichText{{PlainText: "Rotate the **database** password quarterly."}}}}},
+		},
+	}
+	documents := &mockNotionDocuments{docs: make(map[string]*storage.Document)}
+	return &NotionHandler{pages: pages, documents: documents}, pages, documents
+}
+
+func TestNotionHandler_SyncPage(t *testing.T) {
+	handler, pages, documents := newTestNotionHandler()
+
+	if err := handler.SyncPage(context.Background(), "page-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc := documents.get("notion_page_page-1")
+	if doc == nil {
+		t.Fatal("Expected the page to be stored")
+	}
+	wantContent := "Rotating credentials\n\nRotate the database password quarterly."
+	if doc.Content != wantContent || doc.Title != "Rotating credentials" {
+		t.Errorf("Unexpected document %q titled %q", doc.Content, doc.Title)
+	}
+	if doc.Source != notion.Source || doc.SourceID != "page-1" || doc.UserID != "user-1" || doc.ContentHash != storage.HashContent(wantContent) {
+		t.Errorf("Unexpected document fields: %+v", doc)
+	}
+
+	// An archived page is removed
+	pages.pages["page-1"].Archived = true
+	if err := handler.SyncPage(context.Background(), "page-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if documents.get("notion_page_page-1") != nil {
+		t.Error("Expected the archived page to be removed")
+	}
+
+	// Removing a page that was never stored isn't an error
+	pages.pages["page-2"] = notionPage("page-2", "Empty page")
+	if err := handler.SyncPage(context.Background(), "page-2"); err != nil {
+		t.Errorf("Expected an empty page to be skipped, got %v", err)
+	}
+
+	if err := handler.SyncPage(context.Background(), "missing"); err == nil {
+		t.Error("Expected an error for a page that can't be fetched")
+	}
+}
+
+func TestNotionHandler_HandleWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantResult string
+		wantStored bool
+	}{
+		{
+			name:       "page created",
+			body:       `{"type": "page.created", "entity": {"id": "page-1", "type": "page"}}`,
+			wantStatus: http.StatusOK,
+			wantResult: "accepted",
+			wantStored: true,
+		},
+		{
+			name:       "page content updated",
+			body:       `{"type": "page.content_updated", "entity": {"id": "page-1", "type": "page"}}`,
+			wantStatus: http.StatusOK,
+			wantResult: "accepted",
+			wantStored: true,
+		},
+		{
+			name:       "page properties updated",
+			body:       `{"type": "page.properties_updated", "entity": {"id": "page-1", "type": "page"}}`,
+			wantStatus: http.StatusOK,
+			wantResult: "accepted",
+			wantStored: true,
+		},
+		{
+			name:       "other page event",
+			body:       `{"type": "page.locked", "entity": {"id": "page-1", "type": "page"}}`,
+			wantStatus: http.StatusOK,
+			wantResult: "ignored",
+		},
+		{
+			name:       "database event",
+			body:       `{"type": "database.created", "entity": {"id": "db-1", "type": "database"}}`,
+			wantStatus: http.StatusOK,
+			wantResult: "ignored",
+		},
+		{
+			name:       "verification request",
+			body:       `{"verification_token": "secret_abc"}`,
+			wantStatus: http.StatusOK,
+			wantResult: "verification_received",
+		},
+		{
+			name:       "invalid payload",
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, documents := newTestNotionHandler()
+
+			rec := httptest.NewRecorder()
+			handler.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook/notion", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp["status"] != tt.wantResult {
+				t.Errorf("Expected status %q, got %q", tt.wantResult, resp["status"])
+			}
+
+			if !tt.wantStored {
+				return
+			}
+			// The page is ingested in the background
+			deadline := time.Now().Add(time.Second)
+			for documents.get("notion_page_page-1") == nil && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if documents.get("notion_page_page-1") == nil {
+				t.Error("Expected the page to be ingested")
+			}
+		})
+	}
+}
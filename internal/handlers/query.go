@@ -1,21 +1,89 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	kslack "knowthis/internal/integrations/slack"
+	"knowthis/internal/apierror"
+	"knowthis/internal/language"
 	"knowthis/internal/services"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxQueryLimit is the most search results a query may ask for
+	maxQueryLimit = 50
+
+	// maxConversationIDLength bounds caller-assigned conversation IDs
+	maxConversationIDLength = 255
+
+	// maxHistoryTurns bounds the prior turns a request may pass; only the
+	// most recent are used
+	maxHistoryTurns = 20
 )
 
 type QueryHandler struct {
 	ragService *services.RAGService
+
+	// Header carrying the caller's readable channel IDs; empty disables scoping
+	accessScopeHeader string
+
+	// Chat models a request may select in addition to the default
+	allowedModels map[string]bool
+
+	// Links sources to their Slack threads; nil omits permalinks
+	permalinks PermalinkResolver
 }
 
 type QueryRequest struct {
 	Query string `json:"query"`
+	Model string `json:"model,omitempty"` // Optional chat model override, must be allowlisted
+
+	// Answer only from the single most relevant thread, for simple factual questions
+	SingleSource bool `json:"single_source,omitempty"`
+
+	// Optional system prompt replacing the configured one for this query,
+	// e.g. a team's tone and citation style; may not be blank
+	Persona *string `json:"persona,omitempty"`
+
+	// Optional filters: "slack" or "slab", and an RFC3339 timestamp or YYYY-MM-DD date range
+	Source string `json:"source,omitempty"`
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+
+	// Optional ISO 639-1 code restricting sources to threads detected to be
+	// in that language, e.g. "es"
+	Language string `json:"language,omitempty"`
+
+	// Optional recall/precision controls: how many search results to consider
+	// (1-50, default 10) and the minimum source similarity (0-1; by default
+	// the configured threshold, with its fallback when nothing passes)
+	Limit         *int     `json:"limit,omitempty"`
+	MinSimilarity *float64 `json:"min_similarity,omitempty"`
+
+	// Optional "vector" (default), "keyword" for exact terms like error codes,
+	// or "hybrid" to blend both
+	SearchMode string `json:"search_mode,omitempty"`
+
+	// Optional caller-assigned ID; the same ID always gets the same sampling decision
+	QueryID string `json:"query_id,omitempty"`
+
+	// Optional "text" (default), "json" for a structured answer with
+	// answer, confidence and action_items fields, or "structured" for an
+	// answer with citations quoting the sources by ID
+	ResponseFormat string `json:"response_format,omitempty"`
+
+	// Optional conversation for follow-up questions: turns are remembered by
+	// conversation_id, or prior turns can be passed explicitly as history
+	ConversationID string                      `json:"conversation_id,omitempty"`
+	History        []services.ConversationTurn `json:"history,omitempty"`
 }
 
 type QueryResponse struct {
@@ -26,81 +94,292 @@ type QueryResponse struct {
 		Source    string    `json:"source"`
 		Title     string    `json:"title,omitempty"`
 		UserName  string    `json:"user_name,omitempty"`
+		UserTitle string    `json:"user_title,omitempty"`
+		UserTeam  string    `json:"user_team,omitempty"`
 		Timestamp time.Time `json:"timestamp"`
 		Similarity float64  `json:"similarity"`
+		Permalink string    `json:"permalink,omitempty"`
 	} `json:"sources"`
 	Query string `json:"query"`
+
+	// The follow-up rewritten as a standalone question, for follow-up queries
+	StandaloneQuery string `json:"standalone_query,omitempty"`
+
+	// Present when a JSON response was requested and the model returned valid JSON
+	Structured *services.StructuredAnswer `json:"structured,omitempty"`
+
+	// Present when a structured response was requested and the model returned
+	// valid JSON; only citations quoting the listed sources are kept
+	Cited *services.CitedAnswer `json:"cited,omitempty"`
+
+	// Present instead of an answer for prompt previews
+	Prompts *services.PromptPreview `json:"prompts,omitempty"`
+
+	// True when the answer lists the most relevant sources because the chat
+	// model was unavailable
+	Degraded bool `json:"degraded,omitempty"`
+
+	// The threads the answer cites as [number], with the date of each
+	// thread's latest message
+	Citations []services.Citation `json:"citations,omitempty"`
 }
 
 func NewQueryHandler(ragService *services.RAGService) *QueryHandler {
 	return &QueryHandler{ragService: ragService}
 }
 
+// SetAccessScopeHeader sets the header, populated by a trusted auth proxy,
+// that lists the comma-separated channel IDs the caller may read
+func (h *QueryHandler) SetAccessScopeHeader(header string) {
+	h.accessScopeHeader = header
+}
+
+// SetAllowedModels sets the chat models requests may select with the model field
+func (h *QueryHandler) SetAllowedModels(models []string) {
+	h.allowedModels = make(map[string]bool, len(models))
+	for _, model := range models {
+		h.allowedModels[model] = true
+	}
+}
+
+// SetPermalinkResolver adds a permalink to each source's Slack thread when
+// one is available
+func (h *QueryHandler) SetPermalinkResolver(permalinks PermalinkResolver) {
+	h.permalinks = permalinks
+}
+
 func (h *QueryHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	h.serveQuery(w, r, false)
+}
+
+// HandlePromptPreview takes the same request as HandleQuery but returns the
+// prompts that would be sent and the retrieved sources without calling the
+// chat model. It is meant for operators and must only be routed behind admin auth.
+func (h *QueryHandler) HandlePromptPreview(w http.ResponseWriter, r *http.Request) {
+	h.serveQuery(w, r, true)
+}
+
+// HandleQueryGet answers GET /api/query?q=..., the query string form of
+// HandleQuery for quick debugging with curl. Only the query can be given;
+// everything else takes its default.
+func (h *QueryHandler) HandleQueryGet(w http.ResponseWriter, r *http.Request) {
+	values, ok := r.URL.Query()["q"]
+	if !ok {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Query parameter q is required")
+		return
+	}
+
+	h.answerQuery(w, r, QueryRequest{Query: values[0]}, false)
+}
+
+func (h *QueryHandler) serveQuery(w http.ResponseWriter, r *http.Request, dryRun bool) {
 	var req QueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Error decoding query request: %v", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
 		return
 	}
 
+	h.answerQuery(w, r, req, dryRun)
+}
+
+// answerQuery validates a decoded query request and writes its QueryResponse
+func (h *QueryHandler) answerQuery(w http.ResponseWriter, r *http.Request, req QueryRequest, dryRun bool) {
 	if req.Query == "" {
-		http.Error(w, "Query cannot be empty", http.StatusBadRequest)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Query cannot be empty")
+		return
+	}
+
+	if req.Model != "" && !h.allowedModels[req.Model] {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Model is not allowed")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if req.Source != "" && req.Source != "slack" && req.Source != "slab" {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Source must be slack or slab")
+		return
+	}
 
-	result, err := h.ragService.Query(ctx, req.Query)
+	var persona string
+	if req.Persona != nil {
+		persona = strings.TrimSpace(*req.Persona)
+		if persona == "" {
+			apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Persona cannot be empty")
+			return
+		}
+		if utf8.RuneCountInString(persona) > services.MaxSystemPromptChars {
+			apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("Persona must be at most %d characters", services.MaxSystemPromptChars))
+			return
+		}
+	}
+
+	if req.Language != "" && !language.Supported(req.Language) {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Language must be one of: "+strings.Join(language.Codes(), ", "))
+		return
+	}
+
+	if req.Limit != nil && (*req.Limit < 1 || *req.Limit > maxQueryLimit) {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Limit must be between 1 and 50")
+		return
+	}
+
+	if req.MinSimilarity != nil && (*req.MinSimilarity < 0 || *req.MinSimilarity > 1) {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Min similarity must be between 0 and 1")
+		return
+	}
+
+	switch kslack.SearchMode(req.SearchMode) {
+	case "", kslack.SearchModeVector, kslack.SearchModeKeyword, kslack.SearchModeHybrid:
+	default:
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Search mode must be vector, keyword or hybrid")
+		return
+	}
+
+	if len(req.ConversationID) > maxConversationIDLength {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Conversation ID is too long")
+		return
+	}
+
+	if len(req.History) > maxHistoryTurns {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "History has too many turns")
+		return
+	}
+	for _, turn := range req.History {
+		if strings.TrimSpace(turn.Question) == "" {
+			apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "History turns need a question")
+			return
+		}
+	}
+
+	switch req.ResponseFormat {
+	case "", services.ResponseFormatText, services.ResponseFormatJSON, services.ResponseFormatStructured:
+	default:
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Response format must be text, json or structured")
+		return
+	}
+
+	after, err := parseTimeParam(req.After)
+	if err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid after: use RFC3339 or YYYY-MM-DD")
+		return
+	}
+	before, err := parseTimeParam(req.Before)
+	if err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid before: use RFC3339 or YYYY-MM-DD")
+		return
+	}
+
+	// The query's own timeout applies on top of the request's, so a client
+	// that disconnects or set a shorter deadline stops the query
+	ctx := r.Context()
+
+	queryID := req.QueryID
+	if queryID == "" {
+		queryID = uuid.New().String()
+	}
+	ctx = services.WithQueryID(ctx, queryID)
+
+	if h.accessScopeHeader != "" {
+		ctx = services.WithAccessScope(ctx, services.NewAccessScope(parseChannelList(r.Header.Get(h.accessScopeHeader))))
+	}
+
+	opts := services.QueryOptions{
+		Model:          req.Model,
+		SingleSource:   req.SingleSource,
+		Persona:        persona,
+		Source:         req.Source,
+		After:          after,
+		Before:         before,
+		Language:       req.Language,
+		MinSimilarity:  req.MinSimilarity,
+		SearchMode:     kslack.SearchMode(req.SearchMode),
+		ResponseFormat: req.ResponseFormat,
+		DryRun:         dryRun,
+		ConversationID: req.ConversationID,
+		History:        req.History,
+	}
+	if req.Limit != nil {
+		opts.Limit = *req.Limit
+	}
+
+	result, err := h.ragService.QueryWithOptions(ctx, req.Query, opts)
 	if err != nil {
 		log.Printf("Error processing query: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeUpstreamError, "Failed to answer the query")
 		return
 	}
 
 	// Convert to response format
 	response := QueryResponse{
-		Answer: result.Answer,
-		Query:  result.Query,
+		Answer:          result.Answer,
+		Query:           result.Query,
+		StandaloneQuery: result.StandaloneQuery,
+		Structured:      result.Structured,
+		Cited:           result.Cited,
+		Prompts:         result.Prompts,
+		Degraded:        result.Degraded,
+		Citations:       result.Citations,
 		Sources: make([]struct {
 			ID        string    `json:"id"`
 			Content   string    `json:"content"`
 			Source    string    `json:"source"`
 			Title     string    `json:"title,omitempty"`
 			UserName  string    `json:"user_name,omitempty"`
+			UserTitle string    `json:"user_title,omitempty"`
+			UserTeam  string    `json:"user_team,omitempty"`
 			Timestamp time.Time `json:"timestamp"`
 			Similarity float64  `json:"similarity"`
+			Permalink string    `json:"permalink,omitempty"`
 		}, len(result.Sources)),
 	}
 
 	for i, source := range result.Sources {
-		// Calculate similarity estimate based on position
-		similarity := 0.9 - (float64(i) * 0.05)
-		
+		// Documents aren't Slack threads, so only messages have permalinks
+		var permalink string
+		if h.permalinks != nil && source.Source == "" {
+			permalink = h.permalinks.GetThreadPermalink(ctx, source.ChannelID, source.ThreadID)
+		}
+
 		response.Sources[i] = struct {
 			ID        string    `json:"id"`
 			Content   string    `json:"content"`
 			Source    string    `json:"source"`
 			Title     string    `json:"title,omitempty"`
 			UserName  string    `json:"user_name,omitempty"`
+			UserTitle string    `json:"user_title,omitempty"`
+			UserTeam  string    `json:"user_team,omitempty"`
 			Timestamp time.Time `json:"timestamp"`
 			Similarity float64  `json:"similarity"`
+			Permalink string    `json:"permalink,omitempty"`
 		}{
 			ID:        source.ID.String(),
 			Content:   source.Content,
-			Source:    "slack",
-			Title:     "", // Slack messages don't have titles
+			Source:    source.SourceType(),
+			Title:     source.Title, // Slack messages don't have titles
 			UserName:  source.UserName,
+			UserTitle: source.UserTitle,
+			UserTeam:  source.UserTeam,
 			Timestamp: source.CreatedAt,
-			Similarity: similarity,
+			Similarity: source.Similarity,
+			Permalink: permalink,
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
 		return
 	}
-}
\ No newline at end of file
+}
+
+// parseChannelList splits a comma-separated list of channel IDs
+func parseChannelList(value string) []string {
+	var channels []string
+	for _, channel := range strings.Split(value, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
@@ -0,0 +1,580 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/services"
+	"knowthis/internal/storage"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type mockQuerySearcher struct {
+	filters    []slack.SearchFilter
+	limits     []int
+	embeddings [][]float32
+}
+
+func (m *mockQuerySearcher) SearchSimilarMessages(ctx context.Context, embedding []float32, limit int, filter slack.SearchFilter) ([]slack.SlackMessage, error) {
+	m.filters = append(m.filters, filter)
+	m.limits = append(m.limits, limit)
+	m.embeddings = append(m.embeddings, embedding)
+	return []slack.SlackMessage{
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "alice", Content: "Deploys are rolled back with make rollback", Similarity: 0.9},
+	}, nil
+}
+
+type mockQueryEmbedder struct{}
+
+func (m *mockQueryEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{0.1, 0.2}, nil
+}
+
+type mockChatProvider struct {
+	models        []string
+	systemPrompts []string
+}
+
+func (m *mockChatProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.models = append(m.models, req.Model)
+	m.systemPrompts = append(m.systemPrompts, req.Messages[0].Content)
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "Run make rollback"}}},
+	}, nil
+}
+
+func TestQueryHandler_ModelOverride(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedModel  string
+	}{
+		{
+			name:           "default model",
+			body:           `{"query": "how do I roll back?"}`,
+			expectedStatus: http.StatusOK,
+			expectedModel:  "gpt-4o-mini",
+		},
+		{
+			name:           "allowlisted model",
+			body:           `{"query": "how do I roll back?", "model": "gpt-4o"}`,
+			expectedStatus: http.StatusOK,
+			expectedModel:  "gpt-4o",
+		},
+		{
+			name:           "model not in allowlist",
+			body:           `{"query": "how do I roll back?", "model": "o1-preview"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &mockChatProvider{}
+			rag := services.NewRAGService(llm, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+			handler := NewQueryHandler(rag)
+			handler.SetAllowedModels([]string{"gpt-4o-mini", "gpt-4o"})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.HandleQuery(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			if tc.expectedModel == "" {
+				if len(llm.models) != 0 {
+					t.Errorf("Expected no chat completion for a rejected model, got %v", llm.models)
+				}
+				return
+			}
+			if len(llm.models) != 1 || llm.models[0] != tc.expectedModel {
+				t.Errorf("Expected chat completion with model %s, got %v", tc.expectedModel, llm.models)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Filters(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectSearch   bool
+		expectedFilter slack.SearchFilter
+	}{
+		{
+			name:           "no filters",
+			body:           `{"query": "what did we decide about retries?"}`,
+			expectedStatus: http.StatusOK,
+			expectSearch:   true,
+		},
+		{
+			name:           "date range",
+			body:           `{"query": "what did we decide about retries?", "source": "slack", "after": "2024-01-01", "before": "2024-04-01T00:00:00Z"}`,
+			expectedStatus: http.StatusOK,
+			expectSearch:   true,
+			expectedFilter: slack.SearchFilter{
+				After:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:           "language",
+			body:           `{"query": "¿qué decidimos sobre los reintentos?", "language": "es"}`,
+			expectedStatus: http.StatusOK,
+			expectSearch:   true,
+			expectedFilter: slack.SearchFilter{Language: "es"},
+		},
+		{
+			name:           "unsupported language",
+			body:           `{"query": "what did we decide about retries?", "language": "klingon"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "source without searchable content",
+			body:           `{"query": "what did we decide about retries?", "source": "slab"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown source",
+			body:           `{"query": "what did we decide about retries?", "source": "jira"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid date",
+			body:           `{"query": "what did we decide about retries?", "after": "last quarter"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			searcher := &mockQuerySearcher{}
+			rag := services.NewRAGService(&mockChatProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+			handler := NewQueryHandler(rag)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.HandleQuery(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			if !tc.expectSearch {
+				if len(searcher.filters) != 0 {
+					t.Errorf("Expected no search, got %d", len(searcher.filters))
+				}
+				return
+			}
+			if len(searcher.filters) != 1 {
+				t.Fatalf("Expected 1 search, got %d", len(searcher.filters))
+			}
+			if got := searcher.filters[0]; !got.After.Equal(tc.expectedFilter.After) || !got.Before.Equal(tc.expectedFilter.Before) || got.Language != tc.expectedFilter.Language {
+				t.Errorf("Expected filter %+v, got %+v", tc.expectedFilter, got)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_LimitAndMinSimilarity(t *testing.T) {
+	testCases := []struct {
+		name            string
+		body            string
+		expectedStatus  int
+		expectedLimit   int
+		expectedSources int
+	}{
+		{
+			name:            "defaults",
+			body:            `{"query": "how do I roll back?"}`,
+			expectedStatus:  http.StatusOK,
+			expectedLimit:   10,
+			expectedSources: 1,
+		},
+		{
+			name:            "custom limit and threshold",
+			body:            `{"query": "how do I roll back?", "limit": 25, "min_similarity": 0.5}`,
+			expectedStatus:  http.StatusOK,
+			expectedLimit:   25,
+			expectedSources: 1,
+		},
+		{
+			name:            "threshold above every source",
+			body:            `{"query": "how do I roll back?", "min_similarity": 0.95}`,
+			expectedStatus:  http.StatusOK,
+			expectedLimit:   10,
+			expectedSources: 0,
+		},
+		{name: "limit zero", body: `{"query": "how do I roll back?", "limit": 0}`, expectedStatus: http.StatusBadRequest},
+		{name: "limit too large", body: `{"query": "how do I roll back?", "limit": 51}`, expectedStatus: http.StatusBadRequest},
+		{name: "negative similarity", body: `{"query": "how do I roll back?", "min_similarity": -0.1}`, expectedStatus: http.StatusBadRequest},
+		{name: "similarity above one", body: `{"query": "how do I roll back?", "min_similarity": 1.5}`, expectedStatus: http.StatusBadRequest},
+		{
+			name:            "structured response format",
+			body:            `{"query": "how do I roll back?", "response_format": "structured"}`,
+			expectedStatus:  http.StatusOK,
+			expectedLimit:   10,
+			expectedSources: 1,
+		},
+		{name: "unknown response format", body: `{"query": "how do I roll back?", "response_format": "xml"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			searcher := &mockQuerySearcher{}
+			rag := services.NewRAGService(&mockChatProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+			handler := NewQueryHandler(rag)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.HandleQuery(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				if len(searcher.limits) != 0 {
+					t.Errorf("Expected no search for an invalid request")
+				}
+				return
+			}
+
+			if len(searcher.limits) != 1 || searcher.limits[0] != tc.expectedLimit {
+				t.Errorf("Expected search limit %d, got %v", tc.expectedLimit, searcher.limits)
+			}
+
+			var response QueryResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Sources) != tc.expectedSources {
+				t.Errorf("Expected %d sources, got %d", tc.expectedSources, len(response.Sources))
+			}
+		})
+	}
+}
+
+func TestQueryHandler_SearchMode(t *testing.T) {
+	testCases := []struct {
+		name            string
+		body            string
+		expectedStatus  int
+		expectedMode    slack.SearchMode
+		expectEmbedding bool
+	}{
+		{name: "vector by default", body: `{"query": "ERR-4411 on checkout"}`, expectedStatus: http.StatusOK, expectEmbedding: true},
+		{name: "keyword", body: `{"query": "ERR-4411 on checkout", "search_mode": "keyword"}`, expectedStatus: http.StatusOK, expectedMode: slack.SearchModeKeyword},
+		{name: "hybrid", body: `{"query": "ERR-4411 on checkout", "search_mode": "hybrid"}`, expectedStatus: http.StatusOK, expectedMode: slack.SearchModeHybrid, expectEmbedding: true},
+		{name: "unknown mode", body: `{"query": "ERR-4411 on checkout", "search_mode": "fuzzy"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			searcher := &mockQuerySearcher{}
+			rag := services.NewRAGService(&mockChatProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+			handler := NewQueryHandler(rag)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.HandleQuery(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				if len(searcher.filters) != 0 {
+					t.Errorf("Expected no search for an invalid request")
+				}
+				return
+			}
+
+			if len(searcher.filters) != 1 {
+				t.Fatalf("Expected 1 search, got %d", len(searcher.filters))
+			}
+			if got := searcher.filters[0]; got.Mode != tc.expectedMode || got.Query != "ERR-4411 on checkout" {
+				t.Errorf("Expected mode %q with the query, got %+v", tc.expectedMode, got)
+			}
+			if hasEmbedding := searcher.embeddings[0] != nil; hasEmbedding != tc.expectEmbedding {
+				t.Errorf("Expected embedding %t, got %t", tc.expectEmbedding, hasEmbedding)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_PromptPreview(t *testing.T) {
+	llm := &mockChatProvider{}
+	rag := services.NewRAGService(llm, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+	rag.SetAnswerCache(services.NewAnswerCache(time.Minute, 100))
+	handler := NewQueryHandler(rag)
+	handler.SetAllowedModels([]string{"gpt-4o-mini"})
+
+	body := `{"query": "how do I roll back?", "response_format": "json"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/query/preview", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.HandlePromptPreview(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if len(llm.models) != 0 {
+		t.Fatalf("Expected no chat completion for a preview, got %v", llm.models)
+	}
+
+	var response QueryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Prompts == nil {
+		t.Fatalf("Expected prompts in the preview")
+	}
+	if !strings.Contains(response.Prompts.System, `"confidence"`) {
+		t.Errorf("Expected the JSON answer instructions in the system prompt, got %q", response.Prompts.System)
+	}
+	if !strings.Contains(response.Prompts.User, "alice: Deploys are rolled back with make rollback") ||
+		!strings.Contains(response.Prompts.User, "Question: how do I roll back?") {
+		t.Errorf("Expected the sources and question in the user prompt, got %q", response.Prompts.User)
+	}
+	if response.Answer != "" {
+		t.Errorf("Expected no answer in a preview, got %q", response.Answer)
+	}
+	if len(response.Sources) != 1 {
+		t.Errorf("Expected the retrieved source, got %d", len(response.Sources))
+	}
+
+	// The preview isn't cached, so the real query still calls the model
+	req = httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	handler.HandleQuery(rec, req)
+
+	if len(llm.models) != 1 {
+		t.Errorf("Expected the real query to call the model once, got %v", llm.models)
+	}
+	if strings.Contains(rec.Body.String(), `"prompts"`) {
+		t.Errorf("Expected no prompts in a regular query response")
+	}
+}
+
+type mockPermalinkResolver struct {
+	links map[string]string
+}
+
+func (m *mockPermalinkResolver) GetThreadPermalink(ctx context.Context, channelID, threadTS string) string {
+	return m.links[channelID+"/"+threadTS]
+}
+
+func TestQueryHandler_SourcePermalinks(t *testing.T) {
+	rag := services.NewRAGService(&mockChatProvider{}, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+	handler := NewQueryHandler(rag)
+	handler.SetAllowedModels([]string{"gpt-4o-mini"})
+
+	query := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(`{"query": "how do I roll back?"}`))
+		rec := httptest.NewRecorder()
+		handler.HandleQuery(rec, req)
+		return rec
+	}
+
+	if rec := query(); strings.Contains(rec.Body.String(), `"permalink"`) {
+		t.Errorf("Expected no permalinks without a resolver, got %s", rec.Body.String())
+	}
+
+	handler.SetPermalinkResolver(&mockPermalinkResolver{links: map[string]string{
+		"C1/1.0": "https://acme.slack.com/archives/C1/p1000000",
+	}})
+
+	var response QueryResponse
+	if err := json.NewDecoder(query().Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Sources) != 1 || response.Sources[0].Permalink != "https://acme.slack.com/archives/C1/p1000000" {
+		t.Errorf("Expected the source's permalink, got %+v", response.Sources)
+	}
+}
+
+type mockQueryDocumentSearcher struct{}
+
+func (m *mockQueryDocumentSearcher) SearchSimilar(ctx context.Context, embedding []float32, limit int) ([]*storage.Document, error) {
+	return []*storage.Document{
+		{ID: "slab_post_7", Source: "slab", Title: "Rollback runbook", UserName: "dana", Content: "Roll deploys back from the release dashboard", Similarity: 0.95},
+	}, nil
+}
+
+func TestQueryHandler_DocumentSources(t *testing.T) {
+	rag := services.NewRAGService(&mockChatProvider{}, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+	rag.SetDocumentSearch(&mockQueryDocumentSearcher{})
+	handler := NewQueryHandler(rag)
+	handler.SetAllowedModels([]string{"gpt-4o-mini"})
+	resolver := &mockPermalinkResolver{links: map[string]string{
+		"C1/1.0":       "https://acme.slack.com/archives/C1/p1000000",
+		"/slab_post_7": "https://acme.slack.com/archives/unexpected",
+	}}
+	handler.SetPermalinkResolver(resolver)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(`{"query": "how do I roll back?"}`))
+	rec := httptest.NewRecorder()
+	handler.HandleQuery(rec, req)
+
+	var response QueryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Sources) != 2 {
+		t.Fatalf("Expected the Slab post and the Slack message as sources, got %+v", response.Sources)
+	}
+
+	slab, message := response.Sources[0], response.Sources[1]
+	if slab.Source != "slab" || slab.Title != "Rollback runbook" || slab.Permalink != "" {
+		t.Errorf("Expected the Slab post first, titled and without a permalink, got %+v", slab)
+	}
+	if message.Source != "slack" || message.Title != "" || message.Permalink != "https://acme.slack.com/archives/C1/p1000000" {
+		t.Errorf("Expected the Slack message with its permalink, got %+v", message)
+	}
+	if len(response.Citations) != 2 || response.Citations[0].Source != "slab" || response.Citations[1].Source != "slack" {
+		t.Errorf("Expected citations with their source types, got %+v", response.Citations)
+	}
+}
+
+type failingChatProvider struct{}
+
+func (m *failingChatProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{}, errors.New("openai unavailable")
+}
+
+func TestQueryHandler_ErrorResponses(t *testing.T) {
+	testCases := []struct {
+		name           string
+		llm            services.LLMProvider
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"invalid json", &mockChatProvider{}, `{"query":`, http.StatusBadRequest, apierror.CodeInvalidPayload},
+		{"empty query", &mockChatProvider{}, `{"query": ""}`, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"model not allowed", &mockChatProvider{}, `{"query": "how do I roll back?", "model": "o1-preview"}`, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"empty persona", &mockChatProvider{}, `{"query": "how do I roll back?", "persona": "  "}`, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"persona too long", &mockChatProvider{}, `{"query": "how do I roll back?", "persona": "` + strings.Repeat("a", services.MaxSystemPromptChars+1) + `"}`, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"llm failure", &failingChatProvider{}, `{"query": "how do I roll back?"}`, http.StatusInternalServerError, apierror.CodeUpstreamError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rag := services.NewRAGService(tc.llm, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+			handler := NewQueryHandler(rag)
+			handler.SetAllowedModels([]string{"gpt-4o-mini"})
+
+			rec := httptest.NewRecorder()
+			handler.HandleQuery(rec, httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(tc.body)))
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected a JSON error, got content type %q", contentType)
+			}
+			var response apierror.Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			if response.Error.Code != tc.expectedCode || response.Error.Message == "" {
+				t.Errorf("Expected error code %s with a message, got %+v", tc.expectedCode, response.Error)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Persona(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       string
+		wantSystem string
+	}{
+		{"configured prompt", `{"query": "how do I roll back?"}`, "Answer as the platform team's on-call guide."},
+		{"persona", `{"query": "how do I roll back?", "persona": " Answer in one sentence. "}`, "Answer in one sentence."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &mockChatProvider{}
+			rag := services.NewRAGService(llm, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+			rag.SetSystemPrompt("Answer as the platform team's on-call guide.")
+			handler := NewQueryHandler(rag)
+			handler.SetAllowedModels([]string{"gpt-4o-mini"})
+
+			rec := httptest.NewRecorder()
+			handler.HandleQuery(rec, httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(tc.body)))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if len(llm.systemPrompts) != 1 || llm.systemPrompts[0] != tc.wantSystem {
+				t.Errorf("Expected the completion request's system prompt %q, got %q", tc.wantSystem, llm.systemPrompts)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Get(t *testing.T) {
+	testCases := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"missing q", "/api/query", http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"empty q", "/api/query?q=", http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"valid query", "/api/query?q=how+do+I+roll+back%3F", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &mockChatProvider{}
+			rag := services.NewRAGService(llm, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+			handler := NewQueryHandler(rag)
+
+			rec := httptest.NewRecorder()
+			handler.HandleQueryGet(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			if tc.expectedCode != "" {
+				var response apierror.Response
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode error: %v", err)
+				}
+				if response.Error.Code != tc.expectedCode {
+					t.Errorf("Expected error code %s, got %+v", tc.expectedCode, response.Error)
+				}
+				if len(llm.models) != 0 {
+					t.Errorf("Expected no chat completion for an invalid query, got %d", len(llm.models))
+				}
+				return
+			}
+
+			var response QueryResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Query != "how do I roll back?" {
+				t.Errorf("Expected the decoded query, got %q", response.Query)
+			}
+			if response.Answer != "Run make rollback" || len(response.Sources) != 1 {
+				t.Errorf("Expected the answer and its source, got %+v", response)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"knowthis/internal/services"
+)
+
+// readinessTimeout bounds all dependency checks of one readiness probe
+const readinessTimeout = 3 * time.Second
+
+type ReadinessHandler struct {
+	checks map[string]services.HealthChecker
+}
+
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+	Failed []string          `json:"failed,omitempty"`
+}
+
+// NewReadinessHandler creates a readiness probe over the named dependencies
+func NewReadinessHandler(checks map[string]services.HealthChecker) *ReadinessHandler {
+	return &ReadinessHandler{checks: checks}
+}
+
+// HandleReady checks every dependency concurrently, responding 200 when all
+// are usable and 503 listing the failed ones otherwise
+func (h *ReadinessHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]string, len(h.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range h.checks {
+		wg.Add(1)
+		go func(name string, checker services.HealthChecker) {
+			defer wg.Done()
+
+			err := checker.HealthCheck(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				slog.Warn("Readiness check failed", "dependency", name, "error", err)
+				response.Checks[name] = err.Error()
+				response.Failed = append(response.Failed, name)
+				return
+			}
+			response.Checks[name] = "ok"
+		}(name, checker)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if len(response.Failed) > 0 {
+		sort.Strings(response.Failed)
+		response.Status = "not_ready"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
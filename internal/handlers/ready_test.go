@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"knowthis/internal/services"
+)
+
+// Mock dependency whose health check returns a fixed error
+type mockHealthChecker struct {
+	err error
+}
+
+func (m *mockHealthChecker) HealthCheck(ctx context.Context) error {
+	return m.err
+}
+
+func TestReadinessHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		databaseErr    error
+		openaiErr      error
+		expectedStatus int
+		expectedFailed []string
+	}{
+		{
+			name:           "all dependencies ready",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "database ping fails",
+			databaseErr:    errors.New("database unavailable: connection refused"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedFailed: []string{"database"},
+		},
+		{
+			name:           "everything down",
+			databaseErr:    errors.New("database unavailable: connection refused"),
+			openaiErr:      errors.New("embedding API unavailable: timeout"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedFailed: []string{"database", "openai"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewReadinessHandler(map[string]services.HealthChecker{
+				"database": &mockHealthChecker{err: tc.databaseErr},
+				"openai":   &mockHealthChecker{err: tc.openaiErr},
+			})
+
+			rec := httptest.NewRecorder()
+			handler.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			var response ReadinessResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Failed) != len(tc.expectedFailed) {
+				t.Fatalf("Expected failed %v, got %v", tc.expectedFailed, response.Failed)
+			}
+			for i, name := range tc.expectedFailed {
+				if response.Failed[i] != name {
+					t.Errorf("Expected failed %v, got %v", tc.expectedFailed, response.Failed)
+				}
+				if response.Checks[name] == "ok" {
+					t.Errorf("Expected %s check to report its error", name)
+				}
+			}
+			if tc.databaseErr == nil && response.Checks["database"] != "ok" {
+				t.Errorf("Expected database check ok, got %q", response.Checks["database"])
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/storage"
+)
+
+// DocumentReindexer queues stored documents to have their embeddings recomputed
+type DocumentReindexer interface {
+	QueueReindex(ctx context.Context, filter storage.DocumentFilter) (int64, error)
+}
+
+// ReindexRequest selects the documents to re-embed. Reindexing everything
+// must be asked for explicitly with All.
+type ReindexRequest struct {
+	Source string `json:"source,omitempty"`
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+	All    bool   `json:"all,omitempty"`
+}
+
+type ReindexResponse struct {
+	Queued int64 `json:"queued"`
+}
+
+type ReindexHandler struct {
+	documents DocumentReindexer
+}
+
+func NewReindexHandler(documents DocumentReindexer) *ReindexHandler {
+	return &ReindexHandler{documents: documents}
+}
+
+// HandleReindex clears the embeddings of matching documents so the
+// background embedding processor recomputes them, e.g. after changing the
+// embedding model
+func (h *ReindexHandler) HandleReindex(w http.ResponseWriter, r *http.Request) {
+	var req ReindexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Request body must be valid JSON")
+		return
+	}
+
+	filter := storage.DocumentFilter{Source: req.Source}
+	var err error
+	if filter.After, err = parseTimeParam(req.After); err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid after: use RFC3339 or YYYY-MM-DD")
+		return
+	}
+	if filter.Before, err = parseTimeParam(req.Before); err != nil {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid before: use RFC3339 or YYYY-MM-DD")
+		return
+	}
+
+	if req.All && !filter.IsZero() {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "all cannot be combined with source, after or before")
+		return
+	}
+	if !req.All && filter.IsZero() {
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Set source, after or before, or all to reindex every document")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	queued, err := h.documents.QueueReindex(ctx, filter)
+	if err != nil {
+		slog.Error("Failed to queue documents for reindex", "error", err, "source", filter.Source)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+	slog.Info("Queued documents for reindex", "queued", queued, "source", filter.Source, "all", req.All)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ReindexResponse{Queued: queued}); err != nil {
+		slog.Error("Failed to encode reindex response", "error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+)
+
+type mockReindexer struct {
+	filters []storage.DocumentFilter
+}
+
+func (m *mockReindexer) QueueReindex(ctx context.Context, filter storage.DocumentFilter) (int64, error) {
+	m.filters = append(m.filters, filter)
+	return 7, nil
+}
+
+func TestReindexHandler_HandleReindex(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedFilter storage.DocumentFilter
+	}{
+		{
+			name:           "source and date range",
+			body:           `{"source": "slab", "after": "2024-01-01", "before": "2024-02-01T00:00:00Z"}`,
+			expectedStatus: http.StatusOK,
+			expectedFilter: storage.DocumentFilter{
+				Source: "slab",
+				After:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:           "all documents",
+			body:           `{"all": true}`,
+			expectedStatus: http.StatusOK,
+			expectedFilter: storage.DocumentFilter{},
+		},
+		{
+			name:           "no filter without all",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "all with a filter",
+			body:           `{"all": true, "source": "slack"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid date",
+			body:           `{"after": "last week"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed body",
+			body:           `{"all":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reindexer := &mockReindexer{}
+			handler := NewReindexHandler(reindexer)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/reindex", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.HandleReindex(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				if len(reindexer.filters) != 0 {
+					t.Errorf("Expected nothing queued, got %v", reindexer.filters)
+				}
+				return
+			}
+
+			if len(reindexer.filters) != 1 {
+				t.Fatalf("Expected one reindex, got %d", len(reindexer.filters))
+			}
+			filter := reindexer.filters[0]
+			if filter.Source != tc.expectedFilter.Source || !filter.After.Equal(tc.expectedFilter.After) || !filter.Before.Equal(tc.expectedFilter.Before) {
+				t.Errorf("Expected filter %+v, got %+v", tc.expectedFilter, filter)
+			}
+
+			var response ReindexResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Queued != 7 {
+				t.Errorf("Expected 7 queued, got %d", response.Queued)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"knowthis/internal/apierror"
+	kslack "knowthis/internal/integrations/slack"
+	"knowthis/internal/middleware"
+	"knowthis/internal/services"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// slashCommandTimeout bounds answering a question after the command is acked
+	slashCommandTimeout = 60 * time.Second
+
+	// maxSectionText is Slack's limit on a section block's text
+	maxSectionText = 3000
+)
+
+// Querier answers a question from the knowledge base
+type Querier interface {
+	Query(ctx context.Context, query string) (*services.QueryResult, error)
+}
+
+// PermalinkResolver looks up links to Slack threads, returning "" when none is available
+type PermalinkResolver interface {
+	GetThreadPermalink(ctx context.Context, channelID, threadTS string) string
+}
+
+// SlackCommandHandler answers /knowthis slash commands. Slack requires a
+// response within 3 seconds, so the command is acked immediately and the
+// answer is posted to the command's response_url when ready.
+type SlackCommandHandler struct {
+	querier    Querier
+	httpClient *http.Client
+
+	// Resolves source thread links through the Slack API; nil builds them from the team domain
+	permalinks PermalinkResolver
+}
+
+func NewSlackCommandHandler(querier Querier) *SlackCommandHandler {
+	return &SlackCommandHandler{
+		querier:    querier,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetPermalinkResolver makes answers link sources through the Slack API,
+// leaving sources in channels the bot can't access unlinked
+func (h *SlackCommandHandler) SetPermalinkResolver(permalinks PermalinkResolver) {
+	h.permalinks = permalinks
+}
+
+// HandleCommand acks a slash command, answering it asynchronously. Requests
+// must already be verified by SlackSignatureMiddleware.
+func (h *SlackCommandHandler) HandleCommand(w http.ResponseWriter, r *http.Request) {
+	command, err := slack.SlashCommandParse(r)
+	if err != nil {
+		slog.Warn("Failed to parse Slack slash command", "error", err)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Invalid slash command payload")
+		return
+	}
+
+	question := strings.TrimSpace(command.Text)
+	if question == "" {
+		writeSlackResponse(w, &slack.Msg{
+			ResponseType: slack.ResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Ask a question, for example: `%s how do I roll back a deploy?`", command.Command),
+		})
+		return
+	}
+
+	slog.Info("Received Slack slash command", "user_id", command.UserID, "channel_id", command.ChannelID)
+
+	release := middleware.HoldConcurrencySlot(r.Context())
+	go func() {
+		defer release()
+		h.answer(command, question)
+	}()
+
+	writeSlackResponse(w, &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         fmt.Sprintf("Looking up: _%s_", question),
+	})
+}
+
+// answer queries the knowledge base and posts the result to the response URL
+func (h *SlackCommandHandler) answer(command slack.SlashCommand, question string) {
+	ctx, cancel := context.WithTimeout(context.Background(), slashCommandTimeout)
+	defer cancel()
+
+	// Answers are posted to the command's channel, so they may only cite
+	// sources from that channel
+	ctx = services.WithAccessScope(ctx, services.NewAccessScope([]string{command.ChannelID}))
+
+	msg := &slack.WebhookMessage{ResponseType: slack.ResponseTypeEphemeral}
+
+	result, err := h.querier.Query(ctx, question)
+	if err != nil {
+		slog.Error("Failed to answer Slack slash command", "error", err, "user_id", command.UserID)
+		msg.Text = "Sorry, I couldn't answer that right now. Please try again."
+	} else {
+		msg.Text = result.Answer
+		msg.Blocks = &slack.Blocks{BlockSet: answerBlocks(question, result, func(source kslack.SlackMessage) string {
+			return h.sourceLink(ctx, command.TeamDomain, source)
+		})}
+	}
+
+	if err := slack.PostWebhookCustomHTTPContext(ctx, command.ResponseURL, h.httpClient, msg); err != nil {
+		slog.Error("Failed to post Slack slash command response", "error", err, "user_id", command.UserID)
+	}
+}
+
+// answerBlocks formats an answer and links to its source threads as Block Kit
+// blocks. Sources without a link are listed by author only.
+func answerBlocks(question string, result *services.QueryResult, linkFor func(kslack.SlackMessage) string) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, truncateText("*"+question+"*\n"+result.Answer, maxSectionText), false, false), nil, nil),
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	for _, source := range result.Sources {
+		key := source.ChannelID + "/" + source.ThreadID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// Documents are better known by their titles than their authors
+		name := source.AuthorLabel()
+		if source.Title != "" {
+			name = source.Title
+		}
+		label := fmt.Sprintf("[%d] %s", len(links)+1, name)
+		if link := linkFor(source); link != "" {
+			label = fmt.Sprintf("<%s|%s>", link, label)
+		}
+		links = append(links, label)
+	}
+
+	if len(links) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, truncateText("Sources: "+strings.Join(links, " · "), maxSectionText), false, false)))
+	}
+
+	return blocks
+}
+
+// sourceLink links to a source's thread, or returns "" if there's no link.
+// Documents from other sources aren't linked.
+func (h *SlackCommandHandler) sourceLink(ctx context.Context, teamDomain string, source kslack.SlackMessage) string {
+	if source.Source != "" {
+		return ""
+	}
+	if h.permalinks != nil {
+		return h.permalinks.GetThreadPermalink(ctx, source.ChannelID, source.ThreadID)
+	}
+	return threadPermalink(teamDomain, source)
+}
+
+// threadPermalink links to a source's thread in the workspace
+func threadPermalink(teamDomain string, source kslack.SlackMessage) string {
+	return fmt.Sprintf("https://%s.slack.com/archives/%s/p%s", teamDomain, source.ChannelID, strings.ReplaceAll(source.ThreadID, ".", ""))
+}
+
+// truncateText shortens text to at most limit bytes without splitting a character
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+
+	cut := limit - len("…")
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
+
+func writeSlackResponse(w http.ResponseWriter, msg *slack.Msg) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		slog.Error("Error encoding Slack response", "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/services"
+)
+
+type mockQuerier struct {
+	queries chan string
+	result  *services.QueryResult
+}
+
+func (m *mockQuerier) Query(ctx context.Context, query string) (*services.QueryResult, error) {
+	m.queries <- query
+	return m.result, nil
+}
+
+// newSlashCommandRequest builds a slash command request, already verified by middleware
+func newSlashCommandRequest(form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/slack/command", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func slashCommandForm(text, responseURL string) url.Values {
+	return url.Values{
+		"command":      {"/knowthis"},
+		"text":         {text},
+		"team_domain":  {"acme"},
+		"channel_id":   {"C1"},
+		"user_id":      {"U1"},
+		"response_url": {responseURL},
+	}
+}
+
+func TestSlackCommandHandler_EmptyQuestion(t *testing.T) {
+	querier := &mockQuerier{queries: make(chan string, 1)}
+	handler := NewSlackCommandHandler(querier)
+
+	req := newSlashCommandRequest(slashCommandForm("   ", "http://example.invalid"))
+	rec := httptest.NewRecorder()
+	handler.HandleCommand(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Ask a question") {
+		t.Errorf("Expected usage hint, got %s", rec.Body.String())
+	}
+	if len(querier.queries) != 0 {
+		t.Errorf("Expected no query for an empty question")
+	}
+}
+
+func TestSlackCommandHandler_AnswersViaResponseURL(t *testing.T) {
+	posted := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("Failed to decode response_url body: %v", err)
+		}
+		posted <- msg
+	}))
+	defer server.Close()
+
+	querier := &mockQuerier{
+		queries: make(chan string, 1),
+		result: &services.QueryResult{
+			Answer: "Run make rollback [1]",
+			Sources: []slack.SlackMessage{
+				{ChannelID: "C1", ThreadID: "1700000000.123456", UserName: "alice", Content: "Run make rollback"},
+				{ChannelID: "C1", ThreadID: "1700000000.123456", UserName: "bob", Content: "Then check the dashboard"},
+			},
+		},
+	}
+	handler := NewSlackCommandHandler(querier)
+
+	req := newSlashCommandRequest(slashCommandForm(" how do I roll back? ", server.URL))
+	rec := httptest.NewRecorder()
+	handler.HandleCommand(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Looking up") {
+		t.Errorf("Expected an immediate ack, got %s", rec.Body.String())
+	}
+
+	select {
+	case query := <-querier.queries:
+		if query != "how do I roll back?" {
+			t.Errorf("Expected trimmed question, got %q", query)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the query")
+	}
+
+	var msg map[string]interface{}
+	select {
+	case msg = <-posted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the response_url post")
+	}
+
+	if msg["text"] != "Run make rollback [1]" {
+		t.Errorf("Expected answer text, got %v", msg["text"])
+	}
+
+	blocks, _ := json.Marshal(msg["blocks"])
+	permalink := "https://acme.slack.com/archives/C1/p1700000000123456"
+	if strings.Count(string(blocks), permalink) != 1 {
+		t.Errorf("Expected one link to the source thread %s, got %s", permalink, blocks)
+	}
+}
+
+func TestSlackCommandHandler_ScopesSourcesToChannel(t *testing.T) {
+	testCases := []struct {
+		name      string
+		channelID string
+		linked    bool
+	}{
+		{"source in the command's channel", "C1", true},
+		{"source in another channel", "C2", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			posted := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				posted <- string(body)
+			}))
+			defer server.Close()
+
+			rag := services.NewRAGService(&mockChatProvider{}, "gpt-4o-mini", &mockQuerySearcher{}, &mockQueryEmbedder{})
+			rag.SetRequireAccessScope(true)
+			handler := NewSlackCommandHandler(rag)
+
+			form := slashCommandForm("how do I roll back?", server.URL)
+			form.Set("channel_id", tc.channelID)
+			handler.HandleCommand(httptest.NewRecorder(), newSlashCommandRequest(form))
+
+			var body string
+			select {
+			case body = <-posted:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the response_url post")
+			}
+
+			permalink := "https://acme.slack.com/archives/C1/p10"
+			if linked := strings.Contains(body, permalink); linked != tc.linked {
+				t.Errorf("Expected source linked: %v, got %s", tc.linked, body)
+			}
+		})
+	}
+}
+
+func TestAnswerBlocks_UnlinkedSources(t *testing.T) {
+	handler := NewSlackCommandHandler(&mockQuerier{})
+	handler.SetPermalinkResolver(&mockPermalinkResolver{links: map[string]string{
+		"C1/1700000000.123456": "https://acme.slack.com/archives/C1/p1700000000123456",
+	}})
+
+	result := &services.QueryResult{
+		Answer: "Run make rollback [1]",
+		Sources: []slack.SlackMessage{
+			{ChannelID: "C1", ThreadID: "1700000000.123456", UserName: "alice"},
+			{ChannelID: "C2", ThreadID: "1700000001.000000", UserName: "bob"},
+		},
+	}
+	blocks, _ := json.Marshal(answerBlocks("how do I roll back?", result, func(source slack.SlackMessage) string {
+		return handler.sourceLink(context.Background(), "acme", source)
+	}))
+
+	if !strings.Contains(string(blocks), "https://acme.slack.com/archives/C1/p1700000000123456|[1] alice") {
+		t.Errorf("Expected a link to the accessible thread, got %s", string(blocks))
+	}
+	if !strings.Contains(string(blocks), "[2] bob") || strings.Contains(string(blocks), "archives/C2") {
+		t.Errorf("Expected the inaccessible thread listed without a link, got %s", string(blocks))
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("short", 10); got != "short" {
+		t.Errorf("Expected short text unchanged, got %q", got)
+	}
+
+	got := truncateText(strings.Repeat("é", 10), 8)
+	if len(got) > 8 || !strings.HasSuffix(got, "…") || !utf8.ValidString(got) {
+		t.Errorf("Expected valid truncated text within the limit, got %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/storage"
+)
+
+// SourceStatsStore summarizes stored documents by source
+type SourceStatsStore interface {
+	GetSourceStats(ctx context.Context) ([]*storage.SourceStats, error)
+}
+
+// SourcesResponse lists what the knowledge base holds from each source
+type SourcesResponse struct {
+	Sources []*storage.SourceStats `json:"sources"`
+}
+
+type SourcesHandler struct {
+	// Slack messages and other documents are stored in separate tables
+	stores []SourceStatsStore
+}
+
+func NewSourcesHandler(stores ...SourceStatsStore) *SourcesHandler {
+	return &SourcesHandler{stores: stores}
+}
+
+// HandleSources returns, per source, the document count, the channels
+// documents came from and when the newest document was stored, e.g. to check
+// that ingestion is working
+func (h *SourcesHandler) HandleSources(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var stats []*storage.SourceStats
+	for _, store := range h.stores {
+		storeStats, err := store.GetSourceStats(ctx)
+		if err != nil {
+			slog.Error("Failed to get source stats", "error", err)
+			apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+			return
+		}
+		stats = append(stats, storeStats...)
+	}
+	sources := mergeSourceStats(stats)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SourcesResponse{Sources: sources}); err != nil {
+		slog.Error("Failed to encode source stats", "error", err)
+	}
+}
+
+// mergeSourceStats combines stats reported for the same source by different
+// stores, sorted by source
+func mergeSourceStats(stats []*storage.SourceStats) []*storage.SourceStats {
+	bySource := make(map[string]*storage.SourceStats)
+	merged := []*storage.SourceStats{}
+	for _, s := range stats {
+		existing, ok := bySource[s.Source]
+		if !ok {
+			copied := *s
+			copied.Channels = append([]string{}, s.Channels...)
+			bySource[s.Source] = &copied
+			merged = append(merged, &copied)
+			continue
+		}
+
+		existing.Documents += s.Documents
+		existing.Channels = append(existing.Channels, s.Channels...)
+		if s.LastIngestedAt.After(existing.LastIngestedAt) {
+			existing.LastIngestedAt = s.LastIngestedAt
+		}
+	}
+
+	for _, s := range merged {
+		s.Channels = uniqueSorted(s.Channels)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Source < merged[j].Source })
+	return merged
+}
+
+// uniqueSorted sorts values and drops duplicates
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := []string{}
+	for _, value := range values {
+		if len(unique) == 0 || value != unique[len(unique)-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
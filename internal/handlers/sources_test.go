@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+)
+
+// mockSourceStatsStore aggregates its documents as GetSourceStats does in Postgres
+type mockSourceStatsStore struct {
+	documents []storage.Document
+	err       error
+}
+
+func (m *mockSourceStatsStore) GetSourceStats(ctx context.Context) ([]*storage.SourceStats, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	bySource := make(map[string]*storage.SourceStats)
+	channels := make(map[string]map[string]bool)
+	var stats []*storage.SourceStats
+	for _, doc := range m.documents {
+		source, ok := bySource[doc.Source]
+		if !ok {
+			source = &storage.SourceStats{Source: doc.Source, Channels: []string{}}
+			bySource[doc.Source] = source
+			channels[doc.Source] = make(map[string]bool)
+			stats = append(stats, source)
+		}
+		source.Documents++
+		if doc.ChannelID != "" && !channels[doc.Source][doc.ChannelID] {
+			channels[doc.Source][doc.ChannelID] = true
+			source.Channels = append(source.Channels, doc.ChannelID)
+		}
+		if doc.CreatedAt.After(source.LastIngestedAt) {
+			source.LastIngestedAt = doc.CreatedAt
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Source < stats[j].Source })
+	for _, source := range stats {
+		sort.Strings(source.Channels)
+	}
+	return stats, nil
+}
+
+func TestSourcesHandler_HandleSources(t *testing.T) {
+	monday := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.Add(24 * time.Hour)
+
+	store := &mockSourceStatsStore{documents: []storage.Document{
+		{ID: "s1", Source: "slack", ChannelID: "C2", CreatedAt: monday},
+		{ID: "s2", Source: "slack", ChannelID: "C1", CreatedAt: tuesday},
+		{ID: "s3", Source: "slack", ChannelID: "C2", CreatedAt: monday},
+		{ID: "p1", Source: "slab", CreatedAt: monday},
+	}}
+
+	rec := httptest.NewRecorder()
+	NewSourcesHandler(store).HandleSources(rec, httptest.NewRequest(http.MethodGet, "/api/sources", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var body SourcesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Sources) != 2 {
+		t.Fatalf("Expected 2 sources, got %d", len(body.Sources))
+	}
+
+	slab, slack := body.Sources[0], body.Sources[1]
+	if slab.Source != "slab" || slab.Documents != 1 || len(slab.Channels) != 0 || !slab.LastIngestedAt.Equal(monday) {
+		t.Errorf("Unexpected slab stats: %+v", slab)
+	}
+	if slack.Source != "slack" || slack.Documents != 3 || !slack.LastIngestedAt.Equal(tuesday) {
+		t.Errorf("Unexpected slack stats: %+v", slack)
+	}
+	if len(slack.Channels) != 2 || slack.Channels[0] != "C1" || slack.Channels[1] != "C2" {
+		t.Errorf("Expected channels [C1 C2], got %v", slack.Channels)
+	}
+}
+
+func TestSourcesHandler_MergesStores(t *testing.T) {
+	monday := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.Add(24 * time.Hour)
+
+	// Slack messages and Slack canvases are stored in different tables
+	messages := &mockSourceStatsStore{documents: []storage.Document{
+		{ID: "m1", Source: "slack", ChannelID: "C1", CreatedAt: monday},
+		{ID: "m2", Source: "slack", ChannelID: "C2", CreatedAt: monday},
+	}}
+	documents := &mockSourceStatsStore{documents: []storage.Document{
+		{ID: "canvas", Source: "slack", ChannelID: "C2", CreatedAt: tuesday},
+		{ID: "page", Source: "notion", CreatedAt: monday},
+	}}
+
+	rec := httptest.NewRecorder()
+	NewSourcesHandler(messages, documents).HandleSources(rec, httptest.NewRequest(http.MethodGet, "/api/sources", nil))
+
+	var body SourcesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Sources) != 2 || body.Sources[0].Source != "notion" || body.Sources[1].Source != "slack" {
+		t.Fatalf("Expected notion and slack stats, got %+v", body.Sources)
+	}
+
+	slack := body.Sources[1]
+	if slack.Documents != 3 || !slack.LastIngestedAt.Equal(tuesday) {
+		t.Errorf("Expected 3 slack documents last ingested %v, got %+v", tuesday, slack)
+	}
+	if len(slack.Channels) != 2 || slack.Channels[0] != "C1" || slack.Channels[1] != "C2" {
+		t.Errorf("Expected channels [C1 C2], got %v", slack.Channels)
+	}
+}
+
+func TestSourcesHandler_HandleSourcesEmpty(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewSourcesHandler(&mockSourceStatsStore{}).HandleSources(rec, httptest.NewRequest(http.MethodGet, "/api/sources", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != "{\"sources\":[]}\n" {
+		t.Errorf("Expected an empty source list, got %s", body)
+	}
+}
+
+func TestSourcesHandler_HandleSourcesStoreError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewSourcesHandler(&mockSourceStatsStore{err: errors.New("connection refused")}).HandleSources(rec, httptest.NewRequest(http.MethodGet, "/api/sources", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+}
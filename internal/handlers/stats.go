@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"knowthis/internal/apierror"
+)
+
+// StatsProvider reports background processing statistics
+type StatsProvider interface {
+	GetStats(ctx context.Context) (map[string]interface{}, error)
+}
+
+type StatsHandler struct {
+	stats StatsProvider
+}
+
+func NewStatsHandler(stats StatsProvider) *StatsHandler {
+	return &StatsHandler{stats: stats}
+}
+
+// HandleStats returns the embedding processor's backlog, batch size and interval
+func (h *StatsHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	stats, err := h.stats.GetStats(ctx)
+	if err != nil {
+		slog.Error("Failed to get embedding stats", "error", err)
+		apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		slog.Error("Failed to encode embedding stats", "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"knowthis/internal/jobs"
+	"knowthis/internal/storage"
+)
+
+// mockStore is a document store holding documents in memory
+type mockStore struct {
+	documents []storage.Document
+	stored    []storage.Document
+}
+
+func (m *mockStore) StoreDocument(ctx context.Context, doc *storage.Document) error {
+	m.stored = append(m.stored, *doc)
+	return nil
+}
+
+func (m *mockStore) UpdateEmbedding(ctx context.Context, documentID string, embedding []float32) error {
+	return nil
+}
+
+func (m *mockStore) SearchSimilar(ctx context.Context, embedding []float32, limit int) ([]*storage.Document, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetDocumentsWithoutEmbeddings(ctx context.Context, limit int) ([]*storage.Document, error) {
+	var documents []*storage.Document
+	for i := range m.documents {
+		if m.documents[i].Embedding == nil && len(documents) < limit {
+			documents = append(documents, &m.documents[i])
+		}
+	}
+	return documents, nil
+}
+
+func (m *mockStore) CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error) {
+	count := 0
+	for i := range m.documents {
+		if m.documents[i].Embedding == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockStore) GetDocument(ctx context.Context, id string) (*storage.Document, error) {
+	for i := range m.documents {
+		if m.documents[i].ID == id {
+			return &m.documents[i], nil
+		}
+	}
+	return nil, storage.ErrDocumentNotFound
+}
+
+func (m *mockStore) DeleteDocument(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *mockStore) Close() error {
+	return nil
+}
+
+func TestStatsHandler_ReportsEmbeddingBacklog(t *testing.T) {
+	store := &mockStore{}
+	for i := 0; i < 7; i++ {
+		store.documents = append(store.documents, storage.Document{ID: fmt.Sprintf("pending_%d", i)})
+	}
+	store.documents = append(store.documents, storage.Document{ID: "embedded", Embedding: []float32{0.1}})
+
+	handler := NewStatsHandler(jobs.NewEmbeddingProcessor(store, nil))
+
+	rec := httptest.NewRecorder()
+	handler.HandleStats(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["documents_without_embeddings"] != float64(7) {
+		t.Errorf("Expected a backlog of 7, got %v", body["documents_without_embeddings"])
+	}
+	if body["batch_size"] != float64(10) {
+		t.Errorf("Expected batch size 10, got %v", body["batch_size"])
+	}
+	if body["processing_interval"] != "1m0s" {
+		t.Errorf("Expected processing interval 1m0s, got %v", body["processing_interval"])
+	}
+}
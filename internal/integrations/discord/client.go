@@ -0,0 +1,136 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// apiBaseURL is the Discord REST API the client calls
+const apiBaseURL = "https://discord.com/api/v10"
+
+// maxErrorBody bounds how much of an error response is included in errors
+const maxErrorBody = 512
+
+// discordAPI is the subset of the Discord REST API used by the handler
+type discordAPI interface {
+	GetChannel(ctx context.Context, channelID string) (*Channel, error)
+	GetMessage(ctx context.Context, channelID, messageID string) (*Message, error)
+	GetMessages(ctx context.Context, channelID string, params MessagesParams) ([]Message, error)
+	CreateFollowupMessage(ctx context.Context, applicationID, interactionToken, content string) error
+}
+
+// Client calls the Discord REST API as a bot
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	botToken   string
+}
+
+// NewClient creates a Discord API client authenticating with the bot token
+func NewClient(botToken string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		baseURL:    apiBaseURL,
+		botToken:   botToken,
+	}
+}
+
+// GetChannel returns the channel or thread
+func (c *Client) GetChannel(ctx context.Context, channelID string) (*Channel, error) {
+	var channel Channel
+	if err := c.do(ctx, http.MethodGet, "/channels/"+url.PathEscape(channelID), nil, &channel); err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+	return &channel, nil
+}
+
+// GetMessage returns a single message
+func (c *Client) GetMessage(ctx context.Context, channelID, messageID string) (*Message, error) {
+	var message Message
+	path := fmt.Sprintf("/channels/%s/messages/%s", url.PathEscape(channelID), url.PathEscape(messageID))
+	if err := c.do(ctx, http.MethodGet, path, nil, &message); err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return &message, nil
+}
+
+// GetMessages returns up to params.Limit (at most 100) messages of the
+// channel, newest first
+func (c *Client) GetMessages(ctx context.Context, channelID string, params MessagesParams) ([]Message, error) {
+	query := url.Values{}
+	if params.Around != "" {
+		query.Set("around", params.Around)
+	}
+	if params.Limit > 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+
+	path := fmt.Sprintf("/channels/%s/messages", url.PathEscape(channelID))
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var messages []Message
+	if err := c.do(ctx, http.MethodGet, path, nil, &messages); err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return messages, nil
+}
+
+// CreateFollowupMessage posts an ephemeral follow-up to an interaction. The
+// interaction token authenticates the request, for up to 15 minutes.
+func (c *Client) CreateFollowupMessage(ctx context.Context, applicationID, interactionToken, content string) error {
+	body := interactionResponseData{Content: content, Flags: messageFlagEphemeral}
+	path := fmt.Sprintf("/webhooks/%s/%s", url.PathEscape(applicationID), url.PathEscape(interactionToken))
+	if err := c.do(ctx, http.MethodPost, path, body, nil); err != nil {
+		return fmt.Errorf("failed to create follow-up message: %w", err)
+	}
+	return nil
+}
+
+// do sends a request with an optional JSON body and decodes a JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bot "+c.botToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("discord API returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/middleware"
+	"knowthis/internal/storage"
+)
+
+// CollectContextCommand is the name of the message command that collects a thread
+const CollectContextCommand = "Collect Context"
+
+// maxThreadMessages is the most messages fetched from a thread, as for Slack threads
+const maxThreadMessages = 100
+
+// defaultContextMessages is how many messages around the target are
+// collected in a channel without threads
+const defaultContextMessages = 25
+
+// DocumentStore upserts documents by ID, re-embedding them when their content changes
+type DocumentStore interface {
+	ImportDocument(ctx context.Context, doc *storage.Document) (bool, error)
+}
+
+// DiscordHandler collects Discord threads into the knowledge base
+type DiscordHandler struct {
+	client discordAPI
+	store  DocumentStore
+
+	// Messages collected around the target message outside threads
+	contextMessages int
+}
+
+// NewDiscordHandler creates a handler collecting threads with the bot token
+func NewDiscordHandler(botToken string, store DocumentStore) *DiscordHandler {
+	return &DiscordHandler{
+		client:          NewClient(botToken),
+		store:           store,
+		contextMessages: defaultContextMessages,
+	}
+}
+
+// SetContextMessages sets how many messages around the target message are
+// collected when it isn't part of a thread
+func (h *DiscordHandler) SetContextMessages(count int) {
+	if count > 0 && count <= maxThreadMessages {
+		h.contextMessages = count
+		slog.Info("Updated Discord context messages", "count", count)
+	}
+}
+
+// HandleInteraction handles Discord interactions: the endpoint verification
+// ping and the collect context message command. Requests must already be
+// verified by DiscordSignatureMiddleware.
+func (h *DiscordHandler) HandleInteraction(w http.ResponseWriter, r *http.Request) {
+	var interaction Interaction
+	if err := json.NewDecoder(r.Body).Decode(&interaction); err != nil {
+		slog.Error("Failed to parse Discord interaction", "error", err)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Invalid payload")
+		return
+	}
+
+	switch interaction.Type {
+	case interactionTypePing:
+		writeInteractionResponse(w, interactionResponse{Type: responseTypePong})
+
+	case interactionTypeApplicationCommand:
+		data := interaction.Data
+		if data == nil || data.Type != commandTypeMessage || data.Name != CollectContextCommand {
+			slog.Warn("Unknown Discord command received", "interaction_id", interaction.ID)
+			writeEphemeral(w, "ℹ️ Unknown command.")
+			return
+		}
+
+		if target, ok := data.Resolved.Messages[data.TargetID]; ok && target.Author.Bot {
+			slog.Info("Command used on bot message, skipping", "message_id", data.TargetID)
+			writeEphemeral(w, "ℹ️ Cannot collect context from bot messages. Please use this command on human messages.")
+			return
+		}
+
+		// Collecting can outlast Discord's 3 second response deadline; the
+		// request's concurrency slot is held until it's done
+		release := middleware.HoldConcurrencySlot(r.Context())
+		go func() {
+			defer release()
+			h.collectInteraction(interaction)
+		}()
+
+		writeEphemeral(w, "✅ Collecting thread context for knowledge base...")
+
+	default:
+		slog.Warn("Unknown Discord interaction type", "type", interaction.Type)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Unsupported interaction type")
+	}
+}
+
+// collectInteraction collects the command's target thread and reports the
+// outcome to the user in a follow-up message
+func (h *DiscordHandler) collectInteraction(interaction Interaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	message := "❌ Failed to process thread. Please try again."
+	count, err := h.CollectThread(ctx, interaction.ChannelID, interaction.Data.TargetID)
+	if err != nil {
+		slog.Error("Failed to collect Discord thread", "error", err, "channel", interaction.ChannelID, "message_id", interaction.Data.TargetID)
+	} else {
+		message = fmt.Sprintf("✅ Stored %d messages from thread in knowledge base", count)
+	}
+
+	if err := h.client.CreateFollowupMessage(ctx, interaction.ApplicationID, interaction.Token, message); err != nil {
+		slog.Error("Failed to send Discord follow-up", "error", err)
+	}
+}
+
+// CollectThread stores the conversation around a message as one document and
+// returns how many messages it holds. In a thread, or for a message that
+// started one, that is the whole thread; otherwise the messages around it.
+func (h *DiscordHandler) CollectThread(ctx context.Context, channelID, messageID string) (int, error) {
+	channel, err := h.client.GetChannel(ctx, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	threadID, messages, err := h.threadMessages(ctx, channel, messageID)
+	if err != nil {
+		return 0, err
+	}
+
+	doc := threadToDocument(channelID, threadID, messages)
+	if doc == nil {
+		return 0, fmt.Errorf("no meaningful content in thread")
+	}
+
+	if _, err := h.store.ImportDocument(ctx, doc); err != nil {
+		return 0, fmt.Errorf("failed to store thread document: %w", err)
+	}
+
+	slog.Info("Stored Discord thread", "channel", channelID, "thread_id", threadID, "document_id", doc.ID)
+	return len(collectableMessages(messages)), nil
+}
+
+// threadMessages fetches the conversation a message belongs to and the ID
+// identifying it
+func (h *DiscordHandler) threadMessages(ctx context.Context, channel *Channel, messageID string) (string, []Message, error) {
+	if channel.IsThread() {
+		messages, err := h.client.GetMessages(ctx, channel.ID, MessagesParams{Limit: maxThreadMessages})
+		if err != nil {
+			return "", nil, err
+		}
+
+		// A thread started from a message shares its ID, and the message
+		// lives in the parent channel
+		if channel.ParentID != "" {
+			if starter, err := h.client.GetMessage(ctx, channel.ParentID, channel.ID); err == nil {
+				messages = append(messages, *starter)
+			} else {
+				slog.Debug("No thread starter message", "thread_id", channel.ID, "error", err)
+			}
+		}
+		return channel.ID, messages, nil
+	}
+
+	target, err := h.client.GetMessage(ctx, channel.ID, messageID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if target.Thread != nil {
+		messages, err := h.client.GetMessages(ctx, target.Thread.ID, MessagesParams{Limit: maxThreadMessages})
+		if err != nil {
+			return "", nil, err
+		}
+		return target.Thread.ID, append(messages, *target), nil
+	}
+
+	messages, err := h.client.GetMessages(ctx, channel.ID, MessagesParams{Around: messageID, Limit: h.contextMessages})
+	if err != nil {
+		return "", nil, err
+	}
+	return messageID, messages, nil
+}
+
+// collectableMessages returns the user-written messages worth storing, oldest
+// first, with mentions removed. Bot, system and very short messages are
+// skipped as for Slack threads.
+func collectableMessages(messages []Message) []Message {
+	seen := make(map[string]bool)
+	var collected []Message
+	for _, msg := range messages {
+		if seen[msg.ID] || msg.Author.Bot {
+			continue
+		}
+		if msg.Type != messageTypeDefault && msg.Type != messageTypeReply {
+			continue
+		}
+		seen[msg.ID] = true
+
+		msg.Content = slack.CleanMessageText(msg.Content)
+		if len(msg.Content) < slack.MinMessageChars {
+			continue
+		}
+		collected = append(collected, msg)
+	}
+
+	sort.SliceStable(collected, func(i, j int) bool {
+		return collected[i].Timestamp.Before(collected[j].Timestamp)
+	})
+	return collected
+}
+
+// threadToDocument converts a conversation into a document, or nil when no
+// message is worth storing
+func threadToDocument(channelID, threadID string, messages []Message) *storage.Document {
+	collected := collectableMessages(messages)
+	if len(collected) == 0 {
+		return nil
+	}
+
+	var content strings.Builder
+	var participants []string
+	participantSet := make(map[string]bool)
+	for _, msg := range collected {
+		name := msg.Author.DisplayName()
+		if !participantSet[msg.Author.ID] {
+			participantSet[msg.Author.ID] = true
+			participants = append(participants, name)
+		}
+		fmt.Fprintf(&content, "%s: %s\n", name, msg.Content)
+	}
+
+	root := collected[0]
+	title := root.Content
+	if runes := []rune(title); len(runes) > 50 {
+		title = string(runes[:50]) + "..."
+	}
+
+	finalContent := strings.TrimSpace(content.String())
+	return &storage.Document{
+		ID:          fmt.Sprintf("discord_thread_%s_%s", channelID, threadID),
+		Content:     finalContent,
+		Source:      Source,
+		SourceID:    threadID,
+		Title:       title,
+		ChannelID:   channelID,
+		UserID:      root.Author.ID,
+		UserName:    strings.Join(participants, ", "),
+		Timestamp:   root.Timestamp,
+		ContentHash: storage.HashContent(finalContent),
+	}
+}
+
+// writeEphemeral replies to an interaction with a message only the user sees
+func writeEphemeral(w http.ResponseWriter, content string) {
+	writeInteractionResponse(w, interactionResponse{
+		Type: responseTypeChannelMessage,
+		Data: &interactionResponseData{Content: content, Flags: messageFlagEphemeral},
+	})
+}
+
+func writeInteractionResponse(w http.ResponseWriter, response interactionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode Discord interaction response", "error", err)
+	}
+}
@@ -0,0 +1,324 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+)
+
+// Mock Discord client for handler tests
+type mockDiscordClient struct {
+	mu sync.Mutex
+
+	channels map[string]*Channel
+	messages map[string][]Message // by channel ID, newest first
+
+	messageParams []MessagesParams
+	followups     []string
+}
+
+func (m *mockDiscordClient) GetChannel(ctx context.Context, channelID string) (*Channel, error) {
+	if c, ok := m.channels[channelID]; ok {
+		return c, nil
+	}
+	return nil, errors.New("unknown channel")
+}
+
+func (m *mockDiscordClient) GetMessage(ctx context.Context, channelID, messageID string) (*Message, error) {
+	for _, msg := range m.messages[channelID] {
+		if msg.ID == messageID {
+			return &msg, nil
+		}
+	}
+	return nil, errors.New("unknown message")
+}
+
+func (m *mockDiscordClient) GetMessages(ctx context.Context, channelID string, params MessagesParams) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messageParams = append(m.messageParams, params)
+	return m.messages[channelID], nil
+}
+
+func (m *mockDiscordClient) CreateFollowupMessage(ctx context.Context, applicationID, interactionToken, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.followups = append(m.followups, content)
+	return nil
+}
+
+type mockDocumentStore struct {
+	mu   sync.Mutex
+	docs []*storage.Document
+}
+
+func (m *mockDocumentStore) ImportDocument(ctx context.Context, doc *storage.Document) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.docs = append(m.docs, doc)
+	return true, nil
+}
+
+var baseTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testMessage(id, channelID, authorID, content string, minute int) Message {
+	return Message{
+		ID:        id,
+		ChannelID: channelID,
+		Content:   content,
+		Author:    User{ID: authorID, Username: strings.ToLower(authorID)},
+		Timestamp: baseTime.Add(time.Duration(minute) * time.Minute),
+	}
+}
+
+func newTestHandler(client *mockDiscordClient) (*DiscordHandler, *mockDocumentStore) {
+	store := &mockDocumentStore{}
+	return &DiscordHandler{client: client, store: store, contextMessages: defaultContextMessages}, store
+}
+
+func TestCollectThread_InThread(t *testing.T) {
+	bot := testMessage("M5", "T1", "BOT", "Deploy finished successfully", 5)
+	bot.Author.Bot = true
+	system := testMessage("M6", "T1", "U1", "Someone pinned a message here", 6)
+	system.Type = 6
+	reply := testMessage("M3", "T1", "U2", "<@U1> restart the worker pool first", 3)
+	reply.Type = messageTypeReply
+	reply.Author.GlobalName = "Bob"
+
+	client := &mockDiscordClient{
+		channels: map[string]*Channel{
+			"T1": {ID: "T1", Type: channelTypePublicThread, ParentID: "C1"},
+		},
+		messages: map[string][]Message{
+			"T1": {system, bot, testMessage("M4", "T1", "U1", "ok", 4), reply, testMessage("M2", "T1", "U1", "Which service is failing?", 2)},
+			"C1": {testMessage("T1", "C1", "U3", "Deploys are failing on staging", 1)},
+		},
+	}
+	handler, store := newTestHandler(client)
+
+	count, err := handler.CollectThread(context.Background(), "T1", "M3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 collected messages, got %d", count)
+	}
+	if len(store.docs) != 1 {
+		t.Fatalf("Expected 1 stored document, got %d", len(store.docs))
+	}
+
+	doc := store.docs[0]
+	wantContent := "u3: Deploys are failing on staging\nu1: Which service is failing?\nBob: restart the worker pool first"
+	if doc.Content != wantContent {
+		t.Errorf("Unexpected content:\n%s\nwant:\n%s", doc.Content, wantContent)
+	}
+	if doc.ID != "discord_thread_T1_T1" || doc.Source != Source || doc.SourceID != "T1" {
+		t.Errorf("Unexpected document identity: id=%s source=%s source_id=%s", doc.ID, doc.Source, doc.SourceID)
+	}
+	if doc.UserID != "U3" || doc.UserName != "u3, u1, Bob" {
+		t.Errorf("Expected the starter as author and all participants, got %s / %s", doc.UserID, doc.UserName)
+	}
+	if doc.Title != "Deploys are failing on staging" || !doc.Timestamp.Equal(baseTime.Add(time.Minute)) {
+		t.Errorf("Unexpected title or timestamp: %q %v", doc.Title, doc.Timestamp)
+	}
+	if doc.ContentHash != storage.HashContent(wantContent) {
+		t.Error("Expected the content hash to match the content")
+	}
+	if len(client.messageParams) != 1 || client.messageParams[0].Limit != maxThreadMessages || client.messageParams[0].Around != "" {
+		t.Errorf("Expected the whole thread to be fetched, got %+v", client.messageParams)
+	}
+}
+
+func TestCollectThread_MessageStartingThread(t *testing.T) {
+	starter := testMessage("M1", "C1", "U1", "Why is the cache hit rate dropping?", 1)
+	starter.Thread = &Channel{ID: "M1", Type: channelTypePublicThread, ParentID: "C1"}
+
+	client := &mockDiscordClient{
+		channels: map[string]*Channel{"C1": {ID: "C1", Type: 0}},
+		messages: map[string][]Message{
+			"C1": {starter},
+			"M1": {testMessage("M2", "M1", "U2", "The TTL was lowered yesterday", 2)},
+		},
+	}
+	handler, store := newTestHandler(client)
+
+	count, err := handler.CollectThread(context.Background(), "C1", "M1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 2 || len(store.docs) != 1 {
+		t.Fatalf("Expected 2 messages in 1 document, got %d in %d", count, len(store.docs))
+	}
+	if doc := store.docs[0]; doc.ID != "discord_thread_C1_M1" || !strings.HasPrefix(doc.Content, "u1: Why is the cache") {
+		t.Errorf("Expected the thread with its starter first, got %s: %q", doc.ID, doc.Content)
+	}
+}
+
+func TestCollectThread_AroundMessageOutsideThreads(t *testing.T) {
+	client := &mockDiscordClient{
+		channels: map[string]*Channel{"C1": {ID: "C1", Type: 0}},
+		messages: map[string][]Message{
+			"C1": {
+				testMessage("M3", "C1", "U1", "Thanks, that fixed the build", 3),
+				testMessage("M2", "C1", "U2", "Clear the module cache and retry", 2),
+			},
+		},
+	}
+	handler, store := newTestHandler(client)
+	handler.SetContextMessages(10)
+
+	if _, err := handler.CollectThread(context.Background(), "C1", "M2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.messageParams) != 1 || client.messageParams[0] != (MessagesParams{Around: "M2", Limit: 10}) {
+		t.Errorf("Expected messages around the target, got %+v", client.messageParams)
+	}
+	if doc := store.docs[0]; doc.ID != "discord_thread_C1_M2" || doc.Title != "Clear the module cache and retry" {
+		t.Errorf("Unexpected document %s titled %q", doc.ID, doc.Title)
+	}
+}
+
+func TestCollectThread_NoMeaningfulContent(t *testing.T) {
+	client := &mockDiscordClient{
+		channels: map[string]*Channel{"C1": {ID: "C1", Type: 0}},
+		messages: map[string][]Message{"C1": {testMessage("M1", "C1", "U1", "+1", 1)}},
+	}
+	handler, store := newTestHandler(client)
+
+	if _, err := handler.CollectThread(context.Background(), "C1", "M1"); err == nil {
+		t.Error("Expected an error for a conversation with nothing worth storing")
+	}
+	if len(store.docs) != 0 {
+		t.Errorf("Expected nothing stored, got %d documents", len(store.docs))
+	}
+}
+
+func TestHandleInteraction(t *testing.T) {
+	botMessage := testMessage("M1", "C1", "BOT", "Build finished", 1)
+	botMessage.Author.Bot = true
+
+	tests := []struct {
+		name        string
+		interaction Interaction
+		wantStatus  int
+		wantType    int
+		wantContent string
+		wantCollect bool
+	}{
+		{
+			name:        "ping",
+			interaction: Interaction{Type: interactionTypePing},
+			wantStatus:  http.StatusOK,
+			wantType:    responseTypePong,
+		},
+		{
+			name: "collect context",
+			interaction: Interaction{Type: interactionTypeApplicationCommand, ChannelID: "C1", Token: "tok",
+				Data: &InteractionData{Name: CollectContextCommand, Type: commandTypeMessage, TargetID: "M2"}},
+			wantStatus:  http.StatusOK,
+			wantType:    responseTypeChannelMessage,
+			wantContent: "Collecting thread context",
+			wantCollect: true,
+		},
+		{
+			name: "bot message target",
+			interaction: func() Interaction {
+				data := &InteractionData{Name: CollectContextCommand, Type: commandTypeMessage, TargetID: "M1"}
+				data.Resolved.Messages = map[string]Message{"M1": botMessage}
+				return Interaction{Type: interactionTypeApplicationCommand, ChannelID: "C1", Data: data}
+			}(),
+			wantStatus:  http.StatusOK,
+			wantType:    responseTypeChannelMessage,
+			wantContent: "Cannot collect context from bot messages",
+		},
+		{
+			name: "unknown command",
+			interaction: Interaction{Type: interactionTypeApplicationCommand,
+				Data: &InteractionData{Name: "Other", Type: commandTypeMessage}},
+			wantStatus:  http.StatusOK,
+			wantType:    responseTypeChannelMessage,
+			wantContent: "Unknown command",
+		},
+		{
+			name:        "unsupported interaction type",
+			interaction: Interaction{Type: 5},
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockDiscordClient{
+				channels: map[string]*Channel{"C1": {ID: "C1", Type: 0}},
+				messages: map[string][]Message{
+					"C1": {testMessage("M2", "C1", "U1", "The migration needs a lock timeout", 2)},
+				},
+			}
+			handler, store := newTestHandler(client)
+
+			body, _ := json.Marshal(tt.interaction)
+			rec := httptest.NewRecorder()
+			handler.HandleInteraction(rec, httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(string(body))))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp interactionResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Type != tt.wantType {
+				t.Errorf("Expected response type %d, got %d", tt.wantType, resp.Type)
+			}
+			if tt.wantContent != "" {
+				if resp.Data == nil || !strings.Contains(resp.Data.Content, tt.wantContent) || resp.Data.Flags != messageFlagEphemeral {
+					t.Errorf("Expected an ephemeral reply containing %q, got %+v", tt.wantContent, resp.Data)
+				}
+			}
+
+			// Collection finishes in the background with a follow-up
+			deadline := time.Now().Add(time.Second)
+			for tt.wantCollect && time.Now().Before(deadline) {
+				client.mu.Lock()
+				done := len(client.followups) > 0
+				client.mu.Unlock()
+				if done {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if !tt.wantCollect {
+				if len(client.followups) != 0 || len(store.docs) != 0 {
+					t.Errorf("Expected no collection, got %d follow-ups and %d documents", len(client.followups), len(store.docs))
+				}
+				return
+			}
+			if len(client.followups) != 1 || !strings.Contains(client.followups[0], "Stored 1 messages") {
+				t.Errorf("Expected a success follow-up, got %v", client.followups)
+			}
+			if len(store.docs) != 1 {
+				t.Errorf("Expected 1 stored document, got %d", len(store.docs))
+			}
+		})
+	}
+}
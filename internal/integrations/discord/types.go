@@ -0,0 +1,116 @@
+package discord
+
+import "time"
+
+// Source is the document source of collected Discord threads
+const Source = "discord"
+
+// Channel types that are threads
+const (
+	channelTypeAnnouncementThread = 10
+	channelTypePublicThread       = 11
+	channelTypePrivateThread      = 12
+)
+
+// Message types that carry user-written content
+const (
+	messageTypeDefault = 0
+	messageTypeReply   = 19
+)
+
+// Interaction and response types used by the collect command
+const (
+	interactionTypePing               = 1
+	interactionTypeApplicationCommand = 2
+
+	commandTypeMessage = 3
+
+	responseTypePong           = 1
+	responseTypeChannelMessage = 4
+	messageFlagEphemeral       = 64
+)
+
+// Channel is a Discord channel or thread
+type Channel struct {
+	ID       string `json:"id"`
+	Type     int    `json:"type"`
+	ParentID string `json:"parent_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// IsThread reports whether the channel is a thread
+func (c *Channel) IsThread() bool {
+	switch c.Type {
+	case channelTypeAnnouncementThread, channelTypePublicThread, channelTypePrivateThread:
+		return true
+	}
+	return false
+}
+
+// User is a Discord message author
+type User struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name,omitempty"`
+	Bot        bool   `json:"bot,omitempty"`
+}
+
+// DisplayName returns the user's display name, falling back to the username
+func (u User) DisplayName() string {
+	if u.GlobalName != "" {
+		return u.GlobalName
+	}
+	return u.Username
+}
+
+// Message is a Discord message
+type Message struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	Type      int       `json:"type"`
+	Content   string    `json:"content"`
+	Author    User      `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// The thread started from this message, if any
+	Thread *Channel `json:"thread,omitempty"`
+}
+
+// MessagesParams selects the messages returned by GetMessages; an empty
+// Around returns the most recent messages
+type MessagesParams struct {
+	Around string
+	Limit  int
+}
+
+// Interaction is an interaction webhook payload
+type Interaction struct {
+	ID            string           `json:"id"`
+	ApplicationID string           `json:"application_id"`
+	Type          int              `json:"type"`
+	Token         string           `json:"token"`
+	ChannelID     string           `json:"channel_id"`
+	Data          *InteractionData `json:"data,omitempty"`
+}
+
+// InteractionData is the invoked command and, for message commands, the
+// target message
+type InteractionData struct {
+	Name     string `json:"name"`
+	Type     int    `json:"type"`
+	TargetID string `json:"target_id,omitempty"`
+	Resolved struct {
+		Messages map[string]Message `json:"messages,omitempty"`
+	} `json:"resolved"`
+}
+
+// interactionResponse is the immediate reply to an interaction
+type interactionResponse struct {
+	Type int                      `json:"type"`
+	Data *interactionResponseData `json:"data,omitempty"`
+}
+
+type interactionResponseData struct {
+	Content string `json:"content"`
+	Flags   int    `json:"flags,omitempty"`
+}
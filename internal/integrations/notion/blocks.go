@@ -0,0 +1,162 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxBlockDepth bounds how deeply nested block children are fetched
+const maxBlockDepth = 5
+
+// BlockFetcher returns all direct children of a page or block
+type BlockFetcher interface {
+	GetBlockChildren(ctx context.Context, blockID string) ([]Block, error)
+}
+
+// FetchBlocks returns the page's blocks with their nested children. Child
+// pages and databases are left out; they are pages of their own.
+func FetchBlocks(ctx context.Context, fetcher BlockFetcher, pageID string) ([]Block, error) {
+	return fetchBlocks(ctx, fetcher, pageID, 0)
+}
+
+func fetchBlocks(ctx context.Context, fetcher BlockFetcher, blockID string, depth int) ([]Block, error) {
+	blocks, err := fetcher.GetBlockChildren(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range blocks {
+		block := &blocks[i]
+		if !block.HasChildren || depth+1 >= maxBlockDepth || block.Type == "child_page" || block.Type == "child_database" {
+			continue
+		}
+		if block.Children, err = fetchBlocks(ctx, fetcher, block.ID, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// FlattenBlocks renders blocks as plain text, one block per line with nested
+// blocks indented. Headings start a new paragraph, list items and to-dos keep
+// their markers, table cells are separated by " | " and code is kept verbatim.
+func FlattenBlocks(blocks []Block) string {
+	var out strings.Builder
+	flattenBlocks(&out, blocks, 0)
+	return strings.TrimSpace(out.String())
+}
+
+func flattenBlocks(out *strings.Builder, blocks []Block, depth int) {
+	indent := strings.Repeat("  ", depth)
+	number := 0
+	for _, block := range blocks {
+		if block.Type == "numbered_list_item" {
+			number++
+		} else {
+			number = 0
+		}
+
+		if line := blockText(block, number); line != "" {
+			if strings.HasPrefix(block.Type, "heading_") && out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			for _, l := range strings.Split(line, "\n") {
+				out.WriteString(indent + l + "\n")
+			}
+		}
+
+		flattenBlocks(out, block.Children, depth+1)
+	}
+}
+
+// blockText returns a block's own text, without its children; number is the
+// block's position in a numbered list
+func blockText(block Block, number int) string {
+	switch block.Type {
+	case "paragraph":
+		return richText(block.Paragraph)
+	case "heading_1":
+		return richText(block.Heading1)
+	case "heading_2":
+		return richText(block.Heading2)
+	case "heading_3":
+		return richText(block.Heading3)
+	case "quote":
+		return richText(block.Quote)
+	case "callout":
+		return richText(block.Callout)
+	case "toggle":
+		return richText(block.Toggle)
+	case "bulleted_list_item":
+		return withMarker("- ", richText(block.BulletedListItem))
+	case "numbered_list_item":
+		return withMarker(fmt.Sprintf("%d. ", number), richText(block.NumberedListItem))
+	case "to_do":
+		if block.ToDo == nil {
+			return ""
+		}
+		marker := "[ ] "
+		if block.ToDo.Checked {
+			marker = "[x] "
+		}
+		return withMarker(marker, richText(block.ToDo))
+	case "code":
+		if block.Code == nil {
+			return ""
+		}
+		return strings.TrimRight(plainText(block.Code.RichText), "\n")
+	case "table_row":
+		if block.TableRow == nil {
+			return ""
+		}
+		cells := make([]string, len(block.TableRow.Cells))
+		for i, cell := range block.TableRow.Cells {
+			cells[i] = cleanNotionText(plainText(cell))
+		}
+		return strings.TrimSpace(strings.Join(cells, " | "))
+	case "child_page":
+		if block.ChildPage == nil {
+			return ""
+		}
+		return cleanNotionText(block.ChildPage.Title)
+	}
+	return ""
+}
+
+func richText(block *TextBlock) string {
+	if block == nil {
+		return ""
+	}
+	return cleanNotionText(plainText(block.RichText))
+}
+
+func plainText(runs []RichText) string {
+	var text strings.Builder
+	for _, run := range runs {
+		text.WriteString(run.PlainText)
+	}
+	return text.String()
+}
+
+func withMarker(marker, text string) string {
+	if text == "" {
+		return ""
+	}
+	return marker + text
+}
+
+var (
+	markdownLinkPattern     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownEmphasisPattern = regexp.MustCompile("\\*\\*|__|~~|`")
+	whitespacePattern       = regexp.MustCompile(`\s+`)
+)
+
+// cleanNotionText strips markdown left in text typed or pasted into Notion,
+// keeping link text, and collapses whitespace
+func cleanNotionText(text string) string {
+	text = markdownLinkPattern.ReplaceAllString(text, "$1")
+	text = markdownEmphasisPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+}
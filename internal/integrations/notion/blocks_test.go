@@ -0,0 +1,135 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func text(s string) *TextBlock {
+	return &TextBlock{RichText: []RichText{{PlainText: s}}}
+}
+
+func TestFlattenBlocks(t *testing.T) {
+	blocks := []Block{
+		{Type: "heading_1", Heading1: text("Restarting the worker pool")},
+		{Type: "paragraph", Paragraph: &TextBlock{RichText: []RichText{
+			{PlainText: "Use this when **queues** back up. See "},
+			{PlainText: "[the dashboard](https://grafana.example.com)"},
+			{PlainText: " first."},
+		}}},
+		{Type: "numbered_list_item", NumberedListItem: text("Drain the queue"),
+			Children: []Block{
+				{Type: "bulleted_list_item", BulletedListItem: text("Pause `producers`")},
+			}},
+		{Type: "numbered_list_item", NumberedListItem: text("Restart workers")},
+		{Type: "code", Code: &TextBlock{RichText: []RichText{{PlainText: "kubectl rollout restart deploy/workers\n"}}, Language: "bash"}},
+		{Type: "divider"},
+		{Type: "heading_2", Heading2: text("Checklist")},
+		{Type: "to_do", ToDo: &TextBlock{RichText: []RichText{{PlainText: "Page on-call"}}, Checked: true}},
+		{Type: "to_do", ToDo: text("Update the incident doc")},
+		{Type: "paragraph", Paragraph: &TextBlock{}},
+		{Type: "table", Children: []Block{
+			{Type: "table_row", TableRow: &struct {
+				Cells [][]RichText `json:"cells"`
+			}{Cells: [][]RichText{{{PlainText: "Queue"}}, {{PlainText: "Limit"}}}}},
+		}},
+		{Type: "numbered_list_item", NumberedListItem: text("Numbering restarts after other blocks")},
+	}
+
+	want := "Restarting the worker pool\n" +
+		"Use this when queues back up. See the dashboard first.\n" +
+		"1. Drain the queue\n" +
+		"  - Pause producers\n" +
+		"2. Restart workers\n" +
+		"kubectl rollout restart deploy/workers\n" +
+		"\n" +
+		"Checklist\n" +
+		"[x] Page on-call\n" +
+		"[ ] Update the incident doc\n" +
+		"  Queue | Limit\n" +
+		"1. Numbering restarts after other blocks"
+
+	if got := FlattenBlocks(blocks); got != want {
+		t.Errorf("Unexpected text:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCleanNotionText(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"**bold** and __underline__ and ~~struck~~", "bold and underline and struck"},
+		{"see [runbook](https://example.com/a) and [docs](x)", "see runbook and docs"},
+		{"  spaced\n\tout  text ", "spaced out text"},
+		{"run `make deploy`", "run make deploy"},
+	}
+
+	for _, tc := range testCases {
+		if got := cleanNotionText(tc.input); got != tc.expected {
+			t.Errorf("cleanNotionText(%q) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+// mockBlockFetcher serves block children by parent ID, counting requests
+type mockBlockFetcher struct {
+	children map[string][]Block
+	calls    map[string]int
+}
+
+func (m *mockBlockFetcher) GetBlockChildren(ctx context.Context, blockID string) ([]Block, error) {
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[blockID]++
+
+	children, ok := m.children[blockID]
+	if !ok {
+		return nil, errors.New("object_not_found")
+	}
+	return children, nil
+}
+
+func TestFetchBlocks(t *testing.T) {
+	fetcher := &mockBlockFetcher{children: map[string][]Block{
+		"page": {
+			{ID: "toggle", Type: "toggle", HasChildren: true, Toggle: text("Details")},
+			{ID: "sub", Type: "child_page", HasChildren: true},
+			{ID: "para", Type: "paragraph", Paragraph: text("Top level")},
+		},
+		"toggle": {{ID: "nested", Type: "paragraph", HasChildren: true, Paragraph: text("Nested")}},
+		"nested": {{ID: "deep", Type: "paragraph", Paragraph: text("Deeper")}},
+	}}
+
+	blocks, err := FetchBlocks(context.Background(), fetcher, "page")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := FlattenBlocks(blocks); got != "Details\n  Nested\n    Deeper\nTop level" {
+		t.Errorf("Unexpected text %q", got)
+	}
+	if fetcher.calls["sub"] != 0 {
+		t.Error("Expected child pages not to be fetched")
+	}
+}
+
+func TestFetchBlocks_DepthLimit(t *testing.T) {
+	fetcher := &mockBlockFetcher{children: map[string][]Block{}}
+	parent := "page"
+	for depth := 0; depth < maxBlockDepth+2; depth++ {
+		id := fmt.Sprintf("block-%d", depth)
+		fetcher.children[parent] = []Block{{ID: id, Type: "paragraph", HasChildren: true, Paragraph: text(id)}}
+		parent = id
+	}
+
+	if _, err := FetchBlocks(context.Background(), fetcher, "page"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fetcher.calls) != maxBlockDepth {
+		t.Errorf("Expected %d levels fetched, got %d", maxBlockDepth, len(fetcher.calls))
+	}
+}
@@ -0,0 +1,103 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// apiBaseURL is the Notion REST API the client calls
+	apiBaseURL = "https://api.notion.com/v1"
+
+	// apiVersion is the Notion-Version the client's types follow
+	apiVersion = "2022-06-28"
+
+	// blockPageSize is the most block children Notion returns per request
+	blockPageSize = 100
+
+	// maxErrorBody bounds how much of an error response is included in errors
+	maxErrorBody = 512
+)
+
+// Client reads pages through the Notion REST API with an integration token
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewClient creates a Notion API client authenticating with the integration token
+func NewClient(token string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		baseURL:    apiBaseURL,
+		token:      token,
+	}
+}
+
+// GetPage returns the page's metadata
+func (c *Client) GetPage(ctx context.Context, pageID string) (*Page, error) {
+	var page Page
+	if err := c.get(ctx, "/pages/"+url.PathEscape(pageID), &page); err != nil {
+		return nil, fmt.Errorf("failed to get page: %w", err)
+	}
+	return &page, nil
+}
+
+// GetBlockChildren returns all direct children of a page or block, following
+// pagination
+func (c *Client) GetBlockChildren(ctx context.Context, blockID string) ([]Block, error) {
+	var blocks []Block
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Set("page_size", fmt.Sprint(blockPageSize))
+		if cursor != "" {
+			query.Set("start_cursor", cursor)
+		}
+
+		var list blockList
+		path := fmt.Sprintf("/blocks/%s/children?%s", url.PathEscape(blockID), query.Encode())
+		if err := c.get(ctx, path, &list); err != nil {
+			return nil, fmt.Errorf("failed to get block children: %w", err)
+		}
+
+		blocks = append(blocks, list.Results...)
+		if !list.HasMore || list.NextCursor == "" {
+			return blocks, nil
+		}
+		cursor = list.NextCursor
+	}
+}
+
+// get sends a GET request and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Notion-Version", apiVersion)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("notion API returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_GetBlockChildrenFollowsPagination(t *testing.T) {
+	var cursors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret_token" || r.Header.Get("Notion-Version") != apiVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/blocks/page-1/children" || r.URL.Query().Get("page_size") != "100" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		cursor := r.URL.Query().Get("start_cursor")
+		cursors = append(cursors, cursor)
+
+		list := blockList{Results: []Block{{ID: "b1", Type: "paragraph"}}, HasMore: true, NextCursor: "next"}
+		if cursor == "next" {
+			list = blockList{Results: []Block{{ID: "b2", Type: "paragraph"}}}
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+	defer server.Close()
+
+	client := NewClient("secret_token")
+	client.baseURL = server.URL
+
+	blocks, err := client.GetBlockChildren(context.Background(), "page-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].ID != "b1" || blocks[1].ID != "b2" {
+		t.Errorf("Expected blocks from both pages, got %+v", blocks)
+	}
+	if len(cursors) != 2 || cursors[0] != "" || cursors[1] != "next" {
+		t.Errorf("Expected a second request from the next cursor, got %v", cursors)
+	}
+}
@@ -0,0 +1,103 @@
+package notion
+
+import "time"
+
+// Source is the document source of ingested Notion pages
+const Source = "notion"
+
+// Event types that (re-)ingest a page
+const (
+	EventPageCreated           = "page.created"
+	EventPageContentUpdated    = "page.content_updated"
+	EventPagePropertiesUpdated = "page.properties_updated"
+)
+
+// Event is a Notion webhook event. Events only identify the changed entity;
+// its content is fetched from the API.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Entity    struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"entity"`
+
+	// Sent once, unsigned, when the subscription is created; it becomes the
+	// secret signing all later events
+	VerificationToken string `json:"verification_token,omitempty"`
+}
+
+// RichText is a run of formatted text
+type RichText struct {
+	PlainText string `json:"plain_text"`
+}
+
+// Page is a Notion page's metadata
+type Page struct {
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	Archived       bool      `json:"archived"`
+	InTrash        bool      `json:"in_trash"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+	LastEditedBy   struct {
+		ID string `json:"id"`
+	} `json:"last_edited_by"`
+	Properties map[string]struct {
+		Type  string     `json:"type"`
+		Title []RichText `json:"title,omitempty"`
+	} `json:"properties"`
+}
+
+// Title returns the page's title property as plain text
+func (p *Page) Title() string {
+	for _, property := range p.Properties {
+		if property.Type == "title" {
+			return plainText(property.Title)
+		}
+	}
+	return ""
+}
+
+// Block is a piece of page content. Only the fields of block types holding
+// text are decoded.
+type Block struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	HasChildren bool   `json:"has_children"`
+
+	Paragraph        *TextBlock `json:"paragraph,omitempty"`
+	Heading1         *TextBlock `json:"heading_1,omitempty"`
+	Heading2         *TextBlock `json:"heading_2,omitempty"`
+	Heading3         *TextBlock `json:"heading_3,omitempty"`
+	BulletedListItem *TextBlock `json:"bulleted_list_item,omitempty"`
+	NumberedListItem *TextBlock `json:"numbered_list_item,omitempty"`
+	ToDo             *TextBlock `json:"to_do,omitempty"`
+	Toggle           *TextBlock `json:"toggle,omitempty"`
+	Quote            *TextBlock `json:"quote,omitempty"`
+	Callout          *TextBlock `json:"callout,omitempty"`
+	Code             *TextBlock `json:"code,omitempty"`
+	TableRow         *struct {
+		Cells [][]RichText `json:"cells"`
+	} `json:"table_row,omitempty"`
+	ChildPage *struct {
+		Title string `json:"title"`
+	} `json:"child_page,omitempty"`
+
+	// Fetched separately for blocks with children
+	Children []Block `json:"-"`
+}
+
+// TextBlock is the content of a block type holding rich text
+type TextBlock struct {
+	RichText []RichText `json:"rich_text"`
+	Checked  bool       `json:"checked,omitempty"`
+	Language string     `json:"language,omitempty"`
+}
+
+// blockList is a page of block children
+type blockList struct {
+	Results    []Block `json:"results"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor"`
+}
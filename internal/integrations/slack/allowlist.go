@@ -0,0 +1,162 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChannelOverrideStore persists runtime changes to the channel allowlist
+type ChannelOverrideStore interface {
+	GetChannelOverrides(ctx context.Context) (map[string]bool, error)
+	SetChannelAllowed(ctx context.Context, channelID string, allowed bool) error
+}
+
+// ChannelAllowlist decides which channels may be ingested. The configured
+// defaults can be overridden at runtime; overrides are persisted so they
+// survive restarts and always take precedence over the defaults.
+type ChannelAllowlist struct {
+	store     ChannelOverrideStore
+	defaults  map[string]bool
+	overrides map[string]bool
+	mu        sync.RWMutex
+}
+
+// NewChannelAllowlist creates an allowlist seeded with the configured channels
+func NewChannelAllowlist(store ChannelOverrideStore, defaults []string) *ChannelAllowlist {
+	defaultSet := make(map[string]bool)
+	for _, channelID := range defaults {
+		if channelID = strings.TrimSpace(channelID); channelID != "" {
+			defaultSet[channelID] = true
+		}
+	}
+
+	return &ChannelAllowlist{
+		store:     store,
+		defaults:  defaultSet,
+		overrides: make(map[string]bool),
+	}
+}
+
+// Load reads the persisted overrides from storage
+func (a *ChannelAllowlist) Load(ctx context.Context) error {
+	overrides, err := a.store.GetChannelOverrides(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load channel allowlist: %w", err)
+	}
+
+	a.mu.Lock()
+	a.overrides = overrides
+	a.mu.Unlock()
+
+	slog.Info("Channel allowlist loaded",
+		"defaults", len(a.defaults),
+		"overrides", len(overrides))
+	return nil
+}
+
+// IsAllowed reports whether messages from the channel may be collected.
+// When no channel has been allowed at all, every channel not explicitly
+// removed is allowed.
+func (a *ChannelAllowlist) IsAllowed(channelID string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if allowed, ok := a.overrides[channelID]; ok {
+		return allowed
+	}
+	if a.defaults[channelID] {
+		return true
+	}
+
+	return !a.isRestricted()
+}
+
+// Add allows a channel, overriding the configured defaults
+func (a *ChannelAllowlist) Add(ctx context.Context, channelID string) error {
+	return a.set(ctx, channelID, true)
+}
+
+// Remove blocks a channel, overriding the configured defaults
+func (a *ChannelAllowlist) Remove(ctx context.Context, channelID string) error {
+	return a.set(ctx, channelID, false)
+}
+
+// Channels returns the effective set of allowed channels, sorted
+func (a *ChannelAllowlist) Channels() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	channels := make([]string, 0, len(a.defaults)+len(a.overrides))
+	for channelID := range a.defaults {
+		if allowed, ok := a.overrides[channelID]; ok && !allowed {
+			continue
+		}
+		channels = append(channels, channelID)
+	}
+	for channelID, allowed := range a.overrides {
+		if allowed && !a.defaults[channelID] {
+			channels = append(channels, channelID)
+		}
+	}
+
+	sort.Strings(channels)
+	return channels
+}
+
+// Blocked returns the channels that have been removed at runtime, sorted
+func (a *ChannelAllowlist) Blocked() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	channels := []string{}
+	for channelID, allowed := range a.overrides {
+		if !allowed {
+			channels = append(channels, channelID)
+		}
+	}
+
+	sort.Strings(channels)
+	return channels
+}
+
+// Restricted reports whether only allowlisted channels may be collected
+func (a *ChannelAllowlist) Restricted() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.isRestricted()
+}
+
+func (a *ChannelAllowlist) isRestricted() bool {
+	if len(a.defaults) > 0 {
+		return true
+	}
+	for _, allowed := range a.overrides {
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ChannelAllowlist) set(ctx context.Context, channelID string, allowed bool) error {
+	channelID = strings.TrimSpace(channelID)
+	if channelID == "" {
+		return fmt.Errorf("channel ID cannot be empty")
+	}
+
+	if err := a.store.SetChannelAllowed(ctx, channelID, allowed); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.overrides[channelID] = allowed
+	a.mu.Unlock()
+
+	slog.Info("Channel allowlist updated", "channel_id", channelID, "allowed", allowed)
+	return nil
+}
@@ -0,0 +1,115 @@
+package slack
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// Mock override store for allowlist tests
+type mockOverrideStore struct {
+	overrides map[string]bool
+}
+
+func (m *mockOverrideStore) GetChannelOverrides(ctx context.Context) (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	for channelID, allowed := range m.overrides {
+		overrides[channelID] = allowed
+	}
+	return overrides, nil
+}
+
+func (m *mockOverrideStore) SetChannelAllowed(ctx context.Context, channelID string, allowed bool) error {
+	m.overrides[channelID] = allowed
+	return nil
+}
+
+func TestChannelAllowlist_Unrestricted(t *testing.T) {
+	allowlist := NewChannelAllowlist(&mockOverrideStore{overrides: map[string]bool{}}, nil)
+
+	if allowlist.Restricted() {
+		t.Errorf("Expected allowlist without channels to be unrestricted")
+	}
+	if !allowlist.IsAllowed("C123") {
+		t.Errorf("Expected any channel to be allowed when unrestricted")
+	}
+}
+
+func TestChannelAllowlist_AddAndRemove(t *testing.T) {
+	store := &mockOverrideStore{overrides: map[string]bool{}}
+	allowlist := NewChannelAllowlist(store, []string{"C_DEFAULT"})
+
+	if !allowlist.IsAllowed("C_DEFAULT") {
+		t.Errorf("Expected configured channel to be allowed")
+	}
+	if allowlist.IsAllowed("C_OTHER") {
+		t.Errorf("Expected unlisted channel to be blocked")
+	}
+
+	if err := allowlist.Add(context.Background(), "C_OTHER"); err != nil {
+		t.Fatalf("Unexpected error adding channel: %v", err)
+	}
+	if !allowlist.IsAllowed("C_OTHER") {
+		t.Errorf("Expected added channel to be allowed")
+	}
+
+	if err := allowlist.Remove(context.Background(), "C_DEFAULT"); err != nil {
+		t.Fatalf("Unexpected error removing channel: %v", err)
+	}
+	if allowlist.IsAllowed("C_DEFAULT") {
+		t.Errorf("Expected removed channel to be blocked")
+	}
+
+	if got := allowlist.Channels(); !reflect.DeepEqual(got, []string{"C_OTHER"}) {
+		t.Errorf("Expected effective channels [C_OTHER], got %v", got)
+	}
+	if got := allowlist.Blocked(); !reflect.DeepEqual(got, []string{"C_DEFAULT"}) {
+		t.Errorf("Expected blocked channels [C_DEFAULT], got %v", got)
+	}
+
+	// Overrides are persisted
+	if allowed, ok := store.overrides["C_DEFAULT"]; !ok || allowed {
+		t.Errorf("Expected removal to be persisted, got %v (present=%v)", allowed, ok)
+	}
+}
+
+func TestChannelAllowlist_RemovedChannelBlockedWhenUnrestricted(t *testing.T) {
+	allowlist := NewChannelAllowlist(&mockOverrideStore{overrides: map[string]bool{}}, nil)
+
+	if err := allowlist.Remove(context.Background(), "C_NOISY"); err != nil {
+		t.Fatalf("Unexpected error removing channel: %v", err)
+	}
+
+	if allowlist.IsAllowed("C_NOISY") {
+		t.Errorf("Expected removed channel to be blocked")
+	}
+	if !allowlist.IsAllowed("C_OTHER") {
+		t.Errorf("Expected other channels to remain allowed")
+	}
+}
+
+func TestChannelAllowlist_OverridesSurviveReload(t *testing.T) {
+	store := &mockOverrideStore{overrides: map[string]bool{}}
+	allowlist := NewChannelAllowlist(store, []string{"C_DEFAULT"})
+	if err := allowlist.Remove(context.Background(), "C_DEFAULT"); err != nil {
+		t.Fatalf("Unexpected error removing channel: %v", err)
+	}
+
+	// Simulate a restart with the same configured defaults
+	reloaded := NewChannelAllowlist(store, []string{"C_DEFAULT"})
+	if err := reloaded.Load(context.Background()); err != nil {
+		t.Fatalf("Unexpected error loading allowlist: %v", err)
+	}
+
+	if reloaded.IsAllowed("C_DEFAULT") {
+		t.Errorf("Expected persisted removal to override configured default after reload")
+	}
+}
+
+func TestChannelAllowlist_RejectsEmptyChannel(t *testing.T) {
+	allowlist := NewChannelAllowlist(&mockOverrideStore{overrides: map[string]bool{}}, nil)
+
+	if err := allowlist.Add(context.Background(), "  "); err == nil {
+		t.Errorf("Expected error for empty channel ID")
+	}
+}
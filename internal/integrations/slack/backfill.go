@@ -0,0 +1,129 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"knowthis/internal/storage"
+)
+
+// backfillPageSize is the number of documents read per page during backfill
+const backfillPageSize = 500
+
+// Document ID prefixes used by the legacy handler for Slack content
+const (
+	legacyThreadPrefix  = "slack_thread_"
+	legacyMessagePrefix = "slack_message_"
+)
+
+// legacyMessageLabel prefixes each message in a legacy thread document
+var legacyMessageLabel = regexp.MustCompile(`(?m)^Message \d+: `)
+
+// DocumentPager pages through stored documents
+type DocumentPager interface {
+	ListDocuments(ctx context.Context, filter storage.DocumentFilter, afterID string, limit int, includeEmbeddings bool) ([]*storage.Document, error)
+}
+
+// MessageInserter stores messages without overwriting existing ones
+type MessageInserter interface {
+	InsertMessageIfAbsent(ctx context.Context, msg SlackMessage) (bool, error)
+}
+
+// BackfillResult counts the outcome of a backfill run
+type BackfillResult struct {
+	Scanned  int `json:"scanned"`
+	Inserted int `json:"inserted"`
+	Skipped  int `json:"skipped"` // Already present in slack_messages or not legacy Slack content
+}
+
+// BackfillDocuments copies Slack threads and messages stored in the documents
+// table by the legacy handler into slack_messages, so they are embedded and
+// searched like collected threads. Threads already present are left as they
+// are, and re-collecting a backfilled thread replaces it with the real messages.
+func BackfillDocuments(ctx context.Context, documents DocumentPager, messages MessageInserter) (BackfillResult, error) {
+	var result BackfillResult
+	afterID := ""
+
+	for {
+		page, err := documents.ListDocuments(ctx, storage.DocumentFilter{Source: "slack"}, afterID, backfillPageSize, false)
+		if err != nil {
+			return result, fmt.Errorf("failed to list documents: %w", err)
+		}
+
+		for _, doc := range page {
+			result.Scanned++
+
+			msg, ok := documentToMessage(doc)
+			if !ok {
+				result.Skipped++
+				continue
+			}
+
+			inserted, err := messages.InsertMessageIfAbsent(ctx, *msg)
+			if err != nil {
+				return result, fmt.Errorf("failed to backfill document %s: %w", doc.ID, err)
+			}
+			if inserted {
+				result.Inserted++
+			} else {
+				result.Skipped++
+			}
+		}
+
+		if len(page) < backfillPageSize {
+			break
+		}
+		afterID = page[len(page)-1].ID
+	}
+
+	slog.Info("Backfilled Slack documents", "scanned", result.Scanned, "inserted", result.Inserted, "skipped", result.Skipped)
+	return result, nil
+}
+
+// IsLegacyDocument reports whether a document ID is a Slack thread or message
+// stored in the documents table by the legacy handler, rather than content
+// like canvases and thread summaries that only lives there
+func IsLegacyDocument(id string) bool {
+	if strings.HasPrefix(id, summaryDocumentPrefix) {
+		return false
+	}
+	return strings.HasPrefix(id, legacyThreadPrefix) || strings.HasPrefix(id, legacyMessagePrefix)
+}
+
+// documentToMessage maps a legacy Slack document onto a thread root message.
+// Thread documents don't keep per-message timestamps or authors, so the whole
+// thread becomes its root message, attributed to its first participant.
+func documentToMessage(doc *storage.Document) (*SlackMessage, bool) {
+	if doc.ChannelID == "" || doc.SourceID == "" || !IsLegacyDocument(doc.ID) {
+		return nil, false
+	}
+
+	msg := &SlackMessage{
+		ChannelID:        doc.ChannelID,
+		ThreadID:         doc.SourceID,
+		MessageTimestamp: doc.SourceID,
+		IsThreadRoot:     true,
+	}
+
+	switch {
+	case strings.HasPrefix(doc.ID, legacyThreadPrefix):
+		msg.Content = strings.TrimSpace(legacyMessageLabel.ReplaceAllString(doc.Content, ""))
+		firstParticipant, _, _ := strings.Cut(doc.UserName, ",")
+		msg.UserID = strings.TrimSpace(firstParticipant)
+	case strings.HasPrefix(doc.ID, legacyMessagePrefix):
+		msg.Content = strings.TrimSpace(doc.Content)
+		msg.UserID = doc.UserID
+	default:
+		return nil, false
+	}
+
+	if msg.Content == "" {
+		return nil, false
+	}
+	msg.UserName = msg.UserID
+
+	return msg, true
+}
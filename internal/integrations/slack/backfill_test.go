@@ -0,0 +1,120 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"knowthis/internal/storage"
+)
+
+type mockDocumentPager struct {
+	documents []*storage.Document
+	filters   []storage.DocumentFilter
+}
+
+func (m *mockDocumentPager) ListDocuments(ctx context.Context, filter storage.DocumentFilter, afterID string, limit int, includeEmbeddings bool) ([]*storage.Document, error) {
+	m.filters = append(m.filters, filter)
+
+	var page []*storage.Document
+	for _, doc := range m.documents {
+		if doc.ID > afterID && len(page) < limit {
+			page = append(page, doc)
+		}
+	}
+	return page, nil
+}
+
+type mockMessageInserter struct {
+	messages map[string]SlackMessage
+}
+
+func (m *mockMessageInserter) InsertMessageIfAbsent(ctx context.Context, msg SlackMessage) (bool, error) {
+	key := msg.ChannelID + "/" + msg.MessageTimestamp
+	if _, exists := m.messages[key]; exists {
+		return false, nil
+	}
+	m.messages[key] = msg
+	return true, nil
+}
+
+func TestDocumentToMessage_LegacyThread(t *testing.T) {
+	doc := &storage.Document{
+		ID:        "slack_thread_C1_1700000000.000100",
+		Content:   "Message 1: How do I roll back a deploy?\nMessage 2: Run make rollback\nthen check the dashboard\n",
+		Source:    "slack",
+		SourceID:  "1700000000.000100",
+		Title:     "How do I roll back a deploy?",
+		ChannelID: "C1",
+		UserName:  "U1, U2",
+	}
+
+	msg, ok := documentToMessage(doc)
+	if !ok {
+		t.Fatal("Expected legacy thread document to map to a message")
+	}
+
+	expected := SlackMessage{
+		ChannelID:        "C1",
+		ThreadID:         "1700000000.000100",
+		MessageTimestamp: "1700000000.000100",
+		UserID:           "U1",
+		UserName:         "U1",
+		Content:          "How do I roll back a deploy?\nRun make rollback\nthen check the dashboard",
+		IsThreadRoot:     true,
+	}
+	if *msg != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *msg)
+	}
+}
+
+func TestDocumentToMessage_SkipsNonLegacyDocuments(t *testing.T) {
+	testCases := []*storage.Document{
+		{ID: "slack_canvas_F1", Content: "Canvas text", Source: "slack", SourceID: "F1", ChannelID: "C1"},
+		{ID: "slack_thread_summary_C1_1.0", Content: "- The deploy was rolled back", Source: "slack", SourceID: "1.0", ChannelID: "C1"},
+		{ID: "slack_thread_C1_1.0", Content: "Message 1: ", Source: "slack", SourceID: "1.0", ChannelID: "C1"},
+		{ID: "slack_thread__1.0", Content: "Message 1: hello there", Source: "slack", SourceID: "1.0"},
+	}
+
+	for _, doc := range testCases {
+		if _, ok := documentToMessage(doc); ok {
+			t.Errorf("Expected document %s to be skipped", doc.ID)
+		}
+	}
+}
+
+func TestBackfillDocuments(t *testing.T) {
+	pager := &mockDocumentPager{}
+	for i := 0; i < backfillPageSize+2; i++ {
+		pager.documents = append(pager.documents, &storage.Document{
+			ID:        fmt.Sprintf("slack_message_C1_%04d.000100", i),
+			Content:   fmt.Sprintf("Message content %d", i),
+			Source:    "slack",
+			SourceID:  fmt.Sprintf("%04d.000100", i),
+			ChannelID: "C1",
+			UserID:    "U1",
+		})
+	}
+
+	// A thread already collected into slack_messages keeps its real content
+	inserter := &mockMessageInserter{messages: map[string]SlackMessage{
+		"C1/0000.000100": {ChannelID: "C1", MessageTimestamp: "0000.000100", Content: "Collected content"},
+	}}
+
+	result, err := BackfillDocuments(context.Background(), pager, inserter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Scanned != backfillPageSize+2 || result.Inserted != backfillPageSize+1 || result.Skipped != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if inserter.messages["C1/0000.000100"].Content != "Collected content" {
+		t.Errorf("Expected existing message to be left untouched")
+	}
+	for _, filter := range pager.filters {
+		if filter.Source != "slack" {
+			t.Errorf("Expected backfill to list only Slack documents, got %q", filter.Source)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"knowthis/internal/storage"
+
+	"github.com/slack-go/slack"
+)
+
+// CanvasSource is the document source of ingested Slack canvases
+const CanvasSource = "slack_canvas"
+
+// CanvasStore upserts canvas documents by ID, re-embedding them when their content changes
+type CanvasStore interface {
+	ImportDocument(ctx context.Context, doc *storage.Document) (bool, error)
+}
+
+var (
+	// Tags that end a line of text when a canvas is flattened
+	canvasBlockTag = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/h[1-6]|/li|/tr|/blockquote|/pre)\b[^>]*>`)
+	canvasTag      = regexp.MustCompile(`<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// SetCanvasStore enables ingestion of the canvases bookmarked in a channel
+// whenever a thread from that channel is collected
+func (h *SlackHandler) SetCanvasStore(store CanvasStore) {
+	h.canvasStore = store
+	slog.Info("Enabled Slack canvas ingestion")
+}
+
+// syncChannelCanvases stores the channel's bookmarked canvases as documents.
+// Unchanged canvases are left as they are; failures are logged and skipped.
+func (h *SlackHandler) syncChannelCanvases(ctx context.Context, channelID string) int {
+	bookmarks, err := h.client.ListBookmarksContext(ctx, channelID)
+	if err != nil {
+		slog.Warn("Failed to list channel bookmarks", "error", err, "channel", channelID)
+		return 0
+	}
+
+	synced := 0
+	for _, bookmark := range bookmarks {
+		// Bookmarked files carry their file ID as the entity ID
+		if !strings.HasPrefix(bookmark.EntityID, "F") {
+			continue
+		}
+
+		file, _, _, err := h.client.GetFileInfoContext(ctx, bookmark.EntityID, 0, 0)
+		if err != nil {
+			slog.Warn("Failed to get bookmarked file", "error", err, "file_id", bookmark.EntityID)
+			continue
+		}
+		if !isCanvas(file) {
+			continue
+		}
+
+		var content bytes.Buffer
+		if err := h.client.GetFileContext(ctx, file.URLPrivateDownload, &content); err != nil {
+			slog.Warn("Failed to download canvas", "error", err, "file_id", file.ID)
+			continue
+		}
+
+		doc := canvasToDocument(file, channelID, content.String())
+		if doc == nil {
+			continue
+		}
+
+		if _, err := h.canvasStore.ImportDocument(ctx, doc); err != nil {
+			slog.Error("Failed to store canvas", "error", err, "file_id", file.ID)
+			continue
+		}
+		synced++
+	}
+
+	slog.Info("Synced channel canvases", "channel", channelID, "canvases", synced)
+	return synced
+}
+
+// isCanvas reports whether a file is a Slack canvas
+func isCanvas(file *slack.File) bool {
+	return file.Filetype == "quip" || file.Filetype == "canvas" || strings.EqualFold(file.PrettyType, "canvas")
+}
+
+// canvasToDocument converts a canvas and its downloaded HTML into a document
+// keyed by file ID, so edits to the canvas update the same document.
+// Returns nil for canvases without text.
+func canvasToDocument(file *slack.File, channelID, rawHTML string) *storage.Document {
+	content := canvasText(rawHTML)
+	if content == "" {
+		return nil
+	}
+
+	updated := file.Timestamp.Time()
+	if file.Timestamp == 0 {
+		updated = file.Created.Time()
+	}
+
+	title := file.Title
+	if title == "" {
+		title = file.Name
+	}
+
+	return &storage.Document{
+		ID:          fmt.Sprintf("%s_%s", CanvasSource, file.ID),
+		Content:     content,
+		Source:      CanvasSource,
+		SourceID:    file.ID,
+		Title:       title,
+		ChannelID:   channelID,
+		UserID:      file.User,
+		Timestamp:   updated.UTC().Truncate(time.Second),
+		ContentHash: storage.HashContent(content),
+	}
+}
+
+// canvasText flattens canvas HTML to plain text, one line per block
+func canvasText(rawHTML string) string {
+	text := canvasBlockTag.ReplaceAllString(rawHTML, "\n")
+	text = canvasTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text = strings.Join(lines, "\n")
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
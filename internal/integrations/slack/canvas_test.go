@@ -0,0 +1,109 @@
+package slack
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+
+	"github.com/slack-go/slack"
+)
+
+type mockCanvasStore struct {
+	documents map[string]*storage.Document
+}
+
+func (m *mockCanvasStore) ImportDocument(ctx context.Context, doc *storage.Document) (bool, error) {
+	if m.documents == nil {
+		m.documents = make(map[string]*storage.Document)
+	}
+	_, exists := m.documents[doc.ID]
+	m.documents[doc.ID] = doc
+	return !exists, nil
+}
+
+func (m *mockCanvasStore) DeleteDocumentChunks(ctx context.Context, id string, from int) (int64, error) {
+	var removed int64
+	for docID := range m.documents {
+		suffix, ok := strings.CutPrefix(docID, id+"_chunk_")
+		if n, err := strconv.Atoi(suffix); ok && err == nil && n >= from {
+			delete(m.documents, docID)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func TestCanvasToDocument(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	file := &slack.File{
+		ID:        "F123",
+		Title:     "On-call handbook",
+		User:      "U1",
+		Filetype:  "quip",
+		Created:   slack.JSONTime(updated.Add(-time.Hour).Unix()),
+		Timestamp: slack.JSONTime(updated.Unix()),
+	}
+	rawHTML := `<h1>On-call</h1><p>Page the <b>primary</b> first &amp; wait 5&nbsp;minutes.</p><ul><li>Check dashboards</li><li>Roll back</li></ul>`
+
+	doc := canvasToDocument(file, "C1", rawHTML)
+	if doc == nil {
+		t.Fatal("Expected a document")
+	}
+
+	expectedContent := "On-call\nPage the primary first & wait 5 minutes.\nCheck dashboards\nRoll back"
+	if doc.Content != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, doc.Content)
+	}
+	if doc.ID != "slack_canvas_F123" || doc.Source != CanvasSource || doc.SourceID != "F123" {
+		t.Errorf("Unexpected document identity: id=%s source=%s source_id=%s", doc.ID, doc.Source, doc.SourceID)
+	}
+	if doc.Title != "On-call handbook" || doc.ChannelID != "C1" || doc.UserID != "U1" {
+		t.Errorf("Unexpected document metadata: %+v", doc)
+	}
+	if !doc.Timestamp.Equal(updated) {
+		t.Errorf("Expected last update time %v, got %v", updated, doc.Timestamp)
+	}
+	if doc.ContentHash != storage.HashContent(expectedContent) {
+		t.Errorf("Expected content hash of the flattened text")
+	}
+
+	if canvasToDocument(file, "C1", "<p> </p>") != nil {
+		t.Errorf("Expected no document for an empty canvas")
+	}
+}
+
+func TestSyncChannelCanvases(t *testing.T) {
+	client := &mockSlackClient{
+		bookmarks: []slack.Bookmark{
+			{Title: "Runbook", Type: "link", Link: "https://wiki.internal/runbook"},
+			{Title: "Handbook", EntityID: "F_CANVAS"},
+			{Title: "Diagram", EntityID: "F_IMAGE"},
+		},
+		files: map[string]*slack.File{
+			"F_CANVAS": {ID: "F_CANVAS", Title: "Handbook", Filetype: "quip", URLPrivateDownload: "https://files/canvas"},
+			"F_IMAGE":  {ID: "F_IMAGE", Title: "Diagram", Filetype: "png", URLPrivateDownload: "https://files/image"},
+		},
+		fileContents: map[string]string{
+			"https://files/canvas": "<p>Escalate to the platform team</p>",
+		},
+	}
+	store := &mockCanvasStore{}
+	handler := &SlackHandler{client: client}
+	handler.SetCanvasStore(store)
+
+	if synced := handler.syncChannelCanvases(context.Background(), "C1"); synced != 1 {
+		t.Errorf("Expected 1 canvas synced, got %d", synced)
+	}
+
+	doc := store.documents["slack_canvas_F_CANVAS"]
+	if doc == nil || doc.Content != "Escalate to the platform team" {
+		t.Errorf("Expected the canvas to be stored, got %+v", store.documents)
+	}
+	if len(store.documents) != 1 {
+		t.Errorf("Expected only canvases to be stored, got %d documents", len(store.documents))
+	}
+}
@@ -0,0 +1,407 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// buildLongThread creates a thread whose formatted content spans multiple chunks
+func buildLongThread(threadID string, messageCount, wordsPerMessage int) []SlackMessage {
+	messages := make([]SlackMessage, messageCount)
+	for i := range messages {
+		messages[i] = SlackMessage{
+			ThreadID:         threadID,
+			MessageTimestamp: fmt.Sprintf("17000000%02d.000100", i),
+			UserName:         "alice",
+			Content:          strings.TrimSpace(strings.Repeat(fmt.Sprintf("word%d ", i), wordsPerMessage)),
+		}
+	}
+	return messages
+}
+
+func TestChunkMessageRanges(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+	messages := buildLongThread("T1", 10, 2000)
+
+	chunks := processor.chunkContent(processor.buildThreadContent(messages))
+	ranges := processor.chunkMessageRanges("T1", messages)
+
+	if len(ranges) != len(chunks) {
+		t.Fatalf("Expected %d chunk ranges to match chunks, got %d", len(chunks), len(ranges))
+	}
+
+	for i, chunkRange := range ranges {
+		if chunkRange.StartTimestamp > chunkRange.EndTimestamp {
+			t.Errorf("Chunk %d has inverted range %s-%s", i, chunkRange.StartTimestamp, chunkRange.EndTimestamp)
+		}
+	}
+
+	if ranges[0].StartTimestamp != messages[0].MessageTimestamp {
+		t.Errorf("First chunk should start at first message, got %s", ranges[0].StartTimestamp)
+	}
+	if last := ranges[len(ranges)-1]; last.EndTimestamp != messages[len(messages)-1].MessageTimestamp {
+		t.Errorf("Last chunk should end at last message, got %s", last.EndTimestamp)
+	}
+
+	// Every message in a chunk's range must actually appear in that chunk's text
+	for i, chunkRange := range ranges {
+		for _, msg := range messages {
+			if msg.MessageTimestamp < chunkRange.StartTimestamp || msg.MessageTimestamp > chunkRange.EndTimestamp {
+				continue
+			}
+			marker := strings.Fields(msg.Content)[0]
+			if !strings.Contains(chunks[i], marker) {
+				t.Errorf("Chunk %d range includes message %s but chunk text lacks it", i, msg.MessageTimestamp)
+			}
+		}
+	}
+}
+
+func TestChunkMessageRanges_SingleChunk(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+	messages := buildLongThread("T1", 3, 5)
+
+	ranges := processor.chunkMessageRanges("T1", messages)
+	if len(ranges) != 1 {
+		t.Fatalf("Expected 1 chunk range, got %d", len(ranges))
+	}
+	if ranges[0].StartTimestamp != messages[0].MessageTimestamp || ranges[0].EndTimestamp != messages[2].MessageTimestamp {
+		t.Errorf("Expected range to cover whole thread, got %+v", ranges[0])
+	}
+}
+
+func TestFilterMessagesToChunks(t *testing.T) {
+	messages := append(buildLongThread("T1", 6, 3), buildLongThread("T2", 2, 3)...)
+
+	chunks := []ChunkRange{
+		{ThreadID: "T1", StartTimestamp: messages[2].MessageTimestamp, EndTimestamp: messages[3].MessageTimestamp},
+		{ThreadID: "T2"}, // legacy chunk without a recorded range
+	}
+
+	filtered := filterMessagesToChunks(messages, chunks)
+
+	var t1Timestamps []string
+	t2Count := 0
+	for _, msg := range filtered {
+		switch msg.ThreadID {
+		case "T1":
+			t1Timestamps = append(t1Timestamps, msg.MessageTimestamp)
+		case "T2":
+			t2Count++
+		}
+	}
+
+	if len(t1Timestamps) != 2 || t1Timestamps[0] != messages[2].MessageTimestamp || t1Timestamps[1] != messages[3].MessageTimestamp {
+		t.Errorf("Expected only messages within the matched chunk range, got %v", t1Timestamps)
+	}
+	if t2Count != 2 {
+		t.Errorf("Expected legacy chunk without range to return whole thread, got %d messages", t2Count)
+	}
+}
+
+func TestChunkContent_OversizedSingleMessage(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+
+	// A pasted log dump: well under the word limit but far over the character limit
+	var lines []string
+	for i := 0; len(strings.Join(lines, " ")) < 3*maxCharsPerChunk; i++ {
+		lines = append(lines, fmt.Sprintf("2024-03-01T12:00:%02dZ ERROR request_id=%06d upstream connect error or disconnect/reset before headers", i%60, i))
+	}
+	messages := []SlackMessage{{
+		ThreadID:         "T1",
+		MessageTimestamp: "1700000000.000100",
+		UserName:         "alice",
+		Content:          strings.Join(lines, "\n") + " END_OF_DUMP",
+	}}
+
+	content := processor.buildThreadContent(messages)
+	if len(content) <= 32000 {
+		t.Fatalf("Test message should exceed 32k characters, got %d", len(content))
+	}
+
+	chunks := processor.chunkContent(content)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected oversized message to produce multiple chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > maxCharsPerChunk {
+			t.Errorf("Chunk %d has %d characters, exceeding the %d limit", i, len(chunk), maxCharsPerChunk)
+		}
+	}
+
+	// Nothing is truncated: every word survives, in order
+	if joined := strings.Join(chunks, " "); joined != strings.Join(strings.Fields(content), " ") {
+		t.Errorf("Expected chunks to cover the whole message without truncation")
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "END_OF_DUMP") {
+		t.Errorf("Expected the tail of the message in the last chunk")
+	}
+
+	ranges := processor.chunkMessageRanges("T1", messages)
+	if len(ranges) != len(chunks) {
+		t.Fatalf("Expected %d chunk ranges to match chunks, got %d", len(chunks), len(ranges))
+	}
+	for i, chunkRange := range ranges {
+		if chunkRange.StartTimestamp != messages[0].MessageTimestamp || chunkRange.EndTimestamp != messages[0].MessageTimestamp {
+			t.Errorf("Chunk %d should cover the single message, got %+v", i, chunkRange)
+		}
+	}
+}
+
+func TestChunkContent_SplitsWordsLongerThanChunk(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+	blob := strings.Repeat("é", maxCharsPerChunk) // 2 bytes per rune
+
+	chunks := processor.chunkContent("base64: " + blob)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected blob to be split across chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > maxCharsPerChunk {
+			t.Errorf("Chunk %d has %d characters, exceeding the %d limit", i, len(chunk), maxCharsPerChunk)
+		}
+		if !utf8.ValidString(chunk) {
+			t.Errorf("Chunk %d was split inside a rune", i)
+		}
+	}
+}
+
+func TestChunkContent_Overlap(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+	processor.SetChunking(10, 3)
+
+	words := make([]string, 25)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	chunks := processor.chunkContent(strings.Join(words, " "))
+
+	expected := []string{
+		"w0 w1 w2 w3 w4 w5 w6 w7 w8 w9",
+		"w7 w8 w9 w10 w11 w12 w13 w14 w15 w16",
+		"w14 w15 w16 w17 w18 w19 w20 w21 w22 w23",
+		"w21 w22 w23 w24",
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d chunks, got %d: %q", len(expected), len(chunks), chunks)
+	}
+	for i := range expected {
+		if chunks[i] != expected[i] {
+			t.Errorf("Chunk %d: expected %q, got %q", i, expected[i], chunks[i])
+		}
+	}
+
+	// Dropping each chunk's overlap gives back the content exactly once
+	var rebuilt []string
+	for i, chunk := range chunks {
+		chunkWords := strings.Fields(chunk)
+		if i > 0 {
+			chunkWords = chunkWords[3:]
+		}
+		rebuilt = append(rebuilt, chunkWords...)
+	}
+	if strings.Join(rebuilt, " ") != strings.Join(words, " ") {
+		t.Errorf("Expected chunks without overlap to cover the content once, got %q", rebuilt)
+	}
+}
+
+func TestChunkContent_OverlapKeepsBoundaryPassageWhole(t *testing.T) {
+	decision := "we decided to pin the driver to 1.4"
+	content := strings.Repeat("filler ", 16) + decision + strings.Repeat(" filler", 16)
+
+	for _, tc := range []struct {
+		overlap   int
+		wantWhole bool
+	}{
+		{overlap: 0, wantWhole: false},
+		{overlap: 8, wantWhole: true},
+	} {
+		processor := &EmbeddingProcessor{}
+		processor.SetChunking(20, tc.overlap)
+
+		whole := false
+		for _, chunk := range processor.chunkContent(content) {
+			if strings.Contains(chunk, decision) {
+				whole = true
+			}
+		}
+		if whole != tc.wantWhole {
+			t.Errorf("overlap %d: expected the decision in one chunk %t, got %t", tc.overlap, tc.wantWhole, whole)
+		}
+	}
+}
+
+func TestChunkMessageRanges_Overlap(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+	processor.SetChunking(1000, 100)
+	messages := buildLongThread("T1", 4, 400)
+
+	chunks := processor.chunkContent(processor.buildThreadContent(messages))
+	ranges := processor.chunkMessageRanges("T1", messages)
+	if len(ranges) != len(chunks) || len(chunks) < 2 {
+		t.Fatalf("Expected matching multi-chunk ranges, got %d ranges for %d chunks", len(ranges), len(chunks))
+	}
+
+	// Each later chunk starts inside the message the previous chunk ended in
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].StartTimestamp != ranges[i-1].EndTimestamp {
+			t.Errorf("Chunk %d should start in the message chunk %d ended in, got %s after %s",
+				i, i-1, ranges[i].StartTimestamp, ranges[i-1].EndTimestamp)
+		}
+	}
+	for i, chunkRange := range ranges {
+		for _, msg := range messages {
+			if msg.MessageTimestamp >= chunkRange.StartTimestamp && msg.MessageTimestamp <= chunkRange.EndTimestamp &&
+				!strings.Contains(chunks[i], strings.Fields(msg.Content)[0]) {
+				t.Errorf("Chunk %d range includes message %s but chunk text lacks it", i, msg.MessageTimestamp)
+			}
+		}
+	}
+}
+
+func TestSetChunking_IgnoresInvalidSettings(t *testing.T) {
+	processor := &EmbeddingProcessor{}
+	for _, settings := range [][2]int{{0, 0}, {maxWordsPerChunk + 1, 0}, {100, -1}, {100, 100}} {
+		processor.SetChunking(settings[0], settings[1])
+	}
+	if processor.chunking() != chunkingSettings(maxWordsPerChunk, 0) {
+		t.Errorf("Expected invalid settings to be ignored, got %s", processor.chunking())
+	}
+}
+
+func TestRankMessagesBySimilarity(t *testing.T) {
+	// Messages come back from SQL ordered by thread ID, not similarity
+	messages := append(append(buildLongThread("T1", 2, 3), buildLongThread("T2", 3, 3)...), buildLongThread("T3", 2, 3)...)
+	threadSimilarity := map[string]float64{
+		"T1": 0.62,
+		"T2": 0.91,
+		"T3": -0.2, // cosine similarity can be negative
+	}
+
+	ranked := rankMessagesBySimilarity(messages, threadSimilarity)
+
+	if len(ranked) != len(messages) {
+		t.Fatalf("Expected %d messages, got %d", len(messages), len(ranked))
+	}
+	for i, msg := range ranked {
+		if msg.Similarity < 0 || msg.Similarity > 1 {
+			t.Errorf("Message %d similarity %v outside [0,1]", i, msg.Similarity)
+		}
+		if i > 0 && msg.Similarity > ranked[i-1].Similarity {
+			t.Errorf("Similarity increased at message %d: %v after %v", i, msg.Similarity, ranked[i-1].Similarity)
+		}
+		if i > 0 && msg.ThreadID == ranked[i-1].ThreadID && msg.MessageTimestamp < ranked[i-1].MessageTimestamp {
+			t.Errorf("Messages within thread %s are out of timestamp order", msg.ThreadID)
+		}
+	}
+
+	if ranked[0].ThreadID != "T2" || ranked[0].Similarity != 0.91 {
+		t.Errorf("Expected the most similar thread first, got %s at %v", ranked[0].ThreadID, ranked[0].Similarity)
+	}
+	if last := ranked[len(ranked)-1]; last.ThreadID != "T3" || last.Similarity != 0 {
+		t.Errorf("Expected negative similarity clamped to 0 for the last thread, got %s at %v", last.ThreadID, last.Similarity)
+	}
+}
+
+func TestSearchFilter_Conditions(t *testing.T) {
+	baseArgs := []interface{}{"embedding", 10}
+
+	// No filter leaves the search unchanged
+	sql, args := SearchFilter{}.conditions(baseArgs)
+	if sql != "" || len(args) != 2 {
+		t.Errorf("Expected no conditions for an empty filter, got %q with %d args", sql, len(args))
+	}
+
+	filter := SearchFilter{
+		After:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Before: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	sql, args = filter.conditions(baseArgs)
+
+	if !strings.Contains(sql, "EXISTS (SELECT 1 FROM slack_messages m WHERE m.thread_id = e.thread_id") {
+		t.Errorf("Expected threads to be filtered by their messages, got %q", sql)
+	}
+	if !strings.Contains(sql, ">= $3") || !strings.Contains(sql, "< $4") {
+		t.Errorf("Expected placeholders numbered after the existing args, got %q", sql)
+	}
+	if len(args) != 4 || args[2] != float64(1704067200) || args[3] != float64(1711929600) {
+		t.Fatalf("Expected range bounds as Unix seconds, got %v", args)
+	}
+
+	// The language must hold for the same message as the time range
+	filter.Language = "es"
+	sql, args = filter.conditions(baseArgs)
+	if strings.Count(sql, "EXISTS") != 1 || !strings.Contains(sql, "AND m.language = $5") {
+		t.Errorf("Expected the language matched by the same message, got %q", sql)
+	}
+	if len(args) != 5 || args[4] != "es" {
+		t.Fatalf("Expected the language as the last arg, got %v", args)
+	}
+
+	sql, args = SearchFilter{Language: "de"}.conditions(baseArgs)
+	if sql != " AND EXISTS (SELECT 1 FROM slack_messages m WHERE m.thread_id = e.thread_id AND m.language = $3)" || len(args) != 3 {
+		t.Errorf("Expected a language-only condition, got %q with %d args", sql, len(args))
+	}
+}
+
+func TestMergeSearchScores(t *testing.T) {
+	// "ERR-4411 on checkout" embeds close to general checkout threads, so
+	// vector search prefers T1 while only T2 mentions the exact error code
+	vectorScores := map[string]float64{"T1": 0.82, "T2": 0.78, "T3": 0.70}
+	keywordScores := map[string]float64{"T2": 0.5, "T4": 0.1}
+
+	best := func(scores map[string]float64) string {
+		var bestID string
+		for threadID, score := range scores {
+			if bestID == "" || score > scores[bestID] {
+				bestID = threadID
+			}
+		}
+		return bestID
+	}
+
+	tests := []struct {
+		name      string
+		mode      SearchMode
+		wantBest  string
+		wantCount int
+	}{
+		{"vector by default", "", "T1", 3},
+		{"vector", SearchModeVector, "T1", 3},
+		{"keyword", SearchModeKeyword, "T2", 2},
+		{"hybrid", SearchModeHybrid, "T2", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores := mergeSearchScores(vectorScores, keywordScores, tt.mode, defaultKeywordWeight, 10)
+			if len(scores) != tt.wantCount {
+				t.Errorf("Expected %d threads, got %v", tt.wantCount, scores)
+			}
+			if got := best(scores); got != tt.wantBest {
+				t.Errorf("Expected %s ranked first, got %s (%v)", tt.wantBest, got, scores)
+			}
+		})
+	}
+
+	// Keyword ranks are relative to the best match
+	keyword := mergeSearchScores(vectorScores, keywordScores, SearchModeKeyword, defaultKeywordWeight, 10)
+	if keyword["T2"] != 1 || keyword["T4"] != 0.2 {
+		t.Errorf("Expected keyword scores scaled to the best match, got %v", keyword)
+	}
+
+	// Hybrid leaves threads without a keyword match at their similarity
+	hybrid := mergeSearchScores(vectorScores, keywordScores, SearchModeHybrid, defaultKeywordWeight, 10)
+	if hybrid["T1"] != 0.82 || hybrid["T3"] != 0.70 {
+		t.Errorf("Expected unmatched threads to keep their similarity, got %v", hybrid)
+	}
+
+	// Only the best threads up to the limit are kept
+	limited := mergeSearchScores(vectorScores, keywordScores, SearchModeHybrid, defaultKeywordWeight, 2)
+	if len(limited) != 2 || limited["T1"] == 0 || limited["T2"] == 0 {
+		t.Errorf("Expected the two best threads, got %v", limited)
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"log/slog"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/time/rate"
 )
 
 // EmbeddingServiceInterface to avoid circular dependencies
@@ -15,24 +19,153 @@ type EmbeddingServiceInterface interface {
 	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
 }
 
+// ThreadEmbeddingStore is the storage used to find and embed threads
+type ThreadEmbeddingStore interface {
+	GetThreadsWithoutEmbeddings(ctx context.Context, limit int) ([]string, error)
+	GetMessagesInThread(ctx context.Context, threadID string) ([]SlackMessage, error)
+	GetThreadEmbeddingHashes(ctx context.Context, threadID string) (map[int]string, error)
+	StoreThreadEmbedding(ctx context.Context, chunk ChunkRange, chunkIndex int, contentHash string, embedding []float32) error
+	CompleteThreadEmbeddings(ctx context.Context, threadID string, chunkCount int) error
+	InvalidateChunking(ctx context.Context, chunking string) (int64, error)
+}
+
+// maxWordsPerChunk is the default and largest number of words embedded per
+// thread chunk
+const maxWordsPerChunk = 7000
+
+// maxCharsPerChunk matches the input EmbeddingService accepts before truncating
+const maxCharsPerChunk = 32000
+
+// dryRunContentHash marks chunks stored by a dry run without an embedding, so
+// they never match the hash of real content and are embedded once dry runs end
+const dryRunContentHash = "dry_run"
+
 // EmbeddingProcessor handles background processing of embeddings for Slack messages
 type EmbeddingProcessor struct {
-	storage          *SlackStorage
+	storage          ThreadEmbeddingStore
 	embeddingService EmbeddingServiceInterface
 	batchSize        int
 	interval         time.Duration
 	done             chan struct{}
+
+	// Bounds for the adaptive interval; equal bounds keep the interval fixed
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	// Drop quoted lines from messages before embedding
+	trimQuotes bool
+
+	// Words per chunk (0 for maxWordsPerChunk), and how many trailing words
+	// of a chunk are repeated at the start of the next
+	chunkWords   int
+	chunkOverlap int
+
+	// Threads of a batch processed at once, and the embedding requests
+	// allowed per second across them; nil leaves requests unlimited
+	concurrency int
+	limiter     *rate.Limiter
+
+	// Log what would be embedded and store markers instead of calling the
+	// embedding service
+	dryRun bool
 }
 
 // NewEmbeddingProcessor creates a new embedding processor for Slack
-func NewEmbeddingProcessor(storage *SlackStorage, embeddingService EmbeddingServiceInterface) *EmbeddingProcessor {
+func NewEmbeddingProcessor(storage ThreadEmbeddingStore, embeddingService EmbeddingServiceInterface) *EmbeddingProcessor {
 	return &EmbeddingProcessor{
 		storage:          storage,
 		embeddingService: embeddingService,
 		batchSize:        10,               // Reduced batch size for cost control
 		interval:         60 * time.Second, // Increased interval to reduce API calls
 		done:             make(chan struct{}),
+		minInterval:      60 * time.Second,
+		maxInterval:      60 * time.Second,
+		concurrency:      1,
+	}
+}
+
+// SetAdaptiveInterval lets the interval shrink toward min while batches come
+// back full (a backlog) and grow toward max while they come back empty
+func (e *EmbeddingProcessor) SetAdaptiveInterval(min, max time.Duration) {
+	if min <= 0 || min > max {
+		return
+	}
+
+	e.minInterval = min
+	e.maxInterval = max
+	e.interval = e.clampInterval(e.interval)
+	slog.Info("Updated embedding processor adaptive interval", "min", min, "max", max)
+}
+
+// SetQuoteTrimming drops blockquoted lines, usually a prior message quoted in
+// a reply, from messages before embedding so the reply's new content isn't
+// diluted by content that is already embedded
+func (e *EmbeddingProcessor) SetQuoteTrimming(enabled bool) {
+	e.trimQuotes = enabled
+	slog.Info("Updated embedding processor quote trimming", "enabled", enabled)
+}
+
+// SetChunking sets the words per chunk (at most maxWordsPerChunk) and the
+// overlap window: the last overlap words of a chunk start the next one too,
+// so a passage cut at a boundary is still embedded whole in one chunk
+func (e *EmbeddingProcessor) SetChunking(words, overlap int) {
+	if words <= 0 || words > maxWordsPerChunk || overlap < 0 || overlap >= words {
+		return
+	}
+
+	e.chunkWords = words
+	e.chunkOverlap = overlap
+	slog.Info("Updated embedding processor chunking", "words", words, "overlap", overlap)
+}
+
+// SetConcurrency processes up to workers threads of a batch at once, so one
+// slow embedding request doesn't hold up the rest, while keeping embedding
+// requests across all workers under requestsPerSecond (0 for no limit)
+func (e *EmbeddingProcessor) SetConcurrency(workers int, requestsPerSecond float64) {
+	if workers < 1 || requestsPerSecond < 0 {
+		return
+	}
+
+	e.concurrency = workers
+	e.limiter = nil
+	if requestsPerSecond > 0 {
+		e.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), workers)
+	}
+	slog.Info("Updated embedding processor concurrency", "workers", workers, "requests_per_second", requestsPerSecond)
+}
+
+// SetDryRun logs the chunks each thread would be embedded as, with their
+// estimated tokens, instead of embedding them. Chunks never embedded are
+// stored without an embedding, marked with dryRunContentHash, and existing
+// embeddings are left searchable. Dry runs record their own chunking
+// settings, so threads are re-chunked and changed chunks embedded once dry
+// runs end.
+func (e *EmbeddingProcessor) SetDryRun(enabled bool) {
+	e.dryRun = enabled
+	if enabled {
+		slog.Warn("Slack embedding processor is in dry run mode; threads will not be embedded")
+	}
+}
+
+// chunking describes the chunking settings, so embeddings made with other
+// settings, or by dry runs, can be told apart
+func (e *EmbeddingProcessor) chunking() string {
+	settings := chunkingSettings(e.maxChunkWords(), e.chunkOverlap)
+	if e.dryRun {
+		settings += ",dry_run"
+	}
+	return settings
+}
+
+func chunkingSettings(words, overlap int) string {
+	return fmt.Sprintf("words=%d,overlap=%d", words, overlap)
+}
+
+func (e *EmbeddingProcessor) maxChunkWords() int {
+	if e.chunkWords > 0 {
+		return e.chunkWords
 	}
+	return maxWordsPerChunk
 }
 
 // Start begins the background processing of embeddings
@@ -41,8 +174,16 @@ func (e *EmbeddingProcessor) Start(ctx context.Context) {
 		"batch_size", e.batchSize,
 		"interval", e.interval)
 
-	ticker := time.NewTicker(e.interval)
-	defer ticker.Stop()
+	// Threads embedded with other chunking are re-chunked; chunks that come
+	// out the same keep their embeddings
+	if stale, err := e.storage.InvalidateChunking(ctx, e.chunking()); err != nil {
+		slog.Error("Failed to check thread embedding chunking", "error", err)
+	} else if stale > 0 {
+		slog.Info("Chunking changed, marked thread embeddings stale", "chunking", e.chunking(), "embeddings", stale)
+	}
+
+	timer := time.NewTimer(e.interval)
+	defer timer.Stop()
 
 	for {
 		select {
@@ -52,45 +193,103 @@ func (e *EmbeddingProcessor) Start(ctx context.Context) {
 		case <-e.done:
 			slog.Info("Slack embedding processor stopped")
 			return
-		case <-ticker.C:
-			if err := e.processBatch(ctx); err != nil {
+		case <-timer.C:
+			found, err := e.processBatch(ctx)
+			if err != nil {
 				slog.Error("Failed to process embedding batch", "error", err)
+			} else {
+				e.interval = e.nextInterval(found)
 			}
+			timer.Reset(e.interval)
 		}
 	}
 }
 
+// nextInterval halves the interval after a full batch and doubles it after an
+// empty one, within the configured bounds
+func (e *EmbeddingProcessor) nextInterval(found int) time.Duration {
+	next := e.interval
+	switch {
+	case found >= e.batchSize:
+		next = e.interval / 2
+	case found == 0:
+		next = e.interval * 2
+	}
+
+	next = e.clampInterval(next)
+	if next != e.interval {
+		slog.Debug("Adjusted embedding processor interval", "interval", next, "threads_found", found)
+	}
+	return next
+}
+
+func (e *EmbeddingProcessor) clampInterval(interval time.Duration) time.Duration {
+	if interval < e.minInterval {
+		return e.minInterval
+	}
+	if interval > e.maxInterval {
+		return e.maxInterval
+	}
+	return interval
+}
+
 // Stop stops the embedding processor
 func (e *EmbeddingProcessor) Stop() {
 	close(e.done)
 }
 
-// processBatch processes a batch of threads that need embeddings
-func (e *EmbeddingProcessor) processBatch(ctx context.Context) error {
+// processBatch processes a batch of threads that need embeddings and returns
+// how many threads were found
+func (e *EmbeddingProcessor) processBatch(ctx context.Context) (int, error) {
 	// Get threads without embeddings
 	threadIDs, err := e.storage.GetThreadsWithoutEmbeddings(ctx, e.batchSize)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if len(threadIDs) == 0 {
 		slog.Debug("No threads found needing embeddings")
-		return nil
+		return 0, nil
 	}
 
-	slog.Info("Processing embedding batch", "count", len(threadIDs))
+	slog.Info("Processing embedding batch", "count", len(threadIDs), "workers", e.concurrency)
+
+	// Workers take threads until the batch is done or the context is canceled;
+	// a thread that fails is logged and left for a later batch
+	threads := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(e.concurrency, len(threadIDs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for threadID := range threads {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := e.processThread(ctx, threadID); err != nil {
+					slog.Error("Failed to process thread embedding",
+						"error", err,
+						"thread_id", threadID)
+				}
+			}
+		}()
+	}
 
-	// Process each thread
+feed:
 	for _, threadID := range threadIDs {
-		if err := e.processThread(ctx, threadID); err != nil {
-			slog.Error("Failed to process thread embedding",
-				"error", err,
-				"thread_id", threadID)
-			continue
+		select {
+		case threads <- threadID:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(threads)
+	wg.Wait()
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return len(threadIDs), nil
 }
 
 // processThread processes a single thread for embedding generation
@@ -109,20 +308,61 @@ func (e *EmbeddingProcessor) processThread(ctx context.Context, threadID string)
 	// Build thread content with human-readable timestamps
 	threadContent := e.buildThreadContent(messages)
 
-	// Validate content quality
+	// Validate content quality; an edit may have made a previously embedded thread low quality
 	if !e.isQualityContent(threadContent) {
 		slog.Debug("Skipping low quality thread content",
 			"thread_id", threadID,
 			"content_length", len(threadContent))
-		return nil
+		return e.storage.CompleteThreadEmbeddings(ctx, threadID, 0)
 	}
 
-	// Chunk the content if needed (7K words max per chunk)
+	// Chunk the content if needed (7K words, or as configured, and 32K characters max per chunk)
 	chunks := e.chunkContent(threadContent)
+	chunkRanges := e.chunkMessageRanges(threadID, messages)
+
+	// Chunks whose content is unchanged since they were embedded keep their embedding
+	storedHashes, err := e.storage.GetThreadEmbeddingHashes(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread embedding hashes: %w", err)
+	}
 
 	// Process each chunk
 	for chunkIndex, chunk := range chunks {
 		contentHash := e.hashContent(chunk)
+		if storedHashes[chunkIndex] == contentHash {
+			slog.Debug("Thread chunk unchanged, keeping embedding",
+				"thread_id", threadID,
+				"chunk_index", chunkIndex)
+			continue
+		}
+
+		chunkRange := ChunkRange{ThreadID: threadID}
+		if chunkIndex < len(chunkRanges) {
+			chunkRange = chunkRanges[chunkIndex]
+		}
+
+		if e.dryRun {
+			slog.Info("Dry run: would embed thread chunk",
+				"thread_id", threadID,
+				"chunk_index", chunkIndex,
+				"chars", len(chunk),
+				"estimated_tokens", estimateTokens(chunk),
+				"preview", preview(chunk, 200))
+			// An embedded chunk keeps its embedding until dry runs end
+			if _, stored := storedHashes[chunkIndex]; stored {
+				continue
+			}
+			if err := e.storage.StoreThreadEmbedding(ctx, chunkRange, chunkIndex, dryRunContentHash, nil); err != nil {
+				return fmt.Errorf("failed to store dry run marker for chunk %d: %w", chunkIndex, err)
+			}
+			continue
+		}
+
+		if e.limiter != nil {
+			if err := e.limiter.Wait(ctx); err != nil {
+				return fmt.Errorf("failed to wait for embedding rate limit: %w", err)
+			}
+		}
 
 		// Generate embedding
 		embedding, err := e.embeddingService.GenerateEmbedding(ctx, chunk)
@@ -131,7 +371,7 @@ func (e *EmbeddingProcessor) processThread(ctx context.Context, threadID string)
 		}
 
 		// Store thread embedding
-		if err := e.storage.StoreThreadEmbedding(ctx, threadID, chunkIndex, contentHash, embedding); err != nil {
+		if err := e.storage.StoreThreadEmbedding(ctx, chunkRange, chunkIndex, contentHash, embedding); err != nil {
 			return fmt.Errorf("failed to store thread embedding for chunk %d: %w", chunkIndex, err)
 		}
 
@@ -141,6 +381,11 @@ func (e *EmbeddingProcessor) processThread(ctx context.Context, threadID string)
 			"content_length", len(chunk))
 	}
 
+	// Drop chunks past the end of a thread that shrank and mark the rest current
+	if err := e.storage.CompleteThreadEmbeddings(ctx, threadID, len(chunks)); err != nil {
+		return fmt.Errorf("failed to complete thread embeddings: %w", err)
+	}
+
 	return nil
 }
 
@@ -149,58 +394,192 @@ func (e *EmbeddingProcessor) buildThreadContent(messages []SlackMessage) string
 	var parts []string
 
 	for _, msg := range messages {
-		// Convert timestamp to human-readable format
-		timestamp := e.formatTimestamp(msg.MessageTimestamp)
-
-		// Format: [December 15, 2024, 3:45PM] Username: Content
-		formattedMsg := fmt.Sprintf("[%s] %s: %s", timestamp, msg.UserName, msg.Content)
-		parts = append(parts, formattedMsg)
+		parts = append(parts, e.formatMessage(msg))
 	}
 
 	return strings.Join(parts, "\n")
 }
 
-// chunkContent splits content into chunks of approximately 7K words
-func (e *EmbeddingProcessor) chunkContent(content string) []string {
-	words := strings.Fields(content)
-	maxWordsPerChunk := 7000
+// formatMessage formats a single message with a human-readable timestamp
+func (e *EmbeddingProcessor) formatMessage(msg SlackMessage) string {
+	// Convert timestamp to human-readable format
+	timestamp := e.formatTimestamp(msg.MessageTimestamp)
 
-	if len(words) <= maxWordsPerChunk {
-		return []string{content}
+	content := msg.Content
+	if e.trimQuotes {
+		content = trimQuotedLines(content)
 	}
 
-	var chunks []string
+	// Format: [December 15, 2024, 3:45PM] Username (Title, Team): Content
+	return fmt.Sprintf("[%s] %s: %s", timestamp, msg.AuthorLabel(), content)
+}
+
+// trimQuotedLines drops blockquoted lines (">", or "&gt;" as Slack escapes it)
+// from content. Content that is entirely quoted is kept as is, since a quote
+// posted on its own is the message's substance.
+func trimQuotedLines(content string) string {
+	var kept []string
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") || strings.HasPrefix(trimmed, "&gt;") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	trimmed := strings.TrimSpace(strings.Join(kept, "\n"))
+	if trimmed == "" {
+		return content
+	}
+	return trimmed
+}
+
+// chunkMessageRanges returns the first and last message covered by each chunk
+// produced by chunkContent for the same messages
+func (e *EmbeddingProcessor) chunkMessageRanges(threadID string, messages []SlackMessage) []ChunkRange {
+	packer := e.newChunkPacker()
+	var timestamps []string
 
-	for i := 0; i < len(words); i += maxWordsPerChunk {
-		end := i + maxWordsPerChunk
-		if end > len(words) {
-			end = len(words)
+	for _, msg := range messages {
+		for _, word := range splitChunkWords(e.formatMessage(msg)) {
+			packer.add(word)
+			timestamps = append(timestamps, msg.MessageTimestamp)
 		}
+	}
+
+	// A message belongs to every chunk its words fall into, including
+	// chunks it only overlaps into
+	ranges := make([]ChunkRange, len(packer.bounds))
+	for i, bounds := range packer.bounds {
+		ranges[i] = ChunkRange{
+			ThreadID:       threadID,
+			StartTimestamp: timestamps[bounds.start],
+			EndTimestamp:   timestamps[bounds.end-1],
+		}
+	}
+
+	return ranges
+}
+
+// chunkContent splits content into chunks of at most the configured words
+// and maxCharsPerChunk characters, so no part of an oversized thread or
+// single message is lost to truncation by the embedding service. With an
+// overlap, each chunk starts with the last words of the one before.
+func (e *EmbeddingProcessor) chunkContent(content string) []string {
+	words := splitChunkWords(content)
 
-		chunk := strings.Join(words[i:end], " ")
-		chunks = append(chunks, chunk)
+	if len(words) <= e.maxChunkWords() && len(content) <= maxCharsPerChunk {
+		return []string{content}
+	}
+
+	packer := e.newChunkPacker()
+	for _, word := range words {
+		packer.add(word)
+	}
+
+	chunks := make([]string, len(packer.bounds))
+	for i, bounds := range packer.bounds {
+		chunks[i] = strings.Join(packer.words[bounds.start:bounds.end], " ")
 	}
 
 	return chunks
 }
 
-// formatTimestamp converts Slack timestamp to human-readable format
-func (e *EmbeddingProcessor) formatTimestamp(slackTimestamp string) string {
-	// Parse Slack timestamp (Unix timestamp with decimal)
-	parts := strings.Split(slackTimestamp, ".")
-	if len(parts) == 0 {
-		return slackTimestamp // fallback
+func (e *EmbeddingProcessor) newChunkPacker() *chunkPacker {
+	return &chunkPacker{maxWords: e.maxChunkWords(), overlap: e.chunkOverlap}
+}
+
+// chunkPacker assigns words to chunks in order, starting a new chunk when
+// either the word or the character limit would be exceeded. A new chunk
+// repeats up to overlap trailing words of the previous one, as many as fit.
+type chunkPacker struct {
+	maxWords int
+	overlap  int
+
+	words  []string
+	bounds []chunkBounds
+	chars  int // characters in the current chunk, including separators
+}
+
+// chunkBounds are the indexes of a chunk's first word and one past its last
+type chunkBounds struct {
+	start, end int
+}
+
+// add places word at the end of the current chunk or in a new one
+func (p *chunkPacker) add(word string) {
+	p.words = append(p.words, word)
+	index := len(p.words) - 1
+
+	last := len(p.bounds) - 1
+	if last >= 0 && p.bounds[last].end-p.bounds[last].start < p.maxWords && p.chars+1+len(word) <= maxCharsPerChunk {
+		p.bounds[last].end++
+		p.chars += 1 + len(word)
+		return
+	}
+
+	// Always leave room for the new word, and move past the previous chunk's
+	// start so every chunk adds something
+	start, chars := index, len(word)
+	for last >= 0 && start-1 > p.bounds[last].start && index-start < p.overlap && index-start+1 < p.maxWords {
+		withPrevious := chars + 1 + len(p.words[start-1])
+		if withPrevious > maxCharsPerChunk {
+			break
+		}
+		start--
+		chars = withPrevious
+	}
+
+	p.bounds = append(p.bounds, chunkBounds{start: start, end: index + 1})
+	p.chars = chars
+}
+
+// splitChunkWords splits content on whitespace, breaking any word longer than
+// maxCharsPerChunk (e.g. a pasted blob without spaces) at rune boundaries
+func splitChunkWords(content string) []string {
+	var words []string
+
+	for _, word := range strings.Fields(content) {
+		for len(word) > maxCharsPerChunk {
+			cut := maxCharsPerChunk
+			for cut > 0 && !utf8.RuneStart(word[cut]) {
+				cut--
+			}
+			words = append(words, word[:cut])
+			word = word[cut:]
+		}
+		words = append(words, word)
 	}
 
-	unixSeconds, err := strconv.ParseInt(parts[0], 10, 64)
+	return words
+}
+
+// formatTimestamp converts Slack timestamp to human-readable format, keeping
+// it as is when it can't be parsed
+func (e *EmbeddingProcessor) formatTimestamp(slackTimestamp string) string {
+	t, err := parseSlackTimestamp(slackTimestamp)
 	if err != nil {
-		return slackTimestamp // fallback
+		slog.Warn("Keeping unparseable Slack timestamp in thread content", "timestamp", slackTimestamp, "error", err)
+		return slackTimestamp
 	}
 
-	t := time.Unix(unixSeconds, 0)
 	return t.Format("January 2, 2006, 3:04PM")
 }
 
+// estimateTokens approximates a chunk's size in embedding tokens; English
+// text averages about four characters per token
+func estimateTokens(chunk string) int {
+	return (utf8.RuneCountInString(chunk) + 3) / 4
+}
+
+// preview shortens a chunk to its first maxChars characters for logs
+func preview(chunk string, maxChars int) string {
+	if runes := []rune(chunk); len(runes) > maxChars {
+		return string(runes[:maxChars]) + "..."
+	}
+	return chunk
+}
+
 // hashContent generates a SHA256 hash of content
 func (e *EmbeddingProcessor) hashContent(content string) string {
 	hash := sha256.Sum256([]byte(content))
@@ -214,15 +593,15 @@ func (e *EmbeddingProcessor) isQualityContent(content string) bool {
 		return false
 	}
 
-	// Filter out obvious test/placeholder content (less strict)
+	// Filter out obvious test/placeholder content, matched as whole words so
+	// "the latest messages" or "for example" are kept
 	testPatterns := []string{
-		"hello world", "sample", "example", "placeholder",
-		"lorem ipsum", "dummy text", "test message",
+		"hello world", "lorem ipsum", "dummy text", "test message",
 	}
 
 	contentLower := strings.ToLower(content)
 	for _, pattern := range testPatterns {
-		if strings.Contains(contentLower, pattern) {
+		if ContainsPhrase(contentLower, pattern) {
 			return false
 		}
 	}
@@ -241,6 +620,43 @@ func (e *EmbeddingProcessor) isQualityContent(content string) bool {
 	return true
 }
 
+// ContainsPhrase reports whether phrase occurs in content as whole words: a
+// phrase starting or ending with a letter or digit must not be preceded or
+// followed by one. Phrases like ":+1:" or emoji match anywhere.
+func ContainsPhrase(content, phrase string) bool {
+	if phrase == "" {
+		return false
+	}
+
+	first, _ := utf8.DecodeRuneInString(phrase)
+	last, _ := utf8.DecodeLastRuneInString(phrase)
+
+	for offset := 0; offset < len(content); {
+		i := strings.Index(content[offset:], phrase)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(phrase)
+
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		joinedBefore := isWordRune(first) && start > 0 && isWordRune(before)
+		joinedAfter := isWordRune(last) && end < len(content) && isWordRune(after)
+		if !joinedBefore && !joinedAfter {
+			return true
+		}
+
+		_, size := utf8.DecodeRuneInString(content[start:])
+		offset = start + size
+	}
+	return false
+}
+
+// isWordRune reports whether r is part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
 // GetStats returns processing statistics
 func (e *EmbeddingProcessor) GetStats(ctx context.Context) (int, error) {
 	threadIDs, err := e.storage.GetThreadsWithoutEmbeddings(ctx, 1000)
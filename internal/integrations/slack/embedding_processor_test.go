@@ -0,0 +1,585 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingProcessor_AdaptiveInterval(t *testing.T) {
+	processor := NewEmbeddingProcessor(nil, nil)
+	processor.SetAdaptiveInterval(5*time.Second, 4*time.Minute)
+
+	// Consecutive full batches shorten the interval down to the minimum
+	expected := []time.Duration{30 * time.Second, 15 * time.Second, 7500 * time.Millisecond, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		processor.interval = processor.nextInterval(processor.batchSize)
+		if processor.interval != want {
+			t.Errorf("Full batch %d: expected interval %v, got %v", i+1, want, processor.interval)
+		}
+	}
+
+	// A partial batch keeps the current interval
+	processor.interval = processor.nextInterval(processor.batchSize - 1)
+	if processor.interval != 5*time.Second {
+		t.Errorf("Partial batch: expected interval to stay 5s, got %v", processor.interval)
+	}
+
+	// An empty batch lengthens it, up to the maximum
+	processor.interval = processor.nextInterval(0)
+	if processor.interval != 10*time.Second {
+		t.Errorf("Empty batch: expected interval 10s, got %v", processor.interval)
+	}
+	for i := 0; i < 10; i++ {
+		processor.interval = processor.nextInterval(0)
+	}
+	if processor.interval != 4*time.Minute {
+		t.Errorf("Expected interval capped at 4m, got %v", processor.interval)
+	}
+}
+
+func TestEmbeddingProcessor_FixedIntervalByDefault(t *testing.T) {
+	processor := NewEmbeddingProcessor(nil, nil)
+
+	if next := processor.nextInterval(processor.batchSize); next != 60*time.Second {
+		t.Errorf("Expected fixed 60s interval after full batch, got %v", next)
+	}
+	if next := processor.nextInterval(0); next != 60*time.Second {
+		t.Errorf("Expected fixed 60s interval after empty batch, got %v", next)
+	}
+
+	// Invalid bounds are ignored
+	processor.SetAdaptiveInterval(0, time.Minute)
+	processor.SetAdaptiveInterval(time.Minute, time.Second)
+	if processor.minInterval != 60*time.Second || processor.maxInterval != 60*time.Second {
+		t.Errorf("Expected invalid bounds to be ignored, got min %v max %v", processor.minInterval, processor.maxInterval)
+	}
+}
+
+// mockThreadEmbeddingStore keeps one thread's messages and chunk embeddings in memory
+type mockThreadEmbeddingStore struct {
+	messages   []SlackMessage
+	hashes     map[int]string
+	embeddings map[int][]float32 // recorded when non-nil
+	chunkCount int
+	chunking   string
+}
+
+func (m *mockThreadEmbeddingStore) GetThreadsWithoutEmbeddings(ctx context.Context, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockThreadEmbeddingStore) GetMessagesInThread(ctx context.Context, threadID string) ([]SlackMessage, error) {
+	return m.messages, nil
+}
+
+func (m *mockThreadEmbeddingStore) GetThreadEmbeddingHashes(ctx context.Context, threadID string) (map[int]string, error) {
+	hashes := make(map[int]string, len(m.hashes))
+	for chunkIndex, hash := range m.hashes {
+		hashes[chunkIndex] = hash
+	}
+	return hashes, nil
+}
+
+func (m *mockThreadEmbeddingStore) StoreThreadEmbedding(ctx context.Context, chunk ChunkRange, chunkIndex int, contentHash string, embedding []float32) error {
+	m.hashes[chunkIndex] = contentHash
+	if m.embeddings != nil {
+		m.embeddings[chunkIndex] = embedding
+	}
+	return nil
+}
+
+func (m *mockThreadEmbeddingStore) CompleteThreadEmbeddings(ctx context.Context, threadID string, chunkCount int) error {
+	for chunkIndex := range m.hashes {
+		if chunkIndex >= chunkCount {
+			delete(m.hashes, chunkIndex)
+		}
+	}
+	m.chunkCount = chunkCount
+	return nil
+}
+
+func (m *mockThreadEmbeddingStore) InvalidateChunking(ctx context.Context, chunking string) (int64, error) {
+	var stale int64
+	if m.chunking != chunking {
+		stale = int64(len(m.hashes))
+	}
+	m.chunking = chunking
+	return stale, nil
+}
+
+// countingEmbedder records the text of every embedding request
+type countingEmbedder struct {
+	texts []string
+}
+
+func (c *countingEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	c.texts = append(c.texts, text)
+	return []float32{0.1}, nil
+}
+
+func TestEmbeddingProcessor_ReembedsOnlyChangedChunks(t *testing.T) {
+	store := &mockThreadEmbeddingStore{
+		messages: buildLongThread("T1", 10, 2000),
+		hashes:   make(map[int]string),
+	}
+	embedder := &countingEmbedder{}
+	processor := NewEmbeddingProcessor(store, embedder)
+
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to process thread: %v", err)
+	}
+	chunkCount := len(embedder.texts)
+	if chunkCount < 3 {
+		t.Fatalf("Expected a multi-chunk thread, got %d chunks", chunkCount)
+	}
+	original := make(map[int]string)
+	for chunkIndex, hash := range store.hashes {
+		original[chunkIndex] = hash
+	}
+
+	// Edit the first message without changing its length, so chunk boundaries stay put
+	store.messages[0].Content = strings.TrimSpace(strings.Repeat("edit0 ", 2000))
+	embedder.texts = nil
+
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to reprocess thread: %v", err)
+	}
+
+	if len(embedder.texts) != 1 || !strings.Contains(embedder.texts[0], "edit0") {
+		t.Fatalf("Expected only the edited chunk to be re-embedded, got %d embedding requests", len(embedder.texts))
+	}
+	if store.hashes[0] == original[0] {
+		t.Errorf("Expected the edited chunk's hash to be updated")
+	}
+	for chunkIndex := 1; chunkIndex < chunkCount; chunkIndex++ {
+		if store.hashes[chunkIndex] != original[chunkIndex] {
+			t.Errorf("Expected unchanged chunk %d to keep its embedding", chunkIndex)
+		}
+	}
+	if store.chunkCount != chunkCount {
+		t.Errorf("Expected thread embeddings completed with %d chunks, got %d", chunkCount, store.chunkCount)
+	}
+
+	// Shrinking the thread drops the embeddings of chunks past its new end
+	store.messages = store.messages[:2]
+	embedder.texts = nil
+
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to reprocess shrunk thread: %v", err)
+	}
+	if len(store.hashes) != 1 || store.chunkCount != 1 {
+		t.Errorf("Expected embeddings for removed chunks to be dropped, still have %d", len(store.hashes))
+	}
+}
+
+func TestEmbeddingProcessor_RechunksAfterChunkingChange(t *testing.T) {
+	store := &mockThreadEmbeddingStore{
+		messages: buildLongThread("T1", 10, 2000),
+		hashes:   make(map[int]string),
+	}
+	embedder := &countingEmbedder{}
+	processor := NewEmbeddingProcessor(store, embedder)
+
+	// Start records the chunking before processing anything
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	processor.Start(ctx)
+	if store.chunking != "words=7000,overlap=0" {
+		t.Fatalf("Expected the default chunking to be recorded, got %q", store.chunking)
+	}
+
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to process thread: %v", err)
+	}
+	original := len(store.hashes)
+
+	// New settings are recorded on the next start, marking the embeddings
+	// stale, and reprocessing replaces every chunk
+	processor.SetChunking(3000, 200)
+	processor.Start(ctx)
+	if store.chunking != "words=3000,overlap=200" {
+		t.Fatalf("Expected the new chunking to be recorded, got %q", store.chunking)
+	}
+	embedder.texts = nil
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to reprocess thread: %v", err)
+	}
+	if len(store.hashes) != store.chunkCount || len(embedder.texts) != store.chunkCount || store.chunkCount <= original {
+		t.Errorf("Expected all %d smaller chunks embedded, got %d embeddings and %d stored", store.chunkCount, len(embedder.texts), len(store.hashes))
+	}
+	for _, text := range embedder.texts {
+		if words := len(strings.Fields(text)); words > 3000 {
+			t.Errorf("Expected chunks of at most 3000 words, got %d", words)
+		}
+	}
+}
+
+func TestEmbeddingProcessor_DryRun(t *testing.T) {
+	// The thread's first chunk was embedded before it grew
+	store := &mockThreadEmbeddingStore{
+		messages:   buildLongThread("T1", 10, 2000),
+		hashes:     map[int]string{0: "embedded"},
+		embeddings: map[int][]float32{0: {0.1, 0.2}},
+	}
+	embedder := &countingEmbedder{}
+	processor := NewEmbeddingProcessor(store, embedder)
+	processor.SetDryRun(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	processor.Start(ctx)
+	if store.chunking != "words=7000,overlap=0,dry_run" {
+		t.Fatalf("Expected dry runs to record their own chunking, got %q", store.chunking)
+	}
+
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to process thread: %v", err)
+	}
+	if len(embedder.texts) != 0 {
+		t.Errorf("Expected no embedding requests in a dry run, got %d", len(embedder.texts))
+	}
+	if store.chunkCount < 3 || len(store.hashes) != store.chunkCount {
+		t.Fatalf("Expected a marker for each of the thread's chunks, got %d for %d chunks", len(store.hashes), store.chunkCount)
+	}
+	if store.hashes[0] != "embedded" || len(store.embeddings[0]) != 2 {
+		t.Errorf("Expected the embedded chunk to keep its embedding, got hash %q", store.hashes[0])
+	}
+	for chunkIndex := 1; chunkIndex < store.chunkCount; chunkIndex++ {
+		if store.hashes[chunkIndex] != dryRunContentHash || store.embeddings[chunkIndex] != nil {
+			t.Errorf("Expected chunk %d marked as a dry run without an embedding, got hash %q", chunkIndex, store.hashes[chunkIndex])
+		}
+	}
+
+	// Leaving dry runs records new chunking, marking the thread stale, and
+	// reprocessing embeds every marked chunk
+	processor.SetDryRun(false)
+	if stale, err := store.InvalidateChunking(context.Background(), processor.chunking()); err != nil || stale == 0 {
+		t.Fatalf("Expected the dry run markers to be marked stale, got %d (%v)", stale, err)
+	}
+	if err := processor.processThread(context.Background(), "T1"); err != nil {
+		t.Fatalf("Failed to reprocess thread: %v", err)
+	}
+	if len(embedder.texts) != store.chunkCount {
+		t.Errorf("Expected all %d chunks embedded after the dry run, got %d", store.chunkCount, len(embedder.texts))
+	}
+	for chunkIndex, hash := range store.hashes {
+		if hash == dryRunContentHash || store.embeddings[chunkIndex] == nil {
+			t.Errorf("Expected chunk %d's marker to be replaced by an embedding", chunkIndex)
+		}
+	}
+}
+
+func TestEmbeddingProcessor_QuoteTrimming(t *testing.T) {
+	reply := "&gt; Is the staging deploy stuck?\n&gt; It has been queued for an hour\nYes, the runner ran out of disk. Cleared it and the deploy finished."
+	messages := []SlackMessage{
+		{ThreadID: "T1", MessageTimestamp: "1700000000.000100", UserName: "alice", Content: reply},
+		{ThreadID: "T1", MessageTimestamp: "1700000001.000100", UserName: "bob", Content: "> pasted from the runbook: clear /var/lib/docker"},
+	}
+
+	testCases := []struct {
+		name        string
+		trimQuotes  bool
+		expectQuote bool
+	}{
+		{name: "disabled", trimQuotes: false, expectQuote: true},
+		{name: "enabled", trimQuotes: true, expectQuote: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockThreadEmbeddingStore{messages: messages, hashes: make(map[int]string)}
+			embedder := &countingEmbedder{}
+			processor := NewEmbeddingProcessor(store, embedder)
+			processor.SetQuoteTrimming(tc.trimQuotes)
+
+			if err := processor.processThread(context.Background(), "T1"); err != nil {
+				t.Fatalf("Failed to process thread: %v", err)
+			}
+			if len(embedder.texts) != 1 {
+				t.Fatalf("Expected 1 embedding request, got %d", len(embedder.texts))
+			}
+
+			embedded := embedder.texts[0]
+			if !strings.Contains(embedded, "Yes, the runner ran out of disk") {
+				t.Errorf("Expected the reply's new content to be embedded, got %q", embedded)
+			}
+			if got := strings.Contains(embedded, "Is the staging deploy stuck?"); got != tc.expectQuote {
+				t.Errorf("Expected quoted message embedded %t, got %t: %q", tc.expectQuote, got, embedded)
+			}
+			// A message that is only a quote keeps its content
+			if !strings.Contains(embedded, "pasted from the runbook") {
+				t.Errorf("Expected an entirely quoted message to be kept, got %q", embedded)
+			}
+		})
+	}
+}
+
+// batchEmbeddingStore serves a batch of one-message threads and records which
+// were completed; it is safe for concurrent use
+type batchEmbeddingStore struct {
+	mu        sync.Mutex
+	threadIDs []string
+	failing   string // thread whose messages can't be read
+	completed map[string]bool
+}
+
+func newBatchEmbeddingStore(threads int) *batchEmbeddingStore {
+	store := &batchEmbeddingStore{completed: make(map[string]bool)}
+	for i := 0; i < threads; i++ {
+		store.threadIDs = append(store.threadIDs, fmt.Sprintf("17000000%02d.000100", i))
+	}
+	return store
+}
+
+func (m *batchEmbeddingStore) GetThreadsWithoutEmbeddings(ctx context.Context, limit int) ([]string, error) {
+	return m.threadIDs, nil
+}
+
+func (m *batchEmbeddingStore) GetMessagesInThread(ctx context.Context, threadID string) ([]SlackMessage, error) {
+	if threadID == m.failing {
+		return nil, errors.New("connection reset")
+	}
+	return []SlackMessage{{
+		ThreadID:         threadID,
+		MessageTimestamp: threadID,
+		UserName:         "alice",
+		Content:          "The nightly backup job failed again because the disk filled up",
+	}}, nil
+}
+
+func (m *batchEmbeddingStore) GetThreadEmbeddingHashes(ctx context.Context, threadID string) (map[int]string, error) {
+	return nil, nil
+}
+
+func (m *batchEmbeddingStore) StoreThreadEmbedding(ctx context.Context, chunk ChunkRange, chunkIndex int, contentHash string, embedding []float32) error {
+	return nil
+}
+
+func (m *batchEmbeddingStore) CompleteThreadEmbeddings(ctx context.Context, threadID string, chunkCount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completed[threadID] = true
+	return nil
+}
+
+func (m *batchEmbeddingStore) InvalidateChunking(ctx context.Context, chunking string) (int64, error) {
+	return 0, nil
+}
+
+func (m *batchEmbeddingStore) completedCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.completed)
+}
+
+// slowEmbedder takes delay per request, or until the context is canceled,
+// and records the most requests in flight at once
+type slowEmbedder struct {
+	delay time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	calls       int
+	started     chan struct{} // receives a value as each request starts, if set
+}
+
+func (s *slowEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	s.mu.Lock()
+	s.inFlight++
+	s.calls++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	if s.started != nil {
+		select {
+		case s.started <- struct{}{}:
+		default:
+		}
+	}
+
+	select {
+	case <-time.After(s.delay):
+		return []float32{0.1}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestEmbeddingProcessor_ConcurrencyIsBounded(t *testing.T) {
+	store := newBatchEmbeddingStore(10)
+	store.failing = store.threadIDs[4]
+	embedder := &slowEmbedder{delay: 20 * time.Millisecond}
+	processor := NewEmbeddingProcessor(store, embedder)
+	processor.SetConcurrency(3, 0)
+
+	found, err := processor.processBatch(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a failing thread not to fail the batch, got %v", err)
+	}
+
+	if found != 10 {
+		t.Errorf("Expected 10 threads found, got %d", found)
+	}
+	if store.completedCount() != 9 {
+		t.Errorf("Expected every thread but the failing one to be embedded, got %d", store.completedCount())
+	}
+	if store.completed[store.failing] {
+		t.Error("Expected the failing thread to be left for a later batch")
+	}
+	if embedder.maxInFlight > 3 {
+		t.Errorf("Expected at most 3 embedding requests at once, got %d", embedder.maxInFlight)
+	}
+	if embedder.maxInFlight < 2 {
+		t.Errorf("Expected threads to be embedded in parallel, got at most %d request at once", embedder.maxInFlight)
+	}
+}
+
+func TestEmbeddingProcessor_SequentialByDefault(t *testing.T) {
+	store := newBatchEmbeddingStore(4)
+	embedder := &slowEmbedder{delay: time.Millisecond}
+	processor := NewEmbeddingProcessor(store, embedder)
+
+	// Invalid settings are ignored
+	processor.SetConcurrency(0, 10)
+	processor.SetConcurrency(4, -1)
+
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if embedder.maxInFlight != 1 {
+		t.Errorf("Expected one embedding request at a time, got %d", embedder.maxInFlight)
+	}
+	if store.completedCount() != 4 {
+		t.Errorf("Expected all 4 threads to be embedded, got %d", store.completedCount())
+	}
+}
+
+func TestEmbeddingProcessor_RateLimitsAcrossWorkers(t *testing.T) {
+	store := newBatchEmbeddingStore(10)
+	embedder := &slowEmbedder{}
+	processor := NewEmbeddingProcessor(store, embedder)
+	processor.SetConcurrency(5, 50)
+
+	start := time.Now()
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A burst of 5, then the other 5 requests at 50 per second
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected 10 requests at 50 per second to take at least 80ms, took %v", elapsed)
+	}
+	if store.completedCount() != 10 {
+		t.Errorf("Expected all 10 threads to be embedded, got %d", store.completedCount())
+	}
+}
+
+func TestEmbeddingProcessor_CancellationStopsWorkers(t *testing.T) {
+	store := newBatchEmbeddingStore(10)
+	embedder := &slowEmbedder{delay: time.Minute, started: make(chan struct{}, 1)}
+	processor := NewEmbeddingProcessor(store, embedder)
+	processor.SetConcurrency(2, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-embedder.started
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := processor.processBatch(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the batch to report cancellation, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected workers to stop promptly after cancellation")
+	}
+
+	if store.completedCount() != 0 {
+		t.Errorf("Expected no thread to be completed, got %d", store.completedCount())
+	}
+	if embedder.calls > 2 {
+		t.Errorf("Expected no requests after cancellation beyond those in flight, got %d", embedder.calls)
+	}
+}
+
+func TestContainsPhrase(t *testing.T) {
+	testCases := []struct {
+		content  string
+		phrase   string
+		expected bool
+	}{
+		{"a test message!", "test message", true},
+		{"latest messages", "test message", false},
+		{"forgot it again", "got it", false},
+		{"forgot it, then got it", "got it", true},
+		{"lgtm :+1:", ":+1:", true},
+		{"shipped✅", "✅", true},
+		{"hello worlds apart", "hello world", false},
+		{"anything", "", false},
+	}
+
+	for _, tc := range testCases {
+		if result := ContainsPhrase(tc.content, tc.phrase); result != tc.expected {
+			t.Errorf("ContainsPhrase(%q, %q) = %v, want %v", tc.content, tc.phrase, result, tc.expected)
+		}
+	}
+}
+
+func TestEmbeddingProcessor_QualityContentMatchesWholeWords(t *testing.T) {
+	processor := NewEmbeddingProcessor(&mockThreadEmbeddingStore{}, &countingEmbedder{})
+
+	testCases := []struct {
+		content  string
+		expected bool
+	}{
+		{"For example, roll back with make rollback", true},
+		{"A sample config is in the platform repo", true},
+		{"The placeholder values in staging.env need replacing", true},
+		{"Check the latest messages in #deploys", true},
+		{"Posting a test message here", false},
+		{"Lorem ipsum dolor sit amet", false},
+		{"hello world", false},
+	}
+
+	for _, tc := range testCases {
+		if result := processor.isQualityContent(tc.content); result != tc.expected {
+			t.Errorf("isQualityContent(%q) = %v, want %v", tc.content, result, tc.expected)
+		}
+	}
+}
+
+func TestEmbeddingProcessor_FormatTimestamp(t *testing.T) {
+	processor := NewEmbeddingProcessor(&mockThreadEmbeddingStore{}, &countingEmbedder{})
+
+	// 59.9s past the minute stays in that minute
+	want := time.Unix(1700000039, 900000000).Format("January 2, 2006, 3:04PM")
+	if got := processor.formatTimestamp("1700000039.900000"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	for _, ts := range []string{"garbage", "12ab.34", "0.000000"} {
+		if got := processor.formatTimestamp(ts); got != ts {
+			t.Errorf("Expected unparseable timestamp %q kept as is, got %q", ts, got)
+		}
+	}
+}
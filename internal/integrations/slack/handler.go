@@ -5,22 +5,123 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"knowthis/internal/apierror"
+	"knowthis/internal/middleware"
+
 	"github.com/slack-go/slack"
 )
 
+// slackAPI is the subset of the Slack client used by the handler
+type slackAPI interface {
+	AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error)
+	GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+	GetFileContext(ctx context.Context, downloadURL string, writer io.Writer) error
+	GetFileInfoContext(ctx context.Context, fileID string, count, page int) (*slack.File, []slack.Comment, *slack.Paging, error)
+	GetPermalinkContext(ctx context.Context, params *slack.PermalinkParameters) (string, error)
+	GetUserInfoContext(ctx context.Context, user string) (*slack.User, error)
+	GetUserProfileContext(ctx context.Context, params *slack.GetUserProfileParameters) (*slack.UserProfile, error)
+	ListBookmarksContext(ctx context.Context, channelID string) ([]slack.Bookmark, error)
+	PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error)
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+}
+
+// MessageStore stores collected Slack messages
+type MessageStore interface {
+	StoreMessage(ctx context.Context, msg SlackMessage) (*SlackMessage, bool, error)
+}
+
+// ThreadSummarizer summarizes a thread's messages, oldest first
+type ThreadSummarizer interface {
+	SummarizeThread(ctx context.Context, messages []SlackMessage) (string, error)
+}
+
+// Message action callback IDs
+const (
+	collectContextAction  = "collect_context"
+	summarizeThreadAction = "summarize_thread"
+)
+
 // SlackHandler handles Slack message actions and API interactions
 type SlackHandler struct {
-	client    *slack.Client
-	storage   *SlackStorage
+	client    slackAPI
+	storage   MessageStore
+	allowlist *ChannelAllowlist
 	botUserID string
+
+	// Retry policy for user-facing notifications
+	notifyMaxAttempts int
+	notifyRetryDelay  time.Duration
+
+	// How often a Slack API call waits out a rate limit before failing
+	rateLimitRetries int
+
+	// Author title/team enrichment; teamField is a custom profile field ID
+	profileEnrichment bool
+	profileTeamField  string
+
+	// Author profiles by user ID, cached to avoid a users.info call per message
+	profilesMu sync.Mutex
+	profiles   map[string]cachedProfile
+
+	// Stores the channel's bookmarked canvases on collection; nil disables it
+	canvasStore CanvasStore
+
+	// Thread permalinks by channel and thread timestamp
+	permalinksMu sync.Mutex
+	permalinks   map[string]string
+
+	// Posts thread summaries for the summarize_thread action; nil disables it
+	summarizer ThreadSummarizer
+
+	// Stores segment summaries of collected threads longer than
+	// summaryThreshold messages, summarySegment messages per summary; nil
+	// disables them
+	summaryStore     ThreadSummaryStore
+	summaryThreshold int
+	summarySegment   int
+}
+
+// profileCacheTTL is how long a fetched author profile is reused
+const profileCacheTTL = time.Hour
+
+// MinMessageChars is the shortest cleaned reply worth storing; thread roots
+// are kept regardless
+const MinMessageChars = 10
+
+// repliesPageSize is the number of messages requested per thread replies page
+const repliesPageSize = 200
+
+// maxThreadMessages bounds how many messages of a thread are retrieved, so a
+// runaway thread can't hold up collection indefinitely
+const maxThreadMessages = 10000
+
+// collectContextTimeout bounds retrieving and storing a collected thread,
+// which for a thread near maxThreadMessages takes dozens of pages, possibly
+// with rate limit waits, and a write per message. Summaries of the thread get
+// their own budget per segment.
+const collectContextTimeout = 10 * time.Minute
+
+// userProfile is the author information attached to stored messages
+type userProfile struct {
+	Name  string
+	Title string
+	Team  string
+}
+
+type cachedProfile struct {
+	profile   userProfile
+	fetchedAt time.Time
 }
 
 // NewSlackHandler creates a new Slack handler
-func NewSlackHandler(botToken string, storage *SlackStorage) *SlackHandler {
+func NewSlackHandler(botToken string, storage *SlackStorage, allowlist *ChannelAllowlist) *SlackHandler {
 	client := slack.New(botToken)
 	
 	// Get bot user ID
@@ -39,10 +140,61 @@ func NewSlackHandler(botToken string, storage *SlackStorage) *SlackHandler {
 	return &SlackHandler{
 		client:    client,
 		storage:   storage,
+		allowlist: allowlist,
 		botUserID: botUserID,
+
+		notifyMaxAttempts: 3,
+		notifyRetryDelay:  time.Second,
+		rateLimitRetries:  maxRateLimitWaits,
 	}
 }
 
+// HealthCheck confirms the bot token authenticates with Slack
+func (h *SlackHandler) HealthCheck(ctx context.Context) error {
+	if _, err := h.client.AuthTestContext(ctx); err != nil {
+		return fmt.Errorf("slack auth failed: %w", err)
+	}
+	return nil
+}
+
+// SetProfileEnrichment stores each author's profile title, and team from the
+// given custom profile field ID, with collected messages
+func (h *SlackHandler) SetProfileEnrichment(enabled bool, teamField string) {
+	h.profileEnrichment = enabled
+	h.profileTeamField = teamField
+	slog.Info("Updated author profile enrichment", "enabled", enabled, "team_field", teamField)
+}
+
+// SetNotifyRetry configures retries for user-facing Slack notifications
+func (h *SlackHandler) SetNotifyRetry(maxAttempts int, retryDelay time.Duration) {
+	if maxAttempts > 0 {
+		h.notifyMaxAttempts = maxAttempts
+	}
+	if retryDelay >= 0 {
+		h.notifyRetryDelay = retryDelay
+	}
+	slog.Info("Updated Slack notification retry policy",
+		"max_attempts", h.notifyMaxAttempts,
+		"retry_delay", h.notifyRetryDelay)
+}
+
+// SetRateLimitRetries sets how often thread, channel history and user lookups
+// wait out a Slack rate limit, as long as Slack's Retry-After asks, before
+// failing
+func (h *SlackHandler) SetRateLimitRetries(retries int) {
+	if retries < 0 {
+		return
+	}
+	h.rateLimitRetries = retries
+	slog.Info("Updated Slack rate limit retries", "retries", retries)
+}
+
+// SetSummarizer enables the summarize_thread action, which posts a summary of
+// the thread into it without storing anything
+func (h *SlackHandler) SetSummarizer(summarizer ThreadSummarizer) {
+	h.summarizer = summarizer
+}
+
 // HandleMessageAction handles Slack message actions (interactive components)
 func (h *SlackHandler) HandleMessageAction(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Received Slack message action", "method", r.Method, "url", r.URL.Path)
@@ -51,7 +203,7 @@ func (h *SlackHandler) HandleMessageAction(w http.ResponseWriter, r *http.Reques
 	payload := r.FormValue("payload")
 	if payload == "" {
 		slog.Error("Missing payload in Slack action request")
-		http.Error(w, "Missing payload", http.StatusBadRequest)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Missing payload")
 		return
 	}
 
@@ -60,24 +212,22 @@ func (h *SlackHandler) HandleMessageAction(w http.ResponseWriter, r *http.Reques
 	var interaction slack.InteractionCallback
 	if err := json.Unmarshal([]byte(payload), &interaction); err != nil {
 		slog.Error("Failed to parse interaction payload", "error", err, "payload", payload)
-		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Invalid payload")
 		return
 	}
 
 	slog.Info("Parsed interaction", 
 		"callback_id", interaction.CallbackID, 
 		"type", interaction.Type,
-		"action_id", func() string {
-			if len(interaction.ActionCallback.BlockActions) > 0 {
-				return interaction.ActionCallback.BlockActions[0].ActionID
-			}
-			return ""
-		}())
+		"action_id", blockActionID(interaction))
 
-	// Handle collect_context action (check both callback_id and action_id)
-	if interaction.CallbackID == "collect_context" || 
-		(len(interaction.ActionCallback.BlockActions) > 0 && 
-		 interaction.ActionCallback.BlockActions[0].ActionID == "collect_context") {
+	// Actions are matched by callback_id or, for block buttons, action_id
+	if matchesAction(interaction, summarizeThreadAction) {
+		h.handleSummarizeAction(w, r, interaction)
+		return
+	}
+
+	if matchesAction(interaction, collectContextAction) {
 		slog.Info("Processing collect_context action")
 		
 		// Check if the action was triggered on a bot message
@@ -92,9 +242,25 @@ func (h *SlackHandler) HandleMessageAction(w http.ResponseWriter, r *http.Reques
 			json.NewEncoder(w).Encode(response)
 			return
 		}
+
+		// Check if the channel is enabled for collection
+		if h.allowlist != nil && !h.allowlist.IsAllowed(interaction.Channel.ID) {
+			slog.Info("Action triggered in channel not on allowlist, skipping", "channel", interaction.Channel.ID)
+			w.Header().Set("Content-Type", "application/json")
+			response := map[string]interface{}{
+				"response_type": "ephemeral",
+				"text":          "ℹ️ This channel is not enabled for knowledge collection.",
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
 		
-		// Start processing in background
-		go h.handleCollectContext(interaction)
+		// Start processing in background, keeping the request's concurrency slot
+		release := middleware.HoldConcurrencySlot(r.Context())
+		go func() {
+			defer release()
+			h.handleCollectContext(interaction)
+		}()
 
 		// Respond immediately with ephemeral message
 		w.Header().Set("Content-Type", "application/json")
@@ -105,7 +271,7 @@ func (h *SlackHandler) HandleMessageAction(w http.ResponseWriter, r *http.Reques
 		
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			slog.Error("Failed to encode response", "error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			apierror.Respond(w, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error")
 			return
 		}
 		
@@ -118,6 +284,96 @@ func (h *SlackHandler) HandleMessageAction(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleSummarizeAction acks a summarize_thread action and summarizes the
+// thread in the background
+func (h *SlackHandler) handleSummarizeAction(w http.ResponseWriter, r *http.Request, interaction slack.InteractionCallback) {
+	slog.Info("Processing summarize_thread action")
+
+	text := "📝 Summarizing thread..."
+	if h.summarizer == nil {
+		slog.Warn("summarize_thread action received but no summarizer is configured")
+		text = "ℹ️ Thread summaries are not available."
+	} else {
+		release := middleware.HoldConcurrencySlot(r.Context())
+		go func() {
+			defer release()
+			h.handleSummarizeThread(interaction)
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
+// handleSummarizeThread posts a summary of the thread as a reply in it
+func (h *SlackHandler) handleSummarizeThread(interaction slack.InteractionCallback) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	channelID := interaction.Channel.ID
+	userID := interaction.User.ID
+	threadTS := interaction.Message.ThreadTimestamp
+	if threadTS == "" {
+		threadTS = interaction.Message.Timestamp
+	}
+
+	slog.Info("Processing thread summary", "channel", channelID, "thread_ts", threadTS, "user", userID)
+
+	slackMessages, err := h.getThreadMessages(ctx, channelID, threadTS, nil)
+	if err != nil {
+		slog.Error("Failed to get thread messages", "error", err)
+		h.notifyUser(userID, channelID, "❌ Failed to summarize thread. Please try again.")
+		return
+	}
+
+	var messages []SlackMessage
+	for _, slackMsg := range slackMessages {
+		if msg := h.convertSlackMessage(slackMsg, channelID, threadTS, interaction.Team.ID); msg != nil {
+			messages = append(messages, *msg)
+		}
+	}
+	if len(messages) == 0 {
+		h.notifyUser(userID, channelID, "ℹ️ There is nothing in this thread to summarize.")
+		return
+	}
+
+	summary, err := h.summarizer.SummarizeThread(ctx, messages)
+	if err != nil {
+		slog.Error("Failed to summarize thread", "error", err, "channel", channelID, "thread_ts", threadTS)
+		h.notifyUser(userID, channelID, "❌ Failed to summarize thread. Please try again.")
+		return
+	}
+
+	text := fmt.Sprintf("📝 *Thread summary* (requested by <@%s>)\n%s", userID, summary)
+	if _, _, err := h.client.PostMessageContext(ctx, channelID, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTS)); err != nil {
+		slog.Error("Failed to post thread summary", "error", err, "channel", channelID, "thread_ts", threadTS)
+		h.notifyUser(userID, channelID, "❌ Failed to post the thread summary. Please try again.")
+		return
+	}
+
+	slog.Info("Posted thread summary", "channel", channelID, "thread_ts", threadTS, "messages", len(messages))
+}
+
+// matchesAction reports whether an interaction is the given action, by
+// callback_id for message shortcuts or action_id for block buttons
+func matchesAction(interaction slack.InteractionCallback, action string) bool {
+	return interaction.CallbackID == action || blockActionID(interaction) == action
+}
+
+// blockActionID returns the action_id of the first block action, if any
+func blockActionID(interaction slack.InteractionCallback) string {
+	if len(interaction.ActionCallback.BlockActions) > 0 {
+		return interaction.ActionCallback.BlockActions[0].ActionID
+	}
+	return ""
+}
+
 // isTriggeredOnBotMessage checks if the message action was triggered on a bot message
 func (h *SlackHandler) isTriggeredOnBotMessage(interaction slack.InteractionCallback) bool {
 	message := interaction.Message
@@ -151,12 +407,13 @@ func (h *SlackHandler) isTriggeredOnBotMessage(interaction slack.InteractionCall
 
 // handleCollectContext processes the thread context collection
 func (h *SlackHandler) handleCollectContext(interaction slack.InteractionCallback) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), collectContextTimeout)
 	defer cancel()
 
 	message := interaction.Message
 	channelID := interaction.Channel.ID
 	userID := interaction.User.ID
+	teamID := interaction.Team.ID
 
 	// Determine thread timestamp
 	threadTS := message.ThreadTimestamp
@@ -171,7 +428,7 @@ func (h *SlackHandler) handleCollectContext(interaction slack.InteractionCallbac
 		"user", userID)
 
 	// Get all thread messages
-	slackMessages, err := h.getThreadMessages(ctx, channelID, threadTS)
+	slackMessages, err := h.getThreadMessages(ctx, channelID, threadTS, nil)
 	if err != nil {
 		slog.Error("Failed to get thread messages", "error", err)
 		h.sendProcessingError(userID, channelID)
@@ -186,6 +443,7 @@ func (h *SlackHandler) handleCollectContext(interaction slack.InteractionCallbac
 	// Convert and store messages
 	storedCount := 0
 	processedCount := 0
+	var converted []SlackMessage
 	for i, slackMsg := range slackMessages {
 		processedCount++
 		slog.Info("Processing message", 
@@ -196,11 +454,12 @@ func (h *SlackHandler) handleCollectContext(interaction slack.InteractionCallbac
 			"is_root", slackMsg.Timestamp == threadTS)
 		
 		// Convert Slack message to our format
-		msg := h.convertSlackMessage(slackMsg, channelID, threadTS)
+		msg := h.convertSlackMessage(slackMsg, channelID, threadTS, teamID)
 		if msg == nil {
 			slog.Info("Message skipped during conversion", "timestamp", slackMsg.Timestamp)
 			continue // Skip invalid messages
 		}
+		converted = append(converted, *msg)
 
 		// Store message
 		stored, wasInserted, err := h.storage.StoreMessage(ctx, *msg)
@@ -225,29 +484,78 @@ func (h *SlackHandler) handleCollectContext(interaction slack.InteractionCallbac
 		"stored", storedCount,
 		"total_retrieved", len(slackMessages))
 
+	// Not bound by the retrieval budget, which a huge thread may have used up
+	h.summarizeLongThread(context.Background(), channelID, threadTS, converted, len(slackMessages))
+
+	if h.canvasStore != nil {
+		h.syncChannelCanvases(ctx, channelID)
+	}
+
 	// Send completion message to user
 	h.sendCompletionMessage(userID, channelID, storedCount, len(slackMessages))
 }
 
-// getThreadMessages retrieves all messages in a thread from Slack
-func (h *SlackHandler) getThreadMessages(ctx context.Context, channelID, threadTS string) ([]slack.Message, error) {
+// getThreadMessages retrieves all messages in a thread from Slack, following
+// pagination up to maxThreadMessages. Rate limits are waited out, calling
+// onRateLimit, if set, before each wait.
+func (h *SlackHandler) getThreadMessages(ctx context.Context, channelID, threadTS string, onRateLimit func(time.Duration)) ([]slack.Message, error) {
+	if onRateLimit == nil {
+		onRateLimit = func(wait time.Duration) {
+			slog.Warn("Slack rate limited thread retrieval, waiting", "channel", channelID, "thread_ts", threadTS, "retry_after", wait)
+		}
+	}
+
 	params := &slack.GetConversationRepliesParameters{
 		ChannelID: channelID,
 		Timestamp: threadTS,
-		Limit:     100,
+		Limit:     repliesPageSize,
 		Inclusive: true, // Include the parent message (thread root)
 	}
-	
-	msgs, _, _, err := h.client.GetConversationRepliesContext(ctx, params)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get thread messages: %w", err)
+
+	var msgs []slack.Message
+	seen := make(map[string]bool)
+	for {
+		var page []slack.Message
+		var hasMore bool
+		var nextCursor string
+		err := retryRateLimited(ctx, h.rateLimitRetries, func() error {
+			var err error
+			page, hasMore, nextCursor, err = h.client.GetConversationRepliesContext(ctx, params)
+			return err
+		}, onRateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get thread messages: %w", err)
+		}
+
+		// Every page starts with the thread root
+		for _, msg := range page {
+			if !seen[msg.Timestamp] {
+				seen[msg.Timestamp] = true
+				msgs = append(msgs, msg)
+			}
+		}
+
+		if !hasMore || nextCursor == "" {
+			break
+		}
+		if len(msgs) >= maxThreadMessages {
+			slog.Warn("Thread exceeds the message limit, ignoring the rest",
+				"channel", channelID,
+				"thread_ts", threadTS,
+				"limit", maxThreadMessages)
+			break
+		}
+		params.Cursor = nextCursor
 	}
-	
+
 	return msgs, nil
 }
 
-// convertSlackMessage converts a Slack message to our internal format
-func (h *SlackHandler) convertSlackMessage(slackMsg slack.Message, channelID, threadTS string) *SlackMessage {
+// convertSlackMessage converts a Slack message to our internal format. The
+// message is attributed to the workspace it was posted from, which in an
+// enterprise grid shared channel may not be the channel's or the bot's;
+// fallbackTeamID is used only when Slack doesn't report one.
+func (h *SlackHandler) convertSlackMessage(slackMsg slack.Message, channelID, threadTS, fallbackTeamID string) *SlackMessage {
 	slog.Debug("Converting Slack message", 
 		"timestamp", slackMsg.Timestamp,
 		"user", slackMsg.User,
@@ -284,25 +592,33 @@ func (h *SlackHandler) convertSlackMessage(slackMsg slack.Message, channelID, th
 	}
 	
 	// Skip very short messages (not worth embedding cost), but allow thread roots
-	if len(strings.TrimSpace(cleanText)) < 10 && slackMsg.Timestamp != threadTS {
+	if len(strings.TrimSpace(cleanText)) < MinMessageChars && slackMsg.Timestamp != threadTS {
 		slog.Debug("Skipping message: too short", "timestamp", slackMsg.Timestamp, "length", len(strings.TrimSpace(cleanText)))
 		return nil
 	}
 	
-	// Get user display name
-	userName := h.getUserDisplayName(slackMsg.User)
-	slog.Debug("Got user display name", "user_id", slackMsg.User, "user_name", userName)
+	// Get user display name (and title/team when enrichment is enabled)
+	profile := h.getUserProfile(slackMsg.User)
+	slog.Debug("Got user profile", "user_id", slackMsg.User, "user_name", profile.Name, "title", profile.Title, "team", profile.Team)
 	
 	// Determine if this is the thread root
 	isThreadRoot := slackMsg.Timestamp == threadTS
 	slog.Debug("Thread root check", "msg_timestamp", slackMsg.Timestamp, "thread_ts", threadTS, "is_root", isThreadRoot)
 	
+	teamID := slackMsg.Team
+	if teamID == "" {
+		teamID = fallbackTeamID
+	}
+
 	msg := &SlackMessage{
 		ChannelID:        channelID,
+		TeamID:           teamID,
 		ThreadID:         threadTS,
 		MessageTimestamp: slackMsg.Timestamp,
 		UserID:           slackMsg.User,
-		UserName:         userName,
+		UserName:         profile.Name,
+		UserTitle:        profile.Title,
+		UserTeam:         profile.Team,
 		Content:          strings.TrimSpace(cleanText),
 		ClientMsgID:      slackMsg.ClientMsgID,
 		IsThreadRoot:     isThreadRoot,
@@ -317,21 +633,81 @@ func (h *SlackHandler) convertSlackMessage(slackMsg slack.Message, channelID, th
 	return msg
 }
 
-// getUserDisplayName gets the display name for a user ID
-func (h *SlackHandler) getUserDisplayName(userID string) string {
+// getUserProfile returns the author's display name and, when enrichment is
+// enabled, their title and team. Profiles are cached for profileCacheTTL;
+// lookup failures fall back to the user ID and are not cached.
+func (h *SlackHandler) getUserProfile(userID string) userProfile {
 	if userID == "" {
-		return ""
+		return userProfile{}
 	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	h.profilesMu.Lock()
+	cached, ok := h.profiles[userID]
+	h.profilesMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < profileCacheTTL {
+		return cached.profile
+	}
+
+	// Long enough to wait out a short rate limit
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	
-	user, err := h.client.GetUserInfoContext(ctx, userID)
+
+	var user *slack.User
+	err := retryRateLimited(ctx, h.rateLimitRetries, func() error {
+		var err error
+		user, err = h.client.GetUserInfoContext(ctx, userID)
+		return err
+	}, logUserRateLimit(userID))
 	if err != nil {
 		slog.Warn("Failed to get user info", "error", err, "user_id", userID)
-		return userID // Fallback to user ID
+		return userProfile{Name: userID} // Fallback to user ID
 	}
-	
+
+	profile := userProfile{Name: displayName(user)}
+	if h.profileEnrichment {
+		profile.Title = strings.TrimSpace(user.Profile.Title)
+		profile.Team = h.getUserTeam(ctx, userID)
+	}
+
+	h.profilesMu.Lock()
+	if h.profiles == nil {
+		h.profiles = make(map[string]cachedProfile)
+	}
+	h.profiles[userID] = cachedProfile{profile: profile, fetchedAt: time.Now()}
+	h.profilesMu.Unlock()
+
+	return profile
+}
+
+// getUserTeam reads the configured team custom field, which users.info omits
+func (h *SlackHandler) getUserTeam(ctx context.Context, userID string) string {
+	if h.profileTeamField == "" {
+		return ""
+	}
+
+	var profile *slack.UserProfile
+	err := retryRateLimited(ctx, h.rateLimitRetries, func() error {
+		var err error
+		profile, err = h.client.GetUserProfileContext(ctx, &slack.GetUserProfileParameters{UserID: userID})
+		return err
+	}, logUserRateLimit(userID))
+	if err != nil {
+		slog.Warn("Failed to get user profile fields", "error", err, "user_id", userID)
+		return ""
+	}
+
+	return strings.TrimSpace(profile.FieldsMap()[h.profileTeamField].Value)
+}
+
+// logUserRateLimit returns a rate limit callback logging waits for a user lookup
+func logUserRateLimit(userID string) func(time.Duration) {
+	return func(wait time.Duration) {
+		slog.Warn("Slack rate limited user lookup, waiting", "user_id", userID, "retry_after", wait)
+	}
+}
+
+// displayName picks the best available name for a user
+func displayName(user *slack.User) string {
 	// Try display name first, then real name, then name
 	if user.Profile.DisplayName != "" {
 		return user.Profile.DisplayName
@@ -342,12 +718,18 @@ func (h *SlackHandler) getUserDisplayName(userID string) string {
 	if user.Name != "" {
 		return user.Name
 	}
-	
-	return userID // Fallback to user ID
+
+	return user.ID // Fallback to user ID
 }
 
 // cleanMessageText removes user mentions and channel references
 func (h *SlackHandler) cleanMessageText(text string) string {
+	return CleanMessageText(text)
+}
+
+// CleanMessageText removes user mentions like <@U123456> and channel
+// references like <#C123456|general>. Discord mentions share the syntax.
+func CleanMessageText(text string) string {
 	// Remove user mentions like <@U123456>
 	for strings.Contains(text, "<@") {
 		start := strings.Index(text, "<@")
@@ -380,25 +762,50 @@ func (h *SlackHandler) sendCompletionMessage(userID, channelID string, storedCou
 		message = fmt.Sprintf("✅ Stored %d new messages from thread (%d total messages)", storedCount, totalCount)
 	}
 
-	// Send ephemeral message to user
-	_, err := h.client.PostEphemeral(
-		channelID,
-		userID,
-		slack.MsgOptionText(message, false),
-	)
-	if err != nil {
-		slog.Error("Failed to send completion message", "error", err)
-	}
+	h.notifyUser(userID, channelID, message)
 }
 
 // sendProcessingError sends an error message to the user
 func (h *SlackHandler) sendProcessingError(userID, channelID string) {
-	_, err := h.client.PostEphemeral(
-		channelID,
-		userID,
-		slack.MsgOptionText("❌ Failed to process thread. Please try again.", false),
-	)
-	if err != nil {
-		slog.Error("Failed to send error message", "error", err)
+	h.notifyUser(userID, channelID, "❌ Failed to process thread. Please try again.")
+}
+
+// notifyUser posts an ephemeral message, retrying with backoff on failure.
+// If every attempt fails, the message is sent as a DM instead so the user
+// still gets feedback.
+func (h *SlackHandler) notifyUser(userID, channelID, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	delay := h.notifyRetryDelay
+	for attempt := 1; attempt <= h.notifyMaxAttempts; attempt++ {
+		_, err := h.client.PostEphemeralContext(ctx, channelID, userID, slack.MsgOptionText(message, false))
+		if err == nil {
+			return
+		}
+
+		slog.Warn("Failed to send ephemeral message",
+			"error", err,
+			"attempt", attempt,
+			"max_attempts", h.notifyMaxAttempts)
+
+		if attempt == h.notifyMaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Error("Gave up sending ephemeral message", "error", ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
 	}
-}
\ No newline at end of file
+
+	// Fall back to a direct message
+	if _, _, err := h.client.PostMessageContext(ctx, userID, slack.MsgOptionText(message, false)); err != nil {
+		slog.Error("Failed to send fallback direct message", "error", err, "user", userID)
+		return
+	}
+	slog.Info("Sent notification as direct message after ephemeral failures", "user", userID)
+}
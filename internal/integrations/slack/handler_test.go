@@ -0,0 +1,558 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Mock Slack client for handler tests
+type mockSlackClient struct {
+	mu sync.Mutex
+
+	ephemeralFailures int // number of PostEphemeral calls that fail before succeeding
+	ephemeralCalls    int
+	messageChannels   []string
+
+	replies         []slack.Message
+	repliesPageSize int // replies after the root per page; 0 returns them all at once
+	repliesCalls    int
+	rateLimits      int // replies and user info calls rate limited before succeeding
+	users           map[string]*slack.User
+
+	profileFields    map[string]map[string]slack.UserProfileCustomField
+	userInfoCalls    int
+	userProfileCalls int
+
+	bookmarks    []slack.Bookmark
+	files        map[string]*slack.File
+	fileContents map[string]string
+
+	permalinks     map[string]string // by channel ID
+	permalinkCalls int
+
+	posted []postedMessage
+}
+
+// postedMessage is a message sent with PostMessageContext
+type postedMessage struct {
+	channelID string
+	text      string
+	threadTS  string
+}
+
+func (m *mockSlackClient) rateLimited() error {
+	if m.rateLimits > 0 {
+		m.rateLimits--
+		return &slack.RateLimitedError{RetryAfter: time.Millisecond}
+	}
+	return nil
+}
+
+func (m *mockSlackClient) AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error) {
+	return &slack.AuthTestResponse{UserID: "U_BOT", TeamID: "T_HOME"}, nil
+}
+
+func (m *mockSlackClient) GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	return &slack.GetConversationHistoryResponse{}, nil
+}
+
+func (m *mockSlackClient) GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	m.repliesCalls++
+	if err := m.rateLimited(); err != nil {
+		return nil, false, "", err
+	}
+	if m.repliesPageSize == 0 || len(m.replies) == 0 {
+		return m.replies, false, "", nil
+	}
+
+	// Like Slack, every page starts with the thread root; the cursor is an offset
+	offset, _ := strconv.Atoi(params.Cursor)
+	rest := m.replies[1:]
+	end := offset + m.repliesPageSize
+	if end >= len(rest) {
+		return append([]slack.Message{m.replies[0]}, rest[offset:]...), false, "", nil
+	}
+	return append([]slack.Message{m.replies[0]}, rest[offset:end]...), true, strconv.Itoa(end), nil
+}
+
+func (m *mockSlackClient) GetFileContext(ctx context.Context, downloadURL string, writer io.Writer) error {
+	content, ok := m.fileContents[downloadURL]
+	if !ok {
+		return errors.New("file_not_found")
+	}
+	_, err := io.WriteString(writer, content)
+	return err
+}
+
+func (m *mockSlackClient) GetFileInfoContext(ctx context.Context, fileID string, count, page int) (*slack.File, []slack.Comment, *slack.Paging, error) {
+	if f, ok := m.files[fileID]; ok {
+		return f, nil, nil, nil
+	}
+	return nil, nil, nil, errors.New("file_not_found")
+}
+
+func (m *mockSlackClient) GetPermalinkContext(ctx context.Context, params *slack.PermalinkParameters) (string, error) {
+	m.permalinkCalls++
+	base, ok := m.permalinks[params.Channel]
+	if !ok {
+		return "", errors.New("channel_not_found")
+	}
+	return base + "/p" + params.Ts, nil
+}
+
+func (m *mockSlackClient) ListBookmarksContext(ctx context.Context, channelID string) ([]slack.Bookmark, error) {
+	return m.bookmarks, nil
+}
+
+func (m *mockSlackClient) GetUserInfoContext(ctx context.Context, user string) (*slack.User, error) {
+	m.userInfoCalls++
+	if err := m.rateLimited(); err != nil {
+		return nil, err
+	}
+	if u, ok := m.users[user]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user_not_found")
+}
+
+func (m *mockSlackClient) GetUserProfileContext(ctx context.Context, params *slack.GetUserProfileParameters) (*slack.UserProfile, error) {
+	m.userProfileCalls++
+	u, ok := m.users[params.UserID]
+	if !ok {
+		return nil, errors.New("user_not_found")
+	}
+	profile := u.Profile
+	profile.Fields.SetMap(m.profileFields[params.UserID])
+	return &profile, nil
+}
+
+func (m *mockSlackClient) PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ephemeralCalls++
+	if m.ephemeralCalls <= m.ephemeralFailures {
+		return "", errors.New("internal_error")
+	}
+	return "1234567890.123456", nil
+}
+
+func (m *mockSlackClient) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messageChannels = append(m.messageChannels, channelID)
+	_, values, err := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	if err != nil {
+		return "", "", err
+	}
+	m.posted = append(m.posted, postedMessage{channelID: channelID, text: values.Get("text"), threadTS: values.Get("thread_ts")})
+	return channelID, "1234567890.123456", nil
+}
+
+func TestNotifyUser_RetriesThenSucceeds(t *testing.T) {
+	client := &mockSlackClient{ephemeralFailures: 1}
+	handler := &SlackHandler{client: client, notifyMaxAttempts: 3}
+
+	handler.sendCompletionMessage("U123", "C123", 2, 2)
+
+	if client.ephemeralCalls != 2 {
+		t.Errorf("Expected 2 ephemeral attempts, got %d", client.ephemeralCalls)
+	}
+	if len(client.messageChannels) != 0 {
+		t.Errorf("Expected no DM fallback after successful retry, got %v", client.messageChannels)
+	}
+}
+
+func TestNotifyUser_FallsBackToDirectMessage(t *testing.T) {
+	client := &mockSlackClient{ephemeralFailures: 10}
+	handler := &SlackHandler{client: client, notifyMaxAttempts: 3}
+
+	handler.sendProcessingError("U123", "C123")
+
+	if client.ephemeralCalls != 3 {
+		t.Errorf("Expected 3 ephemeral attempts, got %d", client.ephemeralCalls)
+	}
+	if len(client.messageChannels) != 1 || client.messageChannels[0] != "U123" {
+		t.Errorf("Expected DM fallback to user U123, got %v", client.messageChannels)
+	}
+}
+
+func TestGetUserProfile_EnrichmentWithCaching(t *testing.T) {
+	client := &mockSlackClient{
+		users: map[string]*slack.User{
+			"U1": {ID: "U1", Profile: slack.UserProfile{DisplayName: "alice", Title: "Staff SRE"}},
+			"U2": {ID: "U2", Name: "bob"},
+		},
+		profileFields: map[string]map[string]slack.UserProfileCustomField{
+			"U1": {"Xf01TEAM": {Value: "Platform", Label: "Team"}},
+		},
+	}
+	handler := &SlackHandler{client: client}
+	handler.SetProfileEnrichment(true, "Xf01TEAM")
+
+	alice := handler.getUserProfile("U1")
+	if alice != (userProfile{Name: "alice", Title: "Staff SRE", Team: "Platform"}) {
+		t.Errorf("Unexpected enriched profile: %+v", alice)
+	}
+
+	// Repeated lookups are served from the cache
+	handler.getUserProfile("U1")
+	handler.getUserProfile("U1")
+	if client.userInfoCalls != 1 || client.userProfileCalls != 1 {
+		t.Errorf("Expected 1 users.info and 1 users.profile.get call, got %d and %d", client.userInfoCalls, client.userProfileCalls)
+	}
+
+	// Profiles without title or team fall back to just the name
+	bob := handler.getUserProfile("U2")
+	if bob != (userProfile{Name: "bob"}) {
+		t.Errorf("Expected name-only profile, got %+v", bob)
+	}
+
+	// Failed lookups fall back to the user ID and are retried
+	handler.getUserProfile("U3")
+	if missing := handler.getUserProfile("U3"); missing != (userProfile{Name: "U3"}) {
+		t.Errorf("Expected user ID fallback, got %+v", missing)
+	}
+	if client.userInfoCalls != 4 {
+		t.Errorf("Expected failed lookups not to be cached, got %d users.info calls", client.userInfoCalls)
+	}
+}
+
+func TestGetUserProfile_WaitsOutRateLimits(t *testing.T) {
+	client := &mockSlackClient{
+		users:      map[string]*slack.User{"U1": {ID: "U1", Profile: slack.UserProfile{DisplayName: "alice"}}},
+		rateLimits: 1,
+	}
+	handler := &SlackHandler{client: client, rateLimitRetries: 3}
+
+	if profile := handler.getUserProfile("U1"); profile != (userProfile{Name: "alice"}) {
+		t.Errorf("Expected the name after waiting out the rate limit, got %+v", profile)
+	}
+	if client.userInfoCalls != 2 {
+		t.Errorf("Expected a rate limited and a successful users.info call, got %d", client.userInfoCalls)
+	}
+}
+
+func TestGetUserProfile_EnrichmentDisabled(t *testing.T) {
+	client := &mockSlackClient{
+		users: map[string]*slack.User{
+			"U1": {ID: "U1", Profile: slack.UserProfile{DisplayName: "alice", Title: "Staff SRE"}},
+		},
+	}
+	handler := &SlackHandler{client: client}
+
+	if profile := handler.getUserProfile("U1"); profile != (userProfile{Name: "alice"}) {
+		t.Errorf("Expected no title or team without enrichment, got %+v", profile)
+	}
+	if client.userProfileCalls != 0 {
+		t.Errorf("Expected no users.profile.get calls without enrichment")
+	}
+}
+
+func TestSlackMessage_AuthorLabel(t *testing.T) {
+	testCases := []struct {
+		msg      SlackMessage
+		expected string
+	}{
+		{SlackMessage{UserName: "alice", UserTitle: "Staff SRE", UserTeam: "Platform"}, "alice (Staff SRE, Platform)"},
+		{SlackMessage{UserName: "alice", UserTitle: "Staff SRE"}, "alice (Staff SRE)"},
+		{SlackMessage{UserName: "bob", UserTeam: " "}, "bob"},
+	}
+
+	for _, tc := range testCases {
+		if label := tc.msg.AuthorLabel(); label != tc.expected {
+			t.Errorf("AuthorLabel() = %q, want %q", label, tc.expected)
+		}
+	}
+}
+
+func TestConvertSlackMessage_SharedChannelAttribution(t *testing.T) {
+	client := &mockSlackClient{
+		users: map[string]*slack.User{
+			"U_HOME":  {ID: "U_HOME", Name: "alice"},
+			"U_OTHER": {ID: "U_OTHER", Name: "bob"},
+		},
+	}
+	handler := &SlackHandler{client: client}
+
+	// A channel owned by T_HOME and shared with T_OTHER; the action was triggered from T_HOME
+	home := slack.Message{Msg: slack.Msg{Timestamp: "1700000000.000100", User: "U_HOME", Team: "T_HOME", Text: "Who owns the shared billing pipeline?"}}
+	shared := slack.Message{Msg: slack.Msg{Timestamp: "1700000000.000200", User: "U_OTHER", Team: "T_OTHER", Text: "Our payments team in the other workspace owns it"}}
+	legacy := slack.Message{Msg: slack.Msg{Timestamp: "1700000000.000300", User: "U_HOME", Text: "Thanks, I'll follow up with them"}}
+
+	testCases := []struct {
+		msg      slack.Message
+		expected string
+	}{
+		{home, "T_HOME"},
+		{shared, "T_OTHER"},
+		{legacy, "T_HOME"}, // messages without a team fall back to the triggering workspace
+	}
+
+	for _, tc := range testCases {
+		converted := handler.convertSlackMessage(tc.msg, "C_SHARED", "1700000000.000100", "T_HOME")
+		if converted == nil {
+			t.Fatalf("Expected message %s to be converted", tc.msg.Timestamp)
+		}
+		if converted.TeamID != tc.expected {
+			t.Errorf("Message %s: expected team %s, got %s", tc.msg.Timestamp, tc.expected, converted.TeamID)
+		}
+		if converted.ChannelID != "C_SHARED" {
+			t.Errorf("Message %s: expected channel C_SHARED, got %s", tc.msg.Timestamp, converted.ChannelID)
+		}
+	}
+}
+
+func TestGetThreadPermalink_CachesAndOmitsInaccessible(t *testing.T) {
+	client := &mockSlackClient{permalinks: map[string]string{"C1": "https://acme.slack.com/archives/C1"}}
+	handler := &SlackHandler{client: client}
+	ctx := context.Background()
+
+	expected := "https://acme.slack.com/archives/C1/p1700000000.000100"
+	for i := 0; i < 3; i++ {
+		if permalink := handler.GetThreadPermalink(ctx, "C1", "1700000000.000100"); permalink != expected {
+			t.Fatalf("Expected permalink %s, got %q", expected, permalink)
+		}
+	}
+	if client.permalinkCalls != 1 {
+		t.Errorf("Expected the permalink to be fetched once and cached, got %d calls", client.permalinkCalls)
+	}
+
+	// The bot isn't in C_PRIVATE, so there is no permalink to show
+	if permalink := handler.GetThreadPermalink(ctx, "C_PRIVATE", "1700000000.000200"); permalink != "" {
+		t.Errorf("Expected no permalink for an inaccessible channel, got %q", permalink)
+	}
+}
+
+type mockSummarizer struct {
+	summary  string
+	err      error
+	messages []SlackMessage
+	calls    int
+}
+
+func (m *mockSummarizer) SummarizeThread(ctx context.Context, messages []SlackMessage) (string, error) {
+	m.messages = messages
+	m.calls++
+	return m.summary, m.err
+}
+
+func summarizeInteraction() slack.InteractionCallback {
+	interaction := slack.InteractionCallback{CallbackID: summarizeThreadAction}
+	interaction.Channel.ID = "C1"
+	interaction.User.ID = "U_ASKER"
+	interaction.Message.Timestamp = "1700000000.000200"
+	interaction.Message.ThreadTimestamp = "1700000000.000100"
+	return interaction
+}
+
+func threadReplies() []slack.Message {
+	root := slack.Message{}
+	root.Timestamp = "1700000000.000100"
+	root.User = "U1"
+	root.Text = "The deploy to staging is failing on migrations"
+	reply := slack.Message{}
+	reply.Timestamp = "1700000000.000200"
+	reply.User = "U2"
+	reply.Text = "Fixed by re-running the 0042 migration by hand"
+	return []slack.Message{root, reply}
+}
+
+// longThread returns a thread root followed by replies replies, one second apart
+func longThread(replies int) []slack.Message {
+	thread := make([]slack.Message, 0, replies+1)
+	for i := 0; i <= replies; i++ {
+		msg := slack.Message{}
+		msg.Timestamp = fmt.Sprintf("%d.000100", 1700000000+i)
+		msg.ThreadTimestamp = "1700000000.000100"
+		msg.User = "U1"
+		msg.Text = fmt.Sprintf("Message number %d about the outage", i)
+		thread = append(thread, msg)
+	}
+	return thread
+}
+
+func TestGetThreadMessages_FollowsPagination(t *testing.T) {
+	client := &mockSlackClient{replies: longThread(250), repliesPageSize: 100}
+	handler := &SlackHandler{client: client}
+
+	messages, err := handler.getThreadMessages(context.Background(), "C1", "1700000000.000100", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if client.repliesCalls != 3 {
+		t.Errorf("Expected 3 pages to be requested, got %d", client.repliesCalls)
+	}
+	if len(messages) != 251 {
+		t.Fatalf("Expected the root and all 250 replies, got %d messages", len(messages))
+	}
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		if seen[msg.Timestamp] {
+			t.Errorf("Expected each message once, got %s again", msg.Timestamp)
+		}
+		seen[msg.Timestamp] = true
+	}
+	if messages[0].Timestamp != "1700000000.000100" || messages[250].Timestamp != "1700000250.000100" {
+		t.Errorf("Expected messages oldest first, got %s to %s", messages[0].Timestamp, messages[250].Timestamp)
+	}
+}
+
+func TestGetThreadMessages_WaitsOutRateLimits(t *testing.T) {
+	client := &mockSlackClient{replies: longThread(150), repliesPageSize: 100, rateLimits: 2}
+	handler := &SlackHandler{client: client, rateLimitRetries: 3}
+
+	var waits []time.Duration
+	messages, err := handler.getThreadMessages(context.Background(), "C1", "1700000000.000100", func(wait time.Duration) {
+		waits = append(waits, wait)
+	})
+	if err != nil {
+		t.Fatalf("Expected the rate limits to be waited out, got %v", err)
+	}
+
+	if len(messages) != 151 {
+		t.Errorf("Expected all 151 messages, got %d", len(messages))
+	}
+	if len(waits) != 2 || waits[0] != time.Millisecond {
+		t.Errorf("Expected 2 waits of Slack's Retry-After, got %v", waits)
+	}
+	if client.repliesCalls != 4 {
+		t.Errorf("Expected 2 rate limited and 2 successful page requests, got %d", client.repliesCalls)
+	}
+}
+
+func TestGetThreadMessages_GivesUpAfterRetries(t *testing.T) {
+	client := &mockSlackClient{replies: threadReplies(), rateLimits: 5}
+	handler := &SlackHandler{client: client, rateLimitRetries: 2}
+
+	_, err := handler.getThreadMessages(context.Background(), "C1", "1700000000.000100", nil)
+
+	var rateLimited *slack.RateLimitedError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("Expected the rate limit error, got %v", err)
+	}
+	if client.repliesCalls != 3 {
+		t.Errorf("Expected the first request and 2 retries, got %d", client.repliesCalls)
+	}
+}
+
+func TestGetThreadMessages_StopsWaitingWhenCancelled(t *testing.T) {
+	client := &mockSlackClient{replies: threadReplies(), rateLimits: 1}
+	handler := &SlackHandler{client: client, rateLimitRetries: 3}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := handler.getThreadMessages(ctx, "C1", "1700000000.000100", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestHandleSummarizeThread_PostsThreadedReplyWithoutStoring(t *testing.T) {
+	client := &mockSlackClient{replies: threadReplies()}
+	store := &mockMessageStore{messages: make(map[string]SlackMessage)}
+	summarizer := &mockSummarizer{summary: "- Staging deploy failed on migrations\n- Fixed by re-running 0042"}
+	handler := &SlackHandler{client: client, storage: store, notifyMaxAttempts: 1}
+	handler.SetSummarizer(summarizer)
+
+	handler.handleSummarizeThread(summarizeInteraction())
+
+	if len(summarizer.messages) != 2 {
+		t.Fatalf("Expected both thread messages to be summarized, got %d", len(summarizer.messages))
+	}
+	if len(client.posted) != 1 {
+		t.Fatalf("Expected one posted message, got %d", len(client.posted))
+	}
+	posted := client.posted[0]
+	if posted.channelID != "C1" || posted.threadTS != "1700000000.000100" {
+		t.Errorf("Expected a reply in thread 1700000000.000100 of C1, got %+v", posted)
+	}
+	if !strings.Contains(posted.text, summarizer.summary) {
+		t.Errorf("Expected the posted reply to contain the summary, got %q", posted.text)
+	}
+	if len(store.messages) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d messages", len(store.messages))
+	}
+	if client.ephemeralCalls != 0 {
+		t.Errorf("Expected no ephemeral notifications, got %d", client.ephemeralCalls)
+	}
+}
+
+func TestHandleSummarizeThread_NotifiesOnFailure(t *testing.T) {
+	client := &mockSlackClient{replies: threadReplies()}
+	handler := &SlackHandler{client: client, notifyMaxAttempts: 1}
+	handler.SetSummarizer(&mockSummarizer{err: errors.New("rate limited")})
+
+	handler.handleSummarizeThread(summarizeInteraction())
+
+	if len(client.posted) != 0 {
+		t.Errorf("Expected no threaded reply, got %+v", client.posted)
+	}
+	if client.ephemeralCalls != 1 {
+		t.Errorf("Expected the user to be notified of the failure, got %d ephemeral calls", client.ephemeralCalls)
+	}
+}
+
+func TestHandleMessageAction_SummarizeWithoutSummarizer(t *testing.T) {
+	store := &mockMessageStore{messages: make(map[string]SlackMessage)}
+	handler := &SlackHandler{client: &mockSlackClient{replies: threadReplies()}, storage: store}
+
+	payload, err := json.Marshal(summarizeInteraction())
+	if err != nil {
+		t.Fatalf("Failed to marshal interaction: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/slack/actions", strings.NewReader(url.Values{"payload": {string(payload)}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	handler.HandleMessageAction(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "not available") {
+		t.Errorf("Expected summaries to be reported unavailable, got %s", rec.Body.String())
+	}
+	if len(store.messages) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d messages", len(store.messages))
+	}
+}
+
+func TestMatchesAction(t *testing.T) {
+	buttonClick := slack.InteractionCallback{}
+	buttonClick.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: summarizeThreadAction}}
+
+	testCases := []struct {
+		name        string
+		interaction slack.InteractionCallback
+		action      string
+		expected    bool
+	}{
+		{"shortcut callback id", slack.InteractionCallback{CallbackID: collectContextAction}, collectContextAction, true},
+		{"block action id", buttonClick, summarizeThreadAction, true},
+		{"other shortcut", slack.InteractionCallback{CallbackID: collectContextAction}, summarizeThreadAction, false},
+		{"other block action", buttonClick, collectContextAction, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := matchesAction(tc.interaction, tc.action); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// ingestPageSize is the number of messages requested per channel history page
+const ingestPageSize = 200
+
+// maxRateLimitWaits is the default for how often one Slack request waits out
+// a rate limit
+const maxRateLimitWaits = 5
+
+// ErrChannelNotAllowed is returned when ingesting a channel that is not
+// enabled for collection
+var ErrChannelNotAllowed = errors.New("channel is not enabled for collection")
+
+// ChannelIngestProgress counts the work done by a channel ingestion so far
+type ChannelIngestProgress struct {
+	ChannelID      string `json:"channel_id"`
+	Pages          int    `json:"pages"`            // Channel history pages read
+	Threads        int    `json:"threads"`          // Root messages collected, with their replies
+	Messages       int    `json:"messages"`         // Messages retrieved from Slack
+	Stored         int    `json:"stored"`           // Messages not stored before
+	Failed         int    `json:"failed"`           // Threads that could not be retrieved
+	RateLimitWaits int    `json:"rate_limit_waits"` // Times Slack asked us to back off
+}
+
+// IngestChannel collects every thread started in the channel between oldest
+// and latest (zero for no bound), as if each were collected with the message
+// action. Slack rate limits are waited out. report, if set, receives the
+// progress after each root message.
+func (h *SlackHandler) IngestChannel(ctx context.Context, channelID string, oldest, latest time.Time, report func(ChannelIngestProgress)) (ChannelIngestProgress, error) {
+	progress := ChannelIngestProgress{ChannelID: channelID}
+	if h.allowlist != nil && !h.allowlist.IsAllowed(channelID) {
+		return progress, ErrChannelNotAllowed
+	}
+
+	// Messages that don't name their workspace are attributed to the one the
+	// app is installed in, as collected ones are to the action's
+	teamID := h.installationTeamID(ctx)
+
+	onRateLimit := func(wait time.Duration) {
+		progress.RateLimitWaits++
+		slog.Warn("Slack rate limited channel ingestion, waiting", "channel", channelID, "retry_after", wait)
+	}
+
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     ingestPageSize,
+		Inclusive: true,
+		Oldest:    slackTimestamp(oldest),
+		Latest:    slackTimestamp(latest),
+	}
+
+	for {
+		var history *slack.GetConversationHistoryResponse
+		err := retryRateLimited(ctx, h.rateLimitRetries, func() error {
+			var err error
+			history, err = h.client.GetConversationHistoryContext(ctx, params)
+			return err
+		}, onRateLimit)
+		if err != nil {
+			return progress, fmt.Errorf("failed to get channel history: %w", err)
+		}
+		progress.Pages++
+
+		for _, root := range history.Messages {
+			if !isThreadStart(root) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return progress, err
+			}
+
+			thread := []slack.Message{root}
+			var err error
+			if root.ReplyCount > 0 {
+				thread, err = h.getThreadMessages(ctx, channelID, root.Timestamp, onRateLimit)
+			}
+
+			if err != nil {
+				slog.Error("Failed to get thread messages", "error", err, "channel", channelID, "thread_ts", root.Timestamp)
+				progress.Failed++
+			} else {
+				progress.Threads++
+				progress.Messages += len(thread)
+				progress.Stored += h.storeThread(ctx, thread, channelID, root.Timestamp, teamID)
+			}
+
+			if report != nil {
+				report(progress)
+			}
+		}
+
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			break
+		}
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
+
+	if h.canvasStore != nil {
+		h.syncChannelCanvases(ctx, channelID)
+	}
+
+	slog.Info("Ingested channel",
+		"channel", channelID,
+		"pages", progress.Pages,
+		"threads", progress.Threads,
+		"messages", progress.Messages,
+		"stored", progress.Stored,
+		"failed", progress.Failed)
+
+	return progress, nil
+}
+
+// installationTeamID returns the ID of the workspace the bot token belongs
+// to, or "" when it can't be determined
+func (h *SlackHandler) installationTeamID(ctx context.Context) string {
+	authTest, err := h.client.AuthTestContext(ctx)
+	if err != nil {
+		slog.Warn("Could not get the installation's team ID", "error", err)
+		return ""
+	}
+	return authTest.TeamID
+}
+
+// storeThread stores a thread's messages, returning how many were new.
+// Messages without a team are attributed to teamID.
+func (h *SlackHandler) storeThread(ctx context.Context, thread []slack.Message, channelID, threadTS, teamID string) int {
+	stored := 0
+	var converted []SlackMessage
+	for _, slackMsg := range thread {
+		msg := h.convertSlackMessage(slackMsg, channelID, threadTS, teamID)
+		if msg == nil {
+			continue
+		}
+		converted = append(converted, *msg)
+
+		_, wasInserted, err := h.storage.StoreMessage(ctx, *msg)
+		if err != nil {
+			slog.Error("Failed to store message", "error", err, "message_ts", slackMsg.Timestamp)
+			continue
+		}
+		if wasInserted {
+			stored++
+		}
+	}
+
+	h.summarizeLongThread(ctx, channelID, threadTS, converted, len(thread))
+	return stored
+}
+
+// isThreadStart reports whether a channel history message starts a thread or
+// stands alone. Replies also sent to the channel are collected with their
+// thread, and join/leave and other channel events are skipped.
+func isThreadStart(msg slack.Message) bool {
+	if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp {
+		return false
+	}
+	return msg.SubType == "" || msg.SubType == "file_share"
+}
+
+// slackTimestamp formats t as a Slack message timestamp, or "" for zero
+func slackTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+// parseSlackTimestamp parses a Slack timestamp ("1234567890.123456"), keeping
+// up to nanosecond precision of the fractional part
+func parseSlackTimestamp(ts string) (time.Time, error) {
+	ts = strings.TrimSpace(ts)
+	if ts == "" {
+		return time.Time{}, fmt.Errorf("empty slack timestamp")
+	}
+
+	secondsPart, fractionPart, _ := strings.Cut(ts, ".")
+	seconds, err := strconv.ParseInt(secondsPart, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, fmt.Errorf("invalid slack timestamp %q", ts)
+	}
+
+	var nanos int64
+	if fractionPart != "" {
+		if len(fractionPart) > 9 {
+			fractionPart = fractionPart[:9]
+		}
+		fraction, err := strconv.ParseUint(fractionPart, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid slack timestamp %q", ts)
+		}
+		nanos = int64(fraction)
+		for i := len(fractionPart); i < 9; i++ {
+			nanos *= 10
+		}
+	}
+
+	return time.Unix(seconds, nanos), nil
+}
+
+// retryRateLimited calls call, waiting out Slack rate limits for as long as
+// Slack's Retry-After asks, up to maxWaits times
+func retryRateLimited(ctx context.Context, maxWaits int, call func() error, onWait func(time.Duration)) error {
+	for waits := 0; ; waits++ {
+		err := call()
+
+		var rateLimited *slack.RateLimitedError
+		if !errors.As(err, &rateLimited) || waits >= maxWaits {
+			return err
+		}
+
+		wait := rateLimited.RetryAfter
+		if wait <= 0 {
+			wait = time.Second
+		}
+		if onWait != nil {
+			onWait(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
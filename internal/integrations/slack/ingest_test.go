@@ -0,0 +1,298 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// mockHistoryClient serves paginated channel history and thread replies,
+// rate limiting the first requests
+type mockHistoryClient struct {
+	*mockSlackClient
+
+	pages      map[string]*slack.GetConversationHistoryResponse // by cursor
+	threads    map[string][]slack.Message                       // by thread timestamp
+	rateLimits int
+
+	historyParams []slack.GetConversationHistoryParameters
+	replyCalls    []string
+}
+
+func (m *mockHistoryClient) rateLimited() error {
+	if m.rateLimits > 0 {
+		m.rateLimits--
+		return &slack.RateLimitedError{RetryAfter: time.Millisecond}
+	}
+	return nil
+}
+
+func (m *mockHistoryClient) GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	if err := m.rateLimited(); err != nil {
+		return nil, err
+	}
+	m.historyParams = append(m.historyParams, *params)
+	page, ok := m.pages[params.Cursor]
+	if !ok {
+		return nil, errors.New("invalid_cursor")
+	}
+	return page, nil
+}
+
+func (m *mockHistoryClient) GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	if err := m.rateLimited(); err != nil {
+		return nil, false, "", err
+	}
+	m.replyCalls = append(m.replyCalls, params.Timestamp)
+	thread, ok := m.threads[params.Timestamp]
+	if !ok {
+		return nil, false, "", errors.New("thread_not_found")
+	}
+	return thread, false, "", nil
+}
+
+type mockMessageStore struct {
+	messages map[string]SlackMessage // by message timestamp
+}
+
+func (m *mockMessageStore) StoreMessage(ctx context.Context, msg SlackMessage) (*SlackMessage, bool, error) {
+	_, exists := m.messages[msg.MessageTimestamp]
+	m.messages[msg.MessageTimestamp] = msg
+	return &msg, !exists, nil
+}
+
+func historyMessage(ts, text string, replies int) slack.Message {
+	msg := slack.Message{}
+	msg.Timestamp = ts
+	msg.User = "U1"
+	msg.Text = text
+	msg.ReplyCount = replies
+	if replies > 0 {
+		msg.ThreadTimestamp = ts
+	}
+	return msg
+}
+
+func replyMessage(ts, threadTS, text string) slack.Message {
+	msg := historyMessage(ts, text, 0)
+	msg.ThreadTimestamp = threadTS
+	return msg
+}
+
+func newIngestTestClient() *mockHistoryClient {
+	join := historyMessage("1700000400.000000", "<@U2> has joined the channel", 0)
+	join.SubType = "channel_join"
+	broadcast := replyMessage("1700000300.000000", "1700000100.000000", "Also sent to the channel: rotated the key")
+	broadcast.SubType = "thread_broadcast"
+
+	first := &slack.GetConversationHistoryResponse{
+		HasMore:  true,
+		Messages: []slack.Message{join, broadcast, historyMessage("1700000200.000000", "Standalone note about the deploy freeze", 0)},
+	}
+	first.ResponseMetaData.NextCursor = "page2"
+
+	return &mockHistoryClient{
+		mockSlackClient: &mockSlackClient{},
+		pages: map[string]*slack.GetConversationHistoryResponse{
+			"": first,
+			"page2": {Messages: []slack.Message{
+				historyMessage("1700000100.000000", "How do we rotate the deploy key?", 2),
+				historyMessage("1700000000.000000", "Where are the staging credentials?", 1),
+			}},
+		},
+		threads: map[string][]slack.Message{
+			"1700000100.000000": {
+				historyMessage("1700000100.000000", "How do we rotate the deploy key?", 2),
+				replyMessage("1700000150.000000", "1700000100.000000", "Run the rotation job in the platform runbook"),
+				replyMessage("1700000300.000000", "1700000100.000000", "Also sent to the channel: rotated the key"),
+			},
+		},
+	}
+}
+
+func TestIngestChannel_PagesThroughHistory(t *testing.T) {
+	client := newIngestTestClient()
+	client.rateLimits = 2
+	store := &mockMessageStore{messages: make(map[string]SlackMessage)}
+	handler := &SlackHandler{client: client, storage: store, rateLimitRetries: maxRateLimitWaits}
+
+	var reports []ChannelIngestProgress
+	oldest := time.Unix(1690000000, 0)
+	progress, err := handler.IngestChannel(context.Background(), "C1", oldest, time.Time{}, func(p ChannelIngestProgress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := ChannelIngestProgress{ChannelID: "C1", Pages: 2, Threads: 2, Messages: 4, Stored: 4, Failed: 1, RateLimitWaits: 2}
+	if progress != expected {
+		t.Errorf("Expected progress %+v, got %+v", expected, progress)
+	}
+	if len(reports) != 3 || reports[0].Threads != 1 || reports[2] != progress {
+		t.Errorf("Expected progress reported after each root message, got %+v", reports)
+	}
+
+	if len(client.historyParams) != 2 || client.historyParams[0].Oldest != "1690000000.000000" || client.historyParams[0].Latest != "" ||
+		client.historyParams[1].Cursor != "page2" {
+		t.Errorf("Unexpected history requests: %+v", client.historyParams)
+	}
+	// Only threads with replies are fetched; the broadcast reply is not a thread
+	if len(client.replyCalls) != 2 || client.replyCalls[0] != "1700000100.000000" || client.replyCalls[1] != "1700000000.000000" {
+		t.Errorf("Unexpected thread requests: %v", client.replyCalls)
+	}
+
+	reply, ok := store.messages["1700000150.000000"]
+	if !ok || reply.ThreadID != "1700000100.000000" || reply.IsThreadRoot || reply.ChannelID != "C1" {
+		t.Errorf("Expected the reply stored in its thread, got %+v", reply)
+	}
+	if reply.TeamID != "T_HOME" {
+		t.Errorf("Expected a message without a team attributed to the installation's, got %q", reply.TeamID)
+	}
+	if standalone, ok := store.messages["1700000200.000000"]; !ok || !standalone.IsThreadRoot {
+		t.Errorf("Expected the standalone message stored as a thread root, got %+v", standalone)
+	}
+	if _, ok := store.messages["1700000400.000000"]; ok {
+		t.Error("Expected channel join events to be skipped")
+	}
+
+	// Ingesting again stores nothing new
+	again, err := handler.IngestChannel(context.Background(), "C1", oldest, time.Time{}, nil)
+	if err != nil || again.Stored != 0 || again.Messages != 4 {
+		t.Errorf("Expected a repeat ingestion to store nothing new, got %+v, %v", again, err)
+	}
+}
+
+func TestIngestChannel_RespectsAllowlist(t *testing.T) {
+	client := newIngestTestClient()
+	allowlist := NewChannelAllowlist(&mockOverrideStore{overrides: map[string]bool{}}, []string{"C_OTHER"})
+	handler := &SlackHandler{client: client, storage: &mockMessageStore{messages: make(map[string]SlackMessage)}, allowlist: allowlist}
+
+	if _, err := handler.IngestChannel(context.Background(), "C1", time.Time{}, time.Time{}, nil); !errors.Is(err, ErrChannelNotAllowed) {
+		t.Errorf("Expected ErrChannelNotAllowed, got %v", err)
+	}
+	if len(client.historyParams) != 0 {
+		t.Error("Expected no history requests for a channel that isn't allowed")
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	t.Run("gives up after the wait limit", func(t *testing.T) {
+		calls := 0
+		err := retryRateLimited(context.Background(), maxRateLimitWaits, func() error {
+			calls++
+			return &slack.RateLimitedError{RetryAfter: time.Millisecond}
+		}, nil)
+
+		var rateLimited *slack.RateLimitedError
+		if !errors.As(err, &rateLimited) || calls != maxRateLimitWaits+1 {
+			t.Errorf("Expected the rate limit error after %d calls, got %v after %d", maxRateLimitWaits+1, err, calls)
+		}
+	})
+
+	t.Run("other errors fail at once", func(t *testing.T) {
+		calls := 0
+		err := retryRateLimited(context.Background(), maxRateLimitWaits, func() error {
+			calls++
+			return errors.New("channel_not_found")
+		}, nil)
+		if err == nil || calls != 1 {
+			t.Errorf("Expected one failed call, got %v after %d", err, calls)
+		}
+	})
+
+	t.Run("stops when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := retryRateLimited(ctx, maxRateLimitWaits, func() error {
+			return &slack.RateLimitedError{RetryAfter: time.Minute}
+		}, nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestParseSlackTimestamp(t *testing.T) {
+	testCases := []struct {
+		name        string
+		timestamp   string
+		expected    time.Time
+		expectError bool
+	}{
+		{
+			name:      "valid timestamp",
+			timestamp: "1234567890.123456",
+			expected:  time.Unix(1234567890, 123456000),
+		},
+		{
+			name:      "timestamp without decimal",
+			timestamp: "1234567890",
+			expected:  time.Unix(1234567890, 0),
+		},
+		{
+			name:      "very long timestamp",
+			timestamp: "1234567890.123456789012",
+			expected:  time.Unix(1234567890, 123456789),
+		},
+		{
+			name:      "low precision timestamp",
+			timestamp: "1234567890.5",
+			expected:  time.Unix(1234567890, 500000000),
+		},
+		{
+			name:      "short seconds",
+			timestamp: "987654321.000100",
+			expected:  time.Unix(987654321, 100000),
+		},
+		{
+			name:        "empty timestamp",
+			timestamp:   "",
+			expectError: true,
+		},
+		{
+			name:        "malformed timestamp",
+			timestamp:   "not-a-timestamp",
+			expectError: true,
+		},
+		{
+			name:        "malformed fraction",
+			timestamp:   "1234567890.12ab",
+			expectError: true,
+		},
+		{
+			name:        "zero timestamp",
+			timestamp:   "0.000000",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseSlackTimestamp(tc.timestamp)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Equal(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseSlackTimestamp_RoundTrips(t *testing.T) {
+	original := time.Unix(1700000000, 123456000)
+	parsed, err := parseSlackTimestamp(slackTimestamp(original))
+	if err != nil || !parsed.Equal(original) {
+		t.Errorf("Expected %v back from %q, got %v (%v)", original, slackTimestamp(original), parsed, err)
+	}
+}
@@ -0,0 +1,41 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/slack-go/slack"
+)
+
+// GetThreadPermalink returns a link to the thread started by threadTS in the
+// channel, or "" if Slack won't provide one (e.g. the bot can't access the
+// channel). Permalinks don't change, so found ones are cached for the life of
+// the process.
+func (h *SlackHandler) GetThreadPermalink(ctx context.Context, channelID, threadTS string) string {
+	if channelID == "" || threadTS == "" {
+		return ""
+	}
+
+	key := channelID + "/" + threadTS
+	h.permalinksMu.Lock()
+	permalink, ok := h.permalinks[key]
+	h.permalinksMu.Unlock()
+	if ok {
+		return permalink
+	}
+
+	permalink, err := h.client.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channelID, Ts: threadTS})
+	if err != nil {
+		slog.Warn("Failed to get thread permalink", "error", err, "channel", channelID, "thread_ts", threadTS)
+		return ""
+	}
+
+	h.permalinksMu.Lock()
+	if h.permalinks == nil {
+		h.permalinks = make(map[string]string)
+	}
+	h.permalinks[key] = permalink
+	h.permalinksMu.Unlock()
+
+	return permalink
+}
@@ -6,64 +6,134 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"math"
+	"sort"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pgvector/pgvector-go"
+
+	"knowthis/internal/language"
+	"knowthis/internal/storage"
 )
 
+// defaultKeywordWeight is how far a best keyword match lifts a hybrid search score toward 1
+const defaultKeywordWeight = 0.3
+
+// ThreadEmbeddingColumn is the Slack thread chunk embedding column. Threads
+// without chunk embeddings are embedded again, so migrating clears the table.
+var ThreadEmbeddingColumn = storage.VectorColumn{
+	Table:     "slack_thread_embeddings",
+	Column:    "embedding",
+	Migration: "TRUNCATE slack_thread_embeddings; ALTER TABLE slack_thread_embeddings ALTER COLUMN embedding TYPE vector(%d);",
+}
+
 // SlackStorage handles Slack-specific database operations
 type SlackStorage struct {
-	db *sql.DB
+	db          *sql.DB
+	granularity RetrievalGranularity
+
+	// How far (0-1) a best keyword match lifts a hybrid search score toward 1
+	keywordWeight float64
 }
 
 // NewSlackStorage creates a new Slack storage instance
 func NewSlackStorage(db *sql.DB) *SlackStorage {
-	return &SlackStorage{db: db}
+	return &SlackStorage{db: db, granularity: GranularityThread, keywordWeight: defaultKeywordWeight}
+}
+
+// SetKeywordWeight sets how far (0-1) a best keyword match lifts a thread's
+// hybrid search score from its embedding similarity toward 1
+func (s *SlackStorage) SetKeywordWeight(weight float64) {
+	if weight >= 0 && weight <= 1 {
+		s.keywordWeight = weight
+		slog.Info("Updated hybrid search keyword weight", "weight", weight)
+	}
+}
+
+// SetRetrievalGranularity sets whether search returns whole threads or only matched chunks
+func (s *SlackStorage) SetRetrievalGranularity(granularity RetrievalGranularity) {
+	if granularity == GranularityThread || granularity == GranularityChunk {
+		s.granularity = granularity
+		slog.Info("Updated retrieval granularity", "granularity", granularity)
+	}
+}
+
+// slackMigrations evolve the Slack tables. Migration 1 is the schema from
+// before migrations were tracked, so its statements must stay safe to run
+// against a database that already has it.
+var slackMigrations = []storage.Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: storage.ExecMigration(
+			`CREATE TABLE IF NOT EXISTS slack_messages (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				channel_id TEXT NOT NULL,
+				thread_id TEXT NOT NULL,
+				message_timestamp TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				user_name TEXT,
+				content TEXT NOT NULL,
+				content_hash TEXT NOT NULL,
+				client_msg_id TEXT,
+				is_thread_root BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+			);`,
+			// Author profile and source workspace columns, added after the table
+			"ALTER TABLE slack_messages ADD COLUMN IF NOT EXISTS user_title TEXT;",
+			"ALTER TABLE slack_messages ADD COLUMN IF NOT EXISTS user_team TEXT;",
+			"ALTER TABLE slack_messages ADD COLUMN IF NOT EXISTS team_id TEXT;",
+			"ALTER TABLE slack_messages ADD COLUMN IF NOT EXISTS content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;",
+			`CREATE TABLE IF NOT EXISTS slack_thread_embeddings (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				thread_id TEXT NOT NULL,
+				chunk_index INTEGER NOT NULL DEFAULT 0,
+				content_hash TEXT NOT NULL,
+				embedding VECTOR(1536),
+				start_message_ts TEXT,
+				end_message_ts TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+				UNIQUE(thread_id, chunk_index)
+			);`,
+			// Chunk message range columns, added with chunk-level retrieval,
+			// and the flag marking a thread's chunks for re-checking after an edit
+			"ALTER TABLE slack_thread_embeddings ADD COLUMN IF NOT EXISTS start_message_ts TEXT;",
+			"ALTER TABLE slack_thread_embeddings ADD COLUMN IF NOT EXISTS end_message_ts TEXT;",
+			"ALTER TABLE slack_thread_embeddings ADD COLUMN IF NOT EXISTS stale BOOLEAN NOT NULL DEFAULT FALSE;",
+			// Settings embeddings were made with
+			`CREATE TABLE IF NOT EXISTS slack_embedding_settings (
+				key TEXT PRIMARY KEY,
+				value TEXT NOT NULL,
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+			);`,
+			// Runtime overrides of the configured allowlist
+			`CREATE TABLE IF NOT EXISTS slack_channel_allowlist (
+				channel_id TEXT PRIMARY KEY,
+				allowed BOOLEAN NOT NULL,
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+			);`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "message language",
+		Up:      storage.LanguageMigration("slack_messages"),
+	},
 }
 
-// InitSchema creates the Slack-specific tables
+// InitSchema migrates the Slack-specific tables
 func (s *SlackStorage) InitSchema() error {
 	slog.Info("Initializing Slack schema...")
 
-	// Create slack_messages table
-	createMessagesTable := `
-		CREATE TABLE IF NOT EXISTS slack_messages (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			channel_id TEXT NOT NULL,
-			thread_id TEXT NOT NULL,
-			message_timestamp TEXT NOT NULL,
-			user_id TEXT NOT NULL,
-			user_name TEXT,
-			content TEXT NOT NULL,
-			content_hash TEXT NOT NULL,
-			client_msg_id TEXT,
-			is_thread_root BOOLEAN DEFAULT FALSE,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		);
-	`
-	if _, err := s.db.Exec(createMessagesTable); err != nil {
-		return fmt.Errorf("failed to create slack_messages table: %w", err)
-	}
-
-	// Create slack_thread_embeddings table
-	createEmbeddingsTable := `
-		CREATE TABLE IF NOT EXISTS slack_thread_embeddings (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			thread_id TEXT NOT NULL,
-			chunk_index INTEGER NOT NULL DEFAULT 0,
-			content_hash TEXT NOT NULL,
-			embedding VECTOR(1536),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			UNIQUE(thread_id, chunk_index)
-		);
-	`
-	if _, err := s.db.Exec(createEmbeddingsTable); err != nil {
-		return fmt.Errorf("failed to create slack_thread_embeddings table: %w", err)
+	if err := storage.Migrate(context.Background(), s.db, "slack", slackMigrations); err != nil {
+		return err
 	}
 
-	// Create indexes
+	// Indexes stay outside migrations: a failure (e.g. the unique index over
+	// existing duplicates) is only logged, and retried on the next start
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_slack_channel_thread ON slack_messages(channel_id, thread_id);",
 		"CREATE INDEX IF NOT EXISTS idx_slack_content_hash ON slack_messages(content_hash);",
@@ -72,6 +142,7 @@ func (s *SlackStorage) InitSchema() error {
 		"CREATE UNIQUE INDEX IF NOT EXISTS idx_slack_unique_message ON slack_messages(channel_id, message_timestamp);",
 		"CREATE INDEX IF NOT EXISTS idx_slack_thread_embeddings_thread ON slack_thread_embeddings(thread_id);",
 		"CREATE INDEX IF NOT EXISTS idx_slack_thread_embeddings_hash ON slack_thread_embeddings(content_hash);",
+		"CREATE INDEX IF NOT EXISTS idx_slack_content_tsv ON slack_messages USING GIN (content_tsv);",
 	}
 
 	for _, indexSQL := range indexes {
@@ -88,16 +159,21 @@ func (s *SlackStorage) InitSchema() error {
 func (s *SlackStorage) StoreMessage(ctx context.Context, msg SlackMessage) (*SlackMessage, bool, error) {
 	// Generate content hash
 	msg.ContentHash = hashContent(msg.Content)
+	msg.Language = language.Detect(msg.Content)
 
 	query := `
 		INSERT INTO slack_messages (
 			channel_id, thread_id, message_timestamp, user_id, user_name,
-			content, content_hash, client_msg_id, is_thread_root
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			content, content_hash, client_msg_id, is_thread_root, user_title, user_team, team_id, language
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		ON CONFLICT (channel_id, message_timestamp)
 		DO UPDATE SET
 			content = EXCLUDED.content,
 			content_hash = EXCLUDED.content_hash,
+			language = EXCLUDED.language,
+			user_title = COALESCE(EXCLUDED.user_title, slack_messages.user_title),
+			user_team = COALESCE(EXCLUDED.user_team, slack_messages.user_team),
+			team_id = COALESCE(EXCLUDED.team_id, slack_messages.team_id),
 			updated_at = NOW()
 		RETURNING id, created_at, updated_at, (xmax = 0) as was_inserted
 	`
@@ -108,6 +184,7 @@ func (s *SlackStorage) StoreMessage(ctx context.Context, msg SlackMessage) (*Sla
 	err := s.db.QueryRowContext(ctx, query,
 		msg.ChannelID, msg.ThreadID, msg.MessageTimestamp, msg.UserID, msg.UserName,
 		msg.Content, msg.ContentHash, msg.ClientMsgID, msg.IsThreadRoot,
+		nullIfEmpty(msg.UserTitle), nullIfEmpty(msg.UserTeam), nullIfEmpty(msg.TeamID), msg.Language,
 	).Scan(&stored.ID, &stored.CreatedAt, &stored.UpdatedAt, &wasInserted)
 
 	if err != nil {
@@ -124,30 +201,63 @@ func (s *SlackStorage) StoreMessage(ctx context.Context, msg SlackMessage) (*Sla
 	stored.ContentHash = msg.ContentHash
 	stored.ClientMsgID = msg.ClientMsgID
 	stored.IsThreadRoot = msg.IsThreadRoot
-
-	// For now, we'll handle content changes by checking if it's an update
-	// In a future version, we could add logic to detect content changes
-	if !wasInserted {
-		// This was an update, so invalidate thread embeddings to be safe
-		_, err = s.db.ExecContext(ctx, `
-			DELETE FROM slack_thread_embeddings
-			WHERE thread_id = $1
-		`, stored.ThreadID)
-		if err != nil {
-			slog.Error("Failed to invalidate thread embeddings for updated message", "error", err, "thread_id", stored.ThreadID)
-		} else {
-			slog.Debug("Message updated, thread embeddings invalidated", "thread_id", stored.ThreadID)
-		}
+	stored.UserTitle = msg.UserTitle
+	stored.UserTeam = msg.UserTeam
+	stored.TeamID = msg.TeamID
+	stored.Language = msg.Language
+
+	// An edited message or a new reply changes the thread, so have the
+	// embedding processor re-check its chunks. Embeddings stay searchable
+	// until replaced, and only chunks whose content changed are re-embedded.
+	// Threads without embeddings are picked up anyway.
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE slack_thread_embeddings
+		SET stale = TRUE
+		WHERE thread_id = $1 AND NOT stale
+	`, stored.ThreadID)
+	if err != nil {
+		slog.Error("Failed to mark thread embeddings stale for stored message", "error", err, "thread_id", stored.ThreadID)
+	} else if marked, _ := result.RowsAffected(); marked > 0 {
+		slog.Debug("Message stored, thread embeddings marked stale", "thread_id", stored.ThreadID, "was_inserted", wasInserted)
 	}
 
 	return &stored, wasInserted, nil
 }
 
+// InsertMessageIfAbsent stores a message unless one with the same channel and
+// timestamp already exists, which is left untouched. Reports whether it was inserted.
+func (s *SlackStorage) InsertMessageIfAbsent(ctx context.Context, msg SlackMessage) (bool, error) {
+	query := `
+		INSERT INTO slack_messages (
+			channel_id, thread_id, message_timestamp, user_id, user_name,
+			content, content_hash, client_msg_id, is_thread_root, user_title, user_team, team_id, language
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (channel_id, message_timestamp) DO NOTHING
+		RETURNING id
+	`
+
+	var id string
+	err := s.db.QueryRowContext(ctx, query,
+		msg.ChannelID, msg.ThreadID, msg.MessageTimestamp, msg.UserID, msg.UserName,
+		msg.Content, hashContent(msg.Content), msg.ClientMsgID, msg.IsThreadRoot,
+		nullIfEmpty(msg.UserTitle), nullIfEmpty(msg.UserTeam), nullIfEmpty(msg.TeamID), language.Detect(msg.Content),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	return true, nil
+}
+
 // GetThread retrieves all messages in a thread
 func (s *SlackStorage) GetThread(ctx context.Context, threadID string) (*SlackThread, error) {
 	query := `
 		SELECT id, channel_id, thread_id, message_timestamp, user_id, user_name,
-			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at
+			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at,
+			   COALESCE(user_title, ''), COALESCE(user_team, ''), COALESCE(team_id, '')
 		FROM slack_messages
 		WHERE thread_id = $1
 		ORDER BY message_timestamp ASC
@@ -168,6 +278,7 @@ func (s *SlackStorage) GetThread(ctx context.Context, threadID string) (*SlackTh
 			&msg.ID, &msg.ChannelID, &msg.ThreadID, &msg.MessageTimestamp,
 			&msg.UserID, &msg.UserName, &msg.Content, &msg.ContentHash,
 			&msg.ClientMsgID, &msg.IsThreadRoot, &msg.CreatedAt, &msg.UpdatedAt,
+			&msg.UserTitle, &msg.UserTeam, &msg.TeamID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
@@ -190,7 +301,8 @@ func (s *SlackStorage) GetThread(ctx context.Context, threadID string) (*SlackTh
 func (s *SlackStorage) GetThreadRoot(ctx context.Context, threadID string) (*SlackMessage, error) {
 	query := `
 		SELECT id, channel_id, thread_id, message_timestamp, user_id, user_name,
-			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at
+			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at,
+			   COALESCE(user_title, ''), COALESCE(user_team, ''), COALESCE(team_id, '')
 		FROM slack_messages
 		WHERE thread_id = $1 AND is_thread_root = TRUE
 		LIMIT 1
@@ -201,6 +313,7 @@ func (s *SlackStorage) GetThreadRoot(ctx context.Context, threadID string) (*Sla
 		&msg.ID, &msg.ChannelID, &msg.ThreadID, &msg.MessageTimestamp,
 		&msg.UserID, &msg.UserName, &msg.Content, &msg.ContentHash,
 		&msg.ClientMsgID, &msg.IsThreadRoot, &msg.CreatedAt, &msg.UpdatedAt,
+		&msg.UserTitle, &msg.UserTeam, &msg.TeamID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -213,15 +326,18 @@ func (s *SlackStorage) GetThreadRoot(ctx context.Context, threadID string) (*Sla
 	return &msg, nil
 }
 
-// GetThreadsWithoutEmbeddings retrieves threads that need embeddings
+// GetThreadsWithoutEmbeddings retrieves threads that need embeddings: those
+// never embedded and those with stale embeddings after an edit. Threads are
+// returned oldest first by their first stored message, ties broken by thread
+// ID so each batch is deterministic.
 func (s *SlackStorage) GetThreadsWithoutEmbeddings(ctx context.Context, limit int) ([]string, error) {
 	query := `
 		SELECT m.thread_id
 		FROM slack_messages m
 		LEFT JOIN slack_thread_embeddings e ON m.thread_id = e.thread_id
-		WHERE e.thread_id IS NULL
+		WHERE e.thread_id IS NULL OR e.stale
 		GROUP BY m.thread_id
-		ORDER BY MIN(m.created_at) ASC
+		ORDER BY MIN(m.created_at) ASC, m.thread_id ASC
 		LIMIT $1
 	`
 
@@ -239,6 +355,9 @@ func (s *SlackStorage) GetThreadsWithoutEmbeddings(ctx context.Context, limit in
 		}
 		threadIDs = append(threadIDs, threadID)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read threads without embeddings: %w", err)
+	}
 
 	return threadIDs, nil
 }
@@ -247,7 +366,8 @@ func (s *SlackStorage) GetThreadsWithoutEmbeddings(ctx context.Context, limit in
 func (s *SlackStorage) GetMessagesInThread(ctx context.Context, threadID string) ([]SlackMessage, error) {
 	query := `
 		SELECT id, channel_id, thread_id, message_timestamp, user_id, user_name,
-			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at
+			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at,
+			   COALESCE(user_title, ''), COALESCE(user_team, ''), COALESCE(team_id, '')
 		FROM slack_messages
 		WHERE thread_id = $1
 		ORDER BY message_timestamp ASC
@@ -267,6 +387,7 @@ func (s *SlackStorage) GetMessagesInThread(ctx context.Context, threadID string)
 			&msg.ID, &msg.ChannelID, &msg.ThreadID, &msg.MessageTimestamp,
 			&msg.UserID, &msg.UserName, &msg.Content, &msg.ContentHash,
 			&msg.ClientMsgID, &msg.IsThreadRoot, &msg.CreatedAt, &msg.UpdatedAt,
+			&msg.UserTitle, &msg.UserTeam, &msg.TeamID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
@@ -278,19 +399,28 @@ func (s *SlackStorage) GetMessagesInThread(ctx context.Context, threadID string)
 	return messages, nil
 }
 
-// StoreThreadEmbedding stores an embedding for a thread chunk
-func (s *SlackStorage) StoreThreadEmbedding(ctx context.Context, threadID string, chunkIndex int, contentHash string, embedding []float32) error {
+// StoreThreadEmbedding stores an embedding for a thread chunk covering the
+// given message range. A nil embedding stores the chunk without one (a dry
+// run's marker), which search skips.
+func (s *SlackStorage) StoreThreadEmbedding(ctx context.Context, chunk ChunkRange, chunkIndex int, contentHash string, embedding []float32) error {
 	query := `
-		INSERT INTO slack_thread_embeddings (thread_id, chunk_index, content_hash, embedding)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO slack_thread_embeddings (thread_id, chunk_index, content_hash, embedding, start_message_ts, end_message_ts)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		ON CONFLICT (thread_id, chunk_index) DO UPDATE SET
 			content_hash = EXCLUDED.content_hash,
 			embedding = EXCLUDED.embedding,
+			start_message_ts = EXCLUDED.start_message_ts,
+			end_message_ts = EXCLUDED.end_message_ts,
+			stale = FALSE,
 			created_at = NOW()
 	`
 
-	embeddingVector := pgvector.NewVector(embedding)
-	_, err := s.db.ExecContext(ctx, query, threadID, chunkIndex, contentHash, embeddingVector)
+	var embeddingVector interface{}
+	if embedding != nil {
+		embeddingVector = pgvector.NewVector(embedding)
+	}
+	_, err := s.db.ExecContext(ctx, query, chunk.ThreadID, chunkIndex, contentHash, embeddingVector,
+		nullIfEmpty(chunk.StartTimestamp), nullIfEmpty(chunk.EndTimestamp))
 	if err != nil {
 		return fmt.Errorf("failed to store thread embedding: %w", err)
 	}
@@ -298,39 +428,154 @@ func (s *SlackStorage) StoreThreadEmbedding(ctx context.Context, threadID string
 	return nil
 }
 
-// SearchSimilarMessages searches for similar messages using thread embeddings
-func (s *SlackStorage) SearchSimilarMessages(ctx context.Context, embedding []float32, limit int) ([]SlackMessage, error) {
-	// First, find similar threads using embeddings
-	threadQuery := `
-		SELECT e.thread_id, 1 - (e.embedding <=> $1) as similarity
-		FROM slack_thread_embeddings e
-		WHERE e.embedding IS NOT NULL
-		ORDER BY e.embedding <=> $1
-		LIMIT $2
-	`
-
-	embeddingVector := pgvector.NewVector(embedding)
-	rows, err := s.db.QueryContext(ctx, threadQuery, embeddingVector, limit)
+// GetThreadEmbeddingHashes returns the content hash of each embedded chunk of
+// a thread by chunk index
+func (s *SlackStorage) GetThreadEmbeddingHashes(ctx context.Context, threadID string) (map[int]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT chunk_index, content_hash
+		FROM slack_thread_embeddings
+		WHERE thread_id = $1
+	`, threadID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search similar threads: %w", err)
+		return nil, fmt.Errorf("failed to get thread embedding hashes: %w", err)
 	}
 	defer rows.Close()
 
-	var threadIDs []string
+	hashes := make(map[int]string)
 	for rows.Next() {
-		var threadID string
-		var similarity float64
+		var chunkIndex int
+		var contentHash string
+		if err := rows.Scan(&chunkIndex, &contentHash); err != nil {
+			return nil, fmt.Errorf("failed to scan thread embedding hash: %w", err)
+		}
+		hashes[chunkIndex] = contentHash
+	}
 
-		if err := rows.Scan(&threadID, &similarity); err != nil {
-			return nil, fmt.Errorf("failed to scan thread result: %w", err)
+	return hashes, rows.Err()
+}
+
+// CompleteThreadEmbeddings deletes a thread's embeddings from chunkCount on,
+// left over from when the thread had more chunks, and clears the stale flag
+// on the rest
+func (s *SlackStorage) CompleteThreadEmbeddings(ctx context.Context, threadID string, chunkCount int) error {
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM slack_thread_embeddings
+		WHERE thread_id = $1 AND chunk_index >= $2
+	`, threadID, chunkCount); err != nil {
+		return fmt.Errorf("failed to delete extra thread embeddings: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE slack_thread_embeddings
+		SET stale = FALSE
+		WHERE thread_id = $1 AND stale
+	`, threadID); err != nil {
+		return fmt.Errorf("failed to mark thread embeddings current: %w", err)
+	}
+
+	return nil
+}
+
+// InvalidateChunking records the chunking settings thread embeddings are
+// made with. When they differ from the recorded ones, every thread's
+// embeddings are marked stale so the threads are re-chunked; the old
+// embeddings stay searchable until then. Embeddings from before settings were
+// recorded were made with the defaults. Returns how many were marked stale.
+func (s *SlackStorage) InvalidateChunking(ctx context.Context, chunking string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	previous := chunkingSettings(maxWordsPerChunk, 0)
+	err = tx.QueryRowContext(ctx, `
+		SELECT value FROM slack_embedding_settings WHERE key = 'chunking' FOR UPDATE
+	`).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get chunking settings: %w", err)
+	}
+
+	var stale int64
+	if previous != chunking {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE slack_thread_embeddings
+			SET stale = TRUE
+			WHERE NOT stale
+		`)
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark thread embeddings stale: %w", err)
+		}
+		if stale, err = result.RowsAffected(); err != nil {
+			return 0, fmt.Errorf("failed to mark thread embeddings stale: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO slack_embedding_settings (key, value) VALUES ('chunking', $1)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`, chunking); err != nil {
+		return 0, fmt.Errorf("failed to record chunking settings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit chunking settings: %w", err)
+	}
+	return stale, nil
+}
+
+// SearchSimilarMessages searches for similar messages using thread embeddings,
+// full-text match or both, depending on the filter's mode, considering only
+// threads that match the filter
+func (s *SlackStorage) SearchSimilarMessages(ctx context.Context, embedding []float32, limit int, filter SearchFilter) ([]SlackMessage, error) {
+	var chunks []ChunkRange
+	vectorScores := make(map[string]float64)
+	keywordScores := make(map[string]float64)
+
+	if filter.Mode != SearchModeKeyword {
+		var err error
+		if chunks, vectorScores, err = s.searchThreadsByEmbedding(ctx, embedding, limit, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	if (filter.Mode == SearchModeKeyword || filter.Mode == SearchModeHybrid) && strings.TrimSpace(filter.Query) != "" {
+		var err error
+		if keywordScores, err = s.searchThreadsByKeyword(ctx, filter.Query, limit, filter); err != nil {
+			return nil, err
+		}
+
+		// Keyword matches cover their whole thread
+		var keywordOnly []string
+		for threadID := range keywordScores {
+			if _, matched := vectorScores[threadID]; !matched {
+				chunks = append(chunks, ChunkRange{ThreadID: threadID})
+				keywordOnly = append(keywordOnly, threadID)
+			}
+		}
+
+		// Blending needs a similarity for threads the vector search didn't reach
+		if filter.Mode == SearchModeHybrid && len(keywordOnly) > 0 {
+			similarities, err := s.threadSimilarities(ctx, embedding, keywordOnly)
+			if err != nil {
+				return nil, err
+			}
+			for threadID, similarity := range similarities {
+				vectorScores[threadID] = similarity
+			}
 		}
-		threadIDs = append(threadIDs, threadID)
 	}
 
-	if len(threadIDs) == 0 {
+	threadSimilarity := mergeSearchScores(vectorScores, keywordScores, filter.Mode, s.keywordWeight, limit)
+	if len(threadSimilarity) == 0 {
 		return []SlackMessage{}, nil
 	}
 
+	threadIDs := make([]string, 0, len(threadSimilarity))
+	for threadID := range threadSimilarity {
+		threadIDs = append(threadIDs, threadID)
+	}
+
 	// Now get all messages from these threads
 	placeholders := make([]string, len(threadIDs))
 	args := make([]interface{}, len(threadIDs))
@@ -341,7 +586,8 @@ func (s *SlackStorage) SearchSimilarMessages(ctx context.Context, embedding []fl
 
 	messageQuery := fmt.Sprintf(`
 		SELECT id, channel_id, thread_id, message_timestamp, user_id, user_name,
-			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at
+			   content, content_hash, client_msg_id, is_thread_root, created_at, updated_at,
+			   COALESCE(user_title, ''), COALESCE(user_team, ''), COALESCE(team_id, '')
 		FROM slack_messages
 		WHERE thread_id IN (%s)
 		ORDER BY thread_id, message_timestamp ASC
@@ -361,6 +607,7 @@ func (s *SlackStorage) SearchSimilarMessages(ctx context.Context, embedding []fl
 			&msg.ID, &msg.ChannelID, &msg.ThreadID, &msg.MessageTimestamp,
 			&msg.UserID, &msg.UserName, &msg.Content, &msg.ContentHash,
 			&msg.ClientMsgID, &msg.IsThreadRoot, &msg.CreatedAt, &msg.UpdatedAt,
+			&msg.UserTitle, &msg.UserTeam, &msg.TeamID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
@@ -369,7 +616,306 @@ func (s *SlackStorage) SearchSimilarMessages(ctx context.Context, embedding []fl
 		messages = append(messages, msg)
 	}
 
-	return messages, nil
+	if s.granularity == GranularityChunk {
+		messages = filterMessagesToChunks(messages, chunks)
+	}
+
+	return rankMessagesBySimilarity(messages, threadSimilarity), nil
+}
+
+// searchThreadsByEmbedding returns the chunks closest to the embedding and
+// each matched thread's best similarity
+func (s *SlackStorage) searchThreadsByEmbedding(ctx context.Context, embedding []float32, limit int, filter SearchFilter) ([]ChunkRange, map[string]float64, error) {
+	filterSQL, searchArgs := filter.conditions([]interface{}{pgvector.NewVector(embedding), limit})
+	threadQuery := fmt.Sprintf(`
+		SELECT e.thread_id, COALESCE(e.start_message_ts, ''), COALESCE(e.end_message_ts, ''),
+			   1 - (e.embedding <=> $1) as similarity
+		FROM slack_thread_embeddings e
+		WHERE e.embedding IS NOT NULL%s
+		ORDER BY e.embedding <=> $1
+		LIMIT $2
+	`, filterSQL)
+
+	rows, err := s.db.QueryContext(ctx, threadQuery, searchArgs...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search similar threads: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []ChunkRange
+	threadSimilarity := make(map[string]float64)
+	for rows.Next() {
+		var chunk ChunkRange
+		var similarity float64
+
+		if err := rows.Scan(&chunk.ThreadID, &chunk.StartTimestamp, &chunk.EndTimestamp, &similarity); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan thread result: %w", err)
+		}
+		chunks = append(chunks, chunk)
+
+		// Rows are ordered by distance, so a thread's first chunk is its best match
+		if _, seen := threadSimilarity[chunk.ThreadID]; !seen {
+			threadSimilarity[chunk.ThreadID] = similarity
+		}
+	}
+
+	return chunks, threadSimilarity, rows.Err()
+}
+
+// searchThreadsByKeyword returns the threads whose messages best match the
+// query's terms, scored by their best message's full-text rank
+func (s *SlackStorage) searchThreadsByKeyword(ctx context.Context, query string, limit int, filter SearchFilter) (map[string]float64, error) {
+	filterSQL, searchArgs := filter.conditions([]interface{}{query, limit})
+	keywordQuery := fmt.Sprintf(`
+		SELECT e.thread_id, e.rank
+		FROM (
+			SELECT m.thread_id, MAX(ts_rank_cd(m.content_tsv, websearch_to_tsquery('english', $1))) AS rank
+			FROM slack_messages m
+			WHERE m.content_tsv @@ websearch_to_tsquery('english', $1)
+			GROUP BY m.thread_id
+		) e
+		WHERE TRUE%s
+		ORDER BY e.rank DESC
+		LIMIT $2
+	`, filterSQL)
+
+	rows, err := s.db.QueryContext(ctx, keywordQuery, searchArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search threads by keyword: %w", err)
+	}
+	defer rows.Close()
+
+	threadRank := make(map[string]float64)
+	for rows.Next() {
+		var threadID string
+		var rank float64
+		if err := rows.Scan(&threadID, &rank); err != nil {
+			return nil, fmt.Errorf("failed to scan keyword result: %w", err)
+		}
+		threadRank[threadID] = rank
+	}
+
+	return threadRank, rows.Err()
+}
+
+// threadSimilarities returns the best embedding similarity of each given thread
+func (s *SlackStorage) threadSimilarities(ctx context.Context, embedding []float32, threadIDs []string) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT thread_id, MAX(1 - (embedding <=> $1))
+		FROM slack_thread_embeddings
+		WHERE embedding IS NOT NULL AND thread_id = ANY($2)
+		GROUP BY thread_id
+	`, pgvector.NewVector(embedding), pq.Array(threadIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread similarities: %w", err)
+	}
+	defer rows.Close()
+
+	similarities := make(map[string]float64)
+	for rows.Next() {
+		var threadID string
+		var similarity float64
+		if err := rows.Scan(&threadID, &similarity); err != nil {
+			return nil, fmt.Errorf("failed to scan thread similarity: %w", err)
+		}
+		similarities[threadID] = similarity
+	}
+
+	return similarities, rows.Err()
+}
+
+// mergeSearchScores combines per-thread embedding similarities and keyword
+// ranks into one score per thread, keeping the limit best threads. Keyword
+// ranks are scaled so the best match scores 1. In hybrid mode keyword match
+// lifts a thread's similarity toward 1 in proportion to the keyword weight,
+// so threads without a keyword match keep their similarity and the usual
+// thresholds still apply.
+func mergeSearchScores(vectorScores, keywordScores map[string]float64, mode SearchMode, keywordWeight float64, limit int) map[string]float64 {
+	var bestRank float64
+	for _, rank := range keywordScores {
+		bestRank = math.Max(bestRank, rank)
+	}
+	keywordScore := func(threadID string) float64 {
+		if bestRank <= 0 {
+			return 0
+		}
+		return keywordScores[threadID] / bestRank
+	}
+
+	scores := make(map[string]float64)
+	switch mode {
+	case SearchModeKeyword:
+		for threadID := range keywordScores {
+			scores[threadID] = keywordScore(threadID)
+		}
+	case SearchModeHybrid:
+		for threadID, similarity := range vectorScores {
+			scores[threadID] = similarity
+		}
+		for threadID := range keywordScores {
+			similarity := scores[threadID]
+			scores[threadID] = similarity + keywordWeight*keywordScore(threadID)*(1-similarity)
+		}
+	default:
+		for threadID, similarity := range vectorScores {
+			scores[threadID] = similarity
+		}
+	}
+
+	if len(scores) <= limit {
+		return scores
+	}
+
+	threadIDs := make([]string, 0, len(scores))
+	for threadID := range scores {
+		threadIDs = append(threadIDs, threadID)
+	}
+	sort.Slice(threadIDs, func(i, j int) bool {
+		if scores[threadIDs[i]] != scores[threadIDs[j]] {
+			return scores[threadIDs[i]] > scores[threadIDs[j]]
+		}
+		return threadIDs[i] < threadIDs[j]
+	})
+	for _, threadID := range threadIDs[limit:] {
+		delete(scores, threadID)
+	}
+
+	return scores
+}
+
+// conditions appends a SQL condition matching threads with a message in the
+// filter's time range and language, numbering placeholders after the existing args
+func (f SearchFilter) conditions(args []interface{}) (string, []interface{}) {
+	var clauses []string
+	if !f.After.IsZero() {
+		args = append(args, unixSeconds(f.After))
+		clauses = append(clauses, fmt.Sprintf(" AND CAST(m.message_timestamp AS DOUBLE PRECISION) >= $%d", len(args)))
+	}
+	if !f.Before.IsZero() {
+		args = append(args, unixSeconds(f.Before))
+		clauses = append(clauses, fmt.Sprintf(" AND CAST(m.message_timestamp AS DOUBLE PRECISION) < $%d", len(args)))
+	}
+	if f.Language != "" {
+		args = append(args, f.Language)
+		clauses = append(clauses, fmt.Sprintf(" AND m.language = $%d", len(args)))
+	}
+
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " AND EXISTS (SELECT 1 FROM slack_messages m WHERE m.thread_id = e.thread_id" + strings.Join(clauses, "") + ")", args
+}
+
+// unixSeconds converts t to the fractional Unix seconds used by Slack timestamps
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// rankMessagesBySimilarity sets each message's similarity to its thread's best
+// match, clamped to [0,1], and orders threads from most to least similar while
+// keeping messages within a thread in timestamp order
+func rankMessagesBySimilarity(messages []SlackMessage, threadSimilarity map[string]float64) []SlackMessage {
+	for i := range messages {
+		messages[i].Similarity = math.Max(0, math.Min(1, threadSimilarity[messages[i].ThreadID]))
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Similarity > messages[j].Similarity
+	})
+
+	return messages
+}
+
+// filterMessagesToChunks keeps only the messages covered by at least one matched chunk.
+// Chunks without a recorded range (stored before chunk-level retrieval) match the whole thread.
+func filterMessagesToChunks(messages []SlackMessage, chunks []ChunkRange) []SlackMessage {
+	chunksByThread := make(map[string][]ChunkRange)
+	for _, chunk := range chunks {
+		chunksByThread[chunk.ThreadID] = append(chunksByThread[chunk.ThreadID], chunk)
+	}
+
+	var filtered []SlackMessage
+	for _, msg := range messages {
+		for _, chunk := range chunksByThread[msg.ThreadID] {
+			if chunk.StartTimestamp == "" || chunk.EndTimestamp == "" ||
+				(msg.MessageTimestamp >= chunk.StartTimestamp && msg.MessageTimestamp <= chunk.EndTimestamp) {
+				filtered = append(filtered, msg)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// nullIfEmpty converts an empty string to a SQL NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// GetSourceStats counts the stored Slack messages and their channels, as
+// the "slack" source; it returns no stats when no messages are stored
+func (s *SlackStorage) GetSourceStats(ctx context.Context) ([]*storage.SourceStats, error) {
+	query := `
+		SELECT
+			COUNT(*),
+			array_agg(DISTINCT channel_id ORDER BY channel_id),
+			MAX(created_at)
+		FROM slack_messages
+		HAVING COUNT(*) > 0
+	`
+
+	stats := &storage.SourceStats{Source: "slack"}
+	err := s.db.QueryRowContext(ctx, query).Scan(&stats.Documents, pq.Array(&stats.Channels), &stats.LastIngestedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Slack source stats: %w", err)
+	}
+
+	return []*storage.SourceStats{stats}, nil
+}
+
+// GetChannelOverrides retrieves the runtime allowlist overrides keyed by channel ID
+func (s *SlackStorage) GetChannelOverrides(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT channel_id, allowed FROM slack_channel_allowlist`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := make(map[string]bool)
+	for rows.Next() {
+		var channelID string
+		var allowed bool
+		if err := rows.Scan(&channelID, &allowed); err != nil {
+			return nil, fmt.Errorf("failed to scan channel override: %w", err)
+		}
+		overrides[channelID] = allowed
+	}
+
+	return overrides, nil
+}
+
+// SetChannelAllowed persists a runtime allowlist override for a channel
+func (s *SlackStorage) SetChannelAllowed(ctx context.Context, channelID string, allowed bool) error {
+	query := `
+		INSERT INTO slack_channel_allowlist (channel_id, allowed)
+		VALUES ($1, $2)
+		ON CONFLICT (channel_id) DO UPDATE SET
+			allowed = EXCLUDED.allowed,
+			updated_at = NOW()
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, channelID, allowed); err != nil {
+		return fmt.Errorf("failed to set channel override: %w", err)
+	}
+
+	return nil
 }
 
 // hashContent generates a SHA256 hash of content
@@ -0,0 +1,266 @@
+package slack
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+
+	_ "github.com/lib/pq"
+	"github.com/slack-go/slack"
+)
+
+// newTestSlackStorage connects to TEST_DATABASE_URL, skipping the test in
+// short mode or when it is unset
+func newTestSlackStorage(t *testing.T) (*SlackStorage, *sql.DB) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping database test in short mode")
+	}
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storage := NewSlackStorage(db)
+	if err := storage.InitSchema(); err != nil {
+		t.Fatalf("Failed to initialize Slack schema: %v", err)
+	}
+	return storage, db
+}
+
+func TestSlackStorage_GetThreadsWithoutEmbeddingsOldestFirst(t *testing.T) {
+	storage, db := newTestSlackStorage(t)
+	ctx := context.Background()
+
+	// Backdated so these threads sort ahead of anything else awaiting embeddings
+	prefix := fmt.Sprintf("order-test-%d", time.Now().UnixNano())
+	base := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	messages := []struct {
+		thread    string
+		timestamp string
+		createdAt time.Time
+	}{
+		{prefix + "-c", "1.000001", base.Add(3 * time.Hour)},
+		{prefix + "-a", "1.000002", base.Add(2 * time.Hour)},
+		{prefix + "-a", "1.000003", base.Add(5 * time.Hour)}, // the thread's oldest message counts
+		{prefix + "-b", "1.000004", base.Add(1 * time.Hour)},
+		{prefix + "-e", "1.000005", base.Add(4 * time.Hour)},
+		{prefix + "-d", "1.000006", base.Add(4 * time.Hour)}, // ties are ordered by thread ID
+	}
+
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM slack_messages WHERE thread_id LIKE $1", prefix+"%")
+	})
+	for _, m := range messages {
+		_, _, err := storage.StoreMessage(ctx, SlackMessage{
+			ChannelID:        prefix,
+			ThreadID:         m.thread,
+			MessageTimestamp: m.timestamp,
+			UserID:           "U1",
+			UserName:         "alice",
+			Content:          "Rollbacks go through the deploy dashboard",
+		})
+		if err != nil {
+			t.Fatalf("Failed to store message: %v", err)
+		}
+		if _, err := db.ExecContext(ctx,
+			"UPDATE slack_messages SET created_at = $1 WHERE channel_id = $2 AND message_timestamp = $3",
+			m.createdAt, prefix, m.timestamp); err != nil {
+			t.Fatalf("Failed to backdate message: %v", err)
+		}
+	}
+
+	threadIDs, err := storage.GetThreadsWithoutEmbeddings(ctx, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{prefix + "-b", prefix + "-a", prefix + "-c", prefix + "-d"}
+	if !reflect.DeepEqual(threadIDs, expected) {
+		t.Errorf("Expected threads %v, got %v", expected, threadIDs)
+	}
+}
+
+// topicEmbedder embeds text mentioning "rollback" and other text as
+// orthogonal vectors, so only rollback queries match rollback threads
+type topicEmbedder struct{}
+
+func (topicEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	embedding := make([]float32, storage.EmbeddingDimensions)
+	if strings.Contains(strings.ToLower(text), "rollback") {
+		embedding[0] = 1
+	} else {
+		embedding[1] = 1
+	}
+	return embedding, nil
+}
+
+func TestCollectedThreadIsSearchable(t *testing.T) {
+	store, db := newTestSlackStorage(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	channelID := fmt.Sprintf("e2e-%d", now.UnixNano())
+	threadTS := fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM slack_thread_embeddings WHERE thread_id = $1", threadTS)
+		db.Exec("DELETE FROM slack_messages WHERE channel_id = $1", channelID)
+	})
+
+	root := slack.Message{}
+	root.Timestamp = threadTS
+	root.User = "U1"
+	root.Text = "How do we do a rollback of a bad deploy?"
+	reply := slack.Message{}
+	reply.Timestamp = fmt.Sprintf("%d.%06d", now.Unix()+60, now.Nanosecond()/1000)
+	reply.ThreadTimestamp = threadTS
+	reply.User = "U2"
+	reply.Text = "Run the rollback job from the deploy dashboard"
+
+	// Collect the thread as the collect_context message action does
+	client := &mockSlackClient{replies: []slack.Message{root, reply}}
+	handler := &SlackHandler{client: client, storage: store, rateLimitRetries: maxRateLimitWaits}
+	var interaction slack.InteractionCallback
+	interaction.Channel.ID = channelID
+	interaction.User.ID = "U3"
+	interaction.Message = root
+	handler.handleCollectContext(interaction)
+
+	processor := NewEmbeddingProcessor(store, topicEmbedder{})
+	if err := processor.processThread(ctx, threadTS); err != nil {
+		t.Fatalf("Failed to embed collected thread: %v", err)
+	}
+
+	// Query as RAGService does
+	query, _ := topicEmbedder{}.GenerateEmbedding(ctx, "what is the rollback process?")
+	results, err := store.SearchSimilarMessages(ctx, query, 10, SearchFilter{})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+
+	var found []string
+	for _, msg := range results {
+		if msg.ChannelID == channelID {
+			found = append(found, msg.Content)
+			if msg.ThreadID != threadTS || msg.Similarity < 0.99 {
+				t.Errorf("Expected the message ranked with its thread's similarity, got %+v", msg)
+			}
+		}
+	}
+	expected := []string{root.Text, reply.Text}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected the collected thread %v in the results, got %v", expected, found)
+	}
+}
+
+func TestDryRunMarkerIsNotSearchable(t *testing.T) {
+	store, db := newTestSlackStorage(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	channelID := fmt.Sprintf("dry-run-%d", now.UnixNano())
+	threadTS := fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM slack_thread_embeddings WHERE thread_id = $1", threadTS)
+		db.Exec("DELETE FROM slack_messages WHERE channel_id = $1", channelID)
+	})
+
+	_, _, err := store.StoreMessage(ctx, SlackMessage{
+		ChannelID:        channelID,
+		ThreadID:         threadTS,
+		MessageTimestamp: threadTS,
+		UserID:           "U1",
+		UserName:         "alice",
+		Content:          "Run the rollback job from the deploy dashboard",
+	})
+	if err != nil {
+		t.Fatalf("Failed to store message: %v", err)
+	}
+
+	processor := NewEmbeddingProcessor(store, topicEmbedder{})
+	processor.SetDryRun(true)
+	if err := processor.processThread(ctx, threadTS); err != nil {
+		t.Fatalf("Failed to dry run thread: %v", err)
+	}
+
+	hashes, err := store.GetThreadEmbeddingHashes(ctx, threadTS)
+	if err != nil || hashes[0] != dryRunContentHash {
+		t.Fatalf("Expected the thread marked as a dry run, got %v (%v)", hashes, err)
+	}
+
+	query, _ := topicEmbedder{}.GenerateEmbedding(ctx, "what is the rollback process?")
+	results, err := store.SearchSimilarMessages(ctx, query, 10, SearchFilter{})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	for _, msg := range results {
+		if msg.ChannelID == channelID {
+			t.Errorf("Expected the dry run marker to be skipped by search, got %+v", msg)
+		}
+	}
+}
+
+func TestSlackStorage_NewReplyMarksEmbeddedThreadStale(t *testing.T) {
+	store, db := newTestSlackStorage(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	channelID := fmt.Sprintf("stale-reply-%d", now.UnixNano())
+	threadTS := fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM slack_thread_embeddings WHERE thread_id = $1", threadTS)
+		db.Exec("DELETE FROM slack_messages WHERE channel_id = $1", channelID)
+	})
+
+	storeMessage := func(ts, content string) {
+		t.Helper()
+		_, inserted, err := store.StoreMessage(ctx, SlackMessage{
+			ChannelID:        channelID,
+			ThreadID:         threadTS,
+			MessageTimestamp: ts,
+			UserID:           "U1",
+			UserName:         "alice",
+			Content:          content,
+		})
+		if err != nil || !inserted {
+			t.Fatalf("Failed to insert message %s: inserted %v, %v", ts, inserted, err)
+		}
+	}
+	stale := func() bool {
+		t.Helper()
+		var stale bool
+		if err := db.QueryRowContext(ctx, "SELECT stale FROM slack_thread_embeddings WHERE thread_id = $1 AND chunk_index = 0", threadTS).Scan(&stale); err != nil {
+			t.Fatalf("Failed to read thread embedding: %v", err)
+		}
+		return stale
+	}
+
+	storeMessage(threadTS, "Run the rollback job from the deploy dashboard")
+	processor := NewEmbeddingProcessor(store, topicEmbedder{})
+	if err := processor.processThread(ctx, threadTS); err != nil {
+		t.Fatalf("Failed to embed thread: %v", err)
+	}
+	if stale() {
+		t.Fatal("Expected the freshly embedded thread not to be stale")
+	}
+
+	// A reply inserted into the embedded thread must get it re-chunked
+	storeMessage(fmt.Sprintf("%d.%06d", now.Unix()+1, now.Nanosecond()/1000), "The rollback job also needs the release tag")
+	if !stale() {
+		t.Error("Expected a new reply to mark the thread's embeddings stale")
+	}
+}
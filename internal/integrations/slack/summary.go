@@ -0,0 +1,131 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"knowthis/internal/storage"
+)
+
+// ThreadSummaryStore upserts thread summary documents by ID, re-embedding
+// them when their content changes, and deletes chunks a shorter summary no
+// longer has
+type ThreadSummaryStore interface {
+	ImportDocument(ctx context.Context, doc *storage.Document) (bool, error)
+	DeleteDocumentChunks(ctx context.Context, id string, from int) (int64, error)
+}
+
+// defaultSummarySegment is the number of messages summarized together when
+// no segment size is configured
+const defaultSummarySegment = 100
+
+// summaryDocumentPrefix starts the document IDs of thread summaries
+const summaryDocumentPrefix = "slack_thread_summary_"
+
+// summarySegmentTimeout bounds summarizing and storing one segment, so the
+// budget for a thread grows with its length
+const summarySegmentTimeout = 60 * time.Second
+
+// SetLongThreadSummaries stores summaries of collected threads with more than
+// threshold messages as documents, one per segment of segment messages, so
+// huge threads stay answerable as a whole. Summaries are written with the
+// summarizer set by SetSummarizer.
+func (h *SlackHandler) SetLongThreadSummaries(store ThreadSummaryStore, threshold, segment int) {
+	if threshold <= 0 {
+		return
+	}
+	if segment <= 0 {
+		segment = defaultSummarySegment
+	}
+	h.summaryStore = store
+	h.summaryThreshold = threshold
+	h.summarySegment = segment
+	slog.Info("Enabled long thread summaries", "threshold", threshold, "segment", segment)
+}
+
+// summarizeLongThread stores segment summaries of a thread with more than the
+// threshold of messages. The first segment's summary is the thread summary
+// document and the rest are its chunks, each recording total, the thread's
+// true message count. Chunks left from an earlier, longer summary of the
+// thread are deleted. Failures are logged; the messages are stored anyway.
+func (h *SlackHandler) summarizeLongThread(ctx context.Context, channelID, threadTS string, messages []SlackMessage, total int) int {
+	if h.summaryStore == nil || h.summarizer == nil || total <= h.summaryThreshold || len(messages) == 0 {
+		return 0
+	}
+
+	id := fmt.Sprintf("%s%s_%s", summaryDocumentPrefix, channelID, threadTS)
+	segments := (len(messages) + h.summarySegment - 1) / h.summarySegment
+	stored := 0
+	for i := 0; i < segments; i++ {
+		start := i * h.summarySegment
+		end := start + h.summarySegment
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		doc := &storage.Document{
+			ID:           id,
+			Source:       "slack",
+			SourceID:     threadTS,
+			Title:        fmt.Sprintf("Summary of messages %d-%d of a %d-message thread", start+1, end, total),
+			ChannelID:    channelID,
+			UserID:       messages[0].UserID,
+			UserName:     messages[0].UserName,
+			Timestamp:    messageTime(messages[start].MessageTimestamp),
+			MessageCount: total,
+		}
+		if i > 0 {
+			doc.ID = fmt.Sprintf("%s_chunk_%d", id, i)
+		}
+
+		if err := h.storeSegmentSummary(ctx, doc, messages[start:end]); err != nil {
+			slog.Error("Failed to store thread summary", "error", err, "document_id", doc.ID, "segment", i+1)
+			continue
+		}
+		stored++
+	}
+
+	if removed, err := h.summaryStore.DeleteDocumentChunks(ctx, id, segments); err != nil {
+		slog.Error("Failed to delete stale thread summary chunks", "error", err, "document_id", id)
+	} else if removed > 0 {
+		slog.Info("Deleted stale thread summary chunks", "document_id", id, "removed", removed)
+	}
+
+	slog.Info("Stored long thread summaries",
+		"channel", channelID,
+		"thread_ts", threadTS,
+		"messages", total,
+		"segments", segments,
+		"stored", stored)
+	return stored
+}
+
+// storeSegmentSummary summarizes a segment of messages into doc and stores
+// it, within summarySegmentTimeout
+func (h *SlackHandler) storeSegmentSummary(ctx context.Context, doc *storage.Document, segment []SlackMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, summarySegmentTimeout)
+	defer cancel()
+
+	summary, err := h.summarizer.SummarizeThread(ctx, segment)
+	if err != nil {
+		return fmt.Errorf("failed to summarize thread segment: %w", err)
+	}
+
+	doc.Content = summary
+	doc.ContentHash = storage.HashContent(summary)
+	_, err = h.summaryStore.ImportDocument(ctx, doc)
+	return err
+}
+
+// messageTime parses a Slack message timestamp, falling back to the current
+// time when it can't be parsed so a bad value never lands as 1970
+func messageTime(ts string) time.Time {
+	t, err := parseSlackTimestamp(ts)
+	if err != nil {
+		slog.Warn("Falling back to current time for unparseable Slack timestamp", "timestamp", ts, "error", err)
+		return time.Now().UTC()
+	}
+	return t.UTC()
+}
@@ -0,0 +1,123 @@
+package slack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+)
+
+func TestStoreThread_SummarizesLongThreads(t *testing.T) {
+	client := &mockSlackClient{replies: longThread(250), repliesPageSize: 100}
+	store := &mockMessageStore{messages: make(map[string]SlackMessage)}
+	summaries := &mockCanvasStore{}
+	summarizer := &mockSummarizer{summary: "- The outage was caused by a bad deploy"}
+	handler := &SlackHandler{client: client, storage: store}
+	handler.SetSummarizer(summarizer)
+	handler.SetLongThreadSummaries(summaries, 200, 100)
+
+	thread, err := handler.getThreadMessages(context.Background(), "C1", "1700000000.000100", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored := handler.storeThread(context.Background(), thread, "C1", "1700000000.000100", "T1"); stored != 251 {
+		t.Errorf("Expected all 251 messages to be stored, got %d", stored)
+	}
+
+	if summarizer.calls != 3 {
+		t.Errorf("Expected 3 segments to be summarized, got %d", summarizer.calls)
+	}
+	if len(summarizer.messages) != 51 {
+		t.Errorf("Expected the last segment to hold the remaining 51 messages, got %d", len(summarizer.messages))
+	}
+
+	id := "slack_thread_summary_C1_1700000000.000100"
+	for _, docID := range []string{id, id + "_chunk_1", id + "_chunk_2"} {
+		doc, ok := summaries.documents[docID]
+		if !ok {
+			t.Errorf("Expected summary document %s to be stored", docID)
+			continue
+		}
+		if doc.MessageCount != 251 {
+			t.Errorf("Expected %s to record 251 messages, got %d", docID, doc.MessageCount)
+		}
+		if doc.Source != "slack" || doc.SourceID != "1700000000.000100" || doc.ChannelID != "C1" {
+			t.Errorf("Expected %s to belong to the thread, got %+v", docID, doc)
+		}
+		if doc.Content != summarizer.summary || doc.ContentHash == "" {
+			t.Errorf("Expected %s to hold the hashed summary, got %q", docID, doc.Content)
+		}
+	}
+	if len(summaries.documents) != 3 {
+		t.Errorf("Expected 3 summary documents, got %d", len(summaries.documents))
+	}
+
+	chunk := summaries.documents[id+"_chunk_2"]
+	if want := time.Unix(1700000200, 100000).UTC(); !chunk.Timestamp.Equal(want) {
+		t.Errorf("Expected the last segment to be dated by its first message %v, got %v", want, chunk.Timestamp)
+	}
+}
+
+func TestStoreThread_DeletesStaleSummaryChunks(t *testing.T) {
+	store := &mockMessageStore{messages: make(map[string]SlackMessage)}
+	id := "slack_thread_summary_C1_1700000000.000100"
+	summaries := &mockCanvasStore{documents: make(map[string]*storage.Document)}
+	for _, docID := range []string{id, id + "_chunk_1", id + "_chunk_2", id + "_chunk_3", id + "_chunk_10", "slack_thread_summary_C1_1700000000.000200_chunk_3"} {
+		summaries.documents[docID] = &storage.Document{ID: docID}
+	}
+	handler := &SlackHandler{client: &mockSlackClient{}, storage: store}
+	handler.SetSummarizer(&mockSummarizer{summary: "- The thread got shorter"})
+	handler.SetLongThreadSummaries(summaries, 200, 100)
+
+	// An edited thread now summarizes into 3 segments instead of 11
+	handler.storeThread(context.Background(), longThread(250), "C1", "1700000000.000100", "T1")
+
+	for _, docID := range []string{id + "_chunk_3", id + "_chunk_10"} {
+		if _, ok := summaries.documents[docID]; ok {
+			t.Errorf("Expected stale chunk %s to be deleted", docID)
+		}
+	}
+	for _, docID := range []string{id, id + "_chunk_1", id + "_chunk_2", "slack_thread_summary_C1_1700000000.000200_chunk_3"} {
+		if _, ok := summaries.documents[docID]; !ok {
+			t.Errorf("Expected %s to be kept", docID)
+		}
+	}
+}
+
+func TestStoreThread_ShortThreadsAreNotSummarized(t *testing.T) {
+	store := &mockMessageStore{messages: make(map[string]SlackMessage)}
+	summaries := &mockCanvasStore{}
+	summarizer := &mockSummarizer{summary: "- Nothing to see"}
+	handler := &SlackHandler{client: &mockSlackClient{}, storage: store}
+	handler.SetSummarizer(summarizer)
+	handler.SetLongThreadSummaries(summaries, 200, 100)
+
+	handler.storeThread(context.Background(), longThread(150), "C1", "1700000000.000100", "T1")
+
+	if summarizer.calls != 0 || len(summaries.documents) != 0 {
+		t.Errorf("Expected a 151-message thread not to be summarized, got %d calls and %d documents", summarizer.calls, len(summaries.documents))
+	}
+}
+
+func TestSetLongThreadSummaries_DisabledByZeroThreshold(t *testing.T) {
+	handler := &SlackHandler{}
+	handler.SetLongThreadSummaries(&mockCanvasStore{}, 0, 100)
+
+	if handler.summaryStore != nil {
+		t.Error("Expected summaries to stay disabled with a zero threshold")
+	}
+}
+
+func TestMessageTime(t *testing.T) {
+	if got, want := messageTime("1700000200.250000"), time.Unix(1700000200, 250000000).UTC(); !got.Equal(want) {
+		t.Errorf("Expected %v with its fractional seconds, got %v", want, got)
+	}
+
+	// Unparseable timestamps fall back to now, never 1970
+	for _, ts := range []string{"", "garbage", "12ab.34", "0.000000"} {
+		if got := messageTime(ts); time.Since(got) > time.Minute {
+			t.Errorf("messageTime(%q) should fall back to now, got %v", ts, got)
+		}
+	}
+}
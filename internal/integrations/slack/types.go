@@ -1,6 +1,8 @@
 package slack
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,16 +12,53 @@ import (
 type SlackMessage struct {
 	ID               uuid.UUID `json:"id"`
 	ChannelID        string    `json:"channel_id"`
+	TeamID           string    `json:"team_id,omitempty"` // Workspace the message was posted from
 	ThreadID         string    `json:"thread_id"`
 	MessageTimestamp string    `json:"message_timestamp"`
 	UserID           string    `json:"user_id"`
 	UserName         string    `json:"user_name"`
+	UserTitle        string    `json:"user_title,omitempty"`
+	UserTeam         string    `json:"user_team,omitempty"`
 	Content          string    `json:"content"`
 	ContentHash      string    `json:"content_hash"`
 	ClientMsgID      string    `json:"client_msg_id"`
 	IsThreadRoot     bool      `json:"is_thread_root"`
+	Language         string    `json:"language,omitempty"` // ISO 639-1 code detected from the content, "" when unknown
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Cosine similarity of the message's thread to the query, set by search
+	Similarity float64 `json:"similarity,omitempty"`
+
+	// Set for search results found among documents rather than Slack
+	// messages: the document's source (e.g. "slab") and title
+	Source string `json:"source,omitempty"`
+	Title  string `json:"title,omitempty"`
+}
+
+// SourceType returns where the message comes from: "slack" for Slack
+// messages, or the source of a document search result
+func (m SlackMessage) SourceType() string {
+	if m.Source == "" {
+		return "slack"
+	}
+	return m.Source
+}
+
+// AuthorLabel returns the author's name with their title and team when known,
+// e.g. "Alice (Staff SRE, Platform)"
+func (m SlackMessage) AuthorLabel() string {
+	var details []string
+	for _, detail := range []string{m.UserTitle, m.UserTeam} {
+		if detail = strings.TrimSpace(detail); detail != "" {
+			details = append(details, detail)
+		}
+	}
+
+	if len(details) == 0 {
+		return m.UserName
+	}
+	return fmt.Sprintf("%s (%s)", m.UserName, strings.Join(details, ", "))
 }
 
 // SlackThread represents a complete thread with all messages
@@ -34,4 +73,47 @@ type SlackMessageEmbedding struct {
 	MessageID uuid.UUID `json:"message_id"`
 	Embedding []float32 `json:"embedding"`
 	CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+}
+
+// RetrievalGranularity controls how much of a matched thread is returned by search
+type RetrievalGranularity string
+
+const (
+	// GranularityThread returns every message of a matched thread
+	GranularityThread RetrievalGranularity = "thread"
+	// GranularityChunk returns only the messages covered by the matched chunk
+	GranularityChunk RetrievalGranularity = "chunk"
+)
+
+// ChunkRange identifies the messages covered by a thread embedding chunk
+type ChunkRange struct {
+	ThreadID       string
+	StartTimestamp string
+	EndTimestamp   string
+}
+
+// SearchMode selects how threads are matched to a query
+type SearchMode string
+
+const (
+	// SearchModeVector ranks threads by embedding similarity
+	SearchModeVector SearchMode = "vector"
+	// SearchModeKeyword ranks threads by full-text match of the query's
+	// terms, for exact terms like error codes and ticket numbers
+	SearchModeKeyword SearchMode = "keyword"
+	// SearchModeHybrid blends embedding similarity with full-text match
+	SearchModeHybrid SearchMode = "hybrid"
+)
+
+// SearchFilter restricts similarity search to threads with a message in the
+// time range and, when Language is set, detected to be in that language;
+// zero values match everything. Keyword and hybrid modes also match Query's
+// terms; the zero Mode is vector search.
+type SearchFilter struct {
+	After    time.Time
+	Before   time.Time
+	Language string
+
+	Mode  SearchMode
+	Query string
+}
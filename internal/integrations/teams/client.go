@@ -0,0 +1,175 @@
+package teams
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// graphBaseURL is the Microsoft Graph API the client calls
+	graphBaseURL = "https://graph.microsoft.com/v1.0"
+
+	// tokenURLFormat is the token endpoint of a tenant, by tenant ID
+	tokenURLFormat = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+
+	// graphScope requests the application permissions granted to the app,
+	// which need to include ChannelMessage.Read.All
+	graphScope = "https://graph.microsoft.com/.default"
+
+	// repliesPageSize is the most replies Graph returns per request
+	repliesPageSize = 50
+
+	// tokenExpiryMargin renews tokens this long before they expire
+	tokenExpiryMargin = time.Minute
+
+	// maxErrorBody bounds how much of an error response is included in errors
+	maxErrorBody = 512
+)
+
+// graphAPI is the subset of Microsoft Graph used by the handler
+type graphAPI interface {
+	GetChannelMessage(ctx context.Context, teamID, channelID, messageID string) (*ChatMessage, error)
+	GetMessageReplies(ctx context.Context, teamID, channelID, messageID string, limit int) ([]ChatMessage, error)
+}
+
+// Client reads Teams channel messages through Microsoft Graph as an Azure AD
+// application, with the client credentials flow
+type Client struct {
+	httpClient   *http.Client
+	baseURL      string
+	tokenURL     string
+	clientID     string
+	clientSecret string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewClient creates a Graph client for the application registered in the tenant
+func NewClient(tenantID, clientID, clientSecret string) *Client {
+	return &Client{
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		baseURL:      graphBaseURL,
+		tokenURL:     fmt.Sprintf(tokenURLFormat, url.PathEscape(tenantID)),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+// GetChannelMessage returns a channel message, e.g. a thread's root
+func (c *Client) GetChannelMessage(ctx context.Context, teamID, channelID, messageID string) (*ChatMessage, error) {
+	var message ChatMessage
+	path := fmt.Sprintf("/teams/%s/channels/%s/messages/%s", url.PathEscape(teamID), url.PathEscape(channelID), url.PathEscape(messageID))
+	if err := c.get(ctx, c.baseURL+path, &message); err != nil {
+		return nil, fmt.Errorf("failed to get channel message: %w", err)
+	}
+	return &message, nil
+}
+
+// GetMessageReplies returns up to limit replies to a channel message,
+// following pagination
+func (c *Client) GetMessageReplies(ctx context.Context, teamID, channelID, messageID string, limit int) ([]ChatMessage, error) {
+	path := fmt.Sprintf("/teams/%s/channels/%s/messages/%s/replies", url.PathEscape(teamID), url.PathEscape(channelID), url.PathEscape(messageID))
+	next := c.baseURL + path + "?$top=" + strconv.Itoa(repliesPageSize)
+
+	var replies []ChatMessage
+	for next != "" && len(replies) < limit {
+		var page messagesPage
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, fmt.Errorf("failed to get message replies: %w", err)
+		}
+		replies = append(replies, page.Value...)
+		next = page.NextLink
+	}
+
+	if len(replies) > limit {
+		replies = replies[:limit]
+	}
+	return replies, nil
+}
+
+// get sends an authenticated GET request and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, requestURL string, out interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("graph API returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// accessToken returns a Graph token, requesting a new one when the cached
+// token is about to expire
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	form.Set("scope", graphScope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request Graph token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned no access token")
+	}
+
+	c.token = token.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return c.token, nil
+}
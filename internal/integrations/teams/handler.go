@@ -0,0 +1,265 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"knowthis/internal/apierror"
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/middleware"
+	"knowthis/internal/storage"
+)
+
+// maxThreadMessages is the most messages collected from a thread, as for Slack threads
+const maxThreadMessages = 100
+
+var (
+	// Mentions like <at id="0">Jane Doe</at>, removed with the name
+	mentionPattern = regexp.MustCompile(`(?is)<at\b[^>]*>.*?</at>`)
+	// Tags that end a line of text
+	lineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+	spacePattern     = regexp.MustCompile(`[ \t]+`)
+)
+
+// DocumentStore upserts documents by ID, re-embedding them when their content changes
+type DocumentStore interface {
+	ImportDocument(ctx context.Context, doc *storage.Document) (bool, error)
+}
+
+// TeamsHandler collects Teams channel threads into the knowledge base when an
+// outgoing webhook is @mentioned in them
+type TeamsHandler struct {
+	client graphAPI
+	store  DocumentStore
+}
+
+// NewTeamsHandler creates a handler reading threads through Graph as the
+// Azure AD application registered in the tenant
+func NewTeamsHandler(tenantID, clientID, clientSecret string, store DocumentStore) *TeamsHandler {
+	return &TeamsHandler{
+		client: NewClient(tenantID, clientID, clientSecret),
+		store:  store,
+	}
+}
+
+// HandleActivity handles the activity an outgoing webhook posts when it is
+// @mentioned, collecting the thread the mention was posted in. Requests must
+// already be verified by TeamsSignatureMiddleware.
+func (h *TeamsHandler) HandleActivity(w http.ResponseWriter, r *http.Request) {
+	var activity Activity
+	if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
+		slog.Error("Failed to parse Teams activity", "error", err)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Invalid payload")
+		return
+	}
+
+	thread, err := activityThread(activity)
+	if err != nil {
+		slog.Warn("Rejected Teams activity", "error", err, "activity_id", activity.ID, "type", activity.Type)
+		apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Collecting can outlast the webhook's 5 second response deadline; the
+	// request's concurrency slot is held until it's done
+	release := middleware.HoldConcurrencySlot(r.Context())
+	go func() {
+		defer release()
+		h.collectActivity(thread)
+	}()
+
+	writeMessage(w, "✅ Collecting thread context for knowledge base...")
+}
+
+// activityThread returns the thread an activity was posted in, or an error
+// when the activity isn't a message in a team channel
+func activityThread(activity Activity) (ThreadRef, error) {
+	switch {
+	case activity.Type != activityTypeMessage:
+		return ThreadRef{}, fmt.Errorf("unsupported activity type %q", activity.Type)
+	case activity.ID == "" || activity.Conversation.ID == "":
+		return ThreadRef{}, errors.New("activity id and conversation id are required")
+	case activity.ChannelData.Team == nil || activity.ChannelData.Team.AADGroupID == "":
+		return ThreadRef{}, errors.New("activity is not from a team channel")
+	}
+
+	channelID, _, _ := strings.Cut(activity.Conversation.ID, ";")
+	if activity.ChannelData.Channel != nil && activity.ChannelData.Channel.ID != "" {
+		channelID = activity.ChannelData.Channel.ID
+	}
+
+	// A new post, rather than a reply, is its own thread's root
+	rootID := activity.Conversation.RootMessageID()
+	if rootID == "" {
+		rootID = activity.ID
+	}
+
+	return ThreadRef{
+		TeamID:    activity.ChannelData.Team.AADGroupID,
+		ChannelID: channelID,
+		RootID:    rootID,
+		TriggerID: activity.ID,
+	}, nil
+}
+
+// collectActivity collects the thread an activity was posted in. Outgoing
+// webhooks can't post follow-ups, so the outcome is only logged.
+func (h *TeamsHandler) collectActivity(thread ThreadRef) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := h.CollectThread(ctx, thread); err != nil {
+		slog.Error("Failed to collect Teams thread", "error", err, "channel", thread.ChannelID, "root_id", thread.RootID)
+	}
+}
+
+// CollectThread stores a channel thread, its root and replies, as one
+// document and returns how many messages it holds
+func (h *TeamsHandler) CollectThread(ctx context.Context, thread ThreadRef) (int, error) {
+	root, err := h.client.GetChannelMessage(ctx, thread.TeamID, thread.ChannelID, thread.RootID)
+	if err != nil {
+		return 0, err
+	}
+
+	replies, err := h.client.GetMessageReplies(ctx, thread.TeamID, thread.ChannelID, thread.RootID, maxThreadMessages-1)
+	if err != nil {
+		return 0, err
+	}
+
+	messages := []ChatMessage{*root}
+	for _, reply := range replies {
+		// The mention that asked for collection isn't part of the conversation
+		if reply.ID != thread.TriggerID {
+			messages = append(messages, reply)
+		}
+	}
+
+	doc := threadToDocument(thread.ChannelID, thread.RootID, messages)
+	if doc == nil {
+		return 0, fmt.Errorf("no meaningful content in thread")
+	}
+
+	if _, err := h.store.ImportDocument(ctx, doc); err != nil {
+		return 0, fmt.Errorf("failed to store thread document: %w", err)
+	}
+
+	slog.Info("Stored Teams thread", "channel", thread.ChannelID, "root_id", thread.RootID, "document_id", doc.ID)
+	return len(collectableMessages(messages)), nil
+}
+
+// CleanMessageText converts a Teams message body to plain text, removing
+// mentions like <at id="0">Jane Doe</at> as Slack mentions are removed
+func CleanMessageText(content string) string {
+	text := mentionPattern.ReplaceAllString(content, "")
+	text = lineBreakPattern.ReplaceAllString(text, "\n")
+	text = tagPattern.ReplaceAllString(text, "")
+	// &nbsp; unescapes to a non-breaking space
+	text = strings.ReplaceAll(html.UnescapeString(text), "\u00a0", " ")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(spacePattern.ReplaceAllString(line, " ")); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// messageText returns a message's plain text
+func messageText(msg ChatMessage) string {
+	if strings.EqualFold(msg.Body.ContentType, "html") {
+		return CleanMessageText(msg.Body.Content)
+	}
+	return strings.TrimSpace(mentionPattern.ReplaceAllString(msg.Body.Content, ""))
+}
+
+// collectableMessages returns the user-written messages worth storing, oldest
+// first, as plain text. Bot, system, deleted and very short messages are
+// skipped as for Slack threads.
+func collectableMessages(messages []ChatMessage) []ChatMessage {
+	seen := make(map[string]bool)
+	var collected []ChatMessage
+	for _, msg := range messages {
+		if seen[msg.ID] || msg.MessageType != messageTypeMessage || msg.DeletedDateTime != nil {
+			continue
+		}
+		if msg.From == nil || msg.From.User == nil {
+			continue
+		}
+		seen[msg.ID] = true
+
+		msg.Body = ItemBody{ContentType: "text", Content: messageText(msg)}
+		if len(msg.Body.Content) < slack.MinMessageChars {
+			continue
+		}
+		collected = append(collected, msg)
+	}
+
+	sort.SliceStable(collected, func(i, j int) bool {
+		return collected[i].CreatedDateTime.Before(collected[j].CreatedDateTime)
+	})
+	return collected
+}
+
+// threadToDocument converts a thread into a document, or nil when no message
+// is worth storing
+func threadToDocument(channelID, rootID string, messages []ChatMessage) *storage.Document {
+	collected := collectableMessages(messages)
+	if len(collected) == 0 {
+		return nil
+	}
+
+	var content strings.Builder
+	var participants []string
+	participantSet := make(map[string]bool)
+	for _, msg := range collected {
+		author := msg.From.User
+		name := author.DisplayName
+		if name == "" {
+			name = author.ID
+		}
+		if !participantSet[author.ID] {
+			participantSet[author.ID] = true
+			participants = append(participants, name)
+		}
+		fmt.Fprintf(&content, "%s: %s\n", name, msg.Body.Content)
+	}
+
+	root := collected[0]
+	title := root.Body.Content
+	if runes := []rune(title); len(runes) > 50 {
+		title = string(runes[:50]) + "..."
+	}
+
+	finalContent := strings.TrimSpace(content.String())
+	return &storage.Document{
+		ID:          fmt.Sprintf("teams_thread_%s_%s", channelID, rootID),
+		Content:     finalContent,
+		Source:      Source,
+		SourceID:    rootID,
+		Title:       title,
+		ChannelID:   channelID,
+		UserID:      root.From.User.ID,
+		UserName:    strings.Join(participants, ", "),
+		Timestamp:   root.CreatedDateTime,
+		ContentHash: storage.HashContent(finalContent),
+	}
+}
+
+// writeMessage replies to an activity with a message in the thread
+func writeMessage(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(activityResponse{Type: activityTypeMessage, Text: text}); err != nil {
+		slog.Error("Failed to encode Teams activity response", "error", err)
+	}
+}
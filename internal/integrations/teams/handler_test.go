@@ -0,0 +1,278 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"knowthis/internal/storage"
+)
+
+// Mock Graph client for handler tests
+type mockGraphClient struct {
+	messages map[string]ChatMessage   // by message ID
+	replies  map[string][]ChatMessage // by root message ID
+}
+
+func (m *mockGraphClient) GetChannelMessage(ctx context.Context, teamID, channelID, messageID string) (*ChatMessage, error) {
+	if msg, ok := m.messages[messageID]; ok {
+		return &msg, nil
+	}
+	return nil, errors.New("unknown message")
+}
+
+func (m *mockGraphClient) GetMessageReplies(ctx context.Context, teamID, channelID, messageID string, limit int) ([]ChatMessage, error) {
+	return m.replies[messageID], nil
+}
+
+type mockDocumentStore struct {
+	mu   sync.Mutex
+	docs []*storage.Document
+}
+
+func (m *mockDocumentStore) ImportDocument(ctx context.Context, doc *storage.Document) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.docs = append(m.docs, doc)
+	return true, nil
+}
+
+var baseTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testMessage(id, userID, content string, minute int) ChatMessage {
+	return ChatMessage{
+		ID:              id,
+		MessageType:     messageTypeMessage,
+		CreatedDateTime: baseTime.Add(time.Duration(minute) * time.Minute),
+		From:            &ChatMessageFrom{User: &Identity{ID: userID, DisplayName: strings.ToLower(userID)}},
+		Body:            ItemBody{ContentType: "html", Content: content},
+	}
+}
+
+func testThread() *mockGraphClient {
+	bot := testMessage("M5", "", "Deploy finished successfully", 5)
+	bot.From = &ChatMessageFrom{Application: &Identity{ID: "APP", DisplayName: "CI"}}
+	system := testMessage("M6", "U1", "Jane added Bob to the team", 6)
+	system.MessageType = "systemEventMessage"
+	deleted := testMessage("M7", "U2", "This message was removed", 7)
+	deletedAt := baseTime.Add(8 * time.Minute)
+	deleted.DeletedDateTime = &deletedAt
+
+	return &mockGraphClient{
+		messages: map[string]ChatMessage{
+			"M1": testMessage("M1", "U1", "<p>Deploys are failing on <b>staging</b></p>", 1),
+		},
+		replies: map[string][]ChatMessage{
+			// Graph returns replies newest first
+			"M1": {
+				testMessage("M9", "U3", `<at id="0">KnowThis</at> save this`, 9),
+				deleted, system, bot,
+				testMessage("M4", "U1", "ok", 4),
+				testMessage("M3", "U2", `<at id="0">Jane</at> restart the worker pool first`, 3),
+				testMessage("M2", "U1", "Which service is failing?", 2),
+			},
+		},
+	}
+}
+
+func TestCleanMessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain", "Restart the worker pool", "Restart the worker pool"},
+		{"mention", `<at id="0">Jane Doe</at> restart the worker pool`, "restart the worker pool"},
+		{"formatting", "<div><p>Use <b>pgbouncer</b></p><p>not direct connections</p></div>", "Use pgbouncer\nnot direct connections"},
+		{"line breaks", "first line<br>second line<br/>third", "first line\nsecond line\nthird"},
+		{"entities", "a &lt; b &amp;&amp; c&nbsp;&gt; d", "a < b && c > d"},
+		{"whitespace", "<p>  spaced   out  </p><p> </p>", "spaced out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CleanMessageText(tt.content); got != tt.want {
+				t.Errorf("CleanMessageText(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectThread(t *testing.T) {
+	store := &mockDocumentStore{}
+	handler := &TeamsHandler{client: testThread(), store: store}
+
+	count, err := handler.CollectThread(context.Background(), ThreadRef{TeamID: "G1", ChannelID: "C1", RootID: "M1", TriggerID: "M9"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 collected messages, got %d", count)
+	}
+	if len(store.docs) != 1 {
+		t.Fatalf("Expected 1 stored document, got %d", len(store.docs))
+	}
+
+	doc := store.docs[0]
+	wantContent := "u1: Deploys are failing on staging\nu1: Which service is failing?\nu2: restart the worker pool first"
+	if doc.Content != wantContent {
+		t.Errorf("Expected content %q, got %q", wantContent, doc.Content)
+	}
+	if doc.ID != "teams_thread_C1_M1" || doc.Source != Source || doc.SourceID != "M1" || doc.ChannelID != "C1" {
+		t.Errorf("Unexpected document identity: %+v", doc)
+	}
+	if doc.Title != "Deploys are failing on staging" || doc.UserID != "U1" || doc.UserName != "u1, u2" {
+		t.Errorf("Unexpected document metadata: title=%q user=%q participants=%q", doc.Title, doc.UserID, doc.UserName)
+	}
+	if !doc.Timestamp.Equal(baseTime.Add(time.Minute)) {
+		t.Errorf("Expected the root message's timestamp, got %v", doc.Timestamp)
+	}
+	if doc.ContentHash != storage.HashContent(doc.Content) {
+		t.Error("Expected the content hash to match the content")
+	}
+}
+
+func TestCollectThread_NothingToStore(t *testing.T) {
+	client := &mockGraphClient{
+		messages: map[string]ChatMessage{"M1": testMessage("M1", "U1", "hi", 1)},
+	}
+	store := &mockDocumentStore{}
+	handler := &TeamsHandler{client: client, store: store}
+
+	if _, err := handler.CollectThread(context.Background(), ThreadRef{TeamID: "G1", ChannelID: "C1", RootID: "M1"}); err == nil {
+		t.Error("Expected an error for a thread with nothing worth storing")
+	}
+	if len(store.docs) != 0 {
+		t.Errorf("Expected nothing stored, got %d documents", len(store.docs))
+	}
+}
+
+func TestActivityThread(t *testing.T) {
+	team := &TeamInfo{ID: "19:team@thread.tacv2", AADGroupID: "G1"}
+
+	tests := []struct {
+		name     string
+		activity Activity
+		want     ThreadRef
+		wantErr  bool
+	}{
+		{
+			name: "reply in thread",
+			activity: Activity{Type: "message", ID: "M9",
+				Conversation: ConversationAccount{ID: "19:C1@thread.tacv2;messageid=M1"},
+				ChannelData:  ChannelData{Team: team, Channel: &ChannelInfo{ID: "19:C1@thread.tacv2"}}},
+			want: ThreadRef{TeamID: "G1", ChannelID: "19:C1@thread.tacv2", RootID: "M1", TriggerID: "M9"},
+		},
+		{
+			name: "new post",
+			activity: Activity{Type: "message", ID: "M1",
+				Conversation: ConversationAccount{ID: "19:C1@thread.tacv2"},
+				ChannelData:  ChannelData{Team: team}},
+			want: ThreadRef{TeamID: "G1", ChannelID: "19:C1@thread.tacv2", RootID: "M1", TriggerID: "M1"},
+		},
+		{
+			name:     "not a message",
+			activity: Activity{Type: "conversationUpdate", ID: "M1", Conversation: ConversationAccount{ID: "19:C1"}, ChannelData: ChannelData{Team: team}},
+			wantErr:  true,
+		},
+		{
+			name:     "missing ids",
+			activity: Activity{Type: "message", ChannelData: ChannelData{Team: team}},
+			wantErr:  true,
+		},
+		{
+			name:     "not from a team",
+			activity: Activity{Type: "message", ID: "M1", Conversation: ConversationAccount{ID: "a:chat"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := activityThread(tt.activity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("activityThread() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("activityThread() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleActivity(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantCollect bool
+	}{
+		{
+			name: "mention in thread",
+			body: `{"type":"message","id":"M9","conversation":{"id":"19:C1@thread.tacv2;messageid=M1"},
+				"channelData":{"team":{"id":"19:team","aadGroupId":"G1"},"channel":{"id":"C1"}}}`,
+			wantStatus:  http.StatusOK,
+			wantCollect: true,
+		},
+		{
+			name:       "not from a team",
+			body:       `{"type":"message","id":"M9","conversation":{"id":"a:chat"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid json",
+			body:       `{"type":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockDocumentStore{}
+			handler := &TeamsHandler{client: testThread(), store: store}
+
+			rec := httptest.NewRecorder()
+			handler.HandleActivity(rec, httptest.NewRequest(http.MethodPost, "/webhooks/teams", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp activityResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Type != "message" || !strings.Contains(resp.Text, "Collecting thread context") {
+				t.Errorf("Expected a collecting reply, got %+v", resp)
+			}
+
+			// Collection finishes in the background
+			deadline := time.Now().Add(time.Second)
+			for tt.wantCollect && time.Now().Before(deadline) {
+				store.mu.Lock()
+				done := len(store.docs) > 0
+				store.mu.Unlock()
+				if done {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if len(store.docs) != 1 || store.docs[0].ID != "teams_thread_C1_M1" {
+				t.Errorf("Expected the thread to be stored, got %d documents", len(store.docs))
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package teams
+
+import (
+	"strings"
+	"time"
+)
+
+// Source is the document source of collected Teams threads
+const Source = "teams"
+
+// activityTypeMessage is the activity type of a posted message
+const activityTypeMessage = "message"
+
+// messageTypeMessage is the Graph message type of user-written messages, as
+// opposed to system events like members joining
+const messageTypeMessage = "message"
+
+// Activity is a Bot Framework activity, as posted by a Teams outgoing webhook
+// when the webhook is @mentioned in a channel
+type Activity struct {
+	Type         string              `json:"type"`
+	ID           string              `json:"id"`
+	Timestamp    time.Time           `json:"timestamp"`
+	Text         string              `json:"text"`
+	From         ChannelAccount      `json:"from"`
+	Conversation ConversationAccount `json:"conversation"`
+	ChannelData  ChannelData         `json:"channelData"`
+}
+
+// ChannelAccount is the user who sent an activity
+type ChannelAccount struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	AADObjectID string `json:"aadObjectId,omitempty"`
+}
+
+// ConversationAccount is the conversation an activity belongs to. For a
+// channel thread the ID is the channel's, suffixed with
+// ";messageid=<root message ID>".
+type ConversationAccount struct {
+	ID string `json:"id"`
+}
+
+// RootMessageID returns the ID of the thread's root message, or "" when the
+// conversation ID doesn't name one
+func (c ConversationAccount) RootMessageID() string {
+	_, rootID, ok := strings.Cut(c.ID, ";messageid=")
+	if !ok {
+		return ""
+	}
+	return rootID
+}
+
+// ChannelData is the Teams-specific part of an activity
+type ChannelData struct {
+	Team    *TeamInfo    `json:"team,omitempty"`
+	Channel *ChannelInfo `json:"channel,omitempty"`
+}
+
+// TeamInfo identifies a team. Graph addresses teams by their Azure AD group ID.
+type TeamInfo struct {
+	ID         string `json:"id"`
+	AADGroupID string `json:"aadGroupId,omitempty"`
+}
+
+// ChannelInfo identifies a channel
+type ChannelInfo struct {
+	ID string `json:"id"`
+}
+
+// activityResponse is the message a webhook replies to an activity with
+type activityResponse struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ThreadRef identifies a channel thread to collect
+type ThreadRef struct {
+	TeamID    string // Azure AD group ID
+	ChannelID string
+	RootID    string
+
+	// The reply that asked for the thread to be collected, left out of it
+	TriggerID string
+}
+
+// ChatMessage is a Microsoft Graph channel message
+type ChatMessage struct {
+	ID              string           `json:"id"`
+	ReplyToID       string           `json:"replyToId,omitempty"`
+	MessageType     string           `json:"messageType"`
+	CreatedDateTime time.Time        `json:"createdDateTime"`
+	DeletedDateTime *time.Time       `json:"deletedDateTime,omitempty"`
+	From            *ChatMessageFrom `json:"from,omitempty"`
+	Body            ItemBody         `json:"body"`
+}
+
+// ChatMessageFrom is the sender of a message: a user, or an application for
+// bot messages
+type ChatMessageFrom struct {
+	User        *Identity `json:"user,omitempty"`
+	Application *Identity `json:"application,omitempty"`
+}
+
+// Identity is a Graph user or application
+type Identity struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// ItemBody is a message body; ContentType is "html" or "text"
+type ItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+// messagesPage is a page of a Graph message collection
+type messagesPage struct {
+	Value    []ChatMessage `json:"value"`
+	NextLink string        `json:"@odata.nextLink,omitempty"`
+}
+
+// tokenResponse is an OAuth client credentials token
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
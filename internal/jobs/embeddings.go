@@ -2,42 +2,199 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"knowthis/internal/metrics"
-	"knowthis/internal/services"
 	"knowthis/internal/storage"
+	"knowthis/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// minEmbeddingContentLength is the shortest content worth embedding; shorter
+// documents get a zero placeholder so they aren't picked up again
+const minEmbeddingContentLength = 10
+
+// maxEmbeddingChunkChars matches the input EmbeddingService accepts before
+// truncating; longer documents are embedded in several chunks
+const maxEmbeddingChunkChars = 32000
+
+// placeholderSweepLimit bounds the placeholder documents requeued per sweep
+const placeholderSweepLimit = 100
+
+// defaultMaxChunksPerDocument caps the embeddings generated for one document
+// (a huge Slab post) so it can't balloon embedding cost
+const defaultMaxChunksPerDocument = 20
+
+// ParentDocumentStore looks up the post a comment belongs to
+type ParentDocumentStore interface {
+	GetDocumentBySourceID(ctx context.Context, source, sourceID string) (*storage.Document, error)
+}
+
+// PlaceholderStore finds documents whose zero placeholder embedding is stale
+// and queues them to be embedded again
+type PlaceholderStore interface {
+	GetPlaceholderDocuments(ctx context.Context, minContentLength, limit int) ([]*storage.Document, error)
+	RequeuePlaceholders(ctx context.Context, ids []string) (int64, error)
+}
+
+// DryRunStore marks documents a dry run has logged, leaving them without an
+// embedding, so they aren't picked up again until dry runs end
+type DryRunStore interface {
+	MarkDryRun(ctx context.Context, id string) error
+	ClearDryRunMarks(ctx context.Context) (int64, error)
+}
+
+// EmbeddingServiceInterface generates embeddings for document content
+type EmbeddingServiceInterface interface {
+	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
+	GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+}
+
 // EmbeddingProcessor handles background processing of embeddings
 type EmbeddingProcessor struct {
 	store            storage.Store
-	embeddingService *services.EmbeddingService
-	batchSize        int
-	interval         time.Duration
+	embeddingService EmbeddingServiceInterface
 	done             chan struct{}
+
+	// Adapted by the Start goroutine while the stats endpoint reads them
+	mu        sync.Mutex
+	batchSize int
+	interval  time.Duration
+
+	// Chunks beyond this are dropped with a warning
+	maxChunksPerDocument int
+
+	// Baseline set by SetBatchSize/SetInterval that adaptive mode returns to
+	baseBatchSize int
+	baseInterval  time.Duration
+
+	// Adaptive mode grows the batch toward maxBatchSize and shortens the
+	// interval toward minInterval under a backlog; disabled when maxBatchSize
+	// doesn't exceed the baseline
+	maxBatchSize int
+	minInterval  time.Duration
+
+	// Parent posts whose title and opening are prepended to a comment before
+	// embedding; nil embeds comments on their own
+	parents            ParentDocumentStore
+	parentContextChars int
+
+	// Placeholders swept every placeholderSweepInterval; nil disables the sweep
+	placeholders             PlaceholderStore
+	placeholderSweepInterval time.Duration
+
+	// Log what would be embedded and mark documents in dryRunMarks instead
+	// of calling the embedding service
+	dryRun      bool
+	dryRunMarks DryRunStore
 }
 
-func NewEmbeddingProcessor(store storage.Store, embeddingService *services.EmbeddingService) *EmbeddingProcessor {
+func NewEmbeddingProcessor(store storage.Store, embeddingService EmbeddingServiceInterface) *EmbeddingProcessor {
 	return &EmbeddingProcessor{
 		store:            store,
 		embeddingService: embeddingService,
 		batchSize:        10, // Reduced batch size for cost control
 		interval:         60 * time.Second, // Increased interval to reduce API calls
 		done:             make(chan struct{}),
+
+		maxChunksPerDocument: defaultMaxChunksPerDocument,
+
+		baseBatchSize: 10,
+		baseInterval:  60 * time.Second,
+	}
+}
+
+// SetAdaptive enables adaptive batching: after a full batch the batch size
+// doubles up to maxBatchSize and the interval halves down to minInterval, and
+// after an empty one both step back toward the baseline
+func (e *EmbeddingProcessor) SetAdaptive(maxBatchSize int, minInterval time.Duration) {
+	if maxBatchSize > 1000 || minInterval <= 0 || minInterval > e.baseInterval {
+		return
+	}
+
+	e.maxBatchSize = maxBatchSize
+	e.minInterval = minInterval
+	slog.Info("Enabled adaptive embedding processing",
+		slog.Int("max_batch_size", maxBatchSize),
+		slog.Duration("min_interval", minInterval))
+}
+
+// SetCommentParentContext prepends the parent post's title and up to
+// maxChars of its content to Slab comments before embedding, so a comment
+// like "+1, this fixed it" is searchable in context. Only the embedding
+// input changes; the stored comment is left as is.
+func (e *EmbeddingProcessor) SetCommentParentContext(parents ParentDocumentStore, maxChars int) {
+	if maxChars <= 0 {
+		return
+	}
+
+	e.parents = parents
+	e.parentContextChars = maxChars
+	slog.Info("Enabled comment parent context", slog.Int("max_chars", maxChars))
+}
+
+// SetPlaceholderSweep periodically requeues documents that were given a zero
+// placeholder embedding but whose content has since grown long enough to
+// embed, so an edit to an empty document isn't missed
+func (e *EmbeddingProcessor) SetPlaceholderSweep(placeholders PlaceholderStore, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	e.placeholders = placeholders
+	e.placeholderSweepInterval = interval
+	slog.Info("Enabled placeholder embedding sweep", slog.Duration("interval", interval))
+}
+
+// SetDryRun logs the chunks each document would be embedded as, with their
+// estimated tokens, instead of embedding them. Documents are marked in marks
+// and keep no embedding, so search skips them. Marks are cleared when the
+// processor starts without dry runs, queueing the documents to be embedded.
+func (e *EmbeddingProcessor) SetDryRun(marks DryRunStore, enabled bool) {
+	if marks == nil {
+		slog.Warn("Ignoring embedding dry run setting without a store for its marks")
+		return
+	}
+
+	e.dryRun = enabled
+	e.dryRunMarks = marks
+	if enabled {
+		slog.Warn("Embedding processor is in dry run mode; documents will not be embedded")
 	}
 }
 
 // Start begins the background processing of embeddings
 func (e *EmbeddingProcessor) Start(ctx context.Context) {
+	batchSize, interval := e.settings()
 	slog.Info("Starting embedding processor", 
-		slog.Int("batch_size", e.batchSize),
-		slog.Duration("interval", e.interval))
+		slog.Int("batch_size", batchSize),
+		slog.Duration("interval", interval))
 
-	ticker := time.NewTicker(e.interval)
-	defer ticker.Stop()
+	if e.dryRunMarks != nil && !e.dryRun {
+		if cleared, err := e.dryRunMarks.ClearDryRunMarks(ctx); err != nil {
+			slog.Error("Failed to clear embedding dry run marks", "error", err)
+		} else if cleared > 0 {
+			slog.Info("Queued documents from an earlier dry run for embedding", slog.Int64("documents", cleared))
+		}
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	// A nil channel never fires, leaving the sweep off
+	var sweep <-chan time.Time
+	if e.placeholders != nil {
+		ticker := time.NewTicker(e.placeholderSweepInterval)
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
 
 	for {
 		select {
@@ -47,43 +204,105 @@ func (e *EmbeddingProcessor) Start(ctx context.Context) {
 		case <-e.done:
 			slog.Info("Embedding processor stopped")
 			return
-		case <-ticker.C:
-			if err := e.processBatch(ctx); err != nil {
+		case <-timer.C:
+			// Refresh the backlog gauge even when there's nothing to process
+			if _, err := e.GetStats(ctx); err != nil {
+				slog.Warn("Failed to update embedding backlog", "error", err)
+			}
+
+			found, err := e.processBatch(ctx)
+			if err != nil {
 				slog.Error("Error processing embedding batch", "error", err)
+			} else {
+				e.adapt(found)
+			}
+			_, interval := e.settings()
+			timer.Reset(interval)
+		case <-sweep:
+			if _, err := e.sweepPlaceholders(ctx); err != nil {
+				slog.Error("Error sweeping placeholder embeddings", "error", err)
 			}
 		}
 	}
 }
 
+// adapt adjusts the batch size and interval after a batch that found the
+// given number of documents. A partial batch keeps the current settings.
+func (e *EmbeddingProcessor) adapt(found int) {
+	if e.maxBatchSize <= e.baseBatchSize {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	batchSize, interval := e.batchSize, e.interval
+	switch {
+	case found >= e.batchSize:
+		batchSize = min(e.batchSize*2, e.maxBatchSize)
+		interval = min(e.interval, max(e.interval/2, e.minInterval))
+	case found == 0:
+		batchSize = max(e.batchSize/2, e.baseBatchSize)
+		interval = min(e.interval*2, e.baseInterval)
+	}
+
+	if batchSize != e.batchSize || interval != e.interval {
+		slog.Debug("Adjusted embedding processor batch",
+			slog.Int("batch_size", batchSize),
+			slog.Duration("interval", interval),
+			slog.Int("documents_found", found))
+	}
+	e.batchSize, e.interval = batchSize, interval
+}
+
+// settings returns the current batch size and interval
+func (e *EmbeddingProcessor) settings() (int, time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.batchSize, e.interval
+}
+
 // Stop stops the background processing
 func (e *EmbeddingProcessor) Stop() {
 	close(e.done)
 }
 
-// processBatch processes a batch of documents without embeddings
-func (e *EmbeddingProcessor) processBatch(ctx context.Context) error {
+// processBatch processes a batch of documents without embeddings and returns
+// how many documents were found
+func (e *EmbeddingProcessor) processBatch(ctx context.Context) (found int, err error) {
 	start := time.Now()
+	batchSize, _ := e.settings()
+
+	ctx, span := tracing.Start(ctx, "embedding.process_batch", attribute.Int("embedding.batch_size", batchSize))
+	defer func() { tracing.End(span, err) }()
 	
 	// Get documents without embeddings
-	documents, err := e.store.GetDocumentsWithoutEmbeddings(ctx, e.batchSize)
+	documents, err := e.store.GetDocumentsWithoutEmbeddings(ctx, batchSize)
 	if err != nil {
 		metrics.EmbeddingGenerations.WithLabelValues("error").Inc()
-		return err
+		return 0, err
 	}
 
+	span.SetAttributes(attribute.Int("documents.found", len(documents)))
 	if len(documents) == 0 {
 		slog.Debug("No documents found without embeddings")
-		return nil
+		return 0, nil
 	}
 
 	slog.Info("Processing embedding batch", 
 		slog.Int("document_count", len(documents)))
 
-	// Process each document
+	// Mark empty and very short documents with placeholders; embed the rest in one request
 	successCount := 0
+	var pending []*storage.Document
 	for _, doc := range documents {
-		if err := e.processDocument(ctx, doc); err != nil {
-			slog.Error("Error processing document embedding", 
+		if needsEmbedding(doc) {
+			pending = append(pending, doc)
+			continue
+		}
+
+		if err := e.markPlaceholder(ctx, doc, strings.TrimSpace(doc.Content)); err != nil {
+			slog.Error("Error marking document without embeddable content",
 				slog.String("document_id", doc.ID),
 				slog.String("error", err.Error()))
 			metrics.EmbeddingGenerations.WithLabelValues("error").Inc()
@@ -93,6 +312,11 @@ func (e *EmbeddingProcessor) processBatch(ctx context.Context) error {
 		metrics.EmbeddingGenerations.WithLabelValues("success").Inc()
 	}
 
+	successCount += e.embedDocuments(ctx, pending)
+	span.SetAttributes(
+		attribute.Int("documents.placeholders", len(documents)-len(pending)),
+		attribute.Int("documents.processed", successCount))
+
 	duration := time.Since(start)
 	metrics.EmbeddingGenerationDuration.Observe(duration.Seconds())
 	
@@ -101,81 +325,327 @@ func (e *EmbeddingProcessor) processBatch(ctx context.Context) error {
 		slog.Int("total", len(documents)),
 		slog.Duration("duration", duration))
 
+	return len(documents), nil
+}
+
+// embedDocuments generates embeddings for all chunks of the documents in one
+// request. The first chunk's embedding is stored on the document itself and
+// any further chunks of an oversized document are stored as chunk documents.
+// Returns how many documents were stored.
+func (e *EmbeddingProcessor) embedDocuments(ctx context.Context, documents []*storage.Document) int {
+	if len(documents) == 0 {
+		return 0
+	}
+
+	// Comments on the same post in a batch share one parent lookup
+	parentContexts := make(map[string]string)
+
+	var texts []string
+	chunkCounts := make([]int, len(documents))
+	for i, doc := range documents {
+		chunks := chunkText(e.parentContext(ctx, doc, parentContexts)+strings.TrimSpace(doc.Content), maxEmbeddingChunkChars)
+		if len(chunks) > e.maxChunksPerDocument {
+			slog.Warn("Document exceeds chunk limit, truncating",
+				slog.String("document_id", doc.ID),
+				slog.String("source", doc.Source),
+				slog.Int("chunk_count", len(chunks)),
+				slog.Int("max_chunks", e.maxChunksPerDocument))
+			chunks = chunks[:e.maxChunksPerDocument]
+		}
+		chunkCounts[i] = len(chunks)
+		texts = append(texts, chunks...)
+	}
+
+	if e.dryRun {
+		return e.dryRunDocuments(ctx, documents, texts, chunkCounts)
+	}
+
+	embeddings, err := e.embeddingService.GenerateEmbeddings(ctx, texts)
+	if err == nil && len(embeddings) != len(texts) {
+		err = fmt.Errorf("embedding count mismatch: expected %d, got %d", len(texts), len(embeddings))
+	}
+	if err != nil {
+		slog.Error("Error generating batch embeddings",
+			slog.Int("document_count", len(documents)),
+			slog.String("error", err.Error()))
+		metrics.EmbeddingGenerations.WithLabelValues("error").Add(float64(len(documents)))
+		return 0
+	}
+
+	stored := 0
+	offset := 0
+	for i, doc := range documents {
+		first := offset
+		offset += chunkCounts[i]
+
+		// Store extra chunks first so the document isn't marked done while they're missing
+		if err := e.storeChunkDocuments(ctx, doc, texts[first+1:offset], embeddings[first+1:offset]); err != nil {
+			slog.Error("Error storing document chunk embeddings",
+				slog.String("document_id", doc.ID),
+				slog.String("error", err.Error()))
+			metrics.EmbeddingGenerations.WithLabelValues("error").Inc()
+			continue
+		}
+
+		if err := e.store.UpdateEmbedding(ctx, doc.ID, embeddings[first]); err != nil {
+			slog.Error("Error storing document embedding",
+				slog.String("document_id", doc.ID),
+				slog.String("error", err.Error()))
+			metrics.EmbeddingGenerations.WithLabelValues("error").Inc()
+			continue
+		}
+		stored++
+		metrics.EmbeddingGenerations.WithLabelValues("success").Inc()
+	}
+
+	return stored
+}
+
+// dryRunDocuments logs the chunks the documents would be embedded as and marks
+// each as dry run. Returns how many documents were marked.
+func (e *EmbeddingProcessor) dryRunDocuments(ctx context.Context, documents []*storage.Document, texts []string, chunkCounts []int) int {
+	marked := 0
+	offset := 0
+	for i, doc := range documents {
+		for chunkIndex, chunk := range texts[offset : offset+chunkCounts[i]] {
+			slog.Info("Dry run: would embed document chunk",
+				slog.String("document_id", doc.ID),
+				slog.Int("chunk_index", chunkIndex),
+				slog.Int("chars", len(chunk)),
+				slog.Int("estimated_tokens", estimateTokens(chunk)),
+				slog.String("preview", preview(chunk, 200)))
+		}
+		offset += chunkCounts[i]
+
+		if err := e.dryRunMarks.MarkDryRun(ctx, doc.ID); err != nil {
+			slog.Error("Error marking dry run document",
+				slog.String("document_id", doc.ID),
+				slog.String("error", err.Error()))
+			continue
+		}
+		marked++
+	}
+
+	return marked
+}
+
+// estimateTokens approximates the tokens text is embedded as, at about four
+// characters per token
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// preview returns the first maxChars characters of text, for logging
+func preview(text string, maxChars int) string {
+	if runes := []rune(text); len(runes) > maxChars {
+		return string(runes[:maxChars]) + "..."
+	}
+	return text
+}
+
+// parentContext returns the context line prepended to a comment's embedding
+// input, or "" for documents that aren't comments or whose post isn't stored.
+// Results are cached by post ID in cache.
+func (e *EmbeddingProcessor) parentContext(ctx context.Context, doc *storage.Document, cache map[string]string) string {
+	if e.parents == nil || doc.Source != "slab" || doc.PostID == "" || doc.PostID == doc.SourceID {
+		return ""
+	}
+
+	if summary, ok := cache[doc.PostID]; ok {
+		return summary
+	}
+
+	summary := ""
+	parent, err := e.parents.GetDocumentBySourceID(ctx, doc.Source, doc.PostID)
+	switch {
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		slog.Debug("Parent post not stored, embedding comment alone",
+			slog.String("document_id", doc.ID),
+			slog.String("post_id", doc.PostID))
+	case err != nil:
+		slog.Warn("Failed to look up parent post, embedding comment alone",
+			slog.String("document_id", doc.ID),
+			slog.String("post_id", doc.PostID),
+			slog.String("error", err.Error()))
+		// Not cached, so the next comment on the post tries again
+		return ""
+	default:
+		summary = formatParentContext(parent, e.parentContextChars)
+	}
+
+	cache[doc.PostID] = summary
+	return summary
+}
+
+// formatParentContext summarizes a parent post as its title and the first
+// maxChars of its content, cut at a word boundary
+func formatParentContext(parent *storage.Document, maxChars int) string {
+	snippet := strings.Join(strings.Fields(parent.Content), " ")
+	if len(snippet) > maxChars {
+		cut := strings.LastIndex(snippet[:maxChars+1], " ")
+		if cut <= 0 {
+			cut = maxChars
+			for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+				cut--
+			}
+		}
+		snippet = snippet[:cut] + "..."
+	}
+
+	title := strings.TrimSpace(parent.Title)
+	switch {
+	case title == "" && snippet == "":
+		return ""
+	case title == "":
+		return fmt.Sprintf("Comment on post: %s\n\n", snippet)
+	case snippet == "":
+		return fmt.Sprintf("Comment on post %q\n\n", title)
+	}
+	return fmt.Sprintf("Comment on post %q: %s\n\n", title, snippet)
+}
+
+// storeChunkDocuments stores the chunks after the first of an oversized
+// document as separate documents so the whole content stays searchable
+func (e *EmbeddingProcessor) storeChunkDocuments(ctx context.Context, doc *storage.Document, chunks []string, embeddings [][]float32) error {
+	if len(chunks) > 0 {
+		slog.Info("Storing oversized document as multiple chunks",
+			slog.String("document_id", doc.ID),
+			slog.Int("chunk_count", len(chunks)+1))
+	}
+
+	for i, chunk := range chunks {
+		chunkDoc := *doc
+		chunkDoc.ID = fmt.Sprintf("%s_chunk_%d", doc.ID, i+1)
+		chunkDoc.Content = chunk
+		chunkDoc.ContentHash = storage.HashContent(chunk)
+		chunkDoc.Embedding = embeddings[i]
+
+		if err := e.store.StoreDocument(ctx, &chunkDoc); err != nil {
+			return fmt.Errorf("failed to store chunk %d: %w", i+1, err)
+		}
+	}
+
 	return nil
 }
 
-// processDocument processes a single document's embedding
-func (e *EmbeddingProcessor) processDocument(ctx context.Context, doc *storage.Document) error {
-	start := time.Now()
-	
-	// Skip documents with empty content but mark them so they don't get processed again
-	content := strings.TrimSpace(doc.Content)
+// chunkText splits text into chunks of at most maxChars characters, breaking
+// at whitespace where possible and never inside a UTF-8 sequence
+func chunkText(text string, maxChars int) []string {
+	var chunks []string
+
+	for len(text) > maxChars {
+		cut := strings.LastIndexAny(text[:maxChars+1], " \t\n")
+		if cut <= 0 {
+			cut = maxChars
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+
+		chunks = append(chunks, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+
+	return append(chunks, text)
+}
+
+// markPlaceholder stores a zero embedding for a document without embeddable
+// content so it doesn't get processed again
+func (e *EmbeddingProcessor) markPlaceholder(ctx context.Context, doc *storage.Document, content string) error {
 	if content == "" {
 		slog.Warn("Marking document with empty content", slog.String("document_id", doc.ID))
-		// Create a placeholder embedding (1536 zeros) to mark as processed
-		emptyEmbedding := make([]float32, 1536)
-		return e.store.UpdateEmbedding(ctx, doc.ID, emptyEmbedding)
-	}
-	
-	// Skip very short content but mark them so they don't get processed again
-	if len(content) < 10 {
+	} else {
 		slog.Debug("Marking document with very short content", 
 			slog.String("document_id", doc.ID),
 			slog.String("content", content))
-		// Create a placeholder embedding (1536 zeros) to mark as processed
-		emptyEmbedding := make([]float32, 1536)
-		return e.store.UpdateEmbedding(ctx, doc.ID, emptyEmbedding)
 	}
-	
-	// Generate embedding
-	embedding, err := e.embeddingService.GenerateEmbedding(ctx, content)
+
+	// Create a placeholder embedding (1536 zeros) to mark as processed
+	emptyEmbedding := make([]float32, storage.EmbeddingDimensions)
+	return e.store.UpdateEmbedding(ctx, doc.ID, emptyEmbedding)
+}
+
+// sweepPlaceholders requeues placeholder documents that now have embeddable
+// content and returns how many were queued
+func (e *EmbeddingProcessor) sweepPlaceholders(ctx context.Context) (int64, error) {
+	documents, err := e.placeholders.GetPlaceholderDocuments(ctx, minEmbeddingContentLength, placeholderSweepLimit)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	var ids []string
+	for _, doc := range documents {
+		if needsEmbedding(doc) {
+			ids = append(ids, doc.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
 	}
 
-	// Update document with embedding
-	if err := e.store.UpdateEmbedding(ctx, doc.ID, embedding); err != nil {
-		return err
+	queued, err := e.placeholders.RequeuePlaceholders(ctx, ids)
+	if err != nil {
+		return 0, err
 	}
 
-	slog.Debug("Generated embedding for document", 
-		slog.String("document_id", doc.ID),
-		slog.Duration("duration", time.Since(start)))
+	slog.Info("Requeued placeholder embeddings", slog.Int64("queued", queued))
+	return queued, nil
+}
 
-	return nil
+// needsEmbedding reports whether a document's content is long enough to embed
+// rather than mark with a placeholder
+func needsEmbedding(doc *storage.Document) bool {
+	return len(strings.TrimSpace(doc.Content)) >= minEmbeddingContentLength
 }
 
 // GetStats returns statistics about embedding processing
 func (e *EmbeddingProcessor) GetStats(ctx context.Context) (map[string]interface{}, error) {
-	documentsWithoutEmbeddings, err := e.store.GetDocumentsWithoutEmbeddings(ctx, 1000)
+	documentsWithoutEmbeddings, err := e.store.CountDocumentsWithoutEmbeddings(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	batchSize, interval := e.settings()
 	stats := map[string]interface{}{
-		"documents_without_embeddings": len(documentsWithoutEmbeddings),
-		"batch_size":                  e.batchSize,
-		"processing_interval":         e.interval.String(),
+		"documents_without_embeddings": documentsWithoutEmbeddings,
+		"batch_size":                  batchSize,
+		"processing_interval":         interval.String(),
 	}
 
 	// Update metrics
-	metrics.DocumentsWithoutEmbeddings.Set(float64(len(documentsWithoutEmbeddings)))
+	metrics.DocumentsWithoutEmbeddings.Set(float64(documentsWithoutEmbeddings))
 
 	return stats, nil
 }
 
-// SetBatchSize updates the batch size for processing
+// SetBatchSize updates the batch size for processing and the baseline
+// adaptive mode returns to
 func (e *EmbeddingProcessor) SetBatchSize(size int) {
 	if size > 0 && size <= 1000 {
+		e.mu.Lock()
 		e.batchSize = size
+		e.mu.Unlock()
+		e.baseBatchSize = size
 		slog.Info("Updated embedding processor batch size", slog.Int("new_size", size))
 	}
 }
 
-// SetInterval updates the processing interval
+// SetMaxChunksPerDocument updates how many chunks of one document are embedded
+func (e *EmbeddingProcessor) SetMaxChunksPerDocument(maxChunks int) {
+	if maxChunks > 0 {
+		e.maxChunksPerDocument = maxChunks
+		slog.Info("Updated embedding processor max chunks per document", slog.Int("max_chunks", maxChunks))
+	}
+}
+
+// SetInterval updates the processing interval and the baseline adaptive
+// mode returns to
 func (e *EmbeddingProcessor) SetInterval(interval time.Duration) {
 	if interval >= 10*time.Second && interval <= 10*time.Minute {
+		e.mu.Lock()
 		e.interval = interval
+		e.mu.Unlock()
+		e.baseInterval = interval
 		slog.Info("Updated embedding processor interval", slog.Duration("new_interval", interval))
 	}
 }
\ No newline at end of file
@@ -2,21 +2,23 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"knowthis/internal/handlers"
 	"knowthis/internal/storage"
 )
 
-// EmbeddingServiceInterface for testing
-type EmbeddingServiceInterface interface {
-	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
-	GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
-}
-
 // Mock embedding service
 type mockEmbeddingService struct {
 	generateEmbeddingFunc func(ctx context.Context, text string) ([]float32, error)
+	batchCalls            [][]string
 }
 
 func (m *mockEmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
@@ -28,6 +30,7 @@ func (m *mockEmbeddingService) GenerateEmbedding(ctx context.Context, text strin
 }
 
 func (m *mockEmbeddingService) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	m.batchCalls = append(m.batchCalls, texts)
 	results := make([][]float32, len(texts))
 	for i := range texts {
 		embedding, err := m.GenerateEmbedding(ctx, texts[i])
@@ -43,9 +46,11 @@ func (m *mockEmbeddingService) GenerateEmbeddings(ctx context.Context, texts []s
 type mockEmbeddingStore struct {
 	documents        []*storage.Document
 	updatedEmbeddings map[string][]float32
+	storedDocuments   []*storage.Document
 }
 
 func (m *mockEmbeddingStore) StoreDocument(ctx context.Context, doc *storage.Document) error {
+	m.storedDocuments = append(m.storedDocuments, doc)
 	return nil
 }
 
@@ -65,6 +70,23 @@ func (m *mockEmbeddingStore) GetDocumentsWithoutEmbeddings(ctx context.Context,
 	return m.documents, nil
 }
 
+func (m *mockEmbeddingStore) CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error) {
+	return len(m.documents), nil
+}
+
+func (m *mockEmbeddingStore) GetDocument(ctx context.Context, id string) (*storage.Document, error) {
+	for _, doc := range m.documents {
+		if doc.ID == id {
+			return doc, nil
+		}
+	}
+	return nil, storage.ErrDocumentNotFound
+}
+
+func (m *mockEmbeddingStore) DeleteDocument(ctx context.Context, id string) error {
+	return nil
+}
+
 func (m *mockEmbeddingStore) Close() error {
 	return nil
 }
@@ -378,4 +400,608 @@ func TestContentFiltering(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestEmbeddingProcessor_ProcessBatchEmbedsValidDocumentsTogether(t *testing.T) {
+	documents := []*storage.Document{
+		{ID: "doc1", Content: "Valid content for document one"},
+		{ID: "doc2", Content: ""}, // Empty content
+		{ID: "doc3", Content: "Another valid document"},
+		{ID: "doc4", Content: "hi"},  // Too short
+		{ID: "doc5", Content: "   "}, // Whitespace only
+		{ID: "doc6", Content: "  The third valid document  "},
+	}
+
+	mockStore := &mockEmbeddingStore{
+		documents:         documents,
+		updatedEmbeddings: make(map[string][]float32),
+	}
+	// Encode each text's length in its embedding to check the index mapping
+	mockService := &mockEmbeddingService{
+		generateEmbeddingFunc: func(ctx context.Context, text string) ([]float32, error) {
+			embedding := make([]float32, 1536)
+			embedding[0] = float32(len(text))
+			return embedding, nil
+		},
+	}
+	processor := NewEmbeddingProcessor(mockStore, mockService)
+
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mockService.batchCalls) != 1 {
+		t.Fatalf("Expected 1 batch embedding request, got %d", len(mockService.batchCalls))
+	}
+	if len(mockService.batchCalls[0]) != 3 {
+		t.Errorf("Expected 3 texts in the batch, got %d", len(mockService.batchCalls[0]))
+	}
+
+	if len(mockStore.updatedEmbeddings) != len(documents) {
+		t.Errorf("Expected %d embedding updates, got %d", len(documents), len(mockStore.updatedEmbeddings))
+	}
+
+	for _, doc := range documents {
+		embedding := mockStore.updatedEmbeddings[doc.ID]
+		content := strings.TrimSpace(doc.Content)
+		if len(content) < 10 {
+			if embedding[0] != 0 {
+				t.Errorf("Expected placeholder embedding for %s", doc.ID)
+			}
+			continue
+		}
+		if embedding[0] != float32(len(content)) {
+			t.Errorf("Expected %s to get the embedding of its own content, got one for length %v", doc.ID, embedding[0])
+		}
+	}
+}
+
+func TestEmbeddingProcessor_ProcessBatchPlaceholdersOnly(t *testing.T) {
+	mockStore := &mockEmbeddingStore{
+		documents: []*storage.Document{
+			{ID: "empty1", Content: ""},
+			{ID: "short1", Content: "hi"},
+		},
+	}
+	mockService := &mockEmbeddingService{}
+	processor := NewEmbeddingProcessor(mockStore, mockService)
+
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mockService.batchCalls) != 0 {
+		t.Errorf("Expected no embedding request when every document is a placeholder")
+	}
+	if len(mockStore.updatedEmbeddings) != 2 {
+		t.Errorf("Expected 2 placeholder updates, got %d", len(mockStore.updatedEmbeddings))
+	}
+
+	// Placeholders must match the vector columns' dimensions to be stored
+	for id, embedding := range mockStore.updatedEmbeddings {
+		if len(embedding) != storage.EmbeddingDimensions {
+			t.Errorf("Expected a %d-dimension placeholder for %s, got %d", storage.EmbeddingDimensions, id, len(embedding))
+			continue
+		}
+		for _, value := range embedding {
+			if value != 0 {
+				t.Errorf("Expected an all-zero placeholder for %s", id)
+				break
+			}
+		}
+	}
+}
+
+func TestEmbeddingProcessor_ProcessBatchChunksOversizedDocument(t *testing.T) {
+	var lines []string
+	for i := 0; len(strings.Join(lines, "\n")) < 2*maxEmbeddingChunkChars; i++ {
+		lines = append(lines, fmt.Sprintf("comment line %05d with a pasted stack trace frame at handler.go:%d", i, i))
+	}
+	content := strings.Join(lines, "\n") + "\nEND_OF_COMMENT"
+
+	mockStore := &mockEmbeddingStore{
+		documents: []*storage.Document{
+			{ID: "comment_1", Content: content, Source: "slab", SourceID: "c1", PostID: "p1"},
+			{ID: "comment_2", Content: "A normal sized comment"},
+		},
+	}
+	mockService := &mockEmbeddingService{}
+	processor := NewEmbeddingProcessor(mockStore, mockService)
+
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mockService.batchCalls) != 1 {
+		t.Fatalf("Expected 1 batch embedding request, got %d", len(mockService.batchCalls))
+	}
+	texts := mockService.batchCalls[0]
+	if len(texts) < 4 {
+		t.Fatalf("Expected the oversized comment to be split into multiple chunks, got %d texts", len(texts))
+	}
+	for i, text := range texts {
+		if len(text) > maxEmbeddingChunkChars {
+			t.Errorf("Text %d has %d characters, exceeding the %d limit", i, len(text), maxEmbeddingChunkChars)
+		}
+	}
+	if !strings.HasSuffix(texts[len(texts)-2], "END_OF_COMMENT") {
+		t.Errorf("Expected the tail of the comment to be embedded rather than truncated")
+	}
+
+	if _, ok := mockStore.updatedEmbeddings["comment_1"]; !ok {
+		t.Errorf("Expected the oversized document to get its first chunk's embedding")
+	}
+	if _, ok := mockStore.updatedEmbeddings["comment_2"]; !ok {
+		t.Errorf("Expected the normal document to be embedded")
+	}
+
+	if len(mockStore.storedDocuments) != len(texts)-2 {
+		t.Fatalf("Expected %d chunk documents, got %d", len(texts)-2, len(mockStore.storedDocuments))
+	}
+	for i, chunkDoc := range mockStore.storedDocuments {
+		if chunkDoc.ID != fmt.Sprintf("comment_1_chunk_%d", i+1) {
+			t.Errorf("Unexpected chunk document ID %s", chunkDoc.ID)
+		}
+		if chunkDoc.Content != texts[i+1] || chunkDoc.SourceID != "c1" || chunkDoc.PostID != "p1" {
+			t.Errorf("Chunk document %s should carry its chunk and the parent's metadata", chunkDoc.ID)
+		}
+		if chunkDoc.ContentHash != storage.HashContent(chunkDoc.Content) || len(chunkDoc.Embedding) == 0 {
+			t.Errorf("Chunk document %s should have its own content hash and embedding", chunkDoc.ID)
+		}
+	}
+}
+
+func TestEmbeddingProcessor_ProcessBatchCapsChunksPerDocument(t *testing.T) {
+	// Roughly 10 chunks worth of content
+	content := strings.Repeat("A very long Slab post section about incident response procedures. ", 10*maxEmbeddingChunkChars/68)
+
+	mockStore := &mockEmbeddingStore{
+		documents: []*storage.Document{
+			{ID: "post_1", Content: content, Source: "slab", SourceID: "p1"},
+		},
+	}
+	mockService := &mockEmbeddingService{}
+	processor := NewEmbeddingProcessor(mockStore, mockService)
+	processor.SetMaxChunksPerDocument(3)
+
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mockService.batchCalls) != 1 || len(mockService.batchCalls[0]) != 3 {
+		t.Fatalf("Expected one request embedding 3 chunks, got %v", mockService.batchCalls)
+	}
+	if len(mockStore.storedDocuments) != 2 {
+		t.Errorf("Expected 2 chunk documents beyond the first, got %d", len(mockStore.storedDocuments))
+	}
+	if _, ok := mockStore.updatedEmbeddings["post_1"]; !ok {
+		t.Errorf("Expected the capped document to still be embedded")
+	}
+
+	// Invalid caps are ignored
+	processor.SetMaxChunksPerDocument(0)
+	if processor.maxChunksPerDocument != 3 {
+		t.Errorf("Expected invalid cap to be ignored, got %d", processor.maxChunksPerDocument)
+	}
+}
+
+// backlogStore serves a synthetic backlog of documents, at most limit at a time
+type backlogStore struct {
+	mockEmbeddingStore
+	remaining int
+	served    int
+}
+
+func (b *backlogStore) GetDocumentsWithoutEmbeddings(ctx context.Context, limit int) ([]*storage.Document, error) {
+	var documents []*storage.Document
+	for i := 0; i < limit && i < b.remaining; i++ {
+		b.served++
+		documents = append(documents, &storage.Document{
+			ID:      fmt.Sprintf("doc_%d", b.served),
+			Content: "Backlog document with enough content to embed",
+		})
+	}
+	b.remaining -= len(documents)
+	return documents, nil
+}
+
+func (b *backlogStore) CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error) {
+	return b.remaining, nil
+}
+
+func TestEmbeddingProcessor_AdaptiveBatchUnderBacklog(t *testing.T) {
+	store := &backlogStore{remaining: 170}
+	processor := NewEmbeddingProcessor(store, &mockEmbeddingService{})
+	processor.SetAdaptive(80, 10*time.Second)
+
+	run := func() int {
+		found, err := processor.processBatch(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		processor.adapt(found)
+		return found
+	}
+
+	// Full batches grow the batch and shorten the interval, within the bounds
+	growth := []struct {
+		batchSize int
+		interval  time.Duration
+	}{
+		{20, 30 * time.Second},
+		{40, 15 * time.Second},
+		{80, 10 * time.Second},
+		{80, 10 * time.Second},
+	}
+	for i, want := range growth {
+		run()
+		if processor.batchSize != want.batchSize || processor.interval != want.interval {
+			t.Errorf("Full batch %d: expected batch %d every %v, got %d every %v",
+				i+1, want.batchSize, want.interval, processor.batchSize, processor.interval)
+		}
+	}
+
+	// The partial batch that drains the backlog keeps the current settings
+	if found := run(); found != 20 {
+		t.Fatalf("Expected a partial batch of 20, found %d", found)
+	}
+	if processor.batchSize != 80 || processor.interval != 10*time.Second {
+		t.Errorf("Partial batch: expected batch 80 every 10s, got %d every %v", processor.batchSize, processor.interval)
+	}
+
+	// Empty batches back off toward the baseline
+	shrink := []struct {
+		batchSize int
+		interval  time.Duration
+	}{
+		{40, 20 * time.Second},
+		{20, 40 * time.Second},
+		{10, 60 * time.Second},
+		{10, 60 * time.Second},
+	}
+	for i, want := range shrink {
+		if found := run(); found != 0 {
+			t.Fatalf("Expected an empty batch, found %d", found)
+		}
+		if processor.batchSize != want.batchSize || processor.interval != want.interval {
+			t.Errorf("Empty batch %d: expected batch %d every %v, got %d every %v",
+				i+1, want.batchSize, want.interval, processor.batchSize, processor.interval)
+		}
+	}
+
+	if store.served != 170 {
+		t.Errorf("Expected all 170 backlog documents to be processed, got %d", store.served)
+	}
+}
+
+func TestEmbeddingProcessor_FixedBatchByDefault(t *testing.T) {
+	processor := NewEmbeddingProcessor(&mockEmbeddingStore{}, &mockEmbeddingService{})
+
+	processor.adapt(processor.batchSize)
+	if processor.batchSize != 10 || processor.interval != 60*time.Second {
+		t.Errorf("Expected fixed batch without adaptive mode, got %d every %v", processor.batchSize, processor.interval)
+	}
+
+	// Overrides set the baseline adaptive mode backs off to
+	processor.SetBatchSize(5)
+	processor.SetInterval(30 * time.Second)
+	processor.SetAdaptive(20, 10*time.Second)
+	processor.adapt(5)
+	processor.adapt(0)
+	if processor.batchSize != 5 || processor.interval != 30*time.Second {
+		t.Errorf("Expected back-off to the overridden baseline, got %d every %v", processor.batchSize, processor.interval)
+	}
+}
+
+// lockedBacklogStore is a backlogStore safe to read from the stats endpoint
+// while the processor drains it
+type lockedBacklogStore struct {
+	backlogStore
+	mu sync.Mutex
+}
+
+func (l *lockedBacklogStore) GetDocumentsWithoutEmbeddings(ctx context.Context, limit int) ([]*storage.Document, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.backlogStore.GetDocumentsWithoutEmbeddings(ctx, limit)
+}
+
+func (l *lockedBacklogStore) CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.backlogStore.CountDocumentsWithoutEmbeddings(ctx)
+}
+
+// Run with -race: the stats endpoint reads the batch settings adapt changes
+func TestEmbeddingProcessor_StatsWhileAdapting(t *testing.T) {
+	store := &lockedBacklogStore{backlogStore: backlogStore{remaining: 500}}
+	processor := NewEmbeddingProcessor(store, &mockEmbeddingService{})
+	processor.interval = time.Millisecond
+	processor.baseInterval = time.Millisecond
+	processor.SetAdaptive(80, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		processor.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	handler := handlers.NewStatsHandler(processor)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		handler.HandleStats(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		if remaining, _ := store.CountDocumentsWithoutEmbeddings(ctx); remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the backlog to drain")
+		}
+	}
+}
+
+type mockParentStore struct {
+	posts   map[string]*storage.Document
+	lookups int
+}
+
+func (m *mockParentStore) GetDocumentBySourceID(ctx context.Context, source, sourceID string) (*storage.Document, error) {
+	m.lookups++
+	if post, ok := m.posts[sourceID]; ok {
+		return post, nil
+	}
+	return nil, storage.ErrDocumentNotFound
+}
+
+func TestEmbeddingProcessor_CommentParentContext(t *testing.T) {
+	documents := []*storage.Document{
+		{ID: "comment1", Source: "slab", SourceID: "c1", PostID: "post1", Content: "+1, this fixed it"},
+		{ID: "comment2", Source: "slab", SourceID: "c2", PostID: "post1", Content: "Worked for me as well"},
+		{ID: "comment3", Source: "slab", SourceID: "c3", PostID: "missing", Content: "Where is this documented?"},
+		{ID: "post2", Source: "slab", SourceID: "post2", PostID: "post2", Content: "A post is not a comment"},
+	}
+	parents := &mockParentStore{posts: map[string]*storage.Document{
+		"post1": {Source: "slab", SourceID: "post1", Title: "Rolling back deploys", Content: "Run make rollback\n\nfrom the deploy host, then check the dashboard"},
+	}}
+
+	testCases := []struct {
+		name     string
+		maxChars int
+		expected []string
+	}{
+		{
+			name:     "disabled by default",
+			maxChars: 0,
+			expected: []string{"+1, this fixed it", "Worked for me as well", "Where is this documented?", "A post is not a comment"},
+		},
+		{
+			name:     "prepends the parent post",
+			maxChars: 30,
+			expected: []string{
+				"Comment on post \"Rolling back deploys\": Run make rollback from the...\n\n+1, this fixed it",
+				"Comment on post \"Rolling back deploys\": Run make rollback from the...\n\nWorked for me as well",
+				"Where is this documented?",
+				"A post is not a comment",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parents.lookups = 0
+			mockStore := &mockEmbeddingStore{documents: documents}
+			mockService := &mockEmbeddingService{}
+			processor := NewEmbeddingProcessor(mockStore, mockService)
+			processor.SetCommentParentContext(parents, tc.maxChars)
+
+			if _, err := processor.processBatch(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(mockService.batchCalls) != 1 {
+				t.Fatalf("Expected 1 batch embedding request, got %d", len(mockService.batchCalls))
+			}
+			texts := mockService.batchCalls[0]
+			if len(texts) != len(tc.expected) {
+				t.Fatalf("Expected %d texts, got %d", len(tc.expected), len(texts))
+			}
+			for i, expected := range tc.expected {
+				if texts[i] != expected {
+					t.Errorf("Expected text %d to be %q, got %q", i, expected, texts[i])
+				}
+			}
+
+			if tc.maxChars > 0 && parents.lookups != 2 {
+				t.Errorf("Expected one lookup per distinct post, got %d", parents.lookups)
+			}
+			for _, doc := range documents {
+				if strings.HasPrefix(doc.Content, "Comment on post") {
+					t.Errorf("Expected stored content of %s to be unchanged", doc.ID)
+				}
+			}
+		})
+	}
+}
+
+// mockPlaceholderStore returns its placeholder documents as the query would
+// and records which were requeued
+type mockPlaceholderStore struct {
+	documents []*storage.Document
+	err       error
+
+	minContentLength int
+	requeued         []string
+}
+
+func (m *mockPlaceholderStore) GetPlaceholderDocuments(ctx context.Context, minContentLength, limit int) ([]*storage.Document, error) {
+	m.minContentLength = minContentLength
+	return m.documents, m.err
+}
+
+func (m *mockPlaceholderStore) RequeuePlaceholders(ctx context.Context, ids []string) (int64, error) {
+	m.requeued = append(m.requeued, ids...)
+	return int64(len(ids)), nil
+}
+
+func TestEmbeddingProcessor_SweepPlaceholders(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		requeued bool
+	}{
+		{"edited to embeddable content", "The deploy runbook now lives in the platform wiki", true},
+		{"exactly the minimum length", "0123456789", true},
+		{"still short", "ok", false},
+		// Padding doesn't count, as when the placeholder was stored
+		{"short with padding", "   ok \n\n\t   ", false},
+		{"still empty", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockPlaceholderStore{documents: []*storage.Document{{ID: "doc1", Content: tc.content}}}
+			processor := NewEmbeddingProcessor(&mockEmbeddingStore{}, &mockEmbeddingService{})
+			processor.SetPlaceholderSweep(store, time.Hour)
+
+			queued, err := processor.sweepPlaceholders(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if store.minContentLength != minEmbeddingContentLength {
+				t.Errorf("Expected placeholders looked up with min length %d, got %d", minEmbeddingContentLength, store.minContentLength)
+			}
+
+			if tc.requeued && (queued != 1 || len(store.requeued) != 1 || store.requeued[0] != "doc1") {
+				t.Errorf("Expected doc1 requeued, got %d queued: %v", queued, store.requeued)
+			}
+			if !tc.requeued && (queued != 0 || len(store.requeued) != 0) {
+				t.Errorf("Expected nothing requeued, got %d queued: %v", queued, store.requeued)
+			}
+		})
+	}
+}
+
+func TestEmbeddingProcessor_SweepPlaceholdersError(t *testing.T) {
+	store := &mockPlaceholderStore{err: errors.New("connection refused")}
+	processor := NewEmbeddingProcessor(&mockEmbeddingStore{}, &mockEmbeddingService{})
+	processor.SetPlaceholderSweep(store, time.Hour)
+
+	if _, err := processor.sweepPlaceholders(context.Background()); err == nil {
+		t.Error("Expected the lookup error")
+	}
+	if len(store.requeued) != 0 {
+		t.Errorf("Expected nothing requeued, got %v", store.requeued)
+	}
+}
+
+func TestEmbeddingProcessor_PlaceholderSweepDisabled(t *testing.T) {
+	processor := NewEmbeddingProcessor(&mockEmbeddingStore{}, &mockEmbeddingService{})
+	processor.SetPlaceholderSweep(&mockPlaceholderStore{}, 0)
+	if processor.placeholders != nil {
+		t.Error("Expected a zero interval to leave the sweep disabled")
+	}
+}
+
+// mockDryRunStore records dry run marks
+type mockDryRunStore struct {
+	marked  []string
+	cleared bool
+}
+
+func (m *mockDryRunStore) MarkDryRun(ctx context.Context, id string) error {
+	m.marked = append(m.marked, id)
+	return nil
+}
+
+func (m *mockDryRunStore) ClearDryRunMarks(ctx context.Context) (int64, error) {
+	m.cleared = true
+	cleared := int64(len(m.marked))
+	m.marked = nil
+	return cleared, nil
+}
+
+func TestEmbeddingProcessor_DryRun(t *testing.T) {
+	oversized := strings.Repeat("a line of a very long runbook that goes on and on\n", 2*maxEmbeddingChunkChars/50)
+	documents := []*storage.Document{
+		{ID: "doc1", Content: "The deploy runbook now lives in the platform wiki"},
+		{ID: "doc2", Content: "hi"},
+		{ID: "doc3", Content: oversized},
+	}
+	mockStore := &mockEmbeddingStore{documents: documents}
+	mockService := &mockEmbeddingService{
+		generateEmbeddingFunc: func(ctx context.Context, text string) ([]float32, error) {
+			t.Error("Expected no embedding requests in a dry run")
+			return nil, errors.New("unexpected call")
+		},
+	}
+	marks := &mockDryRunStore{}
+	processor := NewEmbeddingProcessor(mockStore, mockService)
+	processor.SetDryRun(marks, true)
+
+	// Marks are kept while dry runs continue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	processor.Start(ctx)
+	if marks.cleared {
+		t.Fatal("Expected dry run marks to be kept during dry runs")
+	}
+
+	if _, err := processor.processBatch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mockService.batchCalls) != 0 {
+		t.Errorf("Expected no embedding requests, got %d", len(mockService.batchCalls))
+	}
+	if len(mockStore.storedDocuments) != 0 {
+		t.Errorf("Expected no chunk documents to be stored, got %d", len(mockStore.storedDocuments))
+	}
+	if fmt.Sprint(marks.marked) != "[doc1 doc3]" {
+		t.Errorf("Expected doc1 and doc3 marked as dry run, got %v", marks.marked)
+	}
+	for _, id := range []string{"doc1", "doc3"} {
+		if _, ok := mockStore.updatedEmbeddings[id]; ok {
+			t.Errorf("Expected no embedding stored for %s in a dry run", id)
+		}
+	}
+	// Too short to embed either way
+	if len(mockStore.updatedEmbeddings["doc2"]) != storage.EmbeddingDimensions {
+		t.Errorf("Expected doc2 to get the usual placeholder")
+	}
+
+	// Starting without dry runs queues the marked documents again
+	processor = NewEmbeddingProcessor(mockStore, mockService)
+	processor.SetDryRun(marks, false)
+	processor.Start(ctx)
+	if !marks.cleared || len(marks.marked) != 0 {
+		t.Errorf("Expected dry run marks to be cleared, got %v", marks.marked)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"héllo wörld", 3}, // Characters, not bytes
+	}
+
+	for _, tc := range testCases {
+		if got := estimateTokens(tc.text); got != tc.expected {
+			t.Errorf("estimateTokens(%q): expected %d, got %d", tc.text, tc.expected, got)
+		}
+	}
+}
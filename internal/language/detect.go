@@ -0,0 +1,132 @@
+// Package language detects the natural language of stored content and queries
+package language
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// English is the code of English, which the default embedding model is
+// trained for
+const English = "en"
+
+// Detection needs at least this many words, and this many stopword hits for
+// the most likely language; shorter text is too ambiguous to call
+const (
+	minWords = 3
+	minHits  = 2
+)
+
+// stopwords are frequent function words of each supported language, by
+// ISO 639-1 code. Words shared between languages count for each of them.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "were", "of", "to", "in", "that", "it", "for", "with", "this",
+		"on", "not", "be", "have", "has", "you", "we", "they", "what", "how", "should", "would", "can",
+		"from", "but", "or", "there", "which", "when", "do", "does"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "un", "una", "es", "por", "para", "con", "no",
+		"se", "del", "al", "lo", "como", "más", "pero", "sus", "le", "ya", "está", "son", "qué", "cómo",
+		"hay", "también", "cuando", "este", "esta", "hemos", "tenemos"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "mit", "auf", "den", "dem", "zu", "von",
+		"für", "sich", "es", "wir", "ich", "sie", "auch", "wie", "noch", "bei", "oder", "nach", "wird",
+		"sind", "haben", "kann", "muss", "dass", "wenn", "aber"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "que", "qui", "dans", "pour", "pas",
+		"sur", "avec", "ne", "ce", "il", "nous", "vous", "sont", "au", "du", "mais", "ou", "par", "plus",
+		"cette", "être", "fait"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "é",
+		"por", "mais", "dos", "das", "no", "na", "se", "mas", "como", "são", "está", "você", "isso",
+		"também"},
+	"it": {"il", "lo", "la", "gli", "le", "di", "che", "e", "è", "un", "una", "per", "con", "non", "sono",
+		"del", "della", "in", "da", "si", "ma", "come", "anche", "questo", "questa", "nel", "alla", "ci",
+		"più"},
+	"nl": {"de", "het", "een", "en", "is", "van", "dat", "niet", "op", "te", "in", "met", "voor", "zijn",
+		"er", "maar", "ook", "als", "aan", "wordt", "bij", "naar", "dit", "wij", "ze", "hebben", "kan",
+		"moet"},
+}
+
+// markers are letters used by only one supported language; each word
+// containing one counts as a hit for that language
+var markers = map[rune]string{
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ã': "pt", 'õ': "pt", 'ç': "pt",
+	'ì': "it", 'ò': "it",
+}
+
+// languagesByWord indexes stopwords by word
+var languagesByWord = func() map[string][]string {
+	index := make(map[string][]string)
+	for code, words := range stopwords {
+		for _, word := range words {
+			index[word] = append(index[word], code)
+		}
+	}
+	return index
+}()
+
+// Codes returns the codes of the languages Detect recognizes, sorted
+func Codes() []string {
+	codes := make([]string, 0, len(stopwords))
+	for code := range stopwords {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Supported reports whether code is a language Detect recognizes
+func Supported(code string) bool {
+	_, ok := stopwords[code]
+	return ok
+}
+
+// Detect returns the ISO 639-1 code of the language text is most likely
+// written in, by counting the stopwords and language-specific letters of
+// each supported language. It returns "" when the text is too short or no
+// language clearly wins, e.g. for code snippets or one-word replies.
+func Detect(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '¿' && r != '¡'
+	})
+	if len(words) < minWords {
+		return ""
+	}
+
+	hits := make(map[string]int)
+	for _, word := range words {
+		for _, code := range languagesByWord[strings.Trim(word, "¿¡")] {
+			hits[code]++
+		}
+		for _, code := range wordMarkers(word) {
+			hits[code]++
+		}
+	}
+
+	best, bestHits, runnerUpHits := "", 0, 0
+	for _, code := range Codes() {
+		switch count := hits[code]; {
+		case count > bestHits:
+			best, bestHits, runnerUpHits = code, count, bestHits
+		case count > runnerUpHits:
+			runnerUpHits = count
+		}
+	}
+
+	if bestHits < minHits || bestHits == runnerUpHits {
+		return ""
+	}
+	return best
+}
+
+// wordMarkers returns the languages whose marker letters a word contains,
+// each once
+func wordMarkers(word string) []string {
+	var codes []string
+	for _, r := range word {
+		if code, ok := markers[r]; ok && !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
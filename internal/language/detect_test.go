@@ -0,0 +1,43 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", "The deploy failed because the migration is still holding a lock on the table", "en"},
+		{"spanish", "¿Cómo reiniciamos el servidor cuando la base de datos no responde?", "es"},
+		{"german", "Der Build ist kaputt, weil die Datenbank nicht erreichbar ist und wir das Passwort ändern müssen", "de"},
+		{"french", "Le déploiement est bloqué parce que la base de données ne répond pas", "fr"},
+		{"portuguese", "Não consegui acessar o servidor, você pode verificar se a configuração está correta?", "pt"},
+		{"italian", "Il server non risponde e la coda dei messaggi è piena, questo è un problema per il rilascio", "it"},
+		{"dutch", "De server is niet bereikbaar en het lijkt erop dat de database ook niet werkt", "nl"},
+		{"slack formatting", "*Heads up:* the `payments` service is down, see <https://status.example.com|status> for updates", "en"},
+		{"too short", "gracias", ""},
+		{"code", "kubectl rollout restart deploy/api -n prod", ""},
+		{"no stopwords", "ERR-4411 checkout timeout retry backoff", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.text); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for _, code := range Codes() {
+		if !Supported(code) {
+			t.Errorf("Expected %q to be supported", code)
+		}
+	}
+	if Supported("xx") || Supported("") {
+		t.Error("Expected unknown codes to be unsupported")
+	}
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// databaseStatsInterval is how often the connection gauge is refreshed
+const databaseStatsInterval = 15 * time.Second
+
+// RecordDatabaseConnections sets the connection gauge to the connections
+// open across dbs, in use or idle
+func RecordDatabaseConnections(dbs ...*sql.DB) {
+	open := 0
+	for _, db := range dbs {
+		open += db.Stats().OpenConnections
+	}
+	DatabaseConnections.Set(float64(open))
+}
+
+// TrackDatabaseConnections refreshes the connection gauge from dbs until ctx
+// is done
+func TrackDatabaseConnections(ctx context.Context, dbs ...*sql.DB) {
+	ticker := time.NewTicker(databaseStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		RecordDatabaseConnections(dbs...)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -91,6 +91,21 @@ var (
 		},
 	)
 
+	AnswerFallbacks = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "knowthis_answer_fallbacks_total",
+			Help: "Total number of queries answered with sources because answer generation failed",
+		},
+	)
+
+	QueryFeedback = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "knowthis_query_feedback_total",
+			Help: "Total number of answer ratings received",
+		},
+		[]string{"rating"},
+	)
+
 	OpenAIChatAPICalls = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "knowthis_openai_chat_api_calls_total",
@@ -107,6 +122,14 @@ var (
 		},
 	)
 
+	EmbeddingCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "knowthis_embedding_cache_requests_total",
+			Help: "Total number of query embedding cache lookups",
+		},
+		[]string{"result"},
+	)
+
 	// OpenAI Embeddings metrics
 	OpenAIEmbeddingAPICalls = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -128,7 +151,7 @@ var (
 	DatabaseConnections = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "knowthis_database_connections",
-			Help: "Number of active database connections",
+			Help: "Number of open database connections, in use or idle",
 		},
 	)
 
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	OpenAITokens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "knowthis_openai_tokens_total",
+			Help: "Total number of OpenAI tokens used",
+		},
+		[]string{"model", "operation", "type"},
+	)
+
+	OpenAIEstimatedCost = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "knowthis_openai_estimated_cost_usd_total",
+			Help: "Estimated OpenAI spend in US dollars, from the configured token prices",
+		},
+		[]string{"model", "operation"},
+	)
+)
+
+// TokenPrice is what a model costs in US dollars per million tokens
+type TokenPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// DefaultTokenPrices are the list prices of the models used by default
+var DefaultTokenPrices = map[string]TokenPrice{
+	"gpt-4o-mini":            {Prompt: 0.15, Completion: 0.60},
+	"gpt-4o":                 {Prompt: 2.50, Completion: 10.00},
+	"text-embedding-ada-002": {Prompt: 0.10},
+	"text-embedding-3-small": {Prompt: 0.02},
+	"text-embedding-3-large": {Prompt: 0.13},
+}
+
+var (
+	tokenPricesMu sync.RWMutex
+	tokenPrices   = DefaultTokenPrices
+)
+
+// SetTokenPrices replaces the price table used to estimate cost. Usage of
+// models without a price is counted in tokens only.
+func SetTokenPrices(prices map[string]TokenPrice) {
+	tokenPricesMu.Lock()
+	defer tokenPricesMu.Unlock()
+	tokenPrices = prices
+}
+
+// RecordTokenUsage counts the tokens of an OpenAI call and its estimated
+// cost. operation tells calls to the same model apart, e.g. "embedding" or
+// "answer".
+func RecordTokenUsage(model, operation string, promptTokens, completionTokens, totalTokens int) {
+	OpenAITokens.WithLabelValues(model, operation, "prompt").Add(float64(promptTokens))
+	OpenAITokens.WithLabelValues(model, operation, "completion").Add(float64(completionTokens))
+	OpenAITokens.WithLabelValues(model, operation, "total").Add(float64(totalTokens))
+
+	tokenPricesMu.RLock()
+	price, ok := tokenPrices[model]
+	tokenPricesMu.RUnlock()
+	if !ok {
+		return
+	}
+
+	cost := (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+	OpenAIEstimatedCost.WithLabelValues(model, operation).Add(cost)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordTokenUsage(t *testing.T) {
+	SetTokenPrices(map[string]TokenPrice{"test-chat": {Prompt: 2, Completion: 8}})
+	t.Cleanup(func() { SetTokenPrices(DefaultTokenPrices) })
+
+	RecordTokenUsage("test-chat", "answer", 1000, 250, 1250)
+	RecordTokenUsage("test-chat", "answer", 500, 0, 500)
+	RecordTokenUsage("unpriced", "answer", 100, 10, 110)
+
+	tokens := map[string]float64{"prompt": 1500, "completion": 250, "total": 1750}
+	for tokenType, expected := range tokens {
+		if got := testutil.ToFloat64(OpenAITokens.WithLabelValues("test-chat", "answer", tokenType)); got != expected {
+			t.Errorf("Expected %v %s tokens, got %v", expected, tokenType, got)
+		}
+	}
+	if got := testutil.ToFloat64(OpenAITokens.WithLabelValues("unpriced", "answer", "total")); got != 110 {
+		t.Errorf("Expected unpriced model tokens to be counted, got %v", got)
+	}
+
+	// 1500 prompt tokens at $2/M and 250 completion tokens at $8/M
+	if got := testutil.ToFloat64(OpenAIEstimatedCost.WithLabelValues("test-chat", "answer")); math.Abs(got-0.005) > 1e-12 {
+		t.Errorf("Expected estimated cost 0.005, got %v", got)
+	}
+	if got := testutil.CollectAndCount(OpenAIEstimatedCost, "knowthis_openai_estimated_cost_usd_total"); got != 1 {
+		t.Errorf("Expected no cost for unpriced models, got %d series", got)
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"knowthis/internal/apierror"
+)
+
+// AdminAuthMiddleware requires a bearer token matching the admin API key.
+// Admin endpoints are disabled entirely when no key is configured.
+func AdminAuthMiddleware(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey == "" {
+				apierror.Respond(w, http.StatusForbidden, apierror.CodeForbidden, "Admin API is disabled")
+				return
+			}
+
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+				apierror.Respond(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIKey is a client's key for the query API. Name identifies the client in
+// logs so the key itself is never logged.
+type APIKey struct {
+	Name string
+	Key  string
+}
+
+// ParseAPIKeys parses "name:key" entries, or bare keys, which are named by a
+// short hash of the key
+func ParseAPIKeys(entries []string) ([]APIKey, error) {
+	var keys []APIKey
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		name, key, named := strings.Cut(entry, ":")
+		if !named {
+			key = entry
+			sum := sha256.Sum256([]byte(key))
+			name = "key-" + hex.EncodeToString(sum[:4])
+		}
+
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if name == "" || key == "" {
+			return nil, fmt.Errorf("API key entry must be name:key or a key, got %q", entry)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate API key name %q", name)
+		}
+		names[name] = true
+		keys = append(keys, APIKey{Name: name, Key: key})
+	}
+	return keys, nil
+}
+
+type apiKeyNameKey struct{}
+
+// APIKeyName returns the name of the API key a request was authenticated
+// with, or "" if it wasn't
+func APIKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameKey{}).(string)
+	return name
+}
+
+// APIKeyAuthMiddleware requires a bearer token matching one of the keys and
+// adds the key's name to the request context and log line. With no keys
+// configured requests pass through unauthenticated.
+func APIKeyAuthMiddleware(keys []APIKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(keys) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				apierror.Respond(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Missing API key")
+				return
+			}
+
+			// Compare against every key so timing doesn't reveal which matched
+			name := ""
+			for _, key := range keys {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(key.Key)) == 1 {
+					name = key.Name
+				}
+			}
+			if name == "" {
+				slog.Warn("Rejected request with an invalid API key", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				apierror.Respond(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid API key")
+				return
+			}
+
+			addRequestLogAttr(r.Context(), slog.String("api_key", name))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyNameKey{}, name)))
+		})
+	}
+}
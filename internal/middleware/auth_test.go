@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"knowthis/internal/apierror"
+)
+
+func TestAPIKeyAuthMiddleware(t *testing.T) {
+	keys := []APIKey{
+		{Name: "search-ui", Key: "sk_search_ui"},
+		{Name: "oncall-bot", Key: "sk_oncall_bot"},
+	}
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedKey    string
+	}{
+		{"first key", "Bearer sk_search_ui", http.StatusOK, "search-ui"},
+		{"second key", "Bearer sk_oncall_bot", http.StatusOK, "oncall-bot"},
+		{"missing header", "", http.StatusUnauthorized, ""},
+		{"empty token", "Bearer ", http.StatusUnauthorized, ""},
+		{"not a bearer token", "Basic c2tfc2VhcmNoX3Vp", http.StatusUnauthorized, ""},
+		{"invalid key", "Bearer sk_revoked", http.StatusUnauthorized, ""},
+		{"prefix of a key", "Bearer sk_search", http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var keyName string
+			called := false
+			handler := APIKeyAuthMiddleware(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				keyName = APIKeyName(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/query", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus == http.StatusOK {
+				if keyName != tc.expectedKey {
+					t.Errorf("Expected the request identified as %q, got %q", tc.expectedKey, keyName)
+				}
+				return
+			}
+
+			if called {
+				t.Error("Expected the handler not to be called")
+			}
+			if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("Expected a Bearer challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+			}
+			var response apierror.Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Error.Code != apierror.CodeUnauthorized {
+				t.Errorf("Expected an unauthorized error, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthMiddleware_DisabledWithoutKeys(t *testing.T) {
+	called := false
+	handler := APIKeyAuthMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/query", nil))
+	if !called || rec.Code != http.StatusOK {
+		t.Errorf("Expected requests to pass without keys configured, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeyAuthMiddleware_LogsKeyName(t *testing.T) {
+	var logs strings.Builder
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	handler := LoggingMiddleware(APIKeyAuthMiddleware([]APIKey{{Name: "search-ui", Key: "sk_search_ui"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	req := httptest.NewRequest(http.MethodPost, "/api/query", nil)
+	req.Header.Set("Authorization", "Bearer sk_search_ui")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logs.String(), `"api_key":"search-ui"`) {
+		t.Errorf("Expected the request log to name the key, got %s", logs.String())
+	}
+	if strings.Contains(logs.String(), "sk_search_ui") {
+		t.Error("Expected the key itself never to be logged")
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys([]string{"search-ui:sk_search_ui", "sk_bare_key"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != (APIKey{Name: "search-ui", Key: "sk_search_ui"}) {
+		t.Fatalf("Unexpected keys: %+v", keys)
+	}
+	if keys[1].Key != "sk_bare_key" || !strings.HasPrefix(keys[1].Name, "key-") || strings.Contains(keys[1].Name, "sk_bare_key") {
+		t.Errorf("Expected a bare key named by its hash, got %+v", keys[1])
+	}
+
+	for _, entries := range [][]string{{":sk_no_name"}, {"no-key:"}, {"dup:one", "dup:two"}} {
+		if _, err := ParseAPIKeys(entries); err == nil {
+			t.Errorf("Expected an error for %q", entries)
+		}
+	}
+}
+
+func TestAPIKeyName_Unauthenticated(t *testing.T) {
+	if name := APIKeyName(context.Background()); name != "" {
+		t.Errorf("Expected no key name, got %q", name)
+	}
+}
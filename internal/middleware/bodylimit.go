@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"knowthis/internal/apierror"
+)
+
+// BodyLimitMiddleware rejects request bodies larger than maxBytes with 413.
+// A body declared larger by Content-Length is refused before it is read;
+// otherwise reads fail once maxBytes have been read, so handlers and
+// signature checks never buffer more than the limit.
+func BodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeBodyTooLarge(w, r, maxBytes)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readRequestBody reads the whole body for signature verification. On
+// failure it responds with 413 if the body exceeded BodyLimitMiddleware's
+// limit, or 400 otherwise, and returns false.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		return body, true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeBodyTooLarge(w, r, tooLarge.Limit)
+		return nil, false
+	}
+
+	apierror.Respond(w, http.StatusBadRequest, apierror.CodeInvalidPayload, "Failed to read request body")
+	return nil, false
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	slog.Warn("Rejected oversized request body", "path", r.URL.Path, "content_length", r.ContentLength, "max_bytes", maxBytes)
+	apierror.Respond(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Request body too large")
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"knowthis/internal/apierror"
+)
+
+// ConcurrencyLimitMiddleware bounds how many requests are processed at once.
+// Requests beyond the limit are shed immediately with 429 and a Retry-After
+// header, so webhook providers retry later instead of piling up on the
+// database. A handler that acks and finishes in the background keeps its slot
+// until that work is done by calling HoldConcurrencySlot. A limit of 0 or
+// less disables it.
+func ConcurrencyLimitMiddleware(maxConcurrent int, retryAfter time.Duration) func(http.Handler) http.Handler {
+	if maxConcurrent <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	slots := make(chan struct{}, maxConcurrent)
+	retryAfterSeconds := strconv.Itoa(max(1, int(retryAfter.Round(time.Second)/time.Second)))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				slog.Warn("Shedding request over concurrency limit", "path", r.URL.Path, "max_concurrent", maxConcurrent)
+				w.Header().Set("Retry-After", retryAfterSeconds)
+				apierror.Respond(w, http.StatusTooManyRequests, apierror.CodeOverloaded, "Too many concurrent requests")
+				return
+			}
+
+			// The request holds the slot until it returns and any background
+			// work it started finishes
+			slot := &concurrencySlot{holds: 1, release: func() { <-slots }}
+			defer slot.done()
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), concurrencySlotKey{}, slot)))
+		})
+	}
+}
+
+type concurrencySlotKey struct{}
+
+// concurrencySlot is a request's concurrency slot, released once the request
+// and every background task holding it are done
+type concurrencySlot struct {
+	mu      sync.Mutex
+	holds   int
+	release func()
+}
+
+func (s *concurrencySlot) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holds--
+	if s.holds == 0 {
+		s.release()
+	}
+}
+
+// HoldConcurrencySlot keeps the request's concurrency slot taken past the
+// handler's return, until the returned func is called. Call it before the
+// handler returns, and call the func when the background work it starts is
+// done. Outside ConcurrencyLimitMiddleware it does nothing.
+func HoldConcurrencySlot(ctx context.Context) func() {
+	slot, ok := ctx.Value(concurrencySlotKey{}).(*concurrencySlot)
+	if !ok {
+		return func() {}
+	}
+
+	slot.mu.Lock()
+	slot.holds++
+	slot.mu.Unlock()
+	return sync.OnceFunc(slot.done)
+}
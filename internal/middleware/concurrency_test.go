@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimit_ShedsExcess(t *testing.T) {
+	const maxConcurrent = 3
+	const requests = 10
+
+	release := make(chan struct{})
+	var active, peak atomic.Int32
+	handler := ConcurrencyLimitMiddleware(maxConcurrent, 5*time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		active.Add(-1)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var wg sync.WaitGroup
+	codes := make(chan *httptest.ResponseRecorder, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/slack/actions", nil))
+			codes <- rec
+		}()
+	}
+
+	// Shed requests return right away; the admitted ones hold their slots
+	deadline := time.After(5 * time.Second)
+	shed := 0
+	for shed < requests-maxConcurrent {
+		select {
+		case rec := <-codes:
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected excess request to get 429, got %d", rec.Code)
+			}
+			if rec.Header().Get("Retry-After") != "5" {
+				t.Errorf("Expected Retry-After: 5, got %q", rec.Header().Get("Retry-After"))
+			}
+			shed++
+		case <-deadline:
+			t.Fatalf("Timed out waiting for excess requests to be shed, got %d", shed)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	for rec := range codes {
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected admitted request to succeed, got %d", rec.Code)
+		}
+	}
+	if peak.Load() > maxConcurrent {
+		t.Errorf("Expected at most %d concurrent requests, got %d", maxConcurrent, peak.Load())
+	}
+
+	// Slots are released once requests finish
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/slack/actions", nil))
+	if rec.Code == http.StatusTooManyRequests {
+		t.Errorf("Expected a request after the burst to be admitted")
+	}
+}
+
+func TestConcurrencyLimit_HoldsSlotForBackgroundWork(t *testing.T) {
+	const maxConcurrent = 2
+
+	finish := make(chan struct{})
+	var background sync.WaitGroup
+	var active, peak atomic.Int32
+	handler := ConcurrencyLimitMiddleware(maxConcurrent, time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ack right away and collect in the background, like the Slack,
+		// Discord and Teams handlers
+		release := HoldConcurrencySlot(r.Context())
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			defer release()
+			n := active.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			<-finish
+			active.Add(-1)
+		}()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/slack/actions", nil))
+		return rec.Code
+	}
+
+	for i := 0; i < maxConcurrent; i++ {
+		if code := send(); code != http.StatusOK {
+			t.Fatalf("Expected request %d to be acked, got %d", i+1, code)
+		}
+	}
+
+	// Every slot is held by background work though the handlers returned
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a request over the limit to get 429 while work runs, got %d", code)
+	}
+
+	close(finish)
+	background.Wait()
+	if peak.Load() > maxConcurrent {
+		t.Errorf("Expected at most %d background tasks at once, got %d", maxConcurrent, peak.Load())
+	}
+	if code := send(); code != http.StatusOK {
+		t.Errorf("Expected a request to be admitted once background work finished, got %d", code)
+	}
+	background.Wait()
+}
+
+func TestHoldConcurrencySlot_NoopWithoutLimit(t *testing.T) {
+	release := HoldConcurrencySlot(httptest.NewRequest(http.MethodPost, "/slack/actions", nil).Context())
+	release()
+	release()
+}
+
+func TestConcurrencyLimit_DisabledWhenZero(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := ConcurrencyLimitMiddleware(0, time.Second)(next)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/slack/actions", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected requests to pass without a limit, got %d", rec.Code)
+	}
+}
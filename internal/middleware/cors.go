@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"knowthis/internal/apierror"
+)
+
+// CORSOptions configures which browser origins may call an API
+type CORSOptions struct {
+	// Origins allowed to make requests, e.g. https://search.example.com;
+	// "*" allows any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// Let the browser send cookies and Authorization headers; never combined
+	// with "*", which browsers reject
+	AllowCredentials bool
+	// How long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORSMiddleware answers CORS preflight requests and adds CORS headers to
+// requests from allowed origins. Requests from other origins are rejected
+// with 403; requests without an Origin header (not from a browser) pass
+// through unchanged.
+func CORSMiddleware(opts CORSOptions) func(http.Handler) http.Handler {
+	anyOrigin := false
+	origins := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	methods := make(map[string]bool, len(opts.AllowedMethods))
+	for _, method := range opts.AllowedMethods {
+		methods[strings.ToUpper(method)] = true
+	}
+	headers := make(map[string]bool, len(opts.AllowedHeaders))
+	for _, header := range opts.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	allowMethods := strings.Join(opts.AllowedMethods, ", ")
+	allowHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The response depends on the origin, so caches must key on it
+			w.Header().Add("Vary", "Origin")
+
+			if !anyOrigin && !origins[strings.ToLower(origin)] {
+				slog.Warn("Rejected cross-origin request", "origin", origin, "path", r.URL.Path)
+				apierror.Respond(w, http.StatusForbidden, apierror.CodeForbidden, "Origin not allowed")
+				return
+			}
+
+			if anyOrigin && !opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			requestedMethod := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || requestedMethod == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Preflight: answer here without calling the handler
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			if !methods[strings.ToUpper(requestedMethod)] {
+				apierror.Respond(w, http.StatusForbidden, apierror.CodeForbidden, "Method not allowed for cross-origin requests")
+				return
+			}
+			for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				if header = strings.TrimSpace(header); header != "" && !headers[http.CanonicalHeaderKey(header)] {
+					apierror.Respond(w, http.StatusForbidden, apierror.CodeForbidden, "Header not allowed for cross-origin requests: "+header)
+					return
+				}
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"knowthis/internal/apierror"
+)
+
+func newCORSTestHandler(opts CORSOptions) (http.Handler, *int) {
+	calls := 0
+	return CORSMiddleware(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})), &calls
+}
+
+var searchUICORS = CORSOptions{
+	AllowedOrigins: []string{"https://search.example.com"},
+	AllowedMethods: []string{"GET", "POST"},
+	AllowedHeaders: []string{"Content-Type", "Authorization"},
+	MaxAge:         10 * time.Minute,
+}
+
+func TestCORSMiddleware_AllowedOrigin(t *testing.T) {
+	handler, calls := newCORSTestHandler(searchUICORS)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/query", nil)
+	req.Header.Set("Origin", "https://search.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || *calls != 1 {
+		t.Fatalf("Expected the request to reach the handler, got %d after %d calls", rec.Code, *calls)
+	}
+	if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "https://search.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", origin)
+	}
+	if rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", rec.Header().Get("Vary"))
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Expected no credentials header unless enabled")
+	}
+}
+
+func TestCORSMiddleware_DisallowedOrigin(t *testing.T) {
+	handler, calls := newCORSTestHandler(searchUICORS)
+
+	for _, method := range []string{http.MethodPost, http.MethodOptions} {
+		req := httptest.NewRequest(method, "/api/query", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", method, rec.Code)
+		}
+		var response apierror.Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Error.Code != apierror.CodeForbidden {
+			t.Errorf("%s: expected a forbidden error, got %s", method, rec.Body.String())
+		}
+		if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected no CORS headers for a disallowed origin", method)
+		}
+	}
+	if *calls != 0 {
+		t.Errorf("Expected disallowed origins not to reach the handler, got %d calls", *calls)
+	}
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		headers        string
+		expectedStatus int
+	}{
+		{"allowed", "POST", "content-type, authorization", http.StatusNoContent},
+		{"no extra headers", "GET", "", http.StatusNoContent},
+		{"method not allowed", "DELETE", "", http.StatusForbidden},
+		{"header not allowed", "POST", "X-Debug", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, calls := newCORSTestHandler(searchUICORS)
+
+			req := httptest.NewRequest(http.MethodOptions, "/api/query", nil)
+			req.Header.Set("Origin", "https://search.example.com")
+			req.Header.Set("Access-Control-Request-Method", tc.method)
+			if tc.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tc.headers)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if *calls != 0 {
+				t.Error("Expected the preflight to be answered without calling the handler")
+			}
+			if tc.expectedStatus != http.StatusNoContent {
+				return
+			}
+			if rec.Header().Get("Access-Control-Allow-Methods") != "GET, POST" ||
+				rec.Header().Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+				rec.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Unexpected preflight headers: %v", rec.Header())
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_AnyOrigin(t *testing.T) {
+	testCases := []struct {
+		name           string
+		credentials    bool
+		expectedOrigin string
+	}{
+		{"without credentials", false, "*"},
+		// Browsers reject "*" with credentials, so the origin is echoed
+		{"with credentials", true, "https://tools.example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := searchUICORS
+			opts.AllowedOrigins = []string{"*"}
+			opts.AllowCredentials = tc.credentials
+			handler, _ := newCORSTestHandler(opts)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+			req.Header.Set("Origin", "https://tools.example.com")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != tc.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tc.expectedOrigin, origin)
+			}
+			if credentials := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; credentials != tc.credentials {
+				t.Errorf("Expected credentials allowed: %t", tc.credentials)
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_NoOrigin(t *testing.T) {
+	handler, calls := newCORSTestHandler(searchUICORS)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/query", nil))
+
+	if rec.Code != http.StatusOK || *calls != 1 {
+		t.Errorf("Expected requests without an Origin to pass through, got %d", rec.Code)
+	}
+	if len(rec.Header()) != 0 {
+		t.Errorf("Expected no CORS headers, got %v", rec.Header())
+	}
+}
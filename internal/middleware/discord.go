@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"knowthis/internal/apierror"
+)
+
+// DiscordSignatureMiddleware rejects interaction requests without a valid
+// Ed25519 signature for the application's hex-encoded public key. Discord
+// probes the endpoint with invalid signatures and expects them rejected.
+// Requests are rejected outright when no public key is configured.
+func DiscordSignatureMiddleware(publicKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := readRequestBody(w, r)
+			if !ok {
+				return
+			}
+
+			signature := r.Header.Get("X-Signature-Ed25519")
+			timestamp := r.Header.Get("X-Signature-Timestamp")
+			if err := VerifyDiscordRequest(publicKey, signature, timestamp, body); err != nil {
+				slog.Warn("Rejected Discord request", "error", err, "path", r.URL.Path)
+				apierror.Respond(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// VerifyDiscordRequest checks a Discord interaction's hex-encoded Ed25519
+// signature over the timestamp and body
+func VerifyDiscordRequest(publicKey, signature, timestamp string, body []byte) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("no valid public key configured")
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature encoding")
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), append([]byte(timestamp), body...), sig) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiscordSignatureMiddleware(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	body := `{"type": 1}`
+	timestamp := "1700000000"
+	sign := func(key ed25519.PrivateKey, timestamp, body string) string {
+		return hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body)))
+	}
+
+	testCases := []struct {
+		name           string
+		publicKey      string
+		timestamp      string
+		signature      string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature",
+			publicKey:      hex.EncodeToString(publicKey),
+			timestamp:      timestamp,
+			signature:      sign(privateKey, timestamp, body),
+			body:           body,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "tampered body",
+			publicKey:      hex.EncodeToString(publicKey),
+			timestamp:      timestamp,
+			signature:      sign(privateKey, timestamp, body),
+			body:           `{"type": 2}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "different timestamp",
+			publicKey:      hex.EncodeToString(publicKey),
+			timestamp:      "1700000001",
+			signature:      sign(privateKey, timestamp, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong key",
+			publicKey:      hex.EncodeToString(publicKey),
+			timestamp:      timestamp,
+			signature:      sign(otherKey, timestamp, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing headers",
+			publicKey:      hex.EncodeToString(publicKey),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no public key configured",
+			timestamp:      timestamp,
+			signature:      sign(privateKey, timestamp, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			handler := DiscordSignatureMiddleware(tc.publicKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				received = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(tc.body))
+			if tc.timestamp != "" {
+				req.Header.Set("X-Signature-Timestamp", tc.timestamp)
+			}
+			if tc.signature != "" {
+				req.Header.Set("X-Signature-Ed25519", tc.signature)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus == http.StatusOK && received != tc.body {
+				t.Errorf("Expected handler to receive the original body, got %q", received)
+			}
+			if tc.expectedStatus != http.StatusOK && received != "" {
+				t.Errorf("Expected handler not to run for a rejected request")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"time"
@@ -25,11 +26,12 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		// Add request ID to headers
 		rw.Header().Set("X-Request-ID", requestID)
 		
-		// Call the next handler
-		next.ServeHTTP(rw, r)
+		// Call the next handler, letting inner middleware add to the log line
+		extra := &requestLogAttrs{}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, extra)))
 		
 		// Log the request
-		slog.Info("HTTP Request",
+		attrs := []any{
 			slog.String("request_id", requestID),
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
@@ -37,10 +39,28 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			slog.String("user_agent", r.UserAgent()),
 			slog.Int("status_code", rw.statusCode),
 			slog.Duration("duration", time.Since(start)),
-		)
+		}
+		for _, attr := range extra.attrs {
+			attrs = append(attrs, attr)
+		}
+		slog.Info("HTTP Request", attrs...)
 	})
 }
 
+type requestLogKey struct{}
+
+// requestLogAttrs collects attributes for a request's log line
+type requestLogAttrs struct {
+	attrs []slog.Attr
+}
+
+// addRequestLogAttr adds attr to the request's log line, if it is logged
+func addRequestLogAttr(ctx context.Context, attr slog.Attr) {
+	if extra, ok := ctx.Value(requestLogKey{}).(*requestLogAttrs); ok {
+		extra.attrs = append(extra.attrs, attr)
+	}
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -49,4 +69,9 @@ type responseWriter struct {
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
-}
\ No newline at end of file
+}
+// Unwrap returns the underlying writer, so http.ResponseController can reach
+// its Flush and deadline methods
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
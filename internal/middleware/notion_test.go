@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotionSignatureMiddleware(t *testing.T) {
+	secret := "secret_verification_token"
+	body := `{"type": "page.created", "entity": {"id": "page-1", "type": "page"}}`
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	verification := `{"verification_token": "secret_new"}`
+
+	testCases := []struct {
+		name           string
+		secret         string
+		signature      string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature",
+			secret:         secret,
+			signature:      sign(secret, body),
+			body:           body,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "tampered body",
+			secret:         secret,
+			signature:      sign(secret, body),
+			body:           `{"type": "page.deleted"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong secret",
+			secret:         secret,
+			signature:      sign("other", body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing signature",
+			secret:         secret,
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unsigned event without a secret",
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "verification request without a secret",
+			body:           verification,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsigned verification request once a secret is set",
+			secret:         secret,
+			body:           verification,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			handler := NotionSignatureMiddleware(tc.secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				received = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook/notion", strings.NewReader(tc.body))
+			if tc.signature != "" {
+				req.Header.Set("X-Notion-Signature", tc.signature)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus == http.StatusOK && received != tc.body {
+				t.Errorf("Expected handler to receive the original body, got %q", received)
+			}
+			if tc.expectedStatus != http.StatusOK && received != "" {
+				t.Errorf("Expected handler not to run for a rejected request")
+			}
+		})
+	}
+}
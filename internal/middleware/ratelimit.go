@@ -1,99 +1,211 @@
 package middleware
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"knowthis/internal/apierror"
+
 	"golang.org/x/time/rate"
 )
 
 // RateLimitMiddleware implements rate limiting using token bucket algorithm
 func RateLimitMiddleware(requestsPerSecond float64, burstSize int) func(http.Handler) http.Handler {
 	limiter := rate.NewLimiter(rate.Limit(requestsPerSecond), burstSize)
-	
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !limiter.Allow() {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte(`{"error": "Rate limit exceeded"}`))
+				apierror.Respond(w, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limit exceeded")
 				return
 			}
-			
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// PerIPRateLimitMiddleware implements per-IP rate limiting
-func PerIPRateLimitMiddleware(requestsPerSecond float64, burstSize int) func(http.Handler) http.Handler {
-	limiters := make(map[string]*rate.Limiter)
-	
+// ipLimiter is a client's rate limiter and when the client was last seen
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiters holds the per-IP rate limiters, safe for concurrent use
+type ipLimiters struct {
+	mu                sync.Mutex
+	entries           map[string]*ipLimiter
+	requestsPerSecond float64
+	burstSize         int
+}
+
+func newIPLimiters(requestsPerSecond float64, burstSize int) *ipLimiters {
+	return &ipLimiters{
+		entries:           make(map[string]*ipLimiter),
+		requestsPerSecond: requestsPerSecond,
+		burstSize:         burstSize,
+	}
+}
+
+// get returns the limiter for the IP, creating it if needed, and marks the IP as seen
+func (l *ipLimiters) get(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, exists := l.entries[ip]
+	if !exists {
+		entry = &ipLimiter{limiter: rate.NewLimiter(rate.Limit(l.requestsPerSecond), l.burstSize)}
+		l.entries[ip] = entry
+	}
+	entry.lastSeen = now
+
+	return entry.limiter
+}
+
+// evictIdle removes limiters for IPs not seen within the TTL and returns how many were removed
+func (l *ipLimiters) evictIdle(ttl time.Duration, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := 0
+	for ip, entry := range l.entries {
+		if now.Sub(entry.lastSeen) > ttl {
+			delete(l.entries, ip)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// PerIPRateLimitMiddleware implements per-IP rate limiting. Limiters for IPs
+// idle longer than idleTTL are evicted by a background goroutine. Clients in
+// a bypass network are never limited.
+func PerIPRateLimitMiddleware(requestsPerSecond float64, burstSize int, idleTTL time.Duration, bypass []*net.IPNet) func(http.Handler) http.Handler {
+	limiters := newIPLimiters(requestsPerSecond, burstSize)
+	go cleanupRateLimiters(limiters, idleTTL)
+
+	return perIPRateLimit(limiters, bypass)
+}
+
+func perIPRateLimit(limiters *ipLimiters, bypass []*net.IPNet) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get client IP
 			clientIP := getClientIP(r)
-			
-			// Get or create limiter for this IP
-			limiter, exists := limiters[clientIP]
-			if !exists {
-				limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burstSize)
-				limiters[clientIP] = limiter
+
+			if bypassesRateLimit(clientIP, bypass) {
+				next.ServeHTTP(w, r)
+				return
 			}
-			
-			if !limiter.Allow() {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte(`{"error": "Rate limit exceeded"}`))
+
+			if !limiters.get(clientIP, time.Now()).Allow() {
+				apierror.Respond(w, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limit exceeded")
 				return
 			}
-			
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// getClientIP extracts the client IP from the request
+// unknownClientIP is the limiter key shared by requests without a parseable
+// client IP, so malformed addresses can't each create their own limiter
+const unknownClientIP = "unknown"
+
+// getClientIP extracts the client IP from the request: the first address in
+// X-Forwarded-For, then X-Real-IP, then RemoteAddr, using the first that parses
 func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded
+	// The client is the first entry; proxies append their own addresses after it
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if ip := parseIP(first); ip != "" {
+			return ip
+		}
 	}
-	
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+
+	if ip := parseIP(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
 	}
-	
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+
+	if ip := parseIP(r.RemoteAddr); ip != "" {
+		return ip
+	}
+
+	return unknownClientIP
 }
 
-// APIRateLimitMiddleware applies stricter rate limiting to API endpoints
-func APIRateLimitMiddleware() func(http.Handler) http.Handler {
-	return PerIPRateLimitMiddleware(10, 20) // 10 requests per second, burst of 20
+// parseIP returns the canonical form of an address with or without a port,
+// or "" if it isn't a valid IP
+func parseIP(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
 }
 
-// WebhookRateLimitMiddleware applies rate limiting to webhook endpoints
-func WebhookRateLimitMiddleware() func(http.Handler) http.Handler {
-	return PerIPRateLimitMiddleware(100, 200) // 100 requests per second, burst of 200
+// ParseIPNets parses IPs and CIDRs into networks; a bare IP matches only itself
+func ParseIPNets(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
 }
 
-// CleanupRateLimiters periodically cleans up old rate limiters to prevent memory leaks
-func CleanupRateLimiters(limiters map[string]*rate.Limiter, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-	
-	for range ticker.C {
-		// Simple cleanup - remove limiters that haven't been used recently
-		// In production, you'd want more sophisticated cleanup logic
-		for ip, limiter := range limiters {
-			// If limiter has full tokens, it hasn't been used recently
-			if limiter.Tokens() == float64(limiter.Burst()) {
-				delete(limiters, ip)
-			}
+// bypassesRateLimit reports whether the client IP is in one of the bypass networks
+func bypassesRateLimit(clientIP string, bypass []*net.IPNet) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range bypass {
+		if network.Contains(ip) {
+			return true
 		}
 	}
-}
\ No newline at end of file
+	return false
+}
+
+// APIRateLimitMiddleware applies the (stricter) API rate limit per client IP
+func APIRateLimitMiddleware(requestsPerSecond float64, burstSize int, idleTTL time.Duration, bypass []*net.IPNet) func(http.Handler) http.Handler {
+	return PerIPRateLimitMiddleware(requestsPerSecond, burstSize, idleTTL, bypass)
+}
+
+// WebhookRateLimitMiddleware applies the webhook rate limit per client IP
+func WebhookRateLimitMiddleware(requestsPerSecond float64, burstSize int, idleTTL time.Duration, bypass []*net.IPNet) func(http.Handler) http.Handler {
+	return PerIPRateLimitMiddleware(requestsPerSecond, burstSize, idleTTL, bypass)
+}
+
+// cleanupRateLimiters periodically evicts limiters idle longer than the TTL to
+// bound memory. It runs for the life of the process, like the middleware.
+func cleanupRateLimiters(limiters *ipLimiters, idleTTL time.Duration) {
+	ticker := time.NewTicker(idleTTL)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		limiters.evictIdle(idleTTL, now)
+	}
+}
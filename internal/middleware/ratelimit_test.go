@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"knowthis/internal/apierror"
+)
+
+func TestPerIPRateLimit_ConcurrentDistinctIPs(t *testing.T) {
+	limiters := newIPLimiters(10, 20)
+	handler := perIPRateLimit(limiters, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	const clients = 200
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				req := httptest.NewRequest(http.MethodGet, "/api/query", nil)
+				req.RemoteAddr = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Errorf("Expected request within burst to pass, got %d", rec.Code)
+				}
+			}
+		}(i)
+	}
+
+	// Evict concurrently with requests, as the background cleanup would
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			limiters.evictIdle(time.Hour, time.Now())
+		}
+	}()
+
+	wg.Wait()
+
+	if len(limiters.entries) != clients {
+		t.Errorf("Expected %d tracked IPs, got %d", clients, len(limiters.entries))
+	}
+}
+
+func TestPerIPRateLimit_Bypass(t *testing.T) {
+	bypass, err := ParseIPNets([]string{"10.1.0.0/16", "192.0.2.10"})
+	if err != nil {
+		t.Fatalf("Failed to parse bypass list: %v", err)
+	}
+	handler := perIPRateLimit(newIPLimiters(1, 2), bypass)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/slack/actions", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, addr := range []string{"10.1.2.3:443", "192.0.2.10:443"} {
+		for i := 0; i < 10; i++ {
+			if code := send(addr); code != http.StatusOK {
+				t.Fatalf("Expected allowlisted %s to bypass the limiter, got %d on request %d", addr, code, i+1)
+			}
+		}
+	}
+
+	limited := false
+	for i := 0; i < 10; i++ {
+		if send("192.0.2.11:443") == http.StatusTooManyRequests {
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		t.Errorf("Expected a non-allowlisted IP to be rate limited")
+	}
+}
+
+func TestParseIPNets_Invalid(t *testing.T) {
+	if _, err := ParseIPNets([]string{"10.0.0.0/8", "not-an-ip"}); err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+}
+
+func TestIPLimiters_EvictIdle(t *testing.T) {
+	limiters := newIPLimiters(10, 20)
+	start := time.Now()
+
+	limiters.get("10.0.0.1", start)
+	limiters.get("10.0.0.2", start.Add(8*time.Minute))
+
+	evicted := limiters.evictIdle(5*time.Minute, start.Add(10*time.Minute))
+	if evicted != 1 {
+		t.Errorf("Expected 1 evicted limiter, got %d", evicted)
+	}
+	if _, ok := limiters.entries["10.0.0.1"]; ok {
+		t.Errorf("Expected idle IP to be evicted")
+	}
+	if _, ok := limiters.entries["10.0.0.2"]; !ok {
+		t.Errorf("Expected recently seen IP to be kept")
+	}
+}
+
+func TestIPLimiters_ReusesLimiterAndRefreshesLastSeen(t *testing.T) {
+	limiters := newIPLimiters(10, 20)
+	start := time.Now()
+
+	first := limiters.get("10.0.0.1", start)
+	second := limiters.get("10.0.0.1", start.Add(4*time.Minute))
+	if first != second {
+		t.Errorf("Expected the same limiter for repeat requests from an IP")
+	}
+
+	if evicted := limiters.evictIdle(5*time.Minute, start.Add(6*time.Minute)); evicted != 0 {
+		t.Errorf("Expected refreshed IP to be kept, evicted %d", evicted)
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	testCases := []struct {
+		name       string
+		forwarded  string
+		realIP     string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "remote addr with port", remoteAddr: "192.0.2.1:54321", expected: "192.0.2.1"},
+		{name: "single forwarded IP", forwarded: "203.0.113.7", remoteAddr: "10.0.0.1:80", expected: "203.0.113.7"},
+		{name: "multiple forwarded IPs", forwarded: " 203.0.113.7 , 10.0.0.2, 10.0.0.3", remoteAddr: "10.0.0.1:80", expected: "203.0.113.7"},
+		{name: "IPv6 forwarded", forwarded: "2001:db8::1, 10.0.0.2", expected: "2001:db8::1"},
+		{name: "IPv6 remote addr", remoteAddr: "[2001:db8:0:0::2]:443", expected: "2001:db8::2"},
+		{name: "real IP header", realIP: "198.51.100.4", remoteAddr: "10.0.0.1:80", expected: "198.51.100.4"},
+		{name: "malformed forwarded falls back to remote addr", forwarded: "not-an-ip, 10.0.0.2", remoteAddr: "192.0.2.1:54321", expected: "192.0.2.1"},
+		{name: "nothing parseable", forwarded: "garbage", realIP: "also garbage", remoteAddr: "pipe", expected: unknownClientIP},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/query", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			if tc.realIP != "" {
+				req.Header.Set("X-Real-IP", tc.realIP)
+			}
+
+			if ip := getClientIP(req); ip != tc.expected {
+				t.Errorf("getClientIP() = %q, want %q", ip, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewares_UseConfiguredLimits(t *testing.T) {
+	testCases := []struct {
+		name       string
+		middleware func(requestsPerSecond float64, burstSize int, idleTTL time.Duration, bypass []*net.IPNet) func(http.Handler) http.Handler
+		burst      int
+	}{
+		{"api", APIRateLimitMiddleware, 3},
+		{"webhook", WebhookRateLimitMiddleware, 5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A negligible refill rate leaves exactly the burst available
+			handler := tc.middleware(0.001, tc.burst, time.Hour, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			request := func(ip string) int {
+				req := httptest.NewRequest(http.MethodPost, "/", nil)
+				req.RemoteAddr = ip + ":1234"
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec.Code
+			}
+
+			for i := 0; i < tc.burst; i++ {
+				if code := request("192.0.2.1"); code != http.StatusOK {
+					t.Fatalf("Expected request %d within the burst of %d to pass, got %d", i+1, tc.burst, code)
+				}
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusTooManyRequests {
+				t.Errorf("Expected 429 after the burst of %d, got %d", tc.burst, rec.Code)
+			}
+			var response apierror.Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Error.Code != apierror.CodeRateLimited {
+				t.Errorf("Expected a rate_limited error, got %s", rec.Body.String())
+			}
+			if code := request("192.0.2.2"); code != http.StatusOK {
+				t.Errorf("Expected another client to have its own burst, got %d", code)
+			}
+		})
+	}
+}
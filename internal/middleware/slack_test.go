@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSlackSecret = "test-signing-secret"
+
+func signSlackRequest(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSlackSignatureMiddleware(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := "payload=%7B%22type%22%3A%22message_action%22%7D"
+	fresh := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+
+	testCases := []struct {
+		name           string
+		secret         string
+		timestamp      string
+		signature      string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature",
+			secret:         testSlackSecret,
+			timestamp:      fresh,
+			signature:      signSlackRequest(testSlackSecret, fresh, body),
+			body:           body,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "tampered body",
+			secret:         testSlackSecret,
+			timestamp:      fresh,
+			signature:      signSlackRequest(testSlackSecret, fresh, body),
+			body:           body + "&extra=1",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong secret",
+			secret:         testSlackSecret,
+			timestamp:      fresh,
+			signature:      signSlackRequest("other-secret", fresh, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired timestamp",
+			secret:         testSlackSecret,
+			timestamp:      stale,
+			signature:      signSlackRequest(testSlackSecret, stale, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing headers",
+			secret:         testSlackSecret,
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no secret configured",
+			secret:         "",
+			timestamp:      fresh,
+			signature:      signSlackRequest("", fresh, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			handler := slackSignature(tc.secret, func() time.Time { return now })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				received = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/slack/actions", strings.NewReader(tc.body))
+			if tc.timestamp != "" {
+				req.Header.Set("X-Slack-Request-Timestamp", tc.timestamp)
+			}
+			if tc.signature != "" {
+				req.Header.Set("X-Slack-Signature", tc.signature)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus == http.StatusOK && received != tc.body {
+				t.Errorf("Expected handler to receive the original body, got %q", received)
+			}
+			if tc.expectedStatus != http.StatusOK && received != "" {
+				t.Errorf("Expected handler not to run for a rejected request")
+			}
+		})
+	}
+}
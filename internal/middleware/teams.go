@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"knowthis/internal/apierror"
+)
+
+// TeamsSignatureMiddleware rejects outgoing webhook activities without a
+// valid "HMAC <signature>" Authorization header for the webhook's security
+// token. Requests are rejected outright when no token is configured.
+func TeamsSignatureMiddleware(securityToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := readRequestBody(w, r)
+			if !ok {
+				return
+			}
+
+			if err := VerifyTeamsRequest(securityToken, r.Header.Get("Authorization"), body); err != nil {
+				slog.Warn("Rejected Teams request", "error", err, "path", r.URL.Path)
+				apierror.Respond(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// VerifyTeamsRequest checks an outgoing webhook's base64 HMAC-SHA256
+// signature of the body, keyed with the base64 security token Teams shows
+// when the webhook is created. The "HMAC " prefix of the header is optional.
+func VerifyTeamsRequest(securityToken, signature string, body []byte) error {
+	if securityToken == "" {
+		return fmt.Errorf("no security token configured")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(securityToken)
+	if err != nil {
+		return fmt.Errorf("security token is not base64: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	signature = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(signature), "HMAC "))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTeamsSignatureMiddleware(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte("outgoing webhook security token"))
+	body := `{"type": "message", "id": "1700000000001", "text": "<at>KnowThis</at> collect"}`
+	sign := func(secret, body string) string {
+		key, _ := base64.StdEncoding.DecodeString(secret)
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(body))
+		return "HMAC " + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	testCases := []struct {
+		name           string
+		secret         string
+		authorization  string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature",
+			secret:         secret,
+			authorization:  sign(secret, body),
+			body:           body,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "tampered body",
+			secret:         secret,
+			authorization:  sign(secret, body),
+			body:           `{"type": "message", "id": "1700000000002"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong secret",
+			secret:         secret,
+			authorization:  sign(base64.StdEncoding.EncodeToString([]byte("other")), body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bearer token instead of a signature",
+			secret:         secret,
+			authorization:  "Bearer " + secret,
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing signature",
+			secret:         secret,
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no secret configured",
+			authorization:  sign(secret, body),
+			body:           body,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			handler := TeamsSignatureMiddleware(tc.secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				received = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook/teams", strings.NewReader(tc.body))
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus == http.StatusOK && received != tc.body {
+				t.Errorf("Expected handler to receive the original body, got %q", received)
+			}
+			if tc.expectedStatus != http.StatusOK && received != "" {
+				t.Errorf("Expected handler not to run for a rejected request")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+
+	"knowthis/internal/integrations/slack"
+)
+
+// AccessScope is the set of Slack channels a caller may read. Sources outside
+// the scope are never used to build an answer, however well they match.
+type AccessScope struct {
+	channels map[string]bool
+}
+
+type accessScopeKey struct{}
+
+// NewAccessScope creates a scope covering the given channels; an empty list grants nothing
+func NewAccessScope(channelIDs []string) *AccessScope {
+	channels := make(map[string]bool, len(channelIDs))
+	for _, channelID := range channelIDs {
+		if channelID != "" {
+			channels[channelID] = true
+		}
+	}
+	return &AccessScope{channels: channels}
+}
+
+// Allows reports whether the message belongs to a channel in the scope
+func (s *AccessScope) Allows(msg slack.SlackMessage) bool {
+	return s != nil && s.channels[msg.ChannelID]
+}
+
+// WithAccessScope attaches the caller's scope to the context
+func WithAccessScope(ctx context.Context, scope *AccessScope) context.Context {
+	return context.WithValue(ctx, accessScopeKey{}, scope)
+}
+
+// AccessScopeFromContext returns the caller's scope, if one was attached
+func AccessScopeFromContext(ctx context.Context) (*AccessScope, bool) {
+	scope, ok := ctx.Value(accessScopeKey{}).(*AccessScope)
+	return scope, ok && scope != nil
+}
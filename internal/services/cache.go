@@ -0,0 +1,170 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnswerCache reuses query results for identical queries until they expire.
+// A cached answer can't reflect content ingested after it was generated, so
+// the TTL bounds how stale an answer can be; Flush clears everything at once.
+// Once maxSize answers are cached the least recently used is evicted, and
+// Sweep removes expired answers that are never asked for again.
+type AnswerCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type cachedAnswer struct {
+	key       string
+	result    *QueryResult
+	expiresAt time.Time
+}
+
+// NewAnswerCache creates a cache holding up to maxSize answers, each
+// expiring after ttl
+func NewAnswerCache(ttl time.Duration, maxSize int) *AnswerCache {
+	return &AnswerCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the unexpired result cached under the key
+func (c *AnswerCache) Get(key string) (*QueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cachedAnswer)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	result := *entry.result
+	return &result, true
+}
+
+// Put caches the result under the key for the cache's TTL, evicting the
+// least recently used answer when the cache is full
+func (c *AnswerCache) Put(key string, result *QueryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored := *result
+	entry := &cachedAnswer{key: key, result: &stored, expiresAt: c.now().Add(c.ttl)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedAnswer).key)
+	}
+}
+
+// Flush removes every entry and returns how many were removed
+func (c *AnswerCache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flushed := c.order.Len()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	return flushed
+}
+
+// Len returns the number of cached answers, including expired ones not yet removed
+func (c *AnswerCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Sweep removes expired answers every TTL until ctx is done
+func (c *AnswerCache) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.removeExpired()
+		}
+	}
+}
+
+// removeExpired removes expired answers and returns how many were removed
+func (c *AnswerCache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	removed := 0
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if entry := element.Value.(*cachedAnswer); !now.Before(entry.expiresAt) {
+			c.order.Remove(element)
+			delete(c.entries, entry.key)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// answerCacheKey identifies a query by everything that affects its result,
+// including the caller's access scope so answers never cross scopes
+func answerCacheKey(ctx context.Context, query string, opts QueryOptions) string {
+	minSimilarity := "default"
+	if opts.MinSimilarity != nil {
+		minSimilarity = fmt.Sprint(*opts.MinSimilarity)
+	}
+
+	return fmt.Sprintf("%q|%s|%t|%s|%s|%s|%s|%d|%s|%s|%s|%q|%s",
+		query, opts.Model, opts.SingleSource, opts.Source,
+		opts.After.Format(time.RFC3339Nano), opts.Before.Format(time.RFC3339Nano), opts.Language, opts.Limit,
+		opts.SearchMode, minSimilarity, opts.ResponseFormat, opts.Persona, scopeCacheKey(ctx))
+}
+
+// scopeCacheKey identifies the caller's access scope, independent of channel order
+func scopeCacheKey(ctx context.Context) string {
+	accessScope, ok := AccessScopeFromContext(ctx)
+	if !ok {
+		return "none"
+	}
+
+	channels := make([]string, 0, len(accessScope.channels))
+	for channel := range accessScope.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return strings.Join(channels, ",")
+}
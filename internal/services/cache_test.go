@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"knowthis/internal/integrations/slack"
+)
+
+func TestAnswerCache_ExpiresAfterTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewAnswerCache(5*time.Minute, 100)
+	cache.now = func() time.Time { return now }
+
+	cache.Put("key", &QueryResult{Answer: "Rotate the deploy key"})
+
+	now = now.Add(4 * time.Minute)
+	if result, ok := cache.Get("key"); !ok || result.Answer != "Rotate the deploy key" {
+		t.Errorf("Expected cached answer before expiry, got %v, %v", result, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("Expected answer to expire after the TTL")
+	}
+}
+
+func TestAnswerCache_Flush(t *testing.T) {
+	cache := NewAnswerCache(time.Hour, 100)
+	cache.Put("a", &QueryResult{Answer: "one"})
+	cache.Put("b", &QueryResult{Answer: "two"})
+
+	if flushed := cache.Flush(); flushed != 2 {
+		t.Errorf("Expected 2 flushed entries, got %d", flushed)
+	}
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("Expected flush to clear entries")
+	}
+}
+
+func TestAnswerCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewAnswerCache(time.Hour, 2)
+	cache.Put("a", &QueryResult{Answer: "one"})
+	cache.Put("b", &QueryResult{Answer: "two"})
+
+	// Reading a makes b the least recently used
+	cache.Get("a")
+	cache.Put("c", &QueryResult{Answer: "three"})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected the least recently used answer to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %s to stay cached", key)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected the cache to hold 2 answers, got %d", cache.Len())
+	}
+}
+
+func TestAnswerCache_SweepRemovesExpired(t *testing.T) {
+	now := time.Now()
+	cache := NewAnswerCache(5*time.Minute, 100)
+	cache.now = func() time.Time { return now }
+
+	cache.Put("old", &QueryResult{Answer: "Rotate the deploy key"})
+	now = now.Add(3 * time.Minute)
+	cache.Put("new", &QueryResult{Answer: "Restart the worker"})
+
+	// Expired answers nobody asks for again are swept anyway
+	now = now.Add(3 * time.Minute)
+	if removed := cache.removeExpired(); removed != 1 {
+		t.Errorf("Expected 1 expired answer to be swept, got %d", removed)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 answer left, got %d", cache.Len())
+	}
+	if _, ok := cache.Get("new"); !ok {
+		t.Error("Expected the unexpired answer to survive the sweep")
+	}
+}
+
+func TestAnswerCache_SweepStopsWithContext(t *testing.T) {
+	cache := NewAnswerCache(time.Millisecond, 100)
+	cache.Put("key", &QueryResult{Answer: "Rotate the deploy key"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.Sweep(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the sweep to remove the expired answer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Sweep to return once the context is done")
+	}
+}
+
+func TestRAGService_AnswerCache(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+	cache := NewAnswerCache(time.Hour, 100)
+	rag.SetAnswerCache(cache)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := rag.Query(ctx, "where is the deploy key?"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if calls := len(llm.prompts) / 2; calls != 1 {
+		t.Errorf("Expected repeat query to be served from cache, got %d LLM calls", calls)
+	}
+
+	// A different access scope must not see the cached answer
+	scoped := WithAccessScope(ctx, NewAccessScope([]string{"C_PUBLIC"}))
+	if _, err := rag.Query(scoped, "where is the deploy key?"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := len(llm.prompts) / 2; calls != 2 {
+		t.Errorf("Expected a scoped query to miss the cache, got %d LLM calls", calls)
+	}
+
+	cache.Flush()
+	if _, err := rag.Query(ctx, "where is the deploy key?"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := len(llm.prompts) / 2; calls != 3 {
+		t.Errorf("Expected a flushed query to be regenerated, got %d LLM calls", calls)
+	}
+}
+
+func TestRAGService_AnswerCacheSeparatesScopes(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+	cache := NewAnswerCache(time.Hour, 100)
+	rag.SetAnswerCache(cache)
+
+	public := WithAccessScope(context.Background(), NewAccessScope([]string{"C_PUBLIC"}))
+	restricted := WithAccessScope(context.Background(), NewAccessScope([]string{"C_PUBLIC", "C_RESTRICTED"}))
+
+	publicResult, err := rag.Query(public, "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	restrictedResult, err := rag.Query(restricted, "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(cache.entries) != 2 {
+		t.Errorf("Expected one cache entry per scope, got %d", len(cache.entries))
+	}
+	if len(publicResult.Sources) != 1 || len(restrictedResult.Sources) != 2 {
+		t.Errorf("Expected each scope to get its own sources, got %d and %d", len(publicResult.Sources), len(restrictedResult.Sources))
+	}
+
+	// Repeating the narrower scope's query must not return the wider scope's answer
+	cached, err := rag.Query(public, "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, source := range cached.Sources {
+		if source.ChannelID == "C_RESTRICTED" {
+			t.Errorf("Expected the cached answer to stay within its scope")
+		}
+	}
+}
+
+func TestAnswerCacheKey_DistinguishesOptions(t *testing.T) {
+	minSimilarity := 0.5
+	scoped := WithAccessScope(context.Background(), NewAccessScope([]string{"C1"}))
+	emptyScope := WithAccessScope(context.Background(), NewAccessScope(nil))
+
+	variants := map[string]string{
+		"default":         answerCacheKey(context.Background(), "q", QueryOptions{}),
+		"model":           answerCacheKey(context.Background(), "q", QueryOptions{Model: "gpt-4o"}),
+		"single source":   answerCacheKey(context.Background(), "q", QueryOptions{SingleSource: true}),
+		"source":          answerCacheKey(context.Background(), "q", QueryOptions{Source: "slack"}),
+		"after":           answerCacheKey(context.Background(), "q", QueryOptions{After: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}),
+		"before":          answerCacheKey(context.Background(), "q", QueryOptions{Before: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}),
+		"language":        answerCacheKey(context.Background(), "q", QueryOptions{Language: "es"}),
+		"limit":           answerCacheKey(context.Background(), "q", QueryOptions{Limit: 5}),
+		"min similarity":  answerCacheKey(context.Background(), "q", QueryOptions{MinSimilarity: &minSimilarity}),
+		"response format": answerCacheKey(context.Background(), "q", QueryOptions{ResponseFormat: ResponseFormatJSON}),
+		"search mode":     answerCacheKey(context.Background(), "q", QueryOptions{SearchMode: slack.SearchModeHybrid}),
+		"persona":         answerCacheKey(context.Background(), "q", QueryOptions{Persona: "Answer like a pirate"}),
+		"scope":           answerCacheKey(scoped, "q", QueryOptions{}),
+		"empty scope":     answerCacheKey(emptyScope, "q", QueryOptions{}),
+		"query":           answerCacheKey(context.Background(), "q2", QueryOptions{}),
+	}
+
+	seen := make(map[string]string)
+	for name, key := range variants {
+		if other, ok := seen[key]; ok {
+			t.Errorf("Expected %q and %q to have distinct cache keys, both got %s", name, other, key)
+		}
+		seen[key] = name
+	}
+
+	// Scope order doesn't matter
+	a := answerCacheKey(WithAccessScope(context.Background(), NewAccessScope([]string{"C1", "C2"})), "q", QueryOptions{})
+	b := answerCacheKey(WithAccessScope(context.Background(), NewAccessScope([]string{"C2", "C1"})), "q", QueryOptions{})
+	if a != b {
+		t.Errorf("Expected the same scope in another order to share a key, got %s and %s", a, b)
+	}
+}
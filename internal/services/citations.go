@@ -0,0 +1,165 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"knowthis/internal/integrations/slack"
+)
+
+// citationDateLayout formats a citation's date, e.g. "May 2024"
+const citationDateLayout = "Jan 2006"
+
+// Citation is a thread or document the answer may cite as [Number], dated
+// by its most recent message so readers can judge how current it is. Source
+// is "slack" for threads and the document's source (e.g. "slab") otherwise;
+// ThreadID is a document's ID.
+type Citation struct {
+	Number    int       `json:"number"`
+	Source    string    `json:"source"`
+	ThreadID  string    `json:"thread_id"`
+	ChannelID string    `json:"channel_id"`
+	Date      time.Time `json:"date"`
+}
+
+// groupThreads groups messages by thread, ordering threads by their first
+// message so the most relevant thread is cited as [1]
+func groupThreads(messages []slack.SlackMessage) [][]slack.SlackMessage {
+	var threads [][]slack.SlackMessage
+	index := make(map[string]int)
+	for _, msg := range messages {
+		i, ok := index[msg.ThreadID]
+		if !ok {
+			i = len(threads)
+			index[msg.ThreadID] = i
+			threads = append(threads, nil)
+		}
+		threads[i] = append(threads[i], msg)
+	}
+	return threads
+}
+
+// buildCitations returns the citation of each thread numbered as in the prompt
+func buildCitations(messages []slack.SlackMessage) []Citation {
+	threads := groupThreads(messages)
+	citations := make([]Citation, len(threads))
+	for i, thread := range threads {
+		citation := Citation{Number: i + 1, Source: thread[0].SourceType(), ThreadID: thread[0].ThreadID, ChannelID: thread[0].ChannelID}
+		for _, msg := range thread {
+			if sent := messageTime(msg); sent.After(citation.Date) {
+				citation.Date = sent
+			}
+		}
+		citations[i] = citation
+	}
+	return citations
+}
+
+// messageTime returns when a message was posted, from its Slack timestamp,
+// or when it was collected if the timestamp doesn't parse
+func messageTime(msg slack.SlackMessage) time.Time {
+	seconds, _, _ := strings.Cut(msg.MessageTimestamp, ".")
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || unix <= 0 {
+		return msg.CreatedAt
+	}
+	return time.Unix(unix, 0).UTC()
+}
+
+// citationPattern matches a citation and a date already following it
+var citationPattern = regexp.MustCompile(`\[(\d+)\]( \([A-Z][a-z]{2} \d{4}\))?`)
+
+// inlineCitationDates follows each citation of a known thread in the answer
+// with its date, e.g. "[1] (May 2024)"
+func inlineCitationDates(answer string, citations []Citation) string {
+	dates := make(map[string]string, len(citations))
+	for _, citation := range citations {
+		if !citation.Date.IsZero() {
+			dates[strconv.Itoa(citation.Number)] = citation.Date.Format(citationDateLayout)
+		}
+	}
+
+	return citationPattern.ReplaceAllStringFunc(answer, func(match string) string {
+		groups := citationPattern.FindStringSubmatch(match)
+		date, ok := dates[groups[1]]
+		if !ok || groups[2] != "" {
+			return match
+		}
+		return match + " (" + date + ")"
+	})
+}
+
+// CitedAnswer is the answer schema for structured responses: the answer and
+// the quotes from retrieved messages supporting it
+type CitedAnswer struct {
+	Answer    string        `json:"answer"`
+	Citations []SourceQuote `json:"citations"`
+}
+
+// SourceQuote is a quote from a retrieved message, identified by the
+// message's ID as listed in the query's sources
+type SourceQuote struct {
+	SourceID string `json:"source_id"`
+	Quote    string `json:"quote"`
+}
+
+// citedAnswerInstructions tells the model the CitedAnswer schema
+const citedAnswerInstructions = `Respond with a JSON object with exactly these fields:
+- "answer" (string): the answer, citing sources by their numbers
+- "citations" (array): the messages supporting the answer, each an object with "source_id" (the message's source_id from the context) and "quote" (a short passage copied exactly from that message)`
+
+// parseCitedAnswer parses a structured answer from the model, keeping only
+// the citations that quote one of the retrieved messages. Citations of
+// unknown source IDs or with quotes not found in the message are dropped.
+func parseCitedAnswer(content string, messages []slack.SlackMessage) (*CitedAnswer, error) {
+	var answer CitedAnswer
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if strings.TrimSpace(answer.Answer) == "" {
+		return nil, fmt.Errorf("missing answer")
+	}
+
+	sources := make(map[string]string, len(messages))
+	for _, msg := range messages {
+		sources[msg.ID.String()] = normalizeQuote(msg.Content)
+	}
+
+	citations := []SourceQuote{}
+	seen := make(map[SourceQuote]bool)
+	dropped := 0
+	for _, citation := range answer.Citations {
+		citation.SourceID = strings.TrimSpace(citation.SourceID)
+		citation.Quote = strings.TrimSpace(citation.Quote)
+
+		source, ok := sources[citation.SourceID]
+		quote := normalizeQuote(citation.Quote)
+		if !ok || quote == "" || !strings.Contains(source, quote) {
+			dropped++
+			continue
+		}
+		if !seen[citation] {
+			seen[citation] = true
+			citations = append(citations, citation)
+		}
+	}
+
+	if dropped > 0 {
+		slog.Warn("Dropped citations not matching a retrieved source", "dropped", dropped, "kept", len(citations))
+	}
+
+	answer.Citations = citations
+	return &answer, nil
+}
+
+// normalizeQuote lowercases text and collapses whitespace, so quotes match
+// messages regardless of case and line breaks
+func normalizeQuote(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
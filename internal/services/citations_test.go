@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/integrations/slack"
+)
+
+func datedSearchResults() []slack.SlackMessage {
+	// Ordered by similarity; thread 1.0's latest message is from May 2024
+	return []slack.SlackMessage{
+		{ChannelID: "C1", ThreadID: "1.0", MessageTimestamp: "1714000000.000100", UserName: "alice", Content: "The production deploy key is kept in the vault", Similarity: 0.91},
+		{ChannelID: "C2", ThreadID: "2.0", MessageTimestamp: "1672600000.000200", UserName: "bob", Content: "Deploy keys are rotated through the platform runbook", Similarity: 0.88},
+		{ChannelID: "C1", ThreadID: "1.0", MessageTimestamp: "1716000000.000300", UserName: "carol", Content: "Moved the deploy key to the new vault path today", Similarity: 0.86},
+	}
+}
+
+func TestBuildCitations(t *testing.T) {
+	citations := buildCitations(datedSearchResults())
+
+	expected := []Citation{
+		{Number: 1, Source: "slack", ThreadID: "1.0", ChannelID: "C1", Date: time.Unix(1716000000, 0).UTC()},
+		{Number: 2, Source: "slack", ThreadID: "2.0", ChannelID: "C2", Date: time.Unix(1672600000, 0).UTC()},
+	}
+	if len(citations) != len(expected) {
+		t.Fatalf("Expected %d citations, got %+v", len(expected), citations)
+	}
+	for i := range expected {
+		if citations[i] != expected[i] {
+			t.Errorf("Citation %d: expected %+v, got %+v", i, expected[i], citations[i])
+		}
+	}
+
+	// The prompt numbers threads the same way
+	_, userPrompt, _ := buildPrompts("where is the deploy key?", DefaultSystemPrompt, false, "", datedSearchResults())
+	if !strings.Contains(userPrompt, "[1] Slack thread conversation:\n  alice: The production deploy key") ||
+		!strings.Contains(userPrompt, "[2] Slack thread conversation:\n  bob: Deploy keys are rotated") {
+		t.Errorf("Expected prompt threads numbered by relevance, got %q", userPrompt)
+	}
+}
+
+func TestInlineCitationDates(t *testing.T) {
+	citations := []Citation{
+		{Number: 1, Date: time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC)},
+		{Number: 2, Date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Number: 3},
+	}
+
+	testCases := []struct {
+		answer   string
+		expected string
+	}{
+		{"Keys live in the vault [1].", "Keys live in the vault [1] (May 2024)."},
+		{"See [1][2].", "See [1] (May 2024)[2] (Jan 2023)."},
+		{"Already dated [1] (May 2024).", "Already dated [1] (May 2024)."},
+		{"Unknown [4] and undated [3] citations stay", "Unknown [4] and undated [3] citations stay"},
+		{"No citations", "No citations"},
+	}
+
+	for _, tc := range testCases {
+		if got := inlineCitationDates(tc.answer, citations); got != tc.expected {
+			t.Errorf("inlineCitationDates(%q) = %q, expected %q", tc.answer, got, tc.expected)
+		}
+	}
+}
+
+func TestRAGService_CitationDates(t *testing.T) {
+	for _, inline := range []bool{false, true} {
+		llm := &mockJSONLLMProvider{content: "The key is in the vault [1], rotated per the runbook [2]."}
+		rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: datedSearchResults()}, &mockQueryEmbedder{})
+		rag.SetInlineCitationDates(inline)
+
+		result, err := rag.Query(context.Background(), "where is the deploy key?")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(result.Citations) != 2 || result.Citations[0].Date.Format(citationDateLayout) != "May 2024" ||
+			result.Citations[1].Date.Format(citationDateLayout) != "Jan 2023" {
+			t.Errorf("Expected dated citation metadata, got %+v", result.Citations)
+		}
+
+		expected := "The key is in the vault [1], rotated per the runbook [2]."
+		if inline {
+			expected = "The key is in the vault [1] (May 2024), rotated per the runbook [2] (Jan 2023)."
+		}
+		if result.Answer != expected {
+			t.Errorf("inline=%t: expected answer %q, got %q", inline, expected, result.Answer)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultConversationTurns is how many prior turns are used for a follow-up
+const defaultConversationTurns = 5
+
+// ConversationTurn is one question and the answer given to it
+type ConversationTurn struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// ConversationStore keeps the recent turns of each conversation in memory.
+// A conversation is dropped once it goes unused for the TTL. Conversations
+// are keyed by ID and access scope, so a conversation ID used under another
+// scope starts afresh instead of exposing the original scope's answers.
+type ConversationStore struct {
+	mu            sync.Mutex
+	ttl           time.Duration
+	maxTurns      int
+	conversations map[string]*conversation
+	now           func() time.Time
+}
+
+type conversation struct {
+	turns     []ConversationTurn
+	expiresAt time.Time
+}
+
+// NewConversationStore creates a store keeping up to maxTurns turns per
+// conversation until it goes unused for ttl
+func NewConversationStore(ttl time.Duration, maxTurns int) *ConversationStore {
+	if maxTurns <= 0 {
+		maxTurns = defaultConversationTurns
+	}
+	return &ConversationStore{
+		ttl:           ttl,
+		maxTurns:      maxTurns,
+		conversations: make(map[string]*conversation),
+		now:           time.Now,
+	}
+}
+
+// History returns the conversation's recent turns, oldest first, or nil if
+// it doesn't exist or has expired
+func (s *ConversationStore) History(ctx context.Context, conversationID string) []ConversationTurn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := conversationKey(ctx, conversationID)
+	conv, ok := s.conversations[key]
+	if !ok {
+		return nil
+	}
+	if !s.now().Before(conv.expiresAt) {
+		delete(s.conversations, key)
+		return nil
+	}
+
+	return append([]ConversationTurn(nil), conv.turns...)
+}
+
+// Append adds a turn to the conversation, keeping only the most recent turns
+// and extending its expiry. Expired conversations are swept on the way.
+func (s *ConversationStore) Append(ctx context.Context, conversationID string, turn ConversationTurn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, conv := range s.conversations {
+		if !now.Before(conv.expiresAt) {
+			delete(s.conversations, key)
+		}
+	}
+
+	key := conversationKey(ctx, conversationID)
+	conv, ok := s.conversations[key]
+	if !ok {
+		conv = &conversation{}
+		s.conversations[key] = conv
+	}
+	conv.turns = lastTurns(append(conv.turns, turn), s.maxTurns)
+	conv.expiresAt = now.Add(s.ttl)
+}
+
+// conversationKey scopes a conversation ID to the caller's access scope
+func conversationKey(ctx context.Context, conversationID string) string {
+	return fmt.Sprintf("%q|%s", conversationID, scopeCacheKey(ctx))
+}
+
+// lastTurns returns at most n of the most recent turns
+func lastTurns(turns []ConversationTurn, n int) []ConversationTurn {
+	if len(turns) > n {
+		return turns[len(turns)-n:]
+	}
+	return turns
+}
+
+// historyMessages renders prior turns as alternating user and assistant chat messages
+func historyMessages(history []ConversationTurn) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, 2*len(history))
+	for _, turn := range history {
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: turn.Question},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: turn.Answer})
+	}
+	return messages
+}
+
+// condenseQuestionPrompt asks the model to rewrite a follow-up as a question
+// that can be searched for on its own
+const condenseQuestionPrompt = "Rewrite the user's follow-up question as a single standalone question that can be understood without the conversation, resolving references like \"it\" or \"the second option\" from the conversation. Reply with only the rewritten question."
+
+// condenseQuestion rewrites a follow-up question into a standalone question
+// for retrieval. On failure the follow-up is used as is.
+func (r *RAGService) condenseQuestion(ctx context.Context, model string, history []ConversationTurn, query string) string {
+	var transcript strings.Builder
+	for _, turn := range history {
+		fmt.Fprintf(&transcript, "User: %s\nAssistant: %s\n", turn.Question, turn.Answer)
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Condense)
+	defer cancel()
+
+	resp, err := r.llm.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     model,
+		MaxTokens: 200,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: condenseQuestionPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("Conversation:\n%s\nFollow-up question: %s", transcript.String(), query)},
+		},
+		Temperature: 0,
+	})
+	if err == nil {
+		recordChatUsage(model, "condense", resp.Usage)
+	}
+	if err != nil || len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		slog.Warn("Failed to condense follow-up question, searching with it as is", "error", err)
+		return query
+	}
+
+	return strings.TrimSpace(resp.Choices[0].Message.Content)
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// mockConversationLLM answers condense requests with a fixed standalone
+// question and everything else with a fixed answer
+type mockConversationLLM struct {
+	requests []openai.ChatCompletionRequest
+}
+
+func (m *mockConversationLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.requests = append(m.requests, req)
+
+	content := "Rotate it through the platform runbook"
+	if req.Messages[0].Content == condenseQuestionPrompt {
+		content = "How is the production deploy key rotated?"
+	}
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: content}}},
+	}, nil
+}
+
+type recordingQueryEmbedder struct {
+	texts []string
+}
+
+func (m *recordingQueryEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	m.texts = append(m.texts, text)
+	return []float32{0.1, 0.2, 0.3}, nil
+}
+
+func TestRAGService_FollowUpReusesConversation(t *testing.T) {
+	llm := &mockConversationLLM{}
+	embedder := &recordingQueryEmbedder{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, embedder)
+	rag.SetConversationStore(NewConversationStore(time.Hour, 5))
+	ctx := context.Background()
+
+	first, err := rag.QueryWithOptions(ctx, "where is the deploy key?", QueryOptions{ConversationID: "conv-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.StandaloneQuery != "" || len(llm.requests) != 1 {
+		t.Fatalf("Expected a first question to be answered without condensing, got %d requests", len(llm.requests))
+	}
+
+	followUp, err := rag.QueryWithOptions(ctx, "how do I rotate it?", QueryOptions{ConversationID: "conv-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(llm.requests) != 3 {
+		t.Fatalf("Expected a condense and an answer request for the follow-up, got %d requests", len(llm.requests))
+	}
+	condense := llm.requests[1].Messages[1].Content
+	if !strings.Contains(condense, "where is the deploy key?") || !strings.Contains(condense, "Follow-up question: how do I rotate it?") {
+		t.Errorf("Expected the condense request to include the prior turn and follow-up, got %q", condense)
+	}
+
+	if embedder.texts[1] != "How is the production deploy key rotated?" {
+		t.Errorf("Expected retrieval to embed the standalone question, got %q", embedder.texts[1])
+	}
+	if followUp.StandaloneQuery != "How is the production deploy key rotated?" {
+		t.Errorf("Expected the standalone question in the result, got %q", followUp.StandaloneQuery)
+	}
+
+	answer := llm.requests[2].Messages
+	if len(answer) != 4 ||
+		answer[1].Role != openai.ChatMessageRoleUser || answer[1].Content != "where is the deploy key?" ||
+		answer[2].Role != openai.ChatMessageRoleAssistant || answer[2].Content != first.Answer {
+		t.Errorf("Expected the prior turn between the system and user prompts, got %+v", answer)
+	}
+	if !strings.Contains(answer[3].Content, "Question: how do I rotate it?") {
+		t.Errorf("Expected the follow-up in the user prompt, got %q", answer[3].Content)
+	}
+
+	// Another conversation, or the same ID under another scope, starts afresh
+	scoped := WithAccessScope(ctx, NewAccessScope([]string{"C_PUBLIC"}))
+	for _, queryCtx := range []context.Context{ctx, scoped} {
+		conversationID := "conv-2"
+		if queryCtx == scoped {
+			conversationID = "conv-1"
+		}
+		before := len(llm.requests)
+		result, err := rag.QueryWithOptions(queryCtx, "how do I rotate it?", QueryOptions{ConversationID: conversationID})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.StandaloneQuery != "" || len(llm.requests) != before+1 {
+			t.Errorf("Expected %s to have no history", conversationID)
+		}
+	}
+}
+
+func TestRAGService_FollowUpWithExplicitHistory(t *testing.T) {
+	llm := &mockConversationLLM{}
+	embedder := &recordingQueryEmbedder{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, embedder)
+	rag.SetAnswerCache(NewAnswerCache(time.Hour, 100))
+
+	opts := QueryOptions{History: []ConversationTurn{{Question: "where is the deploy key?", Answer: "In the finance vault"}}}
+	for i := 0; i < 2; i++ {
+		if _, err := rag.QueryWithOptions(context.Background(), "how do I rotate it?", opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(llm.requests) != 4 {
+		t.Errorf("Expected follow-ups never to be cached, got %d requests", len(llm.requests))
+	}
+	if embedder.texts[0] != "How is the production deploy key rotated?" {
+		t.Errorf("Expected retrieval to embed the standalone question, got %q", embedder.texts[0])
+	}
+}
+
+func TestRAGService_CachedFirstTurnStartsConversation(t *testing.T) {
+	llm := &mockConversationLLM{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &recordingQueryEmbedder{})
+	rag.SetAnswerCache(NewAnswerCache(time.Hour, 100))
+	rag.SetConversationStore(NewConversationStore(time.Hour, 5))
+	ctx := context.Background()
+
+	// Another conversation caches the answer to the opening question
+	if _, err := rag.QueryWithOptions(ctx, "where is the deploy key?", QueryOptions{ConversationID: "conv-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := rag.QueryWithOptions(ctx, "where is the deploy key?", QueryOptions{ConversationID: "conv-2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(llm.requests) != 1 {
+		t.Fatalf("Expected the second opening question to be answered from cache, got %d requests", len(llm.requests))
+	}
+
+	followUp, err := rag.QueryWithOptions(ctx, "how do I rotate it?", QueryOptions{ConversationID: "conv-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if followUp.StandaloneQuery != "How is the production deploy key rotated?" {
+		t.Errorf("Expected the follow-up to be condensed with the cached turn, got %q", followUp.StandaloneQuery)
+	}
+	if condense := llm.requests[1].Messages[1].Content; !strings.Contains(condense, "where is the deploy key?") {
+		t.Errorf("Expected the cached turn in the condense request, got %q", condense)
+	}
+}
+
+func TestConversationStore_DropsExpiredConversations(t *testing.T) {
+	store := NewConversationStore(time.Minute, 2)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store.Append(ctx, "conv-1", ConversationTurn{Question: "q1", Answer: "a1"})
+	store.Append(ctx, "conv-1", ConversationTurn{Question: "q2", Answer: "a2"})
+	store.Append(ctx, "conv-1", ConversationTurn{Question: "q3", Answer: "a3"})
+
+	history := store.History(ctx, "conv-1")
+	if len(history) != 2 || history[0].Question != "q2" || history[1].Question != "q3" {
+		t.Errorf("Expected the 2 most recent turns, got %+v", history)
+	}
+
+	// Each turn extends the conversation's expiry
+	now = now.Add(50 * time.Second)
+	store.Append(ctx, "conv-1", ConversationTurn{Question: "q4", Answer: "a4"})
+	now = now.Add(50 * time.Second)
+	if len(store.History(ctx, "conv-1")) != 2 {
+		t.Errorf("Expected an active conversation to be kept")
+	}
+
+	now = now.Add(time.Minute)
+	if history := store.History(ctx, "conv-1"); history != nil {
+		t.Errorf("Expected an expired conversation to be dropped, got %+v", history)
+	}
+
+	// Expired conversations are swept when another conversation is added
+	store.Append(ctx, "conv-2", ConversationTurn{Question: "q1", Answer: "a1"})
+	now = now.Add(2 * time.Minute)
+	store.Append(ctx, "conv-3", ConversationTurn{Question: "q1", Answer: "a1"})
+	if len(store.conversations) != 1 {
+		t.Errorf("Expected expired conversations to be swept, got %d", len(store.conversations))
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// DocumentSearcher finds the stored documents (Slab posts and comments,
+// canvases and other imported content) closest to an embedding
+type DocumentSearcher interface {
+	SearchSimilar(ctx context.Context, embedding []float32, limit int) ([]*storage.Document, error)
+}
+
+// SetDocumentSearch also searches documents for sources, ranking them with
+// Slack threads by similarity. Documents are only searched by vector, so
+// keyword searches and queries routed to another language's embedding model
+// search Slack alone.
+func (r *RAGService) SetDocumentSearch(searcher DocumentSearcher) {
+	r.documents = searcher
+	slog.Info("Updated document search", "enabled", searcher != nil)
+}
+
+// searchDocuments returns the documents most similar to the query embedding
+// as sources, restricted to the source and time range of opts
+func (r *RAGService) searchDocuments(ctx context.Context, embedding []float32, limit int, opts QueryOptions) ([]slack.SlackMessage, error) {
+	docs, err := r.documents.SearchSimilar(ctx, embedding, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []slack.SlackMessage
+	for _, doc := range docs {
+		// Slack conversations are searched in slack_messages, where the
+		// legacy handler's documents are backfilled, so they aren't cited twice
+		if slack.IsLegacyDocument(doc.ID) {
+			continue
+		}
+		if opts.Source != "" && doc.Source != opts.Source {
+			continue
+		}
+		if !opts.After.IsZero() && doc.Timestamp.Before(opts.After) {
+			continue
+		}
+		if !opts.Before.IsZero() && !doc.Timestamp.Before(opts.Before) {
+			continue
+		}
+		sources = append(sources, documentSource(doc))
+	}
+	return sources, nil
+}
+
+// documentSource converts a document into a source. The document is its own
+// thread, and its ID is derived from the document's so structured answers
+// can quote it.
+func documentSource(doc *storage.Document) slack.SlackMessage {
+	return slack.SlackMessage{
+		ID:          uuid.NewSHA1(uuid.NameSpaceURL, []byte(doc.ID)),
+		ChannelID:   doc.ChannelID,
+		ThreadID:    doc.ID,
+		UserID:      doc.UserID,
+		UserName:    doc.UserName,
+		Content:     doc.Content,
+		ContentHash: doc.ContentHash,
+		CreatedAt:   doc.Timestamp,
+		UpdatedAt:   doc.UpdatedAt,
+		Similarity:  doc.Similarity,
+		Source:      doc.Source,
+		Title:       doc.Title,
+	}
+}
+
+// mergeBySimilarity merges Slack messages and document sources, most similar
+// first. A thread's messages share its similarity, so they keep their order.
+func mergeBySimilarity(messages, documents []slack.SlackMessage) []slack.SlackMessage {
+	merged := make([]slack.SlackMessage, 0, len(messages)+len(documents))
+	merged = append(merged, messages...)
+	merged = append(merged, documents...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Similarity > merged[j].Similarity
+	})
+	return merged
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/integrations/slack"
+	"knowthis/internal/storage"
+)
+
+type mockDocumentSearcher struct {
+	documents []*storage.Document
+	calls     int
+}
+
+func (m *mockDocumentSearcher) SearchSimilar(ctx context.Context, embedding []float32, limit int) ([]*storage.Document, error) {
+	m.calls++
+	return m.documents, nil
+}
+
+func deployKeyDocuments() []*storage.Document {
+	return []*storage.Document{
+		{ID: "slab_post_42", Source: "slab", Title: "Deploy key runbook", UserName: "dana", Content: "Deploy keys are stored in the platform vault and rotated quarterly", Timestamp: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Similarity: 0.9},
+		{ID: "slack_thread_C1_1.0", Source: "slack", ChannelID: "C1", Content: "Message 1: Where do we keep the production deploy key?", Timestamp: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Similarity: 0.85},
+		{ID: "slack_canvas_C1_F1", Source: "slack", Title: "Platform canvas", ChannelID: "C1", Content: "The deploy key rotation checklist lives in this canvas", Timestamp: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), Similarity: 0.7},
+	}
+}
+
+func deployKeyThread() []slack.SlackMessage {
+	return []slack.SlackMessage{
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "alice", Content: "Where do we keep the production deploy key?", Similarity: 0.8},
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "bob", Content: "It moved to the new vault path last week", Similarity: 0.8},
+	}
+}
+
+func TestRAGService_SearchesSlackAndDocuments(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: deployKeyThread()}, &mockQueryEmbedder{})
+	rag.SetDocumentSearch(&mockDocumentSearcher{documents: deployKeyDocuments()})
+	rag.SetSimilarityThresholds(SimilarityThresholds{Primary: 0.75, Fallback: 0.75})
+
+	result, err := rag.Query(context.Background(), "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The Slab post is more similar than the thread; the canvas is below the
+	// threshold and the legacy copy of the thread is left to slack_messages
+	var got []string
+	for _, source := range result.Sources {
+		got = append(got, source.SourceType()+":"+source.ThreadID)
+	}
+	expected := []string{"slab:slab_post_42", "slack:1.0", "slack:1.0"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected sources %v, got %v", expected, got)
+	}
+	if result.Sources[0].Title != "Deploy key runbook" || result.Sources[0].Similarity != 0.9 {
+		t.Errorf("Expected the document's title and similarity on its source, got %+v", result.Sources[0])
+	}
+
+	if len(result.Citations) != 2 ||
+		result.Citations[0].Source != "slab" || result.Citations[0].ThreadID != "slab_post_42" ||
+		result.Citations[1].Source != "slack" || result.Citations[1].ThreadID != "1.0" {
+		t.Errorf("Expected the Slab post cited before the Slack thread, got %+v", result.Citations)
+	}
+
+	prompt := strings.Join(llm.prompts, "\n")
+	if !strings.Contains(prompt, "[1] Document from slab \"Deploy key runbook\":\n  dana: Deploy keys are stored") ||
+		!strings.Contains(prompt, "[2] Slack thread conversation:\n  alice: Where do we keep") {
+		t.Errorf("Expected the document and the thread numbered by similarity in the prompt, got %q", prompt)
+	}
+	if !strings.Contains(prompt, "from our internal knowledge base") || strings.Contains(prompt, "Slack knowledge base") {
+		t.Errorf("Expected the prompt to introduce the context without naming one source, got %q", prompt)
+	}
+}
+
+func TestRAGService_DocumentSearchFilters(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        QueryOptions
+		wantSources []string
+		wantSlack   bool // whether Slack messages were searched
+	}{
+		{
+			name:        "slab only",
+			opts:        QueryOptions{Source: "slab"},
+			wantSources: []string{"slab_post_42"},
+			wantSlack:   false,
+		},
+		{
+			name:        "slack keeps slack documents",
+			opts:        QueryOptions{Source: "slack"},
+			wantSources: []string{"1.0", "1.0", "slack_canvas_C1_F1"},
+			wantSlack:   true,
+		},
+		{
+			name:        "time range",
+			opts:        QueryOptions{After: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			wantSources: []string{"slab_post_42", "1.0", "1.0"},
+			wantSlack:   true,
+		},
+		{
+			name:        "keyword search skips documents",
+			opts:        QueryOptions{SearchMode: slack.SearchModeKeyword},
+			wantSources: []string{"1.0", "1.0"},
+			wantSlack:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			searcher := &mockMessageSearcher{messages: deployKeyThread()}
+			rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+			rag.SetDocumentSearch(&mockDocumentSearcher{documents: deployKeyDocuments()})
+			rag.SetSimilarityThresholds(SimilarityThresholds{Primary: 0.5, Fallback: 0.5})
+
+			result, err := rag.QueryWithOptions(context.Background(), "where is the deploy key?", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, source := range result.Sources {
+				got = append(got, source.ThreadID)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.wantSources, ",") {
+				t.Errorf("Expected sources %v, got %v", tc.wantSources, got)
+			}
+			if searched := len(searcher.filters) > 0; searched != tc.wantSlack {
+				t.Errorf("Expected Slack searched: %v, got %v", tc.wantSlack, searched)
+			}
+		})
+	}
+}
+
+func TestRAGService_SlabWithoutDocumentSearch(t *testing.T) {
+	searcher := &mockMessageSearcher{messages: deployKeyThread()}
+	rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+
+	result, err := rag.QueryWithOptions(context.Background(), "where is the deploy key?", QueryOptions{Source: "slab"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Sources) != 0 || len(searcher.filters) != 0 {
+		t.Errorf("Expected no sources and no search without document search, got %+v", result.Sources)
+	}
+}
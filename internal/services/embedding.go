@@ -2,23 +2,236 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
 	"strings"
 	"time"
 
+	"knowthis/internal/language"
+	"knowthis/internal/metrics"
+	"knowthis/internal/storage"
+
 	"github.com/sashabaranov/go-openai"
 )
 
+// DefaultEmbeddingModel is the embedding model used unless configured otherwise
+const DefaultEmbeddingModel = string(openai.AdaEmbeddingV2)
+
+// embeddingModelDimensions is the native output size of known embedding models
+var embeddingModelDimensions = map[string]int{
+	string(openai.AdaEmbeddingV2):  1536,
+	string(openai.SmallEmbedding3): 1536,
+	string(openai.LargeEmbedding3): 3072,
+}
+
+// embeddingClient is the part of the OpenAI client used for embeddings
+type embeddingClient interface {
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+	GetModel(ctx context.Context, modelID string) (openai.Model, error)
+}
+
+// RetryPolicy controls retries of transient embedding API failures
+// (rate limits, 5xx responses, timeouts). Delays grow exponentially from
+// BaseDelay with jitter. Other errors, such as invalid input, fail at once.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+
+	// Timeout of each attempt; 0 uses the call's default (10s for a single
+	// embedding, 30s for a batch)
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used unless configured otherwise
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond}
+
 type EmbeddingService struct {
-	client *openai.Client
+	client embeddingClient
+	model  openai.EmbeddingModel
+	retry  RetryPolicy
+
+	// Requested output size; 0 uses the model's native size
+	dimensions int
+
+	// Reuses embeddings of recently embedded texts; nil disables caching
+	cache *EmbeddingCache
+
+	// Embeds text detected to be in a language other than English; nil
+	// embeds all text with model
+	multilingual *EmbeddingService
+}
+
+// NewEmbeddingService creates an embedding client for the given model.
+// dimensions shortens the output of text-embedding-3 models; 0 keeps the
+// model's native size. The resulting size must match the vector columns.
+func NewEmbeddingService(apiKey, model string, dimensions int, retry RetryPolicy) (*EmbeddingService, error) {
+	return newEmbeddingService(openai.DefaultConfig(apiKey), model, dimensions, retry)
+}
+
+func newEmbeddingService(config openai.ClientConfig, model string, dimensions int, retry RetryPolicy) (*EmbeddingService, error) {
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+
+	size, err := resolveEmbeddingDimensions(model, dimensions)
+	if err != nil {
+		return nil, err
+	}
+	if size != storage.EmbeddingDimensions {
+		return nil, fmt.Errorf("embedding model %s produces %d dimensions but the vector columns are VECTOR(%d); set EMBEDDING_DIMENSIONS=%d or use a %d-dimension model",
+			model, size, storage.EmbeddingDimensions, storage.EmbeddingDimensions, storage.EmbeddingDimensions)
+	}
+
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+
+	return &EmbeddingService{
+		client:     openai.NewClientWithConfig(config),
+		model:      openai.EmbeddingModel(model),
+		retry:      retry,
+		dimensions: dimensions,
+	}, nil
+}
+
+// resolveEmbeddingDimensions returns the output size of model when asked for dimensions
+func resolveEmbeddingDimensions(model string, dimensions int) (int, error) {
+	native, known := embeddingModelDimensions[model]
+
+	switch {
+	case dimensions < 0:
+		return 0, fmt.Errorf("embedding dimensions cannot be negative")
+	case dimensions == 0 && !known:
+		return 0, fmt.Errorf("unknown embedding model %s; set EMBEDDING_DIMENSIONS to its output size", model)
+	case dimensions == 0:
+		return native, nil
+	case model == string(openai.AdaEmbeddingV2) && dimensions != native:
+		return 0, fmt.Errorf("embedding model %s does not support custom dimensions", model)
+	case known && dimensions > native:
+		return 0, fmt.Errorf("embedding model %s produces at most %d dimensions, got %d", model, native, dimensions)
+	}
+
+	return dimensions, nil
+}
+
+// WithRetryPolicy returns a copy of the service that retries with policy,
+// e.g. a tighter budget for latency-sensitive query embeddings
+func (e *EmbeddingService) WithRetryPolicy(policy RetryPolicy) *EmbeddingService {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	service := *e
+	service.retry = policy
+	if e.multilingual != nil {
+		service.multilingual = e.multilingual.WithRetryPolicy(policy)
+	}
+	return &service
+}
+
+// SetMultilingualModel embeds text detected to be in a language other than
+// English with model, e.g. text-embedding-3-small, instead of the configured
+// model. Its output must match the vector columns like the configured
+// model's. Vectors of the two models aren't comparable, so such content is
+// only found by queries in its language.
+func (e *EmbeddingService) SetMultilingualModel(model string) error {
+	// Only text-embedding-3 models accept the dimensions parameter
+	dimensions := e.dimensions
+	if model == string(openai.AdaEmbeddingV2) {
+		dimensions = 0
+	}
+
+	size, err := resolveEmbeddingDimensions(model, dimensions)
+	if err != nil {
+		return err
+	}
+	if size != storage.EmbeddingDimensions {
+		return fmt.Errorf("multilingual embedding model %s produces %d dimensions but the vector columns are VECTOR(%d)",
+			model, size, storage.EmbeddingDimensions)
+	}
+
+	multilingual := *e
+	multilingual.model = openai.EmbeddingModel(model)
+	multilingual.dimensions = dimensions
+	multilingual.multilingual = nil
+	e.multilingual = &multilingual
+	slog.Info("Updated multilingual embedding model", "model", model)
+	return nil
+}
+
+// SetCache reuses embeddings of recently embedded texts instead of calling
+// the API again. Meant for query embedding, where popular questions repeat;
+// background embedding rarely sees the same text twice.
+func (e *EmbeddingService) SetCache(cache *EmbeddingCache) {
+	e.cache = cache
+	if e.multilingual != nil {
+		e.multilingual.cache = cache
+	}
+	slog.Info("Updated embedding cache", "max_size", cache.maxSize, "ttl", cache.ttl)
+}
+
+// ForLanguage returns the service embedding text in lang: the multilingual
+// model's for languages other than English when one is set, otherwise this one
+func (e *EmbeddingService) ForLanguage(lang string) *EmbeddingService {
+	if e.multilingual != nil && lang != "" && lang != language.English {
+		return e.multilingual
+	}
+	return e
 }
 
-func NewEmbeddingService(apiKey string) *EmbeddingService {
-	client := openai.NewClient(apiKey)
-	return &EmbeddingService{client: client}
+// routeText returns the service embedding text, by its detected language
+func (e *EmbeddingService) routeText(text string) *EmbeddingService {
+	if e.multilingual == nil {
+		return e
+	}
+	return e.ForLanguage(language.Detect(text))
+}
+
+// Model returns the configured embedding model name
+func (e *EmbeddingService) Model() string {
+	return string(e.model)
 }
 
+// request builds an embedding request for the configured model
+func (e *EmbeddingService) request(input []string) openai.EmbeddingRequest {
+	req := openai.EmbeddingRequest{
+		Input: input,
+		Model: e.model,
+	}
+	// Only text-embedding-3 models accept the dimensions parameter
+	if e.dimensions > 0 && e.model != openai.AdaEmbeddingV2 {
+		req.Dimensions = e.dimensions
+	}
+	return req
+}
+
+// HealthCheck verifies the embedding API is reachable and the configured model
+// is available. Looking up the model is free, unlike generating an embedding.
+func (e *EmbeddingService) HealthCheck(ctx context.Context) error {
+	if _, err := e.client.GetModel(ctx, string(e.model)); err != nil {
+		return fmt.Errorf("embedding API unavailable: %w", err)
+	}
+	return nil
+}
+
+// GenerateEmbedding embeds text, with the multilingual model when one is set
+// and the text is detected to be in a language other than English
 func (e *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return e.routeText(text).embed(ctx, text)
+}
+
+// GenerateEmbeddingForLanguage embeds text as content in lang, e.g. a query
+// restricted to that language, whatever language the text itself is in
+func (e *EmbeddingService) GenerateEmbeddingForLanguage(ctx context.Context, text, lang string) ([]float32, error) {
+	return e.ForLanguage(lang).embed(ctx, text)
+}
+
+// embed embeds text with the service's model
+func (e *EmbeddingService) embed(ctx context.Context, text string) ([]float32, error) {
 	// Validate and clean input
 	text = strings.TrimSpace(text)
 	if text == "" {
@@ -38,15 +251,15 @@ func (e *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) (
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	req := openai.EmbeddingRequest{
-		Input: []string{text},
-		Model: openai.AdaEmbeddingV2, // More cost-efficient than AdaV2
+	var cacheKey string
+	if e.cache != nil {
+		cacheKey = embeddingCacheKey(string(e.model), e.dimensions, text)
+		if embedding, ok := e.cache.Get(cacheKey); ok {
+			return embedding, nil
+		}
 	}
 
-	resp, err := e.client.CreateEmbeddings(ctx, req)
+	resp, err := e.createEmbeddings(ctx, []string{text}, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embedding: %w", err)
 	}
@@ -55,6 +268,10 @@ func (e *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) (
 		return nil, fmt.Errorf("no embedding data returned")
 	}
 
+	if cacheKey != "" {
+		e.cache.Put(cacheKey, resp.Data[0].Embedding)
+	}
+
 	return resp.Data[0].Embedding, nil
 }
 
@@ -89,15 +306,45 @@ func (e *EmbeddingService) GenerateEmbeddings(ctx context.Context, texts []strin
 		return nil, fmt.Errorf("no valid non-empty texts found")
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	if e.multilingual == nil {
+		return e.embedBatch(ctx, cleanTexts)
+	}
+
+	// Embed each model's texts in one request, keeping the input order
+	routes := make([]*EmbeddingService, len(cleanTexts))
+	for i, text := range cleanTexts {
+		routes[i] = e.routeText(text)
+	}
 
-	req := openai.EmbeddingRequest{
-		Input: cleanTexts,
-		Model: openai.AdaEmbeddingV2, // More cost-efficient than AdaV2
+	embeddings := make([][]float32, len(cleanTexts))
+	for _, service := range []*EmbeddingService{e, e.multilingual} {
+		var indexes []int
+		var batch []string
+		for i, text := range cleanTexts {
+			if routes[i] == service {
+				indexes = append(indexes, i)
+				batch = append(batch, text)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		batchEmbeddings, err := service.embedBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range indexes {
+			embeddings[i] = batchEmbeddings[j]
+		}
 	}
 
-	resp, err := e.client.CreateEmbeddings(ctx, req)
+	return embeddings, nil
+}
+
+// embedBatch embeds cleaned texts with the service's model in one request
+func (e *EmbeddingService) embedBatch(ctx context.Context, cleanTexts []string) ([][]float32, error) {
+	resp, err := e.createEmbeddings(ctx, cleanTexts, 30*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
 	}
@@ -106,10 +353,94 @@ func (e *EmbeddingService) GenerateEmbeddings(ctx context.Context, texts []strin
 		return nil, fmt.Errorf("embedding count mismatch: expected %d, got %d", len(cleanTexts), len(resp.Data))
 	}
 
+	// Order results by input index; the API doesn't guarantee response order
 	embeddings := make([][]float32, len(resp.Data))
-	for i, data := range resp.Data {
-		embeddings[i] = data.Embedding
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(embeddings) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("invalid embedding index %d in response", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
 	}
 
 	return embeddings, nil
 }
+
+// createEmbeddings calls the embeddings API, retrying transient failures with
+// exponential backoff. Each attempt gets its own timeout, defaultTimeout
+// unless the retry policy sets one; retries stop early when ctx is cancelled
+// or its deadline would pass before the next attempt.
+func (e *EmbeddingService) createEmbeddings(ctx context.Context, input []string, defaultTimeout time.Duration) (openai.EmbeddingResponse, error) {
+	attemptTimeout := defaultTimeout
+	if e.retry.AttemptTimeout > 0 {
+		attemptTimeout = e.retry.AttemptTimeout
+	}
+
+	var lastErr error
+
+	for attempt := 1; attempt <= e.retry.MaxAttempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		resp, err := e.client.CreateEmbeddings(attemptCtx, e.request(input))
+		cancel()
+		if err == nil {
+			metrics.RecordTokenUsage(string(e.model), "embedding", resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+			return resp, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil || !isRetryableEmbeddingError(err) || attempt == e.retry.MaxAttempts {
+			break
+		}
+
+		delay := e.retry.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			break
+		}
+
+		slog.Warn("Embedding request failed, retrying",
+			"error", err,
+			"attempt", attempt,
+			"max_attempts", e.retry.MaxAttempts,
+			"delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return openai.EmbeddingResponse{}, lastErr
+		case <-time.After(delay):
+		}
+	}
+
+	return openai.EmbeddingResponse{}, lastErr
+}
+
+// backoff returns the delay before the retry following attempt, with up to 50% jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// isRetryableEmbeddingError reports whether err is a rate limit, server error or timeout
+func isRetryableEmbeddingError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.HTTPStatusCode)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return isRetryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"knowthis/internal/metrics"
+)
+
+// EmbeddingCache keeps the embeddings of recently embedded texts, evicting
+// the least recently used once full. Entries are keyed by model and output
+// size as well as text, so a model change never serves another model's
+// vectors; those entries simply age out.
+type EmbeddingCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type cachedEmbedding struct {
+	key       string
+	embedding []float32
+	expiresAt time.Time
+}
+
+// NewEmbeddingCache creates a cache holding up to maxSize embeddings, each
+// expiring after ttl; a zero ttl keeps entries until they are evicted
+func NewEmbeddingCache(maxSize int, ttl time.Duration) *EmbeddingCache {
+	return &EmbeddingCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the unexpired embedding cached under the key
+func (c *EmbeddingCache) Get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		metrics.EmbeddingCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	entry := element.Value.(*cachedEmbedding)
+	if c.ttl > 0 && !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		metrics.EmbeddingCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	metrics.EmbeddingCacheRequests.WithLabelValues("hit").Inc()
+	return append([]float32(nil), entry.embedding...), true
+}
+
+// Put caches the embedding under the key, evicting the least recently used
+// entry when the cache is full
+func (c *EmbeddingCache) Put(key string, embedding []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cachedEmbedding{
+		key:       key,
+		embedding: append([]float32(nil), embedding...),
+		expiresAt: c.now().Add(c.ttl),
+	}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedEmbedding).key)
+	}
+}
+
+// Len returns the number of cached embeddings, including expired ones not yet removed
+func (c *EmbeddingCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// embeddingCacheKey identifies text embedded by a model at an output size.
+// Whitespace is collapsed, so "how do I  deploy?\n" and "how do I deploy?"
+// share an entry.
+func embeddingCacheKey(model string, dimensions int, text string) string {
+	normalized := strings.Join(strings.Fields(text), " ")
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", model, dimensions, normalized)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEmbeddingCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewEmbeddingCache(2, 0)
+	cache.Put("a", []float32{1})
+	cache.Put("b", []float32{2})
+
+	// Reading a makes b the least recently used
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	cache.Put("c", []float32{3})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %s to stay cached", key)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+
+	// Replacing an entry refreshes it without growing the cache
+	cache.Put("a", []float32{4})
+	cache.Put("d", []float32{5})
+	if embedding, ok := cache.Get("a"); !ok || embedding[0] != 4 {
+		t.Errorf("Expected the replaced embedding, got %v", embedding)
+	}
+	if _, ok := cache.Get("c"); ok {
+		t.Error("Expected c to be evicted after a was replaced")
+	}
+}
+
+func TestEmbeddingCache_ExpiresAfterTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewEmbeddingCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Put("key", []float32{0.1})
+	if _, ok := cache.Get("key"); !ok {
+		t.Fatal("Expected a fresh entry to be cached")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Expected the entry to expire after the TTL")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected the expired entry to be removed, got %d entries", cache.Len())
+	}
+}
+
+func TestEmbeddingCache_ReturnsCopies(t *testing.T) {
+	cache := NewEmbeddingCache(10, 0)
+	embedding := []float32{0.1, 0.2}
+	cache.Put("key", embedding)
+	embedding[0] = 9
+
+	cached, _ := cache.Get("key")
+	cached[1] = 9
+
+	if again, _ := cache.Get("key"); again[0] != 0.1 || again[1] != 0.2 {
+		t.Errorf("Expected callers' changes not to reach the cache, got %v", again)
+	}
+}
+
+func TestEmbeddingCache_ConcurrentAccess(t *testing.T) {
+	cache := NewEmbeddingCache(16, time.Minute)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("query-%d", (worker+i)%32)
+				if _, ok := cache.Get(key); !ok {
+					cache.Put(key, []float32{float32(i)})
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	if cache.Len() > 16 {
+		t.Errorf("Expected at most 16 entries, got %d", cache.Len())
+	}
+}
+
+func TestEmbeddingService_CachesQueryEmbeddings(t *testing.T) {
+	client := &mockEmbeddingClient{}
+	service := newRetryTestService(client, 1)
+	cache := NewEmbeddingCache(10, 0)
+	service.SetCache(cache)
+
+	for _, query := range []string{"how do I roll back?", "  how do I\nroll back?  "} {
+		if _, err := service.GenerateEmbedding(context.Background(), query); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected repeated queries to be embedded once, got %d API calls", client.calls)
+	}
+
+	// Another model's embedding of the same text isn't reused
+	other := newRetryTestService(client, 1)
+	other.model = openai.SmallEmbedding3
+	other.SetCache(cache)
+	if _, err := other.GenerateEmbedding(context.Background(), "how do I roll back?"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.calls != 2 {
+		t.Errorf("Expected a model change to miss the cache, got %d API calls", client.calls)
+	}
+}
@@ -1,8 +1,19 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"knowthis/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sashabaranov/go-openai"
 )
 
 func TestGenerateEmbedding_EmptyInput(t *testing.T) {
@@ -195,4 +206,407 @@ func TestTextTruncation(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// newEmbeddingTestServer records embedding requests and answers with 1536-dimension vectors
+func newEmbeddingTestServer(t *testing.T, requests *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode embedding request: %v", err)
+		}
+		*requests = append(*requests, req)
+
+		inputs, _ := req["input"].([]interface{})
+		resp := openai.EmbeddingResponse{}
+		for i := range inputs {
+			resp.Data = append(resp.Data, openai.Embedding{Index: i, Embedding: make([]float32, 1536)})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestEmbeddingService_UsesConfiguredModel(t *testing.T) {
+	testCases := []struct {
+		name               string
+		model              string
+		dimensions         int
+		expectedModel      string
+		expectedDimensions float64
+	}{
+		{
+			name:          "default model",
+			model:         "",
+			expectedModel: "text-embedding-ada-002",
+		},
+		{
+			name:          "text-embedding-3-small",
+			model:         "text-embedding-3-small",
+			expectedModel: "text-embedding-3-small",
+		},
+		{
+			name:               "text-embedding-3-large shortened to schema size",
+			model:              "text-embedding-3-large",
+			dimensions:         1536,
+			expectedModel:      "text-embedding-3-large",
+			expectedDimensions: 1536,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newEmbeddingTestServer(t, &requests)
+			defer server.Close()
+
+			config := openai.DefaultConfig("test-key")
+			config.BaseURL = server.URL + "/v1"
+			service, err := newEmbeddingService(config, tc.model, tc.dimensions, DefaultRetryPolicy)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if _, err := service.GenerateEmbedding(context.Background(), "deploy runbook"); err != nil {
+				t.Fatalf("GenerateEmbedding failed: %v", err)
+			}
+			if _, err := service.GenerateEmbeddings(context.Background(), []string{"one", "two"}); err != nil {
+				t.Fatalf("GenerateEmbeddings failed: %v", err)
+			}
+
+			if len(requests) != 2 {
+				t.Fatalf("Expected 2 requests, got %d", len(requests))
+			}
+			for _, req := range requests {
+				if req["model"] != tc.expectedModel {
+					t.Errorf("Expected model %s, got %v", tc.expectedModel, req["model"])
+				}
+				dimensions, _ := req["dimensions"].(float64)
+				if dimensions != tc.expectedDimensions {
+					t.Errorf("Expected dimensions %v, got %v", tc.expectedDimensions, req["dimensions"])
+				}
+			}
+		})
+	}
+}
+
+func TestNewEmbeddingService_ValidatesSchemaDimensions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		model       string
+		dimensions  int
+		expectError bool
+	}{
+		{name: "ada matches schema", model: "text-embedding-ada-002"},
+		{name: "3-small matches schema", model: "text-embedding-3-small"},
+		{name: "3-large native size", model: "text-embedding-3-large", expectError: true},
+		{name: "3-large shortened", model: "text-embedding-3-large", dimensions: 1536},
+		{name: "3-small shortened below schema", model: "text-embedding-3-small", dimensions: 512, expectError: true},
+		{name: "ada with custom dimensions", model: "text-embedding-ada-002", dimensions: 512, expectError: true},
+		{name: "unknown model without dimensions", model: "nomic-embed-text", expectError: true},
+		{name: "unknown model with schema dimensions", model: "nomic-embed-text", dimensions: 1536},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewEmbeddingService("test-key", tc.model, tc.dimensions, DefaultRetryPolicy)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected error for model %s with %d dimensions", tc.model, tc.dimensions)
+			} else if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// Mock OpenAI embeddings client returning queued errors before succeeding
+type mockEmbeddingClient struct {
+	errors    []error
+	calls     int
+	modelErr  error
+	deadlines []time.Time
+}
+
+func (m *mockEmbeddingClient) GetModel(ctx context.Context, modelID string) (openai.Model, error) {
+	if m.modelErr != nil {
+		return openai.Model{}, m.modelErr
+	}
+	return openai.Model{ID: modelID}, nil
+}
+
+func (m *mockEmbeddingClient) CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error) {
+	m.calls++
+	deadline, _ := ctx.Deadline()
+	m.deadlines = append(m.deadlines, deadline)
+	if len(m.errors) > 0 {
+		err := m.errors[0]
+		m.errors = m.errors[1:]
+		return openai.EmbeddingResponse{}, err
+	}
+	return openai.EmbeddingResponse{
+		Data:  []openai.Embedding{{Embedding: []float32{0.1, 0.2}}},
+		Usage: openai.Usage{PromptTokens: 4, TotalTokens: 4},
+	}, nil
+}
+
+func newRetryTestService(client *mockEmbeddingClient, maxAttempts int) *EmbeddingService {
+	return &EmbeddingService{
+		client: client,
+		model:  openai.AdaEmbeddingV2,
+		retry:  RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond},
+	}
+}
+
+func TestGenerateEmbedding_RetriesTransientFailures(t *testing.T) {
+	client := &mockEmbeddingClient{errors: []error{
+		&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"},
+		&openai.RequestError{HTTPStatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")},
+	}}
+	service := newRetryTestService(client, 3)
+
+	embedding, err := service.GenerateEmbedding(context.Background(), "deploy runbook")
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if len(embedding) != 2 {
+		t.Errorf("Expected embedding from successful attempt, got %v", embedding)
+	}
+	if client.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", client.calls)
+	}
+}
+
+func TestGenerateEmbedding_RetryLimits(t *testing.T) {
+	testCases := []struct {
+		name          string
+		errors        []error
+		maxAttempts   int
+		expectedCalls int
+	}{
+		{
+			name:          "permanent error is not retried",
+			errors:        []error{&openai.APIError{HTTPStatusCode: http.StatusBadRequest, Message: "invalid input"}},
+			maxAttempts:   3,
+			expectedCalls: 1,
+		},
+		{
+			name: "gives up after max attempts",
+			errors: []error{
+				&openai.APIError{HTTPStatusCode: http.StatusInternalServerError},
+				&openai.APIError{HTTPStatusCode: http.StatusInternalServerError},
+				&openai.APIError{HTTPStatusCode: http.StatusInternalServerError},
+			},
+			maxAttempts:   2,
+			expectedCalls: 2,
+		},
+		{
+			name:          "timeouts are retried",
+			errors:        []error{context.DeadlineExceeded},
+			maxAttempts:   2,
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &mockEmbeddingClient{errors: tc.errors}
+			service := newRetryTestService(client, tc.maxAttempts)
+
+			service.GenerateEmbedding(context.Background(), "deploy runbook")
+			if client.calls != tc.expectedCalls {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedCalls, client.calls)
+			}
+		})
+	}
+}
+
+func TestGenerateEmbedding_StopsWhenContextCancelled(t *testing.T) {
+	client := &mockEmbeddingClient{errors: []error{
+		&openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable},
+		&openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable},
+	}}
+	service := &EmbeddingService{
+		client: client,
+		model:  openai.AdaEmbeddingV2,
+		retry:  RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour},
+	}
+
+	// The backoff would outlive the deadline, so no further attempt is made
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := service.GenerateEmbedding(ctx, "deploy runbook"); err == nil {
+		t.Fatalf("Expected error when retries cannot fit in the deadline")
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", client.calls)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected retry to abort early, took %v", time.Since(start))
+	}
+}
+
+func TestGenerateEmbedding_AttemptDeadline(t *testing.T) {
+	testCases := []struct {
+		name           string
+		attemptTimeout time.Duration
+		callerTimeout  time.Duration
+		wantCaller     bool // the attempt's deadline is the caller's
+	}{
+		{"caller's shorter deadline is kept", 0, 100 * time.Millisecond, true},
+		{"attempt timeout shortens a longer deadline", time.Second, time.Hour, false},
+		{"default attempt timeout without a caller deadline", 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &mockEmbeddingClient{}
+			service := newRetryTestService(client, 1)
+			service.retry.AttemptTimeout = tc.attemptTimeout
+
+			ctx := context.Background()
+			if tc.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.callerTimeout)
+				defer cancel()
+			}
+			callerDeadline, _ := ctx.Deadline()
+
+			start := time.Now()
+			if _, err := service.GenerateEmbedding(ctx, "deploy runbook"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			end := time.Now()
+
+			if len(client.deadlines) != 1 || client.deadlines[0].IsZero() {
+				t.Fatalf("Expected the attempt to have a deadline, got %v", client.deadlines)
+			}
+			deadline := client.deadlines[0]
+			if tc.wantCaller && !deadline.Equal(callerDeadline) {
+				t.Errorf("Expected the caller's deadline %v, got %v", callerDeadline, deadline)
+			}
+			if !tc.wantCaller {
+				timeout := tc.attemptTimeout
+				if timeout == 0 {
+					timeout = 10 * time.Second
+				}
+				if deadline.Before(start.Add(timeout)) || deadline.After(end.Add(timeout)) {
+					t.Errorf("Expected a deadline about %v away, got %v", timeout, deadline.Sub(start))
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddingService_WithRetryPolicyLeavesOriginal(t *testing.T) {
+	service := newRetryTestService(&mockEmbeddingClient{}, 3)
+	query := service.WithRetryPolicy(RetryPolicy{MaxAttempts: 0, AttemptTimeout: time.Second})
+
+	if service.retry.MaxAttempts != 3 || service.retry.AttemptTimeout != 0 {
+		t.Errorf("Expected the original policy unchanged, got %+v", service.retry)
+	}
+	if query.retry.MaxAttempts != 1 {
+		t.Errorf("Expected at least one attempt, got %d", query.retry.MaxAttempts)
+	}
+}
+
+func TestEmbeddingService_HealthCheck(t *testing.T) {
+	healthy := newRetryTestService(&mockEmbeddingClient{}, 1)
+	if err := healthy.HealthCheck(context.Background()); err != nil {
+		t.Errorf("Expected healthy check, got %v", err)
+	}
+
+	unreachable := newRetryTestService(&mockEmbeddingClient{modelErr: errors.New("connection refused")}, 1)
+	if err := unreachable.HealthCheck(context.Background()); err == nil {
+		t.Errorf("Expected health check to fail when the API is unreachable")
+	}
+}
+
+func TestGenerateEmbedding_RecordsTokenUsage(t *testing.T) {
+	tokens := metrics.OpenAITokens.WithLabelValues(string(openai.AdaEmbeddingV2), "embedding", "prompt")
+	cost := metrics.OpenAIEstimatedCost.WithLabelValues(string(openai.AdaEmbeddingV2), "embedding")
+	tokensBefore, costBefore := testutil.ToFloat64(tokens), testutil.ToFloat64(cost)
+
+	// A failed attempt uses no tokens; the successful retry is counted once
+	client := &mockEmbeddingClient{errors: []error{&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}}}
+	if _, err := newRetryTestService(client, 2).GenerateEmbedding(context.Background(), "deploy runbook"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := testutil.ToFloat64(tokens) - tokensBefore; got != 4 {
+		t.Errorf("Expected 4 prompt tokens counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(cost) - costBefore; got <= 0 {
+		t.Errorf("Expected the estimated cost to advance, got %v", got)
+	}
+}
+
+func TestEmbeddingService_MultilingualModel(t *testing.T) {
+	var requests []map[string]interface{}
+	server := newEmbeddingTestServer(t, &requests)
+	defer server.Close()
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	service, err := newEmbeddingService(config, "", 0, DefaultRetryPolicy)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := service.SetMultilingualModel("text-embedding-3-large"); err == nil {
+		t.Error("Expected a model too large for the vector columns to be rejected")
+	}
+	if err := service.SetMultilingualModel("text-embedding-3-small"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spanish := "¿Cómo reiniciamos el servidor cuando la base de datos no responde?"
+	english := "How do we restart the server when the database is down?"
+
+	if _, err := service.GenerateEmbedding(context.Background(), spanish); err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if _, err := service.GenerateEmbeddingForLanguage(context.Background(), english, "es"); err != nil {
+		t.Fatalf("GenerateEmbeddingForLanguage failed: %v", err)
+	}
+	if _, err := service.GenerateEmbedding(context.Background(), english); err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+
+	embeddings, err := service.GenerateEmbeddings(context.Background(), []string{english, spanish, "deploy runbook"})
+	if err != nil {
+		t.Fatalf("GenerateEmbeddings failed: %v", err)
+	}
+	if len(embeddings) != 3 {
+		t.Fatalf("Expected 3 embeddings in input order, got %d", len(embeddings))
+	}
+
+	// Undetected text stays with the configured model; each model's texts are batched
+	expected := []struct {
+		model  string
+		inputs int
+	}{
+		{"text-embedding-3-small", 1},
+		{"text-embedding-3-small", 1},
+		{"text-embedding-ada-002", 1},
+		{"text-embedding-ada-002", 2},
+		{"text-embedding-3-small", 1},
+	}
+	if len(requests) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(requests))
+	}
+	for i, want := range expected {
+		inputs, _ := requests[i]["input"].([]interface{})
+		if requests[i]["model"] != want.model || len(inputs) != want.inputs {
+			t.Errorf("Request %d: expected %d inputs for %s, got %d for %v", i, want.inputs, want.model, len(inputs), requests[i]["model"])
+		}
+	}
+
+	// Query copies route the same way
+	query := service.WithRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	if query.ForLanguage("es") == query || query.ForLanguage("en") != query || query.ForLanguage("") != query {
+		t.Error("Expected the query copy to route only languages other than English")
+	}
+}
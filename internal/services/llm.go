@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"knowthis/internal/metrics"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// LLMProvider generates chat completions. Any OpenAI-compatible API
+// (OpenAI, Ollama, vLLM, ...) can back it.
+type LLMProvider interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// NewLLMProvider creates a chat client for an OpenAI-compatible API.
+// An empty baseURL uses the OpenAI API.
+func NewLLMProvider(apiKey, baseURL string) LLMProvider {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	return openai.NewClientWithConfig(config)
+}
+
+// ValidateLLMProvider checks that the provider is reachable and serves the model
+func ValidateLLMProvider(ctx context.Context, provider LLMProvider, model string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := provider.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     model,
+		MaxTokens: 1,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "ping",
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reach chat model %s: %w", model, err)
+	}
+
+	return nil
+}
+
+// recordChatUsage counts the tokens and estimated cost of a chat completion
+func recordChatUsage(model, operation string, usage openai.Usage) {
+	metrics.RecordTokenUsage(model, operation, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"knowthis/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestLLMProvider_UsesConfiguredBaseURL(t *testing.T) {
+	var gotPath, gotModel string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		gotModel = req.Model
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "pong"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider := NewLLMProvider("", server.URL+"/v1")
+
+	resp, err := provider.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "llama3",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "ping"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if gotPath != "/v1/chat/completions" {
+		t.Errorf("Expected request to configured base URL path /v1/chat/completions, got %s", gotPath)
+	}
+	if gotModel != "llama3" {
+		t.Errorf("Expected model llama3, got %s", gotModel)
+	}
+	if resp.Choices[0].Message.Content != "pong" {
+		t.Errorf("Expected response content pong, got %s", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestValidateLLMProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"message": "model not found"}}`))
+	}))
+	defer server.Close()
+
+	provider := NewLLMProvider("", server.URL+"/v1")
+
+	if err := ValidateLLMProvider(context.Background(), provider, "missing-model"); err == nil {
+		t.Errorf("Expected validation error for unreachable model")
+	}
+}
+
+type usageLLMProvider struct{}
+
+func (m *usageLLMProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "Rotate the deploy key"}}},
+		Usage:   openai.Usage{PromptTokens: 1200, CompletionTokens: 80, TotalTokens: 1280},
+	}, nil
+}
+
+func TestRAGService_RecordsTokenUsage(t *testing.T) {
+	metrics.SetTokenPrices(map[string]metrics.TokenPrice{"usage-test-model": {Prompt: 1, Completion: 5}})
+	t.Cleanup(func() { metrics.SetTokenPrices(metrics.DefaultTokenPrices) })
+
+	rag := NewRAGService(&usageLLMProvider{}, "usage-test-model", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+	if _, err := rag.Query(context.Background(), "where is the deploy key?"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]float64{"prompt": 1200, "completion": 80, "total": 1280}
+	for tokenType, count := range expected {
+		if got := testutil.ToFloat64(metrics.OpenAITokens.WithLabelValues("usage-test-model", "answer", tokenType)); got != count {
+			t.Errorf("Expected %v %s tokens, got %v", count, tokenType, got)
+		}
+	}
+
+	// 1200 prompt tokens at $1/M and 80 completion tokens at $5/M
+	if got := testutil.ToFloat64(metrics.OpenAIEstimatedCost.WithLabelValues("usage-test-model", "answer")); got < 0.0016-1e-12 || got > 0.0016+1e-12 {
+		t.Errorf("Expected estimated cost 0.0016, got %v", got)
+	}
+}
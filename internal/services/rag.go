@@ -2,61 +2,541 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"knowthis/internal/integrations/slack"
+	"knowthis/internal/language"
+	"knowthis/internal/metrics"
+	"knowthis/internal/storage"
+	"knowthis/internal/tracing"
 
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// MessageSearcher finds the stored Slack messages closest to an embedding
+type MessageSearcher interface {
+	SearchSimilarMessages(ctx context.Context, embedding []float32, limit int, filter slack.SearchFilter) ([]slack.SlackMessage, error)
+}
+
+// QueryEmbedder embeds query text
+type QueryEmbedder interface {
+	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
+}
+
+// LanguageEmbedder embeds query text for searching content in a language,
+// with the model that content was embedded with
+type LanguageEmbedder interface {
+	GenerateEmbeddingForLanguage(ctx context.Context, text, lang string) ([]float32, error)
+}
+
+const (
+	// defaultSearchLimit is how many search results are considered per query
+	defaultSearchLimit = 10
+
+	// fallbackThreads and fallbackSnippetChars bound the sources listed when
+	// answering from sources because the chat model is unavailable
+	fallbackThreads      = 3
+	fallbackSnippetChars = 300
+
+	// MaxSystemPromptChars bounds the configured system prompt and personas
+	MaxSystemPromptChars = 4000
+)
+
+// DefaultSystemPrompt is the system prompt answers are generated with unless
+// configured otherwise
+const DefaultSystemPrompt = "You are a helpful assistant that answers questions based on internal company knowledge from Slack conversations and documents. Be concise and cite relevant sources by their numbers when possible."
+
+// singleSourceInstructions follow the system prompt for single source answers
+const singleSourceInstructions = "Answer strictly from the single source provided and cite it as [1]. If it does not answer the question, say so rather than drawing on other knowledge."
+
 type RAGService struct {
-	openaiClient     *openai.Client
-	slackStorage     *slack.SlackStorage
-	embeddingService *EmbeddingService
+	llm              LLMProvider
+	chatModel        string
+	slackStorage     MessageSearcher
+	embeddingService QueryEmbedder
+	qualityFilter    func(content string) bool
+	thresholds       SimilarityThresholds
+	timeouts         Timeouts
+
+	// Deny all sources to queries that carry no access scope
+	requireAccessScope bool
+
+	// Captures prompt context and answer for a sample of queries; nil disables capture
+	sampler *QuerySampler
+
+	// Drop sources whose content is contained in another source's
+	dedupContainedSources bool
+
+	// Reuses answers to identical queries; nil disables caching
+	cache *AnswerCache
+
+	// Remembers turns by conversation ID for follow-up questions; nil only
+	// uses the history passed with each query
+	conversations *ConversationStore
+
+	// List the most relevant sources instead of failing when the chat model
+	// can't answer
+	sourceFallback bool
+
+	// Follow citations in answers with the cited thread's date
+	inlineCitationDates bool
+
+	// Most prompt tokens sent to the chat model; the least similar sources
+	// are dropped to fit. 0 sends every source.
+	promptTokenBudget int
+
+	// Embeds queries with the model used for content in their language; nil
+	// embeds every query with embeddingService
+	languageEmbedder LanguageEmbedder
+
+	// Searches documents like Slab posts alongside Slack; nil searches
+	// Slack alone
+	documents DocumentSearcher
+
+	// Instructions the chat model answers with, unless a query brings its
+	// own persona
+	systemPrompt string
+}
+
+// QualityFilter sets the minimum size of content considered useful as a source.
+// Content containing code or links is exempt from the size floors, since short
+// canonical answers like "Use `kubectl rollout undo`." are often exactly what's needed.
+type QualityFilter struct {
+	MinChars int
+	MinWords int
+
+	// Phrases marking bot acknowledgements and placeholder content, matched
+	// case-insensitively as whole words: "test message" matches "a test
+	// message!" but not "latest messages"
+	BlockedPhrases []string
+}
+
+// DefaultBlockedPhrases are the phrases filtered out unless configured
+// otherwise. Common words like "example" or "test" are left out, as they
+// appear in plenty of useful answers.
+var DefaultBlockedPhrases = []string{
+	// Bot acknowledgements
+	"got it", "i've processed", "stored the messages", "processed and stored",
+	":+1:", "👍", "✅",
+	// Placeholder content
+	"hello world", "lorem ipsum", "test message", "testing 123",
+	"some other content", "this is my other message", "should also go in",
+}
+
+// DefaultQualityFilter is the quality filter used unless configured otherwise
+var DefaultQualityFilter = QualityFilter{MinChars: 10, MinWords: 2, BlockedPhrases: DefaultBlockedPhrases}
+
+// SimilarityThresholds set how similar a source must be to the query. Sources
+// must beat Primary; when none do, Fallback is tried before giving up.
+type SimilarityThresholds struct {
+	Primary  float64
+	Fallback float64
 }
 
+// DefaultSimilarityThresholds are the similarity thresholds used unless configured otherwise
+var DefaultSimilarityThresholds = SimilarityThresholds{Primary: 0.75, Fallback: 0.6}
+
+// Timeouts bound the stages of answering a query. Each only shortens the
+// caller's deadline, never extends it; zero leaves the caller's deadline alone.
+type Timeouts struct {
+	// The whole query, from embedding to answer
+	Query time.Duration
+
+	// Generating the answer, and rewriting a follow-up as a standalone question
+	Completion time.Duration
+	Condense   time.Duration
+}
+
+// DefaultTimeouts are the query timeouts used unless configured otherwise
+var DefaultTimeouts = Timeouts{Query: 30 * time.Second, Completion: 30 * time.Second, Condense: 10 * time.Second}
+
+// QueryOptions are per-query settings; the zero value uses the service defaults
+type QueryOptions struct {
+	// Chat model to answer with instead of the configured default. Callers are
+	// responsible for restricting which models may be requested.
+	Model string
+
+	// Answer strictly from the single most relevant thread, citing only it
+	SingleSource bool
+
+	// System prompt replacing the configured one for this query, e.g. for a
+	// team's tone, citation style or refusal behavior; empty uses the
+	// configured prompt. Callers are responsible for bounding its length.
+	Persona string
+
+	// Restrict sources to one source ("slack" or "slab"), to content in
+	// [After, Before) and to content detected to be in Language (an ISO 639-1
+	// code); zero values don't restrict
+	Source   string
+	After    time.Time
+	Before   time.Time
+	Language string
+
+	// Number of search results to consider; zero uses the default
+	Limit int
+
+	// How threads are matched: slack.SearchModeVector (the default),
+	// SearchModeKeyword for exact terms, or SearchModeHybrid to blend both
+	SearchMode slack.SearchMode
+
+	// Minimum similarity for a source, replacing the default threshold and
+	// its fallback; nil uses the defaults
+	MinSimilarity *float64
+
+	// ResponseFormatJSON asks the model for a StructuredAnswer instead of prose,
+	// and ResponseFormatStructured for a CitedAnswer quoting its sources;
+	// empty or ResponseFormatText answers in prose
+	ResponseFormat string
+
+	// Return the prompts that would be sent with the retrieved sources instead
+	// of calling the chat model, for prompt debugging. Never cached.
+	DryRun bool
+
+	// Conversation the query follows up on. Its stored turns are used when
+	// History is empty, and the answer is added to it.
+	ConversationID string
+
+	// Prior turns, oldest first, for answering a follow-up question. Only the
+	// most recent turns are used. Queries with history are never cached.
+	History []ConversationTurn
+}
+
+// Response formats for QueryOptions.ResponseFormat
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSON       = "json"
+	ResponseFormatStructured = "structured"
+)
+
 type QueryResult struct {
 	Answer  string               `json:"answer"`
 	Sources []slack.SlackMessage `json:"sources"`
 	Query   string               `json:"query"`
+
+	// The follow-up rewritten as a standalone question for retrieval; empty
+	// for queries without conversation history
+	StandaloneQuery string `json:"standalone_query,omitempty"`
+
+	// Set when a JSON response was requested and the model's output parsed
+	Structured *StructuredAnswer `json:"structured,omitempty"`
+
+	// Set when a structured response was requested and the model's output
+	// parsed, with only the citations of retrieved sources
+	Cited *CitedAnswer `json:"cited,omitempty"`
+
+	// Set instead of an answer for dry runs
+	Prompts *PromptPreview `json:"prompts,omitempty"`
+
+	// Set when the chat model failed and Answer lists the most relevant
+	// sources instead of answering
+	Degraded bool `json:"degraded,omitempty"`
+
+	// The threads the answer may cite, by citation number
+	Citations []Citation `json:"citations,omitempty"`
 }
 
-func NewRAGService(openaiAPIKey string, slackStorage *slack.SlackStorage, embeddingService *EmbeddingService) *RAGService {
-	client := openai.NewClient(openaiAPIKey)
+// PromptPreview is the chat prompts a query would send to the model
+type PromptPreview struct {
+	System string `json:"system"`
+	User   string `json:"user"`
+}
 
+// StructuredAnswer is the answer schema for JSON responses
+type StructuredAnswer struct {
+	Answer      string   `json:"answer"`
+	Confidence  float64  `json:"confidence"`   // 0-1, how well the sources support the answer
+	ActionItems []string `json:"action_items"` // Follow-ups mentioned in the sources, possibly empty
+}
+
+// structuredAnswerInstructions tells the model the StructuredAnswer schema
+const structuredAnswerInstructions = `Respond with a JSON object with exactly these fields:
+- "answer" (string): the answer, citing sources by their numbers
+- "confidence" (number between 0 and 1): how well the context supports the answer
+- "action_items" (array of strings): follow-up actions mentioned in the context, empty if none`
+
+func NewRAGService(llm LLMProvider, chatModel string, slackStorage MessageSearcher, embeddingService QueryEmbedder) *RAGService {
 	return &RAGService{
-		openaiClient:     client,
+		llm:              llm,
+		chatModel:        chatModel,
 		slackStorage:     slackStorage,
 		embeddingService: embeddingService,
+		qualityFilter:    DefaultQualityFilter.IsQualityContent,
+		thresholds:       DefaultSimilarityThresholds,
+		timeouts:         DefaultTimeouts,
+		systemPrompt:     DefaultSystemPrompt,
+	}
+}
+
+// SetTimeouts updates the query timeouts; negative timeouts are ignored
+func (r *RAGService) SetTimeouts(timeouts Timeouts) {
+	if timeouts.Query < 0 || timeouts.Completion < 0 || timeouts.Condense < 0 {
+		return
+	}
+	r.timeouts = timeouts
+	slog.Info("Updated query timeouts", "query", timeouts.Query, "completion", timeouts.Completion, "condense", timeouts.Condense)
+}
+
+// SetSimilarityThresholds updates the default similarity thresholds for sources
+func (r *RAGService) SetSimilarityThresholds(thresholds SimilarityThresholds) {
+	if thresholds.Fallback >= 0 && thresholds.Fallback <= thresholds.Primary && thresholds.Primary <= 1 {
+		r.thresholds = thresholds
+		slog.Info("Updated similarity thresholds", "primary", thresholds.Primary, "fallback", thresholds.Fallback)
+	}
+}
+
+// SetQualityFilter updates the minimum content size and blocked phrases for sources
+func (r *RAGService) SetQualityFilter(filter QualityFilter) {
+	if filter.MinChars >= 0 && filter.MinWords >= 0 {
+		r.qualityFilter = filter.IsQualityContent
+		slog.Info("Updated quality filter",
+			"min_chars", filter.MinChars,
+			"min_words", filter.MinWords,
+			"blocked_phrases", len(filter.BlockedPhrases))
+	}
+}
+
+// SetContentFilter replaces the quality filter with a custom predicate
+// reporting whether content is useful as a source; nil is ignored
+func (r *RAGService) SetContentFilter(filter func(content string) bool) {
+	if filter != nil {
+		r.qualityFilter = filter
+		slog.Info("Updated quality filter to a custom content filter")
+	}
+}
+
+// SetRequireAccessScope makes queries without an access scope fail closed:
+// they see no sources at all instead of every source
+func (r *RAGService) SetRequireAccessScope(require bool) {
+	r.requireAccessScope = require
+	slog.Info("Updated access scope enforcement", "require_access_scope", require)
+}
+
+// SetDedupContainedSources drops sources whose content already appears in
+// another source, so a message and a source quoting it aren't both cited
+func (r *RAGService) SetDedupContainedSources(enabled bool) {
+	r.dedupContainedSources = enabled
+	slog.Info("Updated contained source dedup", "enabled", enabled)
+}
+
+// SetSourceFallback makes queries whose answer can't be generated, e.g.
+// because the chat model is down, return the most relevant sources with a
+// notice instead of failing
+func (r *RAGService) SetSourceFallback(enabled bool) {
+	r.sourceFallback = enabled
+	slog.Info("Updated answer source fallback", "enabled", enabled)
+}
+
+// SetInlineCitationDates follows each citation in answers with the cited
+// thread's date, e.g. "[1] (May 2024)", so readers can judge how current
+// each source is without checking the citation metadata
+func (r *RAGService) SetInlineCitationDates(enabled bool) {
+	r.inlineCitationDates = enabled
+	slog.Info("Updated inline citation dates", "enabled", enabled)
+}
+
+// SetPromptTokenBudget bounds the prompt sent to the chat model, including
+// the system prompt and conversation history, to tokens. Sources are dropped
+// least similar first to fit, always keeping the most similar one.
+func (r *RAGService) SetPromptTokenBudget(tokens int) {
+	if tokens < 0 {
+		return
+	}
+	r.promptTokenBudget = tokens
+	slog.Info("Updated prompt token budget", "tokens", tokens)
+}
+
+// SetLanguageRouting embeds queries with the model used for content in their
+// language, for when content in languages other than English is embedded
+// with a multilingual model. Queries detected to be in such a language, or
+// restricted to one, only search content in that language, since vectors of
+// different models aren't comparable.
+func (r *RAGService) SetLanguageRouting(embedder LanguageEmbedder) {
+	r.languageEmbedder = embedder
+	slog.Info("Updated query language routing", "enabled", embedder != nil)
+}
+
+// SetSystemPrompt replaces the system prompt answers are generated with.
+// Blank prompts and prompts over MaxSystemPromptChars are ignored.
+func (r *RAGService) SetSystemPrompt(prompt string) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" || utf8.RuneCountInString(prompt) > MaxSystemPromptChars {
+		return
 	}
+	r.systemPrompt = prompt
+	slog.Info("Updated system prompt", "chars", utf8.RuneCountInString(prompt))
+}
+
+// SetQuerySampler enables capture of a sample of queries for offline evaluation
+func (r *RAGService) SetQuerySampler(sampler *QuerySampler) {
+	r.sampler = sampler
+	slog.Info("Updated query sampling", "rate", sampler.rate)
+}
+
+// SetAnswerCache enables reuse of answers to identical queries until they expire
+func (r *RAGService) SetAnswerCache(cache *AnswerCache) {
+	r.cache = cache
+	slog.Info("Updated answer cache", "ttl", cache.ttl)
+}
+
+// SetConversationStore remembers each conversation's turns, so follow-up
+// questions only need to pass their conversation ID
+func (r *RAGService) SetConversationStore(store *ConversationStore) {
+	r.conversations = store
+	slog.Info("Updated conversation store", "ttl", store.ttl, "max_turns", store.maxTurns)
 }
 
 func (r *RAGService) Query(ctx context.Context, query string) (*QueryResult, error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	return r.QueryWithOptions(ctx, query, QueryOptions{})
+}
+
+// QueryWithOptions answers the query using the given per-query options
+func (r *RAGService) QueryWithOptions(ctx context.Context, query string, opts QueryOptions) (*QueryResult, error) {
+	model := opts.Model
+	if model == "" {
+		model = r.chatModel
+	}
+
+	ctx, span := tracing.Start(ctx, "rag.query",
+		attribute.String("llm.model", model),
+		attribute.String("search.mode", string(opts.SearchMode)),
+		attribute.Bool("rag.dry_run", opts.DryRun))
+	result, err := r.queryWithOptions(ctx, query, model, opts)
+	tracing.End(span, err)
+	return result, err
+}
+
+// queryWithOptions answers the query with the given model, annotating the
+// query span in ctx
+func (r *RAGService) queryWithOptions(ctx context.Context, query, model string, opts QueryOptions) (*QueryResult, error) {
+	span := trace.SpanFromContext(ctx)
+
+	history := opts.History
+	if len(history) == 0 && opts.ConversationID != "" && r.conversations != nil {
+		history = r.conversations.History(ctx, opts.ConversationID)
+	}
+	history = lastTurns(history, r.maxConversationTurns())
+
+	var cacheKey string
+	if r.cache != nil && !opts.DryRun && len(history) == 0 {
+		keyOpts := opts
+		keyOpts.Model = model
+		cacheKey = answerCacheKey(ctx, query, keyOpts)
+		if cached, ok := r.cache.Get(cacheKey); ok {
+			span.SetAttributes(attribute.Bool("rag.cache_hit", true))
+			slog.Info("RAG Query answered from cache", "query", query, "model", model)
+			// The cached answer still opens the conversation for follow-ups
+			r.recordTurn(ctx, opts.ConversationID, query, cached.Answer)
+			return cached, nil
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Query)
 	defer cancel()
 
-	slog.Info("RAG Query started", "query", query)
+	slog.Info("RAG Query started", "query", query, "model", model)
 
-	// Generate embedding for the query
-	queryEmbedding, err := r.embeddingService.GenerateEmbedding(ctx, query)
-	if err != nil {
-		slog.Error("Failed to generate query embedding", "error", err)
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	// Without document search only Slack content is searched, so other
+	// sources have nothing to offer
+	if opts.Source != "" && opts.Source != "slack" && r.documents == nil {
+		slog.Info("No searchable content for source", "source", opts.Source)
+		return noRelevantResult(query), nil
+	}
+
+	// Search with a standalone version of a follow-up, since "what about the
+	// second option?" alone retrieves nothing useful. Dry runs promise not to
+	// call the chat model, so they search with the follow-up as is.
+	searchQuery := query
+	if len(history) > 0 && !opts.DryRun {
+		searchQuery = r.condenseQuestion(ctx, model, history, query)
+		slog.Info("Condensed follow-up question", "query", query, "standalone_query", searchQuery, "turns", len(history))
+	}
+
+	// With language routing, a query in another language than English is
+	// only compared with content embedded by the same model
+	searchLanguage := opts.Language
+	if r.languageEmbedder != nil && searchLanguage == "" {
+		if detected := language.Detect(searchQuery); detected != language.English {
+			searchLanguage = detected
+		}
+	}
+
+	// Generate embedding for the query; keyword search doesn't need one
+	var queryEmbedding []float32
+	if opts.SearchMode != slack.SearchModeKeyword {
+		embedCtx, embedSpan := tracing.Start(ctx, "rag.embed_query")
+		var err error
+		if r.languageEmbedder != nil {
+			queryEmbedding, err = r.languageEmbedder.GenerateEmbeddingForLanguage(embedCtx, searchQuery, searchLanguage)
+		} else {
+			queryEmbedding, err = r.embeddingService.GenerateEmbedding(embedCtx, searchQuery)
+		}
+		embedSpan.SetAttributes(attribute.Int("embedding.dimensions", len(queryEmbedding)))
+		tracing.End(embedSpan, err)
+		if err != nil {
+			slog.Error("Failed to generate query embedding", "error", err)
+			return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		}
+		slog.Info("Query embedding generated", "embedding_length", len(queryEmbedding))
 	}
-	slog.Info("Query embedding generated", "embedding_length", len(queryEmbedding))
 
 	// Search for similar messages
-	messages, err := r.slackStorage.SearchSimilarMessages(ctx, queryEmbedding, 10)
-	if err != nil {
-		slog.Error("Failed to search similar messages", "error", err)
-		return nil, fmt.Errorf("failed to search similar messages: %w", err)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
 	}
-	slog.Info("Vector search completed", "messages_found", len(messages))
 
-	// Filter messages with good similarity (>0.75)
+	threshold, fallbackThreshold := r.thresholds.Primary, r.thresholds.Fallback
+	if opts.MinSimilarity != nil {
+		threshold, fallbackThreshold = *opts.MinSimilarity, *opts.MinSimilarity
+	}
+
+	searchCtx, searchSpan := tracing.Start(ctx, "rag.search",
+		attribute.String("search.mode", string(opts.SearchMode)),
+		attribute.Int("search.limit", limit))
+	var messages []slack.SlackMessage
+	var err error
+	if opts.Source == "" || opts.Source == "slack" {
+		messages, err = r.slackStorage.SearchSimilarMessages(searchCtx, queryEmbedding, limit, slack.SearchFilter{
+			After:    opts.After,
+			Before:   opts.Before,
+			Language: searchLanguage,
+			Mode:     opts.SearchMode,
+			Query:    searchQuery,
+		})
+		if err != nil {
+			tracing.End(searchSpan, err)
+			slog.Error("Failed to search similar messages", "error", err)
+			return nil, fmt.Errorf("failed to search similar messages: %w", err)
+		}
+	}
+
+	// Documents are embedded with the default model, so they can't be
+	// compared with a query embedded for another language
+	var documents []slack.SlackMessage
+	if r.documents != nil && queryEmbedding != nil && searchLanguage == "" {
+		documents, err = r.searchDocuments(searchCtx, queryEmbedding, limit, opts)
+		if err != nil {
+			tracing.End(searchSpan, err)
+			slog.Error("Failed to search similar documents", "error", err)
+			return nil, fmt.Errorf("failed to search similar documents: %w", err)
+		}
+		messages = mergeBySimilarity(messages, documents)
+	}
+	searchSpan.SetAttributes(attribute.Int("documents.found", len(messages)))
+	searchSpan.End()
+	slog.Info("Search completed", "messages_found", len(messages)-len(documents), "documents_found", len(documents), "mode", opts.SearchMode)
+
+	// Drop sources the caller can't access before anything else sees them
+	messages = r.enforceAccessScope(ctx, messages)
+
+	// Filter messages with good similarity
 	var relevantMessages []slack.SlackMessage
 	for i, msg := range messages {
 		contentPreview := msg.Content
@@ -64,17 +544,14 @@ func (r *RAGService) Query(ctx context.Context, query string) (*QueryResult, err
 			contentPreview = contentPreview[:100] + "..."
 		}
 
-		// Calculate similarity (SearchSimilarMessages returns messages ordered by similarity)
-		similarity := calculateSimilarity(queryEmbedding, msg, i)
-
 		slog.Info("Message similarity",
 			"index", i,
-			"similarity", similarity,
+			"similarity", msg.Similarity,
 			"content", contentPreview,
 			"user", msg.UserName,
 			"id", msg.ID)
 
-		if similarity > 0.75 && isQualityContent(msg.Content) {
+		if msg.Similarity > threshold && r.qualityFilter(msg.Content) {
 			relevantMessages = append(relevantMessages, msg)
 		}
 	}
@@ -82,115 +559,350 @@ func (r *RAGService) Query(ctx context.Context, query string) (*QueryResult, err
 	slog.Info("Similarity filtering completed",
 		"total_messages", len(messages),
 		"relevant_messages", len(relevantMessages),
-		"threshold", 0.75)
+		"threshold", threshold)
 
 	// If no high-quality results, try with lower threshold but still apply quality filter
-	if len(relevantMessages) == 0 {
+	if len(relevantMessages) == 0 && fallbackThreshold < threshold {
 		slog.Info("No high-quality results, trying lower threshold")
-		for i, msg := range messages {
-			similarity := calculateSimilarity(queryEmbedding, msg, i)
-			if similarity > 0.6 && isQualityContent(msg.Content) {
+		for _, msg := range messages {
+			if msg.Similarity > fallbackThreshold && r.qualityFilter(msg.Content) {
 				relevantMessages = append(relevantMessages, msg)
 			}
 		}
 		slog.Info("Lower threshold results", "found", len(relevantMessages))
 	}
 
+	span.SetAttributes(
+		attribute.Float64("similarity.threshold", threshold),
+		attribute.Float64("similarity.fallback_threshold", fallbackThreshold),
+		attribute.Int("documents.found", len(messages)),
+		attribute.Int("documents.relevant", len(relevantMessages)))
+
 	if len(relevantMessages) == 0 {
 		slog.Warn("No relevant messages found", "query", query)
+		return noRelevantResult(query), nil
+	}
+
+	if r.dedupContainedSources {
+		relevantMessages = dropContainedSources(relevantMessages)
+	}
+
+	systemPrompt := r.systemPrompt
+	if opts.Persona != "" {
+		systemPrompt = opts.Persona
+	}
+
+	if opts.SingleSource {
+		relevantMessages = topThread(relevantMessages)
+		slog.Info("Single source mode", "thread_id", relevantMessages[0].ThreadID, "messages", len(relevantMessages))
+	}
+
+	if r.promptTokenBudget > 0 {
+		kept := fitPromptBudget(r.promptTokenBudget, query, model, systemPrompt, opts.SingleSource, opts.ResponseFormat, history, relevantMessages)
+		span.SetAttributes(attribute.Int("documents.dropped", len(relevantMessages)-len(kept)))
+		relevantMessages = kept
+	}
+
+	if opts.DryRun {
+		systemPrompt, userPrompt, _ := buildPrompts(query, systemPrompt, opts.SingleSource, opts.ResponseFormat, relevantMessages)
+		slog.Info("Dry run, skipping chat completion", "query", query, "sources", len(relevantMessages))
 		return &QueryResult{
-			Answer:  "I couldn't find any relevant information to answer your question.",
-			Sources: []slack.SlackMessage{},
-			Query:   query,
+			Sources:   relevantMessages,
+			Query:     query,
+			Prompts:   &PromptPreview{System: systemPrompt, User: userPrompt},
+			Citations: buildCitations(relevantMessages),
 		}, nil
 	}
 
 	// Generate answer using OpenAI GPT
-	answer, err := r.generateAnswer(ctx, query, relevantMessages)
+	answer, err := r.generateAnswer(ctx, query, model, systemPrompt, opts.SingleSource, opts.ResponseFormat, history, relevantMessages)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
+		if !r.sourceFallback {
+			return nil, fmt.Errorf("failed to generate answer: %w", err)
+		}
+
+		// The sources are still worth returning; the fallback is neither
+		// cached nor remembered as a conversation turn
+		slog.Warn("Failed to generate answer, answering with sources", "error", err, "sources", len(relevantMessages))
+		metrics.AnswerFallbacks.Inc()
+		return sourceFallbackResult(query, relevantMessages), nil
+	}
+
+	result := &QueryResult{
+		Answer:    answer,
+		Sources:   relevantMessages,
+		Query:     query,
+		Citations: buildCitations(relevantMessages),
+	}
+	if searchQuery != query {
+		result.StandaloneQuery = searchQuery
+	}
+
+	switch opts.ResponseFormat {
+	case ResponseFormatJSON:
+		structured, err := parseStructuredAnswer(answer)
+		if err != nil {
+			// Keep the raw output as a prose answer rather than failing the query
+			slog.Warn("Failed to parse structured answer, falling back to prose", "error", err)
+		} else {
+			result.Answer = structured.Answer
+			result.Structured = structured
+		}
+	case ResponseFormatStructured:
+		cited, err := parseCitedAnswer(answer, relevantMessages)
+		if err != nil {
+			slog.Warn("Failed to parse cited answer, falling back to prose", "error", err)
+		} else {
+			result.Answer = cited.Answer
+			result.Cited = cited
+		}
+	}
+
+	if r.inlineCitationDates {
+		result.Answer = inlineCitationDates(result.Answer, result.Citations)
+		if result.Structured != nil {
+			result.Structured.Answer = result.Answer
+		}
+		if result.Cited != nil {
+			result.Cited.Answer = result.Answer
+		}
+	}
+
+	if cacheKey != "" {
+		r.cache.Put(cacheKey, result)
 	}
 
+	r.recordTurn(ctx, opts.ConversationID, query, result.Answer)
+
+	return result, nil
+}
+
+// recordTurn appends the answered question to its conversation, if any
+func (r *RAGService) recordTurn(ctx context.Context, conversationID, query, answer string) {
+	if conversationID != "" && r.conversations != nil {
+		r.conversations.Append(ctx, conversationID, ConversationTurn{Question: query, Answer: answer})
+	}
+}
+
+// maxConversationTurns is how many prior turns a follow-up is answered with
+func (r *RAGService) maxConversationTurns() int {
+	if r.conversations != nil {
+		return r.conversations.maxTurns
+	}
+	return defaultConversationTurns
+}
+
+// parseStructuredAnswer parses and validates a JSON answer from the model
+func parseStructuredAnswer(content string) (*StructuredAnswer, error) {
+	var answer StructuredAnswer
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if strings.TrimSpace(answer.Answer) == "" {
+		return nil, fmt.Errorf("missing answer")
+	}
+	if answer.Confidence < 0 || answer.Confidence > 1 {
+		return nil, fmt.Errorf("confidence %v out of range", answer.Confidence)
+	}
+	if answer.ActionItems == nil {
+		answer.ActionItems = []string{}
+	}
+
+	return &answer, nil
+}
+
+// noRelevantResult is the answer given when no sources pass the filters
+func noRelevantResult(query string) *QueryResult {
 	return &QueryResult{
-		Answer:  answer,
-		Sources: relevantMessages,
+		Answer:  "I couldn't find any relevant information to answer your question.",
+		Sources: []slack.SlackMessage{},
 		Query:   query,
-	}, nil
+	}
 }
 
-// isQualityContent filters out low-quality content that shouldn't be in search results
-func isQualityContent(content string) bool {
-	content = strings.ToLower(strings.TrimSpace(content))
+// sourceFallbackResult lists snippets of the most relevant threads in place
+// of an answer, for when the chat model is unavailable
+func sourceFallbackResult(query string, messages []slack.SlackMessage) *QueryResult {
+	var answer strings.Builder
+	answer.WriteString("AI summarization is unavailable right now, here are the most relevant threads:")
 
-	// Filter out bot responses and acknowledgments
-	botPatterns := []string{
-		"got it", "i've processed", "stored the messages",
-		":+1:", "👍", "✅", "done", "processed and stored",
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		if seen[msg.ThreadID] {
+			continue
+		}
+		seen[msg.ThreadID] = true
+
+		snippet := strings.Join(strings.Fields(msg.Content), " ")
+		if runes := []rune(snippet); len(runes) > fallbackSnippetChars {
+			snippet = string(runes[:fallbackSnippetChars]) + "..."
+		}
+		fmt.Fprintf(&answer, "\n\n%d. %s: %s", len(seen), msg.UserName, snippet)
+
+		if len(seen) == fallbackThreads {
+			break
+		}
 	}
 
-	for _, pattern := range botPatterns {
-		if strings.Contains(content, pattern) {
-			return false
+	return &QueryResult{
+		Answer:   answer.String(),
+		Sources:  messages,
+		Query:    query,
+		Degraded: true,
+	}
+}
+
+// enforceAccessScope removes messages outside the caller's access scope.
+// Without a scope, all messages pass unless a scope is required.
+func (r *RAGService) enforceAccessScope(ctx context.Context, messages []slack.SlackMessage) []slack.SlackMessage {
+	scope, ok := AccessScopeFromContext(ctx)
+	if !ok {
+		if !r.requireAccessScope {
+			return messages
 		}
+		scope = NewAccessScope(nil)
 	}
 
-	// Filter out test/placeholder content
-	testPatterns := []string{
-		"test", "testing", "some other content",
-		"this is my other message", "should also go in",
-		"hello world", "sample", "example",
+	allowed := make([]slack.SlackMessage, 0, len(messages))
+	for _, msg := range messages {
+		if scope.Allows(msg) {
+			allowed = append(allowed, msg)
+		}
 	}
 
-	for _, pattern := range testPatterns {
-		if strings.Contains(content, pattern) {
+	if suppressed := len(messages) - len(allowed); suppressed > 0 {
+		slog.Info("Suppressed sources outside access scope", "suppressed", suppressed, "allowed", len(allowed))
+	}
+
+	return allowed
+}
+
+// IsQualityContent filters out low-quality content that shouldn't be in search results
+func (f QualityFilter) IsQualityContent(content string) bool {
+	content = strings.ToLower(strings.TrimSpace(content))
+
+	for _, phrase := range f.BlockedPhrases {
+		if slack.ContainsPhrase(content, strings.ToLower(strings.TrimSpace(phrase))) {
 			return false
 		}
 	}
 
+	// Short answers with code or links are still useful
+	if containsCodeOrLink(content) {
+		return true
+	}
+
 	// Require minimum meaningful length (after cleaning)
-	if len(content) < 20 {
+	if len(content) < f.MinChars {
 		return false
 	}
 
 	// Require some meaningful words
 	words := strings.Fields(content)
-	if len(words) < 4 {
+	if len(words) < f.MinWords {
 		return false
 	}
 
 	return true
 }
 
-// calculateSimilarity estimates similarity based on position in results
-// Since SearchSimilarMessages returns results ordered by similarity, we estimate
-func calculateSimilarity(queryEmbedding []float32, msg slack.SlackMessage, index int) float64 {
-	// Return a decreasing similarity score based on position
-	// First result gets ~0.9, subsequent results get lower scores
-	return 0.9 - (float64(index) * 0.05)
+// containsCodeOrLink reports whether content has inline code, a code block, or a URL
+func containsCodeOrLink(content string) bool {
+	return strings.Contains(content, "`") ||
+		strings.Contains(content, "http://") ||
+		strings.Contains(content, "https://")
 }
 
-func (r *RAGService) generateAnswer(ctx context.Context, query string, messages []slack.SlackMessage) (string, error) {
-	// Build context from Slack messages, organized by thread
-	var contextParts []string
-	threadGroups := make(map[string][]slack.SlackMessage)
+// dropContainedSources removes messages whose content is a substring of another
+// message's content, keeping the superset. Of identical messages, the first is kept.
+// Comparison ignores case and whitespace differences.
+func dropContainedSources(messages []slack.SlackMessage) []slack.SlackMessage {
+	normalized := make([]string, len(messages))
+	for i, msg := range messages {
+		normalized[i] = strings.Join(strings.Fields(strings.ToLower(msg.Content)), " ")
+	}
+
+	var kept []slack.SlackMessage
+	for i, msg := range messages {
+		contained := false
+		for j := range messages {
+			if i == j || !strings.Contains(normalized[j], normalized[i]) {
+				continue
+			}
+			if len(normalized[j]) > len(normalized[i]) || j < i {
+				contained = true
+				break
+			}
+		}
+
+		if contained {
+			slog.Debug("Dropping source contained in another source", "id", msg.ID, "thread_id", msg.ThreadID)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+
+	return kept
+}
 
-	// Group messages by thread
+// topThread keeps only the messages of the thread of the first (most similar) message
+func topThread(messages []slack.SlackMessage) []slack.SlackMessage {
+	var thread []slack.SlackMessage
 	for _, msg := range messages {
-		threadGroups[msg.ThreadID] = append(threadGroups[msg.ThreadID], msg)
+		if msg.ThreadID == messages[0].ThreadID {
+			thread = append(thread, msg)
+		}
 	}
+	return thread
+}
+
+func (r *RAGService) generateAnswer(ctx context.Context, query, model, systemPrompt string, singleSource bool, format string, history []ConversationTurn, messages []slack.SlackMessage) (string, error) {
+	systemPrompt, userPrompt, context := buildPrompts(query, systemPrompt, singleSource, format, messages)
+
+	jsonMode := format == ResponseFormatJSON || format == ResponseFormatStructured
+	answer, err := r.callOpenAIAPI(ctx, model, systemPrompt, history, userPrompt, jsonMode)
+	if err != nil {
+		return "", err
+	}
+
+	r.sampler.Capture(ctx, &storage.QuerySample{
+		QueryID: QueryIDFromContext(ctx),
+		Query:   query,
+		Context: context,
+		Answer:  answer,
+		Model:   model,
+	})
+
+	return answer, nil
+}
+
+// buildPrompts builds the system prompt, from the base system prompt, and the
+// user prompt answering the query from the messages in the response format,
+// and the context section of the user prompt. Structured answers quote
+// messages by their IDs.
+func buildPrompts(query, systemPrompt string, singleSource bool, format string, messages []slack.SlackMessage) (string, string, string) {
+	// Build context from Slack messages and documents, organized by thread
+	// and numbered as in the result's citations
+	var contextParts []string
 
 	contextIndex := 1
-	for _, threadMessages := range threadGroups {
+	for _, threadMessages := range groupThreads(messages) {
 		// Sort messages within thread by timestamp
 		// (they should already be sorted from SearchSimilarMessages)
 
 		contextParts = append(contextParts, fmt.Sprintf(
-			"[%d] Thread conversation:",
-			contextIndex))
+			"[%d] %s:",
+			contextIndex, sourceHeading(threadMessages[0])))
 
 		for _, msg := range threadMessages {
+			if format == ResponseFormatStructured {
+				contextParts = append(contextParts, fmt.Sprintf(
+					"  (source_id %s) %s: %s", msg.ID, msg.AuthorLabel(), msg.Content))
+				continue
+			}
 			contextParts = append(contextParts, fmt.Sprintf(
-				"  %s: %s", msg.UserName, msg.Content))
+				"  %s: %s", msg.AuthorLabel(), msg.Content))
 		}
 
 		contextIndex++
@@ -198,43 +910,93 @@ func (r *RAGService) generateAnswer(ctx context.Context, query string, messages
 
 	context := strings.Join(contextParts, "\n")
 
-	// Create system prompt for OpenAI
-	systemPrompt := "You are a helpful assistant that answers questions based on internal company knowledge from Slack conversations. Be concise and cite relevant thread conversations by their numbers when possible."
+	userPrompt := fmt.Sprintf(`Based on the following context from our internal knowledge base, please answer the question. Be concise and cite relevant sources by their numbers.
+
+Context:
+%s
+
+Question: %s`, context, query)
 
-	userPrompt := fmt.Sprintf(`Based on the following context from our internal Slack knowledge base, please answer the question. Be concise and cite relevant thread conversations by their numbers.
+	if singleSource {
+		systemPrompt += "\n\n" + singleSourceInstructions
+
+		userPrompt = fmt.Sprintf(`Based only on the following source from our internal knowledge base, please answer the question. Be concise and cite the source as [1].
 
 Context:
 %s
 
 Question: %s`, context, query)
+	}
+
+	switch format {
+	case ResponseFormatJSON:
+		systemPrompt += "\n\n" + structuredAnswerInstructions
+	case ResponseFormatStructured:
+		systemPrompt += "\n\n" + citedAnswerInstructions
+	}
 
-	return r.callOpenAIAPI(ctx, systemPrompt, userPrompt)
+	return systemPrompt, userPrompt, context
 }
 
-func (r *RAGService) callOpenAIAPI(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+// sourceHeading introduces a source in the prompt context, labeled with where
+// it comes from: a Slack thread, or a document by its source and title
+func sourceHeading(msg slack.SlackMessage) string {
+	if msg.Source == "" {
+		return "Slack thread conversation"
+	}
+	if msg.Title == "" {
+		return fmt.Sprintf("Document from %s", msg.Source)
+	}
+	return fmt.Sprintf("Document from %s %q", msg.Source, msg.Title)
+}
 
-	resp, err := r.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:     "gpt-4o-mini",
-		MaxTokens: 1000,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: systemPrompt,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: userPrompt,
-			},
+// chatMessages is the conversation sent for an answer: the system prompt,
+// any prior turns, then the user prompt with the sources
+func chatMessages(systemPrompt string, history []ConversationTurn, userPrompt string) []openai.ChatCompletionMessage {
+	messages := []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
 		},
-		Temperature: 0.7,
+	}
+	messages = append(messages, historyMessages(history)...)
+	return append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: userPrompt,
 	})
+}
+
+// callOpenAIAPI asks the model for an answer, preceded by any prior conversation turns
+func (r *RAGService) callOpenAIAPI(ctx context.Context, model, systemPrompt string, history []ConversationTurn, userPrompt string, jsonMode bool) (string, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Completion)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "rag.completion",
+		attribute.String("llm.model", model),
+		attribute.Int("llm.history_turns", len(history)))
 
+	req := openai.ChatCompletionRequest{
+		Model:       model,
+		MaxTokens:   1000,
+		Messages:    chatMessages(systemPrompt, history, userPrompt),
+		Temperature: 0.7,
+	}
+	if jsonMode {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+
+	resp, err := r.llm.CreateChatCompletion(ctx, req)
 	if err != nil {
 		slog.Error("Failed to call OpenAI API", "error", err)
+		tracing.End(span, err)
 		return "", fmt.Errorf("failed to call OpenAI API: %w", err)
 	}
+	recordChatUsage(model, "answer", resp.Usage)
+	span.SetAttributes(
+		attribute.Int("llm.usage.prompt_tokens", resp.Usage.PromptTokens),
+		attribute.Int("llm.usage.completion_tokens", resp.Usage.CompletionTokens),
+		attribute.Int("llm.usage.total_tokens", resp.Usage.TotalTokens))
+	span.End()
 
 	if len(resp.Choices) == 0 {
 		return "I couldn't generate a response. Please try again.", nil
@@ -242,3 +1004,13 @@ func (r *RAGService) callOpenAIAPI(ctx context.Context, systemPrompt, userPrompt
 
 	return resp.Choices[0].Message.Content, nil
 }
+
+// withTimeout bounds ctx by timeout from now. A deadline ctx already has is
+// kept when it is sooner, so a caller's shorter deadline is never extended;
+// a zero timeout only keeps the caller's deadline.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
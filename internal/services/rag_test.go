@@ -0,0 +1,997 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"knowthis/internal/integrations/slack"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQualityFilter_IsQualityContent(t *testing.T) {
+	filter := DefaultQualityFilter
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{
+			name:     "short code answer",
+			content:  "Use `kubectl rollout undo`.",
+			expected: true,
+		},
+		{
+			name:     "short link answer",
+			content:  "See https://wiki.internal/runbooks/deploy",
+			expected: true,
+		},
+		{
+			name:     "short plain answer above floors",
+			content:  "Restart the ingress controller",
+			expected: true,
+		},
+		{
+			name:     "acknowledgement noise",
+			content:  "ok thanks",
+			expected: false,
+		},
+		{
+			name:     "single word",
+			content:  "interesting",
+			expected: false,
+		},
+		{
+			name:     "bot acknowledgement",
+			content:  "Got it! I've processed and stored the messages.",
+			expected: false,
+		},
+		{
+			name:     "legitimate example",
+			content:  "Here's a code example for the bug: the retry loop never backs off",
+			expected: true,
+		},
+		{
+			name:     "legitimate test discussion",
+			content:  "The integration test for sampling is flaky on arm64 runners",
+			expected: true,
+		},
+		{
+			name:     "blocked phrase inside a longer word",
+			content:  "The latest messages from the exporter show the disk filling up",
+			expected: true,
+		},
+		{
+			name:     "placeholder content",
+			content:  "Hello world, this is a test message for the new channel",
+			expected: false,
+		},
+		{
+			name:     "emoji acknowledgement",
+			content:  "👍 will take a look at it tomorrow",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := filter.IsQualityContent(tc.content); result != tc.expected {
+				t.Errorf("IsQualityContent(%q) = %v, want %v", tc.content, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestQualityFilter_ConfigurableFloors(t *testing.T) {
+	strict := QualityFilter{MinChars: 20, MinWords: 4}
+	content := "Restart the ingress"
+
+	if strict.IsQualityContent(content) {
+		t.Errorf("Expected strict filter to reject %q", content)
+	}
+	if !DefaultQualityFilter.IsQualityContent(content) {
+		t.Errorf("Expected default filter to accept %q", content)
+	}
+
+	// Code stays exempt from the floors even when strict
+	if !strict.IsQualityContent("`make deploy`") {
+		t.Errorf("Expected code answer to bypass strict floors")
+	}
+}
+
+func TestRAGService_SetContentFilter(t *testing.T) {
+	searcher := &mockMessageSearcher{messages: []slack.SlackMessage{
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "alice", Content: "INTERNAL ONLY: the deploy key is in the vault", Similarity: 0.91},
+		{ChannelID: "C1", ThreadID: "2.0", UserName: "bob", Content: "Deploy keys are rotated through the platform runbook", Similarity: 0.84},
+	}}
+	rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+	rag.SetContentFilter(func(content string) bool {
+		return !strings.HasPrefix(content, "INTERNAL ONLY")
+	})
+	// nil keeps the custom filter
+	rag.SetContentFilter(nil)
+
+	result, err := rag.Query(context.Background(), "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Sources) != 1 || result.Sources[0].UserName != "bob" {
+		t.Errorf("Expected only bob's source to pass the custom filter, got %+v", result.Sources)
+	}
+}
+
+type mockMessageSearcher struct {
+	messages []slack.SlackMessage
+	filters  []slack.SearchFilter
+}
+
+func (m *mockMessageSearcher) SearchSimilarMessages(ctx context.Context, embedding []float32, limit int, filter slack.SearchFilter) ([]slack.SlackMessage, error) {
+	m.filters = append(m.filters, filter)
+	return m.messages, nil
+}
+
+type mockQueryEmbedder struct{}
+
+func (m *mockQueryEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{0.1, 0.2, 0.3}, nil
+}
+
+type mockLLMProvider struct {
+	prompts []string
+}
+
+func (m *mockLLMProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	for _, msg := range req.Messages {
+		m.prompts = append(m.prompts, msg.Content)
+	}
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: "Rotate the deploy key"}},
+		},
+	}, nil
+}
+
+func scopedSearchResults() []slack.SlackMessage {
+	// Ordered by similarity: the restricted message ranks first
+	return []slack.SlackMessage{
+		{ChannelID: "C_RESTRICTED", ThreadID: "1.0", UserName: "alice", Content: "The production deploy key is kept in the finance vault", Similarity: 0.91},
+		{ChannelID: "C_PUBLIC", ThreadID: "2.0", UserName: "bob", Content: "Deploy keys are rotated through the platform runbook", Similarity: 0.84},
+	}
+}
+
+func TestRAGService_RetriesTransientQueryEmbeddingErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		err           error
+		expectedCalls int
+		expectSuccess bool
+	}{
+		{
+			name:          "transient error is retried",
+			err:           &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable},
+			expectedCalls: 2,
+			expectSuccess: true,
+		},
+		{
+			name:          "permanent error fails the query",
+			err:           &openai.APIError{HTTPStatusCode: http.StatusBadRequest, Message: "invalid input"},
+			expectedCalls: 1,
+			expectSuccess: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &mockEmbeddingClient{errors: []error{tc.err}}
+			embedder := newRetryTestService(client, 5).WithRetryPolicy(RetryPolicy{
+				MaxAttempts:    2,
+				BaseDelay:      time.Millisecond,
+				AttemptTimeout: time.Second,
+			})
+			rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, embedder)
+
+			result, err := rag.Query(context.Background(), "where is the deploy key?")
+			if tc.expectSuccess && (err != nil || result.Answer == "") {
+				t.Errorf("Expected the query to succeed after a retry, got %v", err)
+			}
+			if !tc.expectSuccess && err == nil {
+				t.Errorf("Expected the query to fail")
+			}
+			if client.calls != tc.expectedCalls {
+				t.Errorf("Expected %d embedding attempts, got %d", tc.expectedCalls, client.calls)
+			}
+		})
+	}
+}
+
+func TestRAGService_ExcludesSourcesOutsideAccessScope(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+
+	ctx := WithAccessScope(context.Background(), NewAccessScope([]string{"C_PUBLIC"}))
+	result, err := rag.Query(ctx, "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, source := range result.Sources {
+		if source.ChannelID == "C_RESTRICTED" {
+			t.Errorf("Expected restricted source to be excluded from citations")
+		}
+	}
+	if len(result.Sources) != 1 {
+		t.Errorf("Expected 1 in-scope source, got %d", len(result.Sources))
+	}
+
+	for _, prompt := range llm.prompts {
+		if strings.Contains(prompt, "finance vault") {
+			t.Errorf("Expected restricted content to be excluded from the prompt")
+		}
+	}
+	if len(llm.prompts) == 0 || !strings.Contains(strings.Join(llm.prompts, "\n"), "platform runbook") {
+		t.Errorf("Expected in-scope content in the prompt")
+	}
+}
+
+func TestRAGService_RequiredAccessScopeFailsClosed(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+	rag.SetRequireAccessScope(true)
+
+	result, err := rag.Query(context.Background(), "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Sources) != 0 {
+		t.Errorf("Expected no sources without an access scope, got %d", len(result.Sources))
+	}
+	if len(llm.prompts) != 0 {
+		t.Errorf("Expected no LLM call without accessible sources")
+	}
+}
+
+func TestRAGService_UnscopedQueriesSeeAllSources(t *testing.T) {
+	rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+
+	result, err := rag.Query(context.Background(), "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Sources) != 2 {
+		t.Errorf("Expected all sources without scoping, got %d", len(result.Sources))
+	}
+}
+
+func TestRAGService_SingleSourceUsesOnlyTopThread(t *testing.T) {
+	messages := []slack.SlackMessage{
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "alice", Content: "The staging database runs Postgres 15", Similarity: 0.88},
+		{ChannelID: "C1", ThreadID: "2.0", UserName: "bob", Content: "Production was upgraded to Postgres 16 last month", Similarity: 0.8},
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "carol", Content: "Staging upgrades are scheduled after production", Similarity: 0.88},
+	}
+
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: messages}, &mockQueryEmbedder{})
+
+	result, err := rag.QueryWithOptions(context.Background(), "which Postgres version does staging run?", QueryOptions{SingleSource: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Sources) != 2 {
+		t.Fatalf("Expected only the 2 messages of the top thread as sources, got %d", len(result.Sources))
+	}
+	for _, source := range result.Sources {
+		if source.ThreadID != "1.0" {
+			t.Errorf("Expected only the top thread to be cited, got thread %s", source.ThreadID)
+		}
+	}
+
+	prompt := strings.Join(llm.prompts, "\n")
+	if strings.Contains(prompt, "Postgres 16") {
+		t.Errorf("Expected lower-ranked threads to be excluded from the prompt")
+	}
+	if !strings.Contains(prompt, "Postgres 15") || !strings.Contains(prompt, "Staging upgrades") {
+		t.Errorf("Expected the whole top thread in the prompt")
+	}
+	if !strings.Contains(prompt, "strictly from the single source") {
+		t.Errorf("Expected the prompt to restrict the answer to the single thread")
+	}
+}
+
+func TestRAGService_FiltersOnReturnedSimilarity(t *testing.T) {
+	testCases := []struct {
+		name            string
+		similarities    []float64
+		minSimilarity   float64
+		thresholds      *SimilarityThresholds
+		expectedSources int
+	}{
+		{
+			name:            "only sources above the high threshold",
+			similarities:    []float64{0.82, 0.7},
+			expectedSources: 1,
+		},
+		{
+			name:            "falls back to the lower threshold",
+			similarities:    []float64{0.7, 0.65},
+			expectedSources: 2,
+		},
+		{
+			name:            "nothing relevant",
+			similarities:    []float64{0.55, 0.4},
+			expectedSources: 0,
+		},
+		{
+			name:            "custom threshold replaces the default",
+			similarities:    []float64{0.55, 0.4},
+			minSimilarity:   0.5,
+			expectedSources: 1,
+		},
+		{
+			name:            "lower configured threshold admits more sources",
+			similarities:    []float64{0.82, 0.7},
+			thresholds:      &SimilarityThresholds{Primary: 0.65, Fallback: 0.5},
+			expectedSources: 2,
+		},
+		{
+			name:            "lower configured fallback admits sources",
+			similarities:    []float64{0.55, 0.4},
+			thresholds:      &SimilarityThresholds{Primary: 0.75, Fallback: 0.5},
+			expectedSources: 1,
+		},
+		{
+			name:            "custom threshold replaces configured thresholds",
+			similarities:    []float64{0.82, 0.7},
+			thresholds:      &SimilarityThresholds{Primary: 0.65, Fallback: 0.5},
+			minSimilarity:   0.8,
+			expectedSources: 1,
+		},
+		{
+			name:            "custom threshold has no fallback",
+			similarities:    []float64{0.7, 0.65},
+			minSimilarity:   0.8,
+			expectedSources: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages := scopedSearchResults()
+			for i := range messages {
+				messages[i].Similarity = tc.similarities[i]
+			}
+			rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: messages}, &mockQueryEmbedder{})
+			if tc.thresholds != nil {
+				rag.SetSimilarityThresholds(*tc.thresholds)
+			}
+
+			var opts QueryOptions
+			if tc.minSimilarity > 0 {
+				opts.MinSimilarity = &tc.minSimilarity
+			}
+			result, err := rag.QueryWithOptions(context.Background(), "where is the deploy key?", opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(result.Sources) != tc.expectedSources {
+				t.Fatalf("Expected %d sources, got %d", tc.expectedSources, len(result.Sources))
+			}
+			for i, source := range result.Sources {
+				if source.Similarity != tc.similarities[i] {
+					t.Errorf("Expected source %d to carry similarity %v, got %v", i, tc.similarities[i], source.Similarity)
+				}
+			}
+		})
+	}
+}
+
+func TestRAGService_DedupContainedSources(t *testing.T) {
+	messages := []slack.SlackMessage{
+		{ChannelID: "C1", ThreadID: "1.0", UserName: "alice", Content: "To rotate the deploy key, run make rotate-key", Similarity: 0.9},
+		{ChannelID: "C1", ThreadID: "2.0", UserName: "bob", Content: "Summary of the thread: To rotate the deploy key,  run make rotate-key and then restart the workers", Similarity: 0.86},
+		{ChannelID: "C1", ThreadID: "3.0", UserName: "carol", Content: "Deploy keys live in the platform vault", Similarity: 0.8},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: messages}, &mockQueryEmbedder{})
+		rag.SetDedupContainedSources(enabled)
+
+		result, err := rag.Query(context.Background(), "how do I rotate the deploy key?")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !enabled {
+			if len(result.Sources) != 3 {
+				t.Errorf("Expected all 3 sources without dedup, got %d", len(result.Sources))
+			}
+			continue
+		}
+
+		if len(result.Sources) != 2 {
+			t.Fatalf("Expected the contained source to be dropped, got %d sources", len(result.Sources))
+		}
+		for _, source := range result.Sources {
+			if source.ThreadID == "1.0" {
+				t.Errorf("Expected the contained message to be dropped in favour of its superset")
+			}
+		}
+	}
+}
+
+func TestDropContainedSources_KeepsFirstOfIdentical(t *testing.T) {
+	messages := []slack.SlackMessage{
+		{ThreadID: "1.0", Content: "Restart the ingress controller"},
+		{ThreadID: "2.0", Content: "restart the  ingress controller"},
+	}
+
+	kept := dropContainedSources(messages)
+	if len(kept) != 1 || kept[0].ThreadID != "1.0" {
+		t.Errorf("Expected only the first of identical sources to be kept, got %+v", kept)
+	}
+}
+
+type mockJSONLLMProvider struct {
+	content string
+	formats []*openai.ChatCompletionResponseFormat
+}
+
+func (m *mockJSONLLMProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.formats = append(m.formats, req.ResponseFormat)
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: m.content}},
+		},
+	}, nil
+}
+
+func TestRAGService_JSONResponseFormat(t *testing.T) {
+	testCases := []struct {
+		name               string
+		content            string
+		expectedAnswer     string
+		expectedStructured bool
+	}{
+		{
+			name:               "valid JSON",
+			content:            `{"answer": "Rotate the deploy key [1]", "confidence": 0.8, "action_items": ["Update the runbook"]}`,
+			expectedAnswer:     "Rotate the deploy key [1]",
+			expectedStructured: true,
+		},
+		{
+			name:           "prose instead of JSON",
+			content:        "Rotate the deploy key [1]",
+			expectedAnswer: "Rotate the deploy key [1]",
+		},
+		{
+			name:           "confidence out of range",
+			content:        `{"answer": "Rotate the deploy key", "confidence": 7}`,
+			expectedAnswer: `{"answer": "Rotate the deploy key", "confidence": 7}`,
+		},
+		{
+			name:           "missing answer",
+			content:        `{"confidence": 0.5, "action_items": []}`,
+			expectedAnswer: `{"confidence": 0.5, "action_items": []}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &mockJSONLLMProvider{content: tc.content}
+			rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+
+			result, err := rag.QueryWithOptions(context.Background(), "where is the deploy key?", QueryOptions{ResponseFormat: ResponseFormatJSON})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(llm.formats) != 1 || llm.formats[0] == nil || llm.formats[0].Type != openai.ChatCompletionResponseFormatTypeJSONObject {
+				t.Errorf("Expected JSON mode to be requested, got %v", llm.formats)
+			}
+			if result.Answer != tc.expectedAnswer {
+				t.Errorf("Expected answer %q, got %q", tc.expectedAnswer, result.Answer)
+			}
+			if (result.Structured != nil) != tc.expectedStructured {
+				t.Fatalf("Expected structured answer: %v, got %+v", tc.expectedStructured, result.Structured)
+			}
+			if tc.expectedStructured {
+				if result.Structured.Confidence != 0.8 {
+					t.Errorf("Expected confidence 0.8, got %v", result.Structured.Confidence)
+				}
+				if len(result.Structured.ActionItems) != 1 || result.Structured.ActionItems[0] != "Update the runbook" {
+					t.Errorf("Unexpected action items: %v", result.Structured.ActionItems)
+				}
+			}
+		})
+	}
+}
+
+func TestRAGService_TextResponseFormatSkipsJSONMode(t *testing.T) {
+	llm := &mockJSONLLMProvider{content: `{"answer": "Rotate the deploy key", "confidence": 0.8}`}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+
+	result, err := rag.Query(context.Background(), "where is the deploy key?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(llm.formats) != 1 || llm.formats[0] != nil {
+		t.Errorf("Expected no response format for prose answers, got %v", llm.formats)
+	}
+	if result.Structured != nil {
+		t.Errorf("Expected no structured answer for prose answers")
+	}
+}
+
+func TestRAGService_StructuredResponseFormat(t *testing.T) {
+	vault := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	runbook := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	sources := scopedSearchResults()
+	sources[0].ID = vault
+	sources[1].ID = runbook
+
+	testCases := []struct {
+		name              string
+		content           string
+		expectedAnswer    string
+		expectedCited     bool
+		expectedCitations []SourceQuote
+	}{
+		{
+			name: "valid citations",
+			content: `{"answer": "It is in the finance vault [1]", "citations": [
+				{"source_id": "11111111-1111-1111-1111-111111111111", "quote": "kept in the  Finance vault"},
+				{"source_id": "22222222-2222-2222-2222-222222222222", "quote": "rotated through the platform runbook"}]}`,
+			expectedAnswer: "It is in the finance vault [1]",
+			expectedCited:  true,
+			expectedCitations: []SourceQuote{
+				{SourceID: vault.String(), Quote: "kept in the  Finance vault"},
+				{SourceID: runbook.String(), Quote: "rotated through the platform runbook"},
+			},
+		},
+		{
+			name: "hallucinated source and quote are dropped",
+			content: `{"answer": "It is in the finance vault [1]", "citations": [
+				{"source_id": "33333333-3333-3333-3333-333333333333", "quote": "kept in the finance vault"},
+				{"source_id": "22222222-2222-2222-2222-222222222222", "quote": "kept in the finance vault"},
+				{"source_id": "11111111-1111-1111-1111-111111111111", "quote": ""},
+				{"source_id": "11111111-1111-1111-1111-111111111111", "quote": "production deploy key"},
+				{"source_id": "11111111-1111-1111-1111-111111111111", "quote": "production deploy key"}]}`,
+			expectedAnswer:    "It is in the finance vault [1]",
+			expectedCited:     true,
+			expectedCitations: []SourceQuote{{SourceID: vault.String(), Quote: "production deploy key"}},
+		},
+		{
+			name:              "no valid citations",
+			content:           `{"answer": "It is in the finance vault", "citations": [{"source_id": "not-a-source", "quote": "vault"}]}`,
+			expectedAnswer:    "It is in the finance vault",
+			expectedCited:     true,
+			expectedCitations: []SourceQuote{},
+		},
+		{
+			name:           "missing answer",
+			content:        `{"citations": []}`,
+			expectedAnswer: `{"citations": []}`,
+		},
+		{
+			name:           "prose instead of JSON",
+			content:        "It is in the finance vault [1]",
+			expectedAnswer: "It is in the finance vault [1]",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &mockJSONLLMProvider{content: tc.content}
+			rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: sources}, &mockQueryEmbedder{})
+
+			result, err := rag.QueryWithOptions(context.Background(), "where is the deploy key?", QueryOptions{ResponseFormat: ResponseFormatStructured})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(llm.formats) != 1 || llm.formats[0] == nil || llm.formats[0].Type != openai.ChatCompletionResponseFormatTypeJSONObject {
+				t.Errorf("Expected JSON mode to be requested, got %v", llm.formats)
+			}
+			if result.Answer != tc.expectedAnswer {
+				t.Errorf("Expected answer %q, got %q", tc.expectedAnswer, result.Answer)
+			}
+			if result.Structured != nil {
+				t.Errorf("Expected no JSON-format answer, got %+v", result.Structured)
+			}
+			if (result.Cited != nil) != tc.expectedCited {
+				t.Fatalf("Expected cited answer: %v, got %+v", tc.expectedCited, result.Cited)
+			}
+			if tc.expectedCited && !reflect.DeepEqual(result.Cited.Citations, tc.expectedCitations) {
+				t.Errorf("Expected citations %+v, got %+v", tc.expectedCitations, result.Cited.Citations)
+			}
+		})
+	}
+}
+
+func TestBuildPrompts_StructuredListsSourceIDs(t *testing.T) {
+	sources := scopedSearchResults()
+	sources[0].ID = uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	systemPrompt, userPrompt, _ := buildPrompts("where is the deploy key?", DefaultSystemPrompt, false, ResponseFormatStructured, sources)
+	if !strings.Contains(systemPrompt, `"source_id"`) {
+		t.Errorf("Expected the citation instructions in the system prompt, got %q", systemPrompt)
+	}
+	if !strings.Contains(userPrompt, "(source_id 11111111-1111-1111-1111-111111111111) alice: The production deploy key") {
+		t.Errorf("Expected messages listed with their source IDs, got %q", userPrompt)
+	}
+
+	// Other formats don't spend tokens on IDs
+	if _, userPrompt, _ := buildPrompts("where is the deploy key?", DefaultSystemPrompt, false, ResponseFormatJSON, sources); strings.Contains(userPrompt, "source_id") {
+		t.Errorf("Expected no source IDs outside structured answers, got %q", userPrompt)
+	}
+}
+
+type failingLLMProvider struct {
+	calls int
+}
+
+func (m *failingLLMProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.calls++
+	return openai.ChatCompletionResponse{}, errors.New("503 service unavailable")
+}
+
+func TestRAGService_SourceFallbackWhenChatFails(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		rag := NewRAGService(&failingLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+
+		if _, err := rag.Query(context.Background(), "where is the deploy key?"); err == nil {
+			t.Fatal("Expected an error when the answer can't be generated")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		llm := &failingLLMProvider{}
+		rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+		rag.SetSourceFallback(true)
+		rag.SetAnswerCache(NewAnswerCache(time.Minute, 100))
+
+		result, err := rag.Query(context.Background(), "where is the deploy key?")
+		if err != nil {
+			t.Fatalf("Expected sources instead of an error, got %v", err)
+		}
+
+		if !result.Degraded {
+			t.Error("Expected the result to be marked degraded")
+		}
+		if len(result.Sources) != 2 {
+			t.Errorf("Expected both retrieved sources, got %d", len(result.Sources))
+		}
+		if !strings.Contains(result.Answer, "AI summarization is unavailable") ||
+			!strings.Contains(result.Answer, "1. alice: The production deploy key is kept in the finance vault") ||
+			!strings.Contains(result.Answer, "2. bob: Deploy keys are rotated through the platform runbook") {
+			t.Errorf("Expected a notice followed by source snippets, got %q", result.Answer)
+		}
+
+		// The fallback isn't cached, so the model is tried again
+		if _, err := rag.Query(context.Background(), "where is the deploy key?"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if llm.calls != 2 {
+			t.Errorf("Expected the chat model to be retried on the next query, got %d calls", llm.calls)
+		}
+	})
+}
+
+// recordSpans routes spans to an in-memory recorder for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestRAGService_QuerySpans(t *testing.T) {
+	recorder := recordSpans(t)
+
+	rag := NewRAGService(&usageLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: datedSearchResults()}, &mockQueryEmbedder{})
+	if _, err := rag.Query(context.Background(), "where is the deploy key?"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	root, ok := spans["rag.query"]
+	if !ok {
+		t.Fatalf("Expected a rag.query span, got %d spans", len(recorder.Ended()))
+	}
+	if root.Parent().IsValid() {
+		t.Error("Expected rag.query to be the root span")
+	}
+
+	for _, name := range []string{"rag.embed_query", "rag.search", "rag.completion"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Expected a %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of rag.query", name)
+		}
+	}
+	if len(spans) != 4 {
+		t.Errorf("Expected 4 spans, got %d", len(spans))
+	}
+
+	expected := []struct {
+		span  string
+		key   attribute.Key
+		value attribute.Value
+	}{
+		{"rag.query", "llm.model", attribute.StringValue("gpt-4o-mini")},
+		{"rag.query", "similarity.threshold", attribute.Float64Value(DefaultSimilarityThresholds.Primary)},
+		{"rag.query", "documents.relevant", attribute.IntValue(3)},
+		{"rag.search", "documents.found", attribute.IntValue(3)},
+		{"rag.search", "search.limit", attribute.IntValue(defaultSearchLimit)},
+		{"rag.completion", "llm.usage.prompt_tokens", attribute.IntValue(1200)},
+		{"rag.completion", "llm.usage.total_tokens", attribute.IntValue(1280)},
+	}
+	for _, tc := range expected {
+		if value, ok := spanAttribute(spans[tc.span], tc.key); !ok || value != tc.value {
+			t.Errorf("Expected %s %s=%v, got %v", tc.span, tc.key, tc.value.Emit(), value.Emit())
+		}
+	}
+}
+
+type failingQueryEmbedder struct{}
+
+func (m *failingQueryEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return nil, errors.New("embedding service unavailable")
+}
+
+func TestRAGService_QuerySpanRecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+
+	rag := NewRAGService(&usageLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{}, &failingQueryEmbedder{})
+	if _, err := rag.Query(context.Background(), "where is the deploy key?"); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	failed := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		failed[span.Name()] = span.Status().Code == codes.Error
+	}
+	if len(failed) != 2 || !failed["rag.query"] || !failed["rag.embed_query"] {
+		t.Errorf("Expected failed rag.query and rag.embed_query spans, got %v", failed)
+	}
+}
+
+type mockLanguageEmbedder struct {
+	languages []string
+}
+
+func (m *mockLanguageEmbedder) GenerateEmbeddingForLanguage(ctx context.Context, text, lang string) ([]float32, error) {
+	m.languages = append(m.languages, lang)
+	return []float32{0.1, 0.2, 0.3}, nil
+}
+
+func TestRAGService_LanguageFilter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		language      string
+		routing       bool
+		wantFilter    string
+		wantEmbedding string // language the query is embedded for, with routing
+	}{
+		{
+			name:       "no filter",
+			query:      "¿Cómo reiniciamos el servidor de pagos?",
+			wantFilter: "",
+		},
+		{
+			name:       "requested language",
+			query:      "how do we restart the payments server?",
+			language:   "de",
+			wantFilter: "de",
+		},
+		{
+			name:          "routing restricts to the detected language",
+			query:         "¿Cómo reiniciamos el servidor de pagos?",
+			routing:       true,
+			wantFilter:    "es",
+			wantEmbedding: "es",
+		},
+		{
+			name:          "routing leaves english queries unrestricted",
+			query:         "how do we restart the payments server?",
+			routing:       true,
+			wantFilter:    "",
+			wantEmbedding: "",
+		},
+		{
+			name:          "requested language wins over the detected one",
+			query:         "how do we restart the payments server?",
+			language:      "es",
+			routing:       true,
+			wantFilter:    "es",
+			wantEmbedding: "es",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			searcher := &mockMessageSearcher{messages: scopedSearchResults()}
+			rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", searcher, &mockQueryEmbedder{})
+			embedder := &mockLanguageEmbedder{}
+			if tc.routing {
+				rag.SetLanguageRouting(embedder)
+			}
+
+			if _, err := rag.QueryWithOptions(context.Background(), tc.query, QueryOptions{Language: tc.language}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(searcher.filters) != 1 || searcher.filters[0].Language != tc.wantFilter {
+				t.Errorf("Expected search restricted to %q, got %+v", tc.wantFilter, searcher.filters)
+			}
+			if tc.routing && (len(embedder.languages) != 1 || embedder.languages[0] != tc.wantEmbedding) {
+				t.Errorf("Expected the query embedded for %q, got %v", tc.wantEmbedding, embedder.languages)
+			}
+		})
+	}
+}
+
+// deadlineLLMProvider records the deadline of each completion request
+type deadlineLLMProvider struct {
+	mockLLMProvider
+	deadlines []time.Time
+}
+
+func (m *deadlineLLMProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	deadline, _ := ctx.Deadline()
+	m.deadlines = append(m.deadlines, deadline)
+	return m.mockLLMProvider.CreateChatCompletion(ctx, req)
+}
+
+func TestRAGService_Timeouts(t *testing.T) {
+	testCases := []struct {
+		name          string
+		timeouts      Timeouts
+		callerTimeout time.Duration
+		wantCaller    bool          // the completion's deadline is the caller's
+		wantTimeout   time.Duration // otherwise, about how far away it is
+	}{
+		{
+			name:          "short caller deadline is honored",
+			timeouts:      DefaultTimeouts,
+			callerTimeout: 500 * time.Millisecond,
+			wantCaller:    true,
+		},
+		{
+			name:        "completion timeout without a caller deadline",
+			timeouts:    Timeouts{Query: time.Minute, Completion: 2 * time.Second},
+			wantTimeout: 2 * time.Second,
+		},
+		{
+			name:          "query timeout shortens a long caller deadline",
+			timeouts:      Timeouts{Query: 3 * time.Second, Completion: time.Minute},
+			callerTimeout: time.Hour,
+			wantTimeout:   3 * time.Second,
+		},
+		{
+			name:          "zero timeouts keep the caller's deadline",
+			timeouts:      Timeouts{},
+			callerTimeout: 5 * time.Second,
+			wantCaller:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &deadlineLLMProvider{}
+			rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+			rag.SetTimeouts(tc.timeouts)
+
+			ctx := context.Background()
+			if tc.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.callerTimeout)
+				defer cancel()
+			}
+			callerDeadline, _ := ctx.Deadline()
+
+			start := time.Now()
+			if _, err := rag.Query(ctx, "where is the deploy key?"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			end := time.Now()
+
+			if len(llm.deadlines) != 1 || llm.deadlines[0].IsZero() {
+				t.Fatalf("Expected the completion to have a deadline, got %v", llm.deadlines)
+			}
+			deadline := llm.deadlines[0]
+			if tc.wantCaller {
+				if !deadline.Equal(callerDeadline) {
+					t.Errorf("Expected the caller's deadline %v, got %v", callerDeadline, deadline)
+				}
+				return
+			}
+			if deadline.Before(start.Add(tc.wantTimeout)) || deadline.After(end.Add(tc.wantTimeout)) {
+				t.Errorf("Expected a deadline about %v away, got %v", tc.wantTimeout, deadline.Sub(start))
+			}
+		})
+	}
+}
+
+func TestRAGService_SystemPrompt(t *testing.T) {
+	const configured = "You answer for the platform team. Reply in bullet points and cite threads as (see [n])."
+	const persona = "You are the security team's assistant. Refuse to share credentials."
+
+	testCases := []struct {
+		name         string
+		configured   string
+		opts         QueryOptions
+		wantPrefix   string
+		wantAppended string
+	}{
+		{name: "default", wantPrefix: DefaultSystemPrompt},
+		{name: "configured", configured: configured, wantPrefix: configured},
+		{name: "blank configuration keeps the default", configured: "   ", wantPrefix: DefaultSystemPrompt},
+		{name: "too long configuration keeps the default", configured: strings.Repeat("a", MaxSystemPromptChars+1), wantPrefix: DefaultSystemPrompt},
+		{name: "persona replaces the configured prompt", configured: configured, opts: QueryOptions{Persona: persona}, wantPrefix: persona},
+		{name: "single source instructions follow the prompt", configured: configured, opts: QueryOptions{SingleSource: true}, wantPrefix: configured, wantAppended: singleSourceInstructions},
+		{name: "format instructions follow the persona", opts: QueryOptions{Persona: persona, ResponseFormat: ResponseFormatJSON}, wantPrefix: persona, wantAppended: structuredAnswerInstructions},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &mockLLMProvider{}
+			rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+			if tc.configured != "" {
+				rag.SetSystemPrompt(tc.configured)
+			}
+
+			if _, err := rag.QueryWithOptions(context.Background(), "where is the deploy key?", tc.opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(llm.prompts) != 2 {
+				t.Fatalf("Expected a system and a user message, got %d messages", len(llm.prompts))
+			}
+			system := llm.prompts[0]
+			if !strings.HasPrefix(system, tc.wantPrefix) {
+				t.Errorf("Expected the system prompt to start with %q, got %q", tc.wantPrefix, system)
+			}
+			if tc.wantAppended != "" && !strings.HasSuffix(system, "\n\n"+tc.wantAppended) {
+				t.Errorf("Expected %q appended to the system prompt, got %q", tc.wantAppended, system)
+			}
+			if tc.wantAppended == "" && system != tc.wantPrefix {
+				t.Errorf("Expected the system prompt %q, got %q", tc.wantPrefix, system)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"log/slog"
+	"math"
+	"math/rand"
+
+	"knowthis/internal/storage"
+)
+
+// QuerySampleStore persists captured query samples
+type QuerySampleStore interface {
+	StoreQuerySample(ctx context.Context, sample *storage.QuerySample) error
+}
+
+// QuerySampler captures the full prompt context and answer for a fraction of
+// queries, for offline quality evaluation without logging every query
+type QuerySampler struct {
+	rate  float64
+	store QuerySampleStore
+}
+
+type queryIDKey struct{}
+
+// NewQuerySampler creates a sampler capturing roughly rate (0-1) of queries
+func NewQuerySampler(rate float64, store QuerySampleStore) *QuerySampler {
+	return &QuerySampler{rate: math.Max(0, math.Min(1, rate)), store: store}
+}
+
+// ShouldSample reports whether the query should be captured. A query ID
+// always gets the same decision; without one the decision is random.
+func (s *QuerySampler) ShouldSample(queryID string) bool {
+	if s == nil || s.rate <= 0 {
+		return false
+	}
+	if s.rate >= 1 {
+		return true
+	}
+	if queryID == "" {
+		return rand.Float64() < s.rate
+	}
+
+	hash := sha256.Sum256([]byte(queryID))
+	return float64(binary.BigEndian.Uint64(hash[:8]))/float64(math.MaxUint64) < s.rate
+}
+
+// Capture stores the sample if its query is selected. Failures are logged,
+// never returned, so capture can't break a query.
+func (s *QuerySampler) Capture(ctx context.Context, sample *storage.QuerySample) {
+	if !s.ShouldSample(sample.QueryID) {
+		return
+	}
+
+	if err := s.store.StoreQuerySample(ctx, sample); err != nil {
+		slog.Warn("Failed to store query sample", "query_id", sample.QueryID, "error", err)
+	}
+}
+
+// WithQueryID attaches an ID identifying the query to the context
+func WithQueryID(ctx context.Context, queryID string) context.Context {
+	return context.WithValue(ctx, queryIDKey{}, queryID)
+}
+
+// QueryIDFromContext returns the query's ID, or "" if none was attached
+func QueryIDFromContext(ctx context.Context) string {
+	queryID, _ := ctx.Value(queryIDKey{}).(string)
+	return queryID
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"knowthis/internal/storage"
+)
+
+type mockQuerySampleStore struct {
+	samples []*storage.QuerySample
+}
+
+func (m *mockQuerySampleStore) StoreQuerySample(ctx context.Context, sample *storage.QuerySample) error {
+	m.samples = append(m.samples, sample)
+	return nil
+}
+
+func TestQuerySampler_RateControlsCaptureFrequency(t *testing.T) {
+	const queries = 20000
+
+	for _, rate := range []float64{0, 0.05, 0.25, 1} {
+		t.Run(fmt.Sprintf("rate %.2f", rate), func(t *testing.T) {
+			store := &mockQuerySampleStore{}
+			sampler := NewQuerySampler(rate, store)
+
+			for i := 0; i < queries; i++ {
+				sampler.Capture(context.Background(), &storage.QuerySample{QueryID: fmt.Sprintf("query-%d", i)})
+			}
+
+			captured := float64(len(store.samples)) / queries
+			if captured < rate-0.01 || captured > rate+0.01 {
+				t.Errorf("Expected roughly %.2f of queries captured, got %.4f", rate, captured)
+			}
+		})
+	}
+}
+
+func TestQuerySampler_DeterministicPerQueryID(t *testing.T) {
+	sampler := NewQuerySampler(0.5, &mockQuerySampleStore{})
+
+	for i := 0; i < 100; i++ {
+		queryID := fmt.Sprintf("query-%d", i)
+		first := sampler.ShouldSample(queryID)
+		for j := 0; j < 5; j++ {
+			if sampler.ShouldSample(queryID) != first {
+				t.Fatalf("Expected the same sampling decision for %s every time", queryID)
+			}
+		}
+	}
+}
+
+func TestRAGService_CapturesSampledQueries(t *testing.T) {
+	store := &mockQuerySampleStore{}
+	rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+	rag.SetQuerySampler(NewQuerySampler(1, store))
+
+	ctx := WithQueryID(context.Background(), "query-42")
+	if _, err := rag.QueryWithOptions(ctx, "where is the deploy key?", QueryOptions{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(store.samples) != 1 {
+		t.Fatalf("Expected 1 captured sample, got %d", len(store.samples))
+	}
+	sample := store.samples[0]
+	if sample.QueryID != "query-42" || sample.Query != "where is the deploy key?" || sample.Model != "gpt-4o" {
+		t.Errorf("Unexpected sample metadata: %+v", sample)
+	}
+	if sample.Answer != "Rotate the deploy key" {
+		t.Errorf("Expected the answer to be captured, got %q", sample.Answer)
+	}
+	if !strings.Contains(sample.Context, "platform runbook") {
+		t.Errorf("Expected the prompt context to be captured, got %q", sample.Context)
+	}
+}
+
+func TestRAGService_NoCaptureWithoutSampler(t *testing.T) {
+	rag := NewRAGService(&mockLLMProvider{}, "gpt-4o-mini", &mockMessageSearcher{messages: scopedSearchResults()}, &mockQueryEmbedder{})
+
+	if _, err := rag.Query(context.Background(), "where is the deploy key?"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
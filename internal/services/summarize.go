@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"knowthis/internal/integrations/slack"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// summarizeThreadPrompt asks the model for a short summary of a thread
+const summarizeThreadPrompt = `You summarize Slack threads for people who weren't in them. Write a TL;DR of the thread in at most 5 short bullet points: the question or problem, what was decided or found, and any open follow-ups with who owns them. Use only what the thread says. Reply with only the bullet points.`
+
+// SummarizeThread summarizes a thread's messages, oldest first, with the
+// configured chat model. Nothing is searched or stored.
+func (r *RAGService) SummarizeThread(ctx context.Context, messages []slack.SlackMessage) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.AuthorLabel(), msg.Content)
+	}
+	if transcript.Len() == 0 {
+		return "", errors.New("no messages to summarize")
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Completion)
+	defer cancel()
+
+	resp, err := r.llm.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     r.chatModel,
+		MaxTokens: 500,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: summarizeThreadPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: "Thread:\n" + transcript.String()},
+		},
+		Temperature: 0.3,
+	})
+	if err != nil {
+		slog.Error("Failed to summarize thread", "error", err)
+		return "", fmt.Errorf("failed to call OpenAI API: %w", err)
+	}
+	recordChatUsage(r.chatModel, "summarize", resp.Usage)
+
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return "", errors.New("model returned no summary")
+	}
+
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
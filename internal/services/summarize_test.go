@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"knowthis/internal/integrations/slack"
+)
+
+func TestSummarizeThread(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{}, &mockQueryEmbedder{})
+
+	summary, err := rag.SummarizeThread(context.Background(), []slack.SlackMessage{
+		{UserName: "alice", UserTitle: "SRE", Content: "The deploy key expired overnight"},
+		{UserName: "bob", Content: "Rotated it, deploys are green again"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary != "Rotate the deploy key" {
+		t.Errorf("Expected the model's summary, got %q", summary)
+	}
+
+	prompt := strings.Join(llm.prompts, "\n")
+	for _, want := range []string{"alice (SRE): The deploy key expired overnight", "bob: Rotated it, deploys are green again"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got %q", want, prompt)
+		}
+	}
+}
+
+func TestSummarizeThread_NoMessages(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{}, &mockQueryEmbedder{})
+
+	if _, err := rag.SummarizeThread(context.Background(), nil); err == nil {
+		t.Error("Expected an error for an empty thread")
+	}
+	if len(llm.prompts) != 0 {
+		t.Errorf("Expected the model not to be called, got %d prompts", len(llm.prompts))
+	}
+}
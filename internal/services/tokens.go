@@ -0,0 +1,124 @@
+package services
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+
+	"knowthis/internal/integrations/slack"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultTokenEncoding counts tokens for models tiktoken doesn't know, e.g.
+// models served through CHAT_BASE_URL
+const defaultTokenEncoding = "cl100k_base"
+
+// Tokens added by the chat format for each message and to prime the reply
+const (
+	tokensPerChatMessage = 3
+	tokensPerChatReply   = 3
+)
+
+func init() {
+	// Use the encodings bundled with the binary rather than downloading them
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*tiktoken.Tiktoken)
+)
+
+// tokenEncoding returns the tokenizer for model, falling back to
+// defaultTokenEncoding for unknown models
+func tokenEncoding(model string) *tiktoken.Tiktoken {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if encoding, ok := encodings[model]; ok {
+		return encoding
+	}
+
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		slog.Debug("No tokenizer for model, using the default", "model", model, "encoding", defaultTokenEncoding)
+		if encoding, err = tiktoken.GetEncoding(defaultTokenEncoding); err != nil {
+			// The encodings are bundled, so this only fails on a broken build
+			panic("failed to load " + defaultTokenEncoding + " token encoding: " + err.Error())
+		}
+	}
+	encodings[model] = encoding
+	return encoding
+}
+
+// countTokens returns how many tokens text is for model
+func countTokens(model, text string) int {
+	return len(tokenEncoding(model).Encode(text, nil, nil))
+}
+
+// countChatTokens returns how many prompt tokens the chat messages are for
+// model, including the chat format's overhead
+func countChatTokens(model string, messages []openai.ChatCompletionMessage) int {
+	tokens := tokensPerChatReply
+	for _, msg := range messages {
+		tokens += tokensPerChatMessage + countTokens(model, msg.Role) + countTokens(model, msg.Content)
+	}
+	return tokens
+}
+
+// fitPromptBudget drops the least similar messages until the answer prompt
+// for the rest fits in budget tokens. The most similar message is always
+// kept, even if it alone exceeds the budget. The kept messages stay in order.
+func fitPromptBudget(budget int, query, model, systemPrompt string, singleSource bool, format string, history []ConversationTurn, messages []slack.SlackMessage) []slack.SlackMessage {
+	promptTokens := func(messages []slack.SlackMessage) int {
+		systemPrompt, userPrompt, _ := buildPrompts(query, systemPrompt, singleSource, format, messages)
+		return countChatTokens(model, chatMessages(systemPrompt, history, userPrompt))
+	}
+
+	total := promptTokens(messages)
+	if total <= budget || len(messages) <= 1 {
+		return messages
+	}
+	initial := total
+
+	// Least similar first; the most similar is last and never dropped
+	order := make([]int, len(messages))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return messages[order[a]].Similarity < messages[order[b]].Similarity
+	})
+
+	dropped := make([]bool, len(messages))
+	keptMessages := func() []slack.SlackMessage {
+		var kept []slack.SlackMessage
+		for i, msg := range messages {
+			if !dropped[i] {
+				kept = append(kept, msg)
+			}
+		}
+		return kept
+	}
+
+	droppedCount := 0
+	for _, i := range order[:len(order)-1] {
+		dropped[i] = true
+		droppedCount++
+		if total = promptTokens(keptMessages()); total <= budget {
+			break
+		}
+	}
+
+	kept := keptMessages()
+	slog.Warn("Dropped sources to fit the prompt token budget",
+		"dropped", droppedCount,
+		"kept", len(kept),
+		"prompt_tokens", total,
+		"initial_prompt_tokens", initial,
+		"budget", budget)
+	return kept
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"knowthis/internal/integrations/slack"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCountChatTokens(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "You are a helpful assistant."},
+		{Role: openai.ChatMessageRoleUser, Content: "Where is the deploy key?"},
+	}
+
+	tokens := countChatTokens("gpt-4o-mini", messages)
+	content := countTokens("gpt-4o-mini", messages[0].Content) + countTokens("gpt-4o-mini", messages[1].Content)
+	if tokens <= content || tokens > content+20 {
+		t.Errorf("Expected the content's %d tokens plus a little chat overhead, got %d", content, tokens)
+	}
+
+	// Unknown models are counted with the default encoding
+	if unknown := countChatTokens("llama-3-70b", messages); unknown == 0 {
+		t.Error("Expected tokens counted for an unknown model")
+	}
+}
+
+// oversizedSources returns messages of about 500 tokens each, ordered by
+// thread rather than similarity
+func oversizedSources() []slack.SlackMessage {
+	filler := strings.Repeat("The rollback runbook covers database migrations and feature flags. ", 45)
+	return []slack.SlackMessage{
+		{ThreadID: "1.0", UserName: "alice", Content: "Lowest ranked: " + filler, Similarity: 0.78},
+		{ThreadID: "2.0", UserName: "bob", Content: "Top ranked: " + filler, Similarity: 0.95},
+		{ThreadID: "3.0", UserName: "carol", Content: "Second ranked: " + filler, Similarity: 0.9},
+		{ThreadID: "4.0", UserName: "dave", Content: "Third ranked: " + filler, Similarity: 0.85},
+	}
+}
+
+func TestFitPromptBudget(t *testing.T) {
+	messages := oversizedSources()
+	promptTokens := func(messages []slack.SlackMessage) int {
+		systemPrompt, userPrompt, _ := buildPrompts("how do I roll back?", DefaultSystemPrompt, false, "", messages)
+		return countChatTokens("gpt-4o-mini", chatMessages(systemPrompt, nil, userPrompt))
+	}
+
+	full := promptTokens(messages)
+	twoSources := promptTokens([]slack.SlackMessage{messages[1], messages[2]})
+
+	testCases := []struct {
+		name     string
+		budget   int
+		expected []string // user names of the kept messages, in order
+	}{
+		{"fits", full, []string{"alice", "bob", "carol", "dave"}},
+		{"drops the lowest ranked", twoSources, []string{"bob", "carol"}},
+		{"keeps the top source even over budget", 10, []string{"bob"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kept := fitPromptBudget(tc.budget, "how do I roll back?", "gpt-4o-mini", DefaultSystemPrompt, false, "", nil, messages)
+
+			var names []string
+			for _, msg := range kept {
+				names = append(names, msg.UserName)
+			}
+			if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v kept, got %v", tc.expected, names)
+			}
+			if len(kept) > 1 && promptTokens(kept) > tc.budget {
+				t.Errorf("Expected the prompt to fit %d tokens, got %d", tc.budget, promptTokens(kept))
+			}
+		})
+	}
+}
+
+func TestRAGService_PromptTokenBudget(t *testing.T) {
+	llm := &mockLLMProvider{}
+	rag := NewRAGService(llm, "gpt-4o-mini", &mockMessageSearcher{messages: oversizedSources()}, &mockQueryEmbedder{})
+	rag.SetPromptTokenBudget(1200)
+
+	result, err := rag.Query(context.Background(), "how do I roll back?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Sources) == 0 || len(result.Sources) >= len(oversizedSources()) {
+		t.Fatalf("Expected some sources dropped to fit the budget, got %d", len(result.Sources))
+	}
+	topKept := false
+	for _, source := range result.Sources {
+		if source.UserName == "alice" {
+			t.Error("Expected the lowest ranked source to be dropped first")
+		}
+		topKept = topKept || source.UserName == "bob"
+	}
+	if !topKept {
+		t.Error("Expected the top ranked source to survive")
+	}
+
+	prompt := strings.Join(llm.prompts, "\n")
+	if strings.Contains(prompt, "Lowest ranked") || !strings.Contains(prompt, "Top ranked") {
+		t.Error("Expected the prompt to hold only the kept sources")
+	}
+	if len(result.Citations) != len(result.Sources) {
+		t.Errorf("Expected citations for the kept sources only, got %d for %d sources", len(result.Citations), len(result.Sources))
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthChecker is a dependency that can report whether it is usable
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Warmup checks every dependency concurrently before serving, so connection
+// setup and pending auth happen now instead of on the first query. Returns an
+// error naming the dependencies that weren't ready within the timeout.
+func Warmup(ctx context.Context, checks map[string]HealthChecker, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failed []string
+	for name, checker := range checks {
+		wg.Add(1)
+		go func(name string, checker HealthChecker) {
+			defer wg.Done()
+
+			checkStart := time.Now()
+			if err := checker.HealthCheck(ctx); err != nil {
+				slog.Warn("Warmup check failed", "dependency", name, "error", err, "duration", time.Since(checkStart))
+				mu.Lock()
+				failed = append(failed, name)
+				mu.Unlock()
+				return
+			}
+			slog.Info("Warmup check passed", "dependency", name, "duration", time.Since(checkStart))
+		}(name, checker)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("dependencies not ready: %s", strings.Join(failed, ", "))
+	}
+
+	slog.Info("Warmup complete, all dependencies ready", "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mock dependency that fails or blocks until its context is done
+type mockDependency struct {
+	err    error
+	block  bool
+	called bool
+}
+
+func (m *mockDependency) HealthCheck(ctx context.Context) error {
+	m.called = true
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return m.err
+}
+
+func TestWarmup(t *testing.T) {
+	testCases := []struct {
+		name         string
+		checks       map[string]*mockDependency
+		expectFailed []string
+	}{
+		{
+			name: "all ready",
+			checks: map[string]*mockDependency{
+				"database": {},
+				"openai":   {},
+				"slack":    {},
+			},
+		},
+		{
+			name: "failing dependency is named",
+			checks: map[string]*mockDependency{
+				"database": {},
+				"openai":   {err: errors.New("connection refused")},
+				"slack":    {err: errors.New("invalid_auth")},
+			},
+			expectFailed: []string{"openai", "slack"},
+		},
+		{
+			name: "slow dependency times out",
+			checks: map[string]*mockDependency{
+				"database": {block: true},
+				"slack":    {},
+			},
+			expectFailed: []string{"database"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checks := make(map[string]HealthChecker, len(tc.checks))
+			for name, dependency := range tc.checks {
+				checks[name] = dependency
+			}
+
+			start := time.Now()
+			err := Warmup(context.Background(), checks, 50*time.Millisecond)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected warmup to respect its timeout, took %v", elapsed)
+			}
+
+			for name, dependency := range tc.checks {
+				if !dependency.called {
+					t.Errorf("Expected %s to be checked", name)
+				}
+			}
+
+			if len(tc.expectFailed) == 0 {
+				if err != nil {
+					t.Errorf("Expected warmup to succeed, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected warmup to fail")
+			}
+			if want := "dependencies not ready: " + strings.Join(tc.expectFailed, ", "); err.Error() != want {
+				t.Errorf("Expected %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
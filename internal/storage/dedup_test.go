@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"os"
 	"testing"
 	"time"
 )
@@ -116,4 +118,108 @@ func TestContentHashConsistency(t *testing.T) {
 	if len(hash1) != 64 {
 		t.Errorf("Hash length should be 64 characters, got %d", len(hash1))
 	}
-}
\ No newline at end of file
+}
+// newTestStore connects to TEST_DATABASE_URL, skipping the test when unset
+func newTestStore(t *testing.T) *PostgresStore {
+	t.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	store, err := NewPostgresStore(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestPostgresStore_DedupAcrossSourceID(t *testing.T) {
+	store := newTestStore(t)
+	store.SetDedupAcrossSourceID(true)
+	ctx := context.Background()
+
+	content := "Rollbacks go through the deploy dashboard " + time.Now().Format(time.RFC3339Nano)
+	newDoc := func(id, source, sourceID, content string) *Document {
+		return &Document{
+			ID:          id,
+			Content:     content,
+			Source:      source,
+			SourceID:    sourceID,
+			Timestamp:   time.Now(),
+			ContentHash: HashContent(content),
+		}
+	}
+
+	docs := []*Document{
+		newDoc("dedup_test_original", "slack", "1700000000.000100", content),
+		newDoc("dedup_test_recollected", "slack", "1700000000.000200", content),
+		newDoc("dedup_test_other_source", "slab", "post_1", content),
+		newDoc("dedup_test_different", "slack", "1700000000.000300", content+" and a follow-up"),
+	}
+	t.Cleanup(func() {
+		for _, doc := range docs {
+			store.DeleteDocument(ctx, doc.ID)
+		}
+	})
+
+	testCases := []struct {
+		name            string
+		doc             *Document
+		expectedCreated bool
+	}{
+		{name: "first copy is stored", doc: docs[0], expectedCreated: true},
+		{name: "same content under another source ID is skipped", doc: docs[1], expectedCreated: false},
+		{name: "same content from another source is stored", doc: docs[2], expectedCreated: true},
+		{name: "different content is stored", doc: docs[3], expectedCreated: true},
+		{name: "same source ID updates in place", doc: docs[0], expectedCreated: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created, err := store.StoreNewDocument(ctx, tc.doc)
+			if err != nil {
+				t.Fatalf("Failed to store document: %v", err)
+			}
+			if created != tc.expectedCreated {
+				t.Errorf("Expected created=%v, got %v", tc.expectedCreated, created)
+			}
+		})
+	}
+
+	if _, err := store.GetDocument(ctx, "dedup_test_recollected"); err == nil {
+		t.Errorf("Expected the duplicate document not to be stored")
+	}
+}
+
+func TestPostgresStore_NoDedupAcrossSourceIDByDefault(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	content := "Feature flags live in the config service " + time.Now().Format(time.RFC3339Nano)
+	ids := []string{"dedup_default_test_1", "dedup_default_test_2"}
+	t.Cleanup(func() {
+		for _, id := range ids {
+			store.DeleteDocument(ctx, id)
+		}
+	})
+
+	for i, id := range ids {
+		created, err := store.StoreNewDocument(ctx, &Document{
+			ID:          id,
+			Content:     content,
+			Source:      "slack",
+			SourceID:    id,
+			Timestamp:   time.Now(),
+			ContentHash: HashContent(content),
+		})
+		if err != nil {
+			t.Fatalf("Failed to store document: %v", err)
+		}
+		if !created {
+			t.Errorf("Expected document %d to be created without dedup", i+1)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// VectorColumn is a pgvector column holding embeddings
+type VectorColumn struct {
+	Table  string
+	Column string
+
+	// Migration is the SQL resizing the column so its embeddings get
+	// recomputed, with %d standing for the dimensions
+	Migration string
+}
+
+// DocumentEmbeddingColumn is the documents table's embedding column. Cleared
+// embeddings are recomputed by the embedding processor.
+var DocumentEmbeddingColumn = VectorColumn{
+	Table:     "documents",
+	Column:    "embedding",
+	Migration: "ALTER TABLE documents ALTER COLUMN embedding TYPE vector(%d) USING NULL;",
+}
+
+// CheckVectorDimensions returns an error when a vector column in the
+// database doesn't hold embeddings of the expected size, naming the SQL
+// that migrates it. Columns that don't exist or have no fixed size pass.
+func CheckVectorDimensions(ctx context.Context, db *sql.DB, expected int, columns ...VectorColumn) error {
+	actual := make(map[VectorColumn]int)
+	for _, column := range columns {
+		dimensions, err := vectorColumnDimensions(ctx, db, column)
+		if err != nil {
+			return err
+		}
+		actual[column] = dimensions
+	}
+
+	return compareVectorDimensions(columns, actual, expected)
+}
+
+// vectorColumnDimensions returns the declared size of a vector column, read
+// from its type modifier: 0 when the column is missing, -1 when unsized
+func vectorColumnDimensions(ctx context.Context, db *sql.DB, column VectorColumn) (int, error) {
+	var dimensions int
+	err := db.QueryRowContext(ctx, `
+		SELECT atttypmod
+		FROM pg_attribute
+		WHERE attrelid = to_regclass($1) AND attname = $2 AND NOT attisdropped
+	`, column.Table, column.Column).Scan(&dimensions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s.%s dimensions: %w", column.Table, column.Column, err)
+	}
+	return dimensions, nil
+}
+
+// compareVectorDimensions checks the detected column sizes against the expected one
+func compareVectorDimensions(columns []VectorColumn, actual map[VectorColumn]int, expected int) error {
+	var mismatches []string
+	for _, column := range columns {
+		dimensions := actual[column]
+		if dimensions <= 0 || dimensions == expected {
+			continue
+		}
+
+		mismatch := fmt.Sprintf("%s.%s is vector(%d)", column.Table, column.Column, dimensions)
+		if column.Migration != "" {
+			mismatch += "; migrate with: " + fmt.Sprintf(column.Migration, expected)
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+	return fmt.Errorf("embeddings have %d dimensions but %s. Stored embeddings of another size can't be searched; migrating clears them to be recomputed, or set EMBEDDING_DIMENSION_CHECK=false to start anyway",
+		expected, strings.Join(mismatches, ", "))
+}
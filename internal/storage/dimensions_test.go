@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompareVectorDimensions(t *testing.T) {
+	threads := VectorColumn{Table: "threads", Column: "embedding"}
+	columns := []VectorColumn{DocumentEmbeddingColumn, threads}
+
+	tests := []struct {
+		name        string
+		actual      map[VectorColumn]int
+		wantErr     bool
+		wantMessage []string
+	}{
+		{
+			name:   "matching columns",
+			actual: map[VectorColumn]int{DocumentEmbeddingColumn: 1536, threads: 1536},
+		},
+		{
+			name:   "missing and unsized columns pass",
+			actual: map[VectorColumn]int{DocumentEmbeddingColumn: -1},
+		},
+		{
+			name:    "documents column of another size",
+			actual:  map[VectorColumn]int{DocumentEmbeddingColumn: 3072, threads: 1536},
+			wantErr: true,
+			wantMessage: []string{
+				"documents.embedding is vector(3072)",
+				"ALTER TABLE documents ALTER COLUMN embedding TYPE vector(1536) USING NULL;",
+			},
+		},
+		{
+			name:        "every mismatch is reported",
+			actual:      map[VectorColumn]int{DocumentEmbeddingColumn: 768, threads: 3072},
+			wantErr:     true,
+			wantMessage: []string{"documents.embedding is vector(768)", "threads.embedding is vector(3072)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := compareVectorDimensions(columns, tt.actual, 1536)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			for _, want := range tt.wantMessage {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error to mention %q, got %q", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckVectorDimensions(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if _, err := store.DB().Exec("CREATE TABLE IF NOT EXISTS dimension_check (embedding vector(3))"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	t.Cleanup(func() { store.DB().Exec("DROP TABLE IF EXISTS dimension_check") })
+	small := VectorColumn{Table: "dimension_check", Column: "embedding"}
+
+	dimensions, err := vectorColumnDimensions(ctx, store.DB(), small)
+	if err != nil || dimensions != 3 {
+		t.Fatalf("Expected 3 dimensions, got %d (%v)", dimensions, err)
+	}
+	if dimensions, err := vectorColumnDimensions(ctx, store.DB(), VectorColumn{Table: "no_such_table", Column: "embedding"}); err != nil || dimensions != 0 {
+		t.Errorf("Expected a missing table to report 0 dimensions, got %d (%v)", dimensions, err)
+	}
+
+	if err := CheckVectorDimensions(ctx, store.DB(), EmbeddingDimensions, DocumentEmbeddingColumn); err != nil {
+		t.Errorf("Expected the documents table to match, got %v", err)
+	}
+	if err := CheckVectorDimensions(ctx, store.DB(), EmbeddingDimensions, DocumentEmbeddingColumn, small); err == nil {
+		t.Error("Expected a mismatch for the vector(3) column")
+	}
+}
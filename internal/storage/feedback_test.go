@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPostgresStore_StoreAndAggregateFeedback(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	before, err := store.GetFeedbackStats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get feedback stats: %v", err)
+	}
+
+	query := "feedback test: how do I roll back?"
+	t.Cleanup(func() {
+		store.DB().Exec("DELETE FROM query_feedback WHERE query = $1", query)
+	})
+
+	ratings := []*QueryFeedback{
+		{Query: query, AnswerHash: HashContent("Run make rollback"), SourceIDs: []string{"m1", "m2"}, Rating: 1},
+		{Query: query, AnswerHash: HashContent("Run make rollback"), Rating: 1, Comment: "worked"},
+		{Query: query, AnswerHash: HashContent("Ask in #deploys"), Rating: -1, Comment: "not helpful"},
+		{Query: query, AnswerHash: HashContent("Ask in #deploys"), Rating: 0},
+	}
+	for _, feedback := range ratings {
+		if err := store.StoreFeedback(ctx, feedback); err != nil {
+			t.Fatalf("Failed to store feedback: %v", err)
+		}
+	}
+
+	after, err := store.GetFeedbackStats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get feedback stats: %v", err)
+	}
+	if after.Positive-before.Positive != 2 || after.Neutral-before.Neutral != 1 || after.Negative-before.Negative != 1 {
+		t.Errorf("Expected 2 positive, 1 neutral and 1 negative added, got %+v then %+v", before, after)
+	}
+
+	var sourceCount int
+	err = store.DB().QueryRow("SELECT cardinality(source_ids) FROM query_feedback WHERE query = $1 AND rating = 1 AND comment = ''", query).Scan(&sourceCount)
+	if err != nil {
+		t.Fatalf("Failed to read stored feedback: %v", err)
+	}
+	if sourceCount != 2 {
+		t.Errorf("Expected 2 stored source IDs, got %d", sourceCount)
+	}
+
+	if err := store.StoreFeedback(ctx, &QueryFeedback{Query: query, AnswerHash: HashContent("x"), Rating: 3}); err == nil {
+		t.Errorf("Expected an out-of-range rating to be rejected")
+	}
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestPostgresStore_HealthCheckFailsWhenPingFails(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost:1/knowthis?sslmode=disable")
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+	db.Close()
+
+	store := &PostgresStore{db: db}
+	if err := store.HealthCheck(context.Background()); err == nil {
+		t.Errorf("Expected health check to fail for an unusable connection")
+	}
+}
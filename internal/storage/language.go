@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"knowthis/internal/language"
+
+	"github.com/lib/pq"
+)
+
+// LanguageMigration returns a migration step adding a language column to
+// table and filling it in by detecting the language of each row's content.
+// Rows whose language can't be detected keep an empty language.
+func LanguageMigration(table string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS language VARCHAR(8) NOT NULL DEFAULT '';", table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_language ON %s(language);", table, table),
+		}
+		if err := ExecMigration(statements...)(ctx, tx); err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id::text, content FROM %s WHERE language = ''", table))
+		if err != nil {
+			return fmt.Errorf("failed to read %s content: %w", table, err)
+		}
+		defer rows.Close()
+
+		var ids, languages []string
+		for rows.Next() {
+			var id, content string
+			if err := rows.Scan(&id, &content); err != nil {
+				return fmt.Errorf("failed to scan %s content: %w", table, err)
+			}
+			if detected := language.Detect(content); detected != "" {
+				ids = append(ids, id)
+				languages = append(languages, detected)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read %s content: %w", table, err)
+		}
+		rows.Close()
+
+		if len(ids) == 0 {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE %s t
+			SET language = v.language
+			FROM unnest($1::text[], $2::text[]) AS v(id, language)
+			WHERE t.id::text = v.id
+		`, table), pq.Array(ids), pq.Array(languages))
+		if err != nil {
+			return fmt.Errorf("failed to record %s languages: %w", table, err)
+		}
+		return nil
+	}
+}
+
+// documentLanguage returns the document's language, detecting it from the
+// content when it isn't set
+func documentLanguage(doc *Document) string {
+	if doc.Language != "" {
+		return doc.Language
+	}
+	return language.Detect(doc.Content)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPostgresStore_DetectsDocumentLanguage(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	docs := []struct {
+		doc  *Document
+		want string
+	}{
+		{&Document{ID: "language_test_es", Content: "¿Cómo reiniciamos el servidor cuando la base de datos no responde?"}, "es"},
+		{&Document{ID: "language_test_en", Content: "Restart the server when the database is not responding"}, "en"},
+		{&Document{ID: "language_test_unknown", Content: "kubectl rollout restart deploy/api"}, ""},
+		{&Document{ID: "language_test_set", Content: "Restart the server when the database is down", Language: "de"}, "de"},
+	}
+	for _, tc := range docs {
+		tc.doc.Source = "language_test"
+		tc.doc.SourceID = tc.doc.ID
+		tc.doc.Timestamp = time.Now()
+		tc.doc.ContentHash = HashContent(tc.doc.Content)
+		if _, err := store.ImportDocument(ctx, tc.doc); err != nil {
+			t.Fatalf("Failed to store document %s: %v", tc.doc.ID, err)
+		}
+		t.Cleanup(func() { store.DeleteDocument(ctx, tc.doc.ID) })
+	}
+
+	for _, tc := range docs {
+		stored, err := store.GetDocument(ctx, tc.doc.ID)
+		if err != nil {
+			t.Fatalf("Failed to get document %s: %v", tc.doc.ID, err)
+		}
+		if stored.Language != tc.want {
+			t.Errorf("Expected %s in language %q, got %q", tc.doc.ID, tc.want, stored.Language)
+		}
+	}
+}
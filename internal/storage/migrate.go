@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migrationLockID is the Postgres advisory lock held while migrating, so
+// instances starting together don't apply the same migration twice
+const migrationLockID = 4839201
+
+// Migration is one step in the evolution of a component's schema. Up runs in
+// a transaction that also records the migration, so it is applied entirely
+// or not at all.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// ExecMigration returns a migration step that runs the statements in order
+func ExecMigration(statements ...string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Migrate applies the migrations of component not yet recorded in the
+// schema_migrations table, in version order. Components (e.g. "documents"
+// and "slack") number their migrations independently.
+func Migrate(ctx context.Context, db *sql.DB, component string, migrations []Migration) error {
+	if err := validateMigrations(migrations); err != nil {
+		return fmt.Errorf("invalid %s migrations: %w", component, err)
+	}
+
+	// The advisory lock belongs to the session, so hold one connection throughout
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migrations: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			component TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (component, version)
+		);
+	`
+	if _, err := conn.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	applied, err := appliedMigrations(ctx, conn, component)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if err := applyMigration(ctx, conn, component, migration); err != nil {
+			return err
+		}
+		slog.Info("Applied schema migration", "component", component, "version", migration.Version, "name", migration.Name)
+	}
+
+	return nil
+}
+
+// validateMigrations checks that versions are positive and strictly increasing
+func validateMigrations(migrations []Migration) error {
+	previous := 0
+	for _, migration := range migrations {
+		if migration.Version <= previous {
+			return fmt.Errorf("migration %d (%s) must have a version above %d", migration.Version, migration.Name, previous)
+		}
+		if migration.Up == nil {
+			return fmt.Errorf("migration %d (%s) has no Up step", migration.Version, migration.Name)
+		}
+		previous = migration.Version
+	}
+	return nil
+}
+
+// appliedMigrations returns the versions of component already applied
+func appliedMigrations(ctx context.Context, conn *sql.Conn, component string) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations WHERE component = $1", component)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// applyMigration runs a migration and records it in one transaction
+func applyMigration(ctx context.Context, conn *sql.Conn, component string, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin %s migration %d: %w", component, migration.Version, err)
+	}
+	defer tx.Rollback()
+
+	if err := migration.Up(ctx, tx); err != nil {
+		return fmt.Errorf("%s migration %d (%s) failed: %w", component, migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (component, version, name) VALUES ($1, $2, $3)",
+		component, migration.Version, migration.Name); err != nil {
+		return fmt.Errorf("failed to record %s migration %d: %w", component, migration.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %s migration %d: %w", component, migration.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidateMigrations(t *testing.T) {
+	up := ExecMigration()
+	testCases := []struct {
+		name       string
+		migrations []Migration
+		valid      bool
+	}{
+		{"none", nil, true},
+		{"ascending", []Migration{{Version: 1, Up: up}, {Version: 2, Up: up}, {Version: 5, Up: up}}, true},
+		{"zero version", []Migration{{Version: 0, Up: up}}, false},
+		{"duplicate version", []Migration{{Version: 1, Up: up}, {Version: 1, Up: up}}, false},
+		{"out of order", []Migration{{Version: 2, Up: up}, {Version: 1, Up: up}}, false},
+		{"missing step", []Migration{{Version: 1}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMigrations(tc.migrations)
+			if tc.valid && err != nil {
+				t.Errorf("Expected valid migrations, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected invalid migrations to be rejected")
+			}
+		})
+	}
+
+	if err := validateMigrations(documentMigrations); err != nil {
+		t.Errorf("Expected the document migrations to be valid, got %v", err)
+	}
+}
+
+// appliedVersions returns the recorded versions of component, in order
+func appliedVersions(t *testing.T, db *sql.DB, component string) []int {
+	t.Helper()
+
+	rows, err := db.Query("SELECT version FROM schema_migrations WHERE component = $1 ORDER BY version", component)
+	if err != nil {
+		t.Fatalf("Failed to read applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("Failed to scan applied migration: %v", err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestMigrate_AppliesEachMigrationOnce(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	// A component and table unique to this run
+	suffix := time.Now().Format("150405000000")
+	component := "migrate_test_" + suffix
+	table := "migrate_test_" + suffix
+	t.Cleanup(func() {
+		store.DB().Exec("DELETE FROM schema_migrations WHERE component = $1", component)
+		store.DB().Exec("DROP TABLE IF EXISTS " + table)
+	})
+
+	calls := make(map[int]int)
+	step := func(version int, statement string) func(ctx context.Context, tx *sql.Tx) error {
+		return func(ctx context.Context, tx *sql.Tx) error {
+			calls[version]++
+			_, err := tx.ExecContext(ctx, statement)
+			return err
+		}
+	}
+	migrations := []Migration{
+		{Version: 1, Name: "create table", Up: step(1, fmt.Sprintf("CREATE TABLE %s (id INTEGER PRIMARY KEY)", table))},
+		{Version: 2, Name: "add column", Up: step(2, fmt.Sprintf("ALTER TABLE %s ADD COLUMN note TEXT", table))},
+	}
+
+	// Neither migration is idempotent on its own, so a second run fails
+	// unless the recorded versions are skipped
+	for run := 0; run < 2; run++ {
+		if err := Migrate(ctx, store.DB(), component, migrations); err != nil {
+			t.Fatalf("Run %d failed: %v", run+1, err)
+		}
+	}
+	if calls[1] != 1 || calls[2] != 1 {
+		t.Errorf("Expected each migration applied once, got %v", calls)
+	}
+
+	// A migration added later is applied on its own
+	migrations = append(migrations, Migration{Version: 3, Name: "add index", Up: step(3, fmt.Sprintf("CREATE INDEX ON %s (note)", table))})
+	if err := Migrate(ctx, store.DB(), component, migrations); err != nil {
+		t.Fatalf("Failed to apply the new migration: %v", err)
+	}
+	if calls[1] != 1 || calls[2] != 1 || calls[3] != 1 {
+		t.Errorf("Expected only the new migration applied, got %v", calls)
+	}
+
+	if versions := appliedVersions(t, store.DB(), component); fmt.Sprint(versions) != "[1 2 3]" {
+		t.Errorf("Expected versions [1 2 3] recorded, got %v", versions)
+	}
+}
+
+func TestMigrate_FailedMigrationRollsBack(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	suffix := time.Now().Format("150405000000")
+	component := "migrate_fail_test_" + suffix
+	table := "migrate_fail_test_" + suffix
+	t.Cleanup(func() {
+		store.DB().Exec("DELETE FROM schema_migrations WHERE component = $1", component)
+		store.DB().Exec("DROP TABLE IF EXISTS " + table)
+	})
+
+	failure := errors.New("backfill failed")
+	migrations := []Migration{{
+		Version: 1,
+		Name:    "create and fail",
+		Up: func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (id INTEGER)", table)); err != nil {
+				return err
+			}
+			return failure
+		},
+	}}
+
+	if err := Migrate(ctx, store.DB(), component, migrations); !errors.Is(err, failure) {
+		t.Fatalf("Expected the migration's error, got %v", err)
+	}
+
+	var exists bool
+	if err := store.DB().QueryRow("SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+		t.Fatalf("Failed to look up table: %v", err)
+	}
+	if exists {
+		t.Error("Expected the failed migration's table to be rolled back")
+	}
+	if versions := appliedVersions(t, store.DB(), component); len(versions) != 0 {
+		t.Errorf("Expected no versions recorded, got %v", versions)
+	}
+}
+
+func TestPostgresStore_SchemaMigrationsIdempotent(t *testing.T) {
+	// newTestStore migrates the schema; a second store finds it up to date
+	store := newTestStore(t)
+	newTestStore(t)
+
+	var versions []int
+	for _, migration := range documentMigrations {
+		versions = append(versions, migration.Version)
+	}
+	expected := fmt.Sprint(versions)
+
+	if versions := appliedVersions(t, store.DB(), "documents"); fmt.Sprint(versions) != expected {
+		t.Errorf("Expected versions %s recorded, got %v", expected, versions)
+	}
+
+	// Running the migrations again changes nothing
+	if err := Migrate(context.Background(), store.DB(), "documents", documentMigrations); err != nil {
+		t.Fatalf("Failed to migrate again: %v", err)
+	}
+	if versions := appliedVersions(t, store.DB(), "documents"); fmt.Sprint(versions) != expected {
+		t.Errorf("Expected versions %s recorded, got %v", expected, versions)
+	}
+}
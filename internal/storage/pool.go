@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolConfig bounds a database handle's connection pool
+type PoolConfig struct {
+	// Most connections open at once; 0 is unlimited
+	MaxOpenConns int
+	// Most idle connections kept for reuse
+	MaxIdleConns int
+	// How long a connection is reused before it is closed; 0 reuses it forever
+	ConnMaxLifetime time.Duration
+}
+
+// ConfigurePool applies pool to db
+func ConfigurePool(db *sql.DB, pool PoolConfig) {
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+}
+
+// SetConnectionPool applies pool to the store's database handle
+func (s *PostgresStore) SetConnectionPool(pool PoolConfig) {
+	ConfigurePool(s.db, pool)
+}
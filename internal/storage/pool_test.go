@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubDriver opens connections that support nothing but closing, enough to
+// exercise the pool without a database
+type stubDriver struct{}
+
+func (stubDriver) Open(name string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (stubConn) Close() error                              { return nil }
+func (stubConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("storage_stub", stubDriver{})
+}
+
+func TestPostgresStore_SetConnectionPool(t *testing.T) {
+	db, err := sql.Open("storage_stub", "")
+	if err != nil {
+		t.Fatalf("Failed to open stub database: %v", err)
+	}
+	defer db.Close()
+
+	store := &PostgresStore{db: db}
+	store.SetConnectionPool(PoolConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: time.Hour})
+
+	if max := db.Stats().MaxOpenConnections; max != 4 {
+		t.Errorf("Expected at most 4 open connections, got %d", max)
+	}
+
+	// Check out every connection the pool allows, then return them
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 4; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get connection: %v", err)
+		}
+		conns = append(conns, conn)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := db.Conn(waitCtx); err == nil {
+		t.Error("Expected a fifth connection to wait for a free one")
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	stats := db.Stats()
+	if stats.Idle != 2 || stats.MaxIdleClosed != 2 {
+		t.Errorf("Expected 2 idle connections kept and 2 closed, got %d idle and %d closed", stats.Idle, stats.MaxIdleClosed)
+	}
+
+	// Connections older than the lifetime are closed instead of reused
+	store.SetConnectionPool(PoolConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: time.Millisecond})
+	time.Sleep(5 * time.Millisecond)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	conn.Close()
+	if closed := db.Stats().MaxLifetimeClosed; closed == 0 {
+		t.Error("Expected expired connections to be closed")
+	}
+}
@@ -4,17 +4,26 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pgvector/pgvector-go"
 )
 
 type PostgresStore struct {
 	db *sql.DB
+
+	// Per-source vector search; nil searches one blended index
+	sourceWeights map[string]float64
+
+	// Skip documents whose content is already stored for the same source
+	// under another source ID
+	dedupAcrossSourceID bool
 }
 
 func NewPostgresStore(databaseURL string) (*PostgresStore, error) {
@@ -57,55 +66,89 @@ func adjustDatabaseURLForEnvironment(databaseURL string) string {
 	return databaseURL
 }
 
+// documentMigrations evolve the documents, query_samples and query_feedback
+// tables. Migration 1 is the schema from before migrations were tracked, so
+// its statements must stay safe to run against a database that already has it.
+var documentMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: ExecMigration(
+			"CREATE EXTENSION IF NOT EXISTS vector;",
+			`CREATE TABLE IF NOT EXISTS documents (
+				id VARCHAR(255) PRIMARY KEY,
+				content TEXT NOT NULL,
+				source VARCHAR(50) NOT NULL,
+				source_id VARCHAR(255) NOT NULL,
+				title VARCHAR(500),
+				channel_id VARCHAR(255),
+				post_id VARCHAR(255),
+				user_id VARCHAR(255),
+				user_name VARCHAR(255),
+				timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+				content_hash VARCHAR(64) NOT NULL,
+				embedding vector(1536),
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+			);`,
+			// Sampled prompt/answer capture
+			`CREATE TABLE IF NOT EXISTS query_samples (
+				id BIGSERIAL PRIMARY KEY,
+				query_id VARCHAR(255) NOT NULL,
+				query TEXT NOT NULL,
+				context TEXT NOT NULL,
+				answer TEXT NOT NULL,
+				model VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+			);`,
+			// Answer ratings
+			`CREATE TABLE IF NOT EXISTS query_feedback (
+				id BIGSERIAL PRIMARY KEY,
+				query TEXT NOT NULL,
+				answer_hash VARCHAR(64) NOT NULL,
+				source_ids TEXT[] NOT NULL DEFAULT '{}',
+				rating SMALLINT NOT NULL CHECK (rating BETWEEN -1 AND 1),
+				comment TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_documents_content_hash ON documents(content_hash);",
+			"CREATE INDEX IF NOT EXISTS idx_documents_source ON documents(source);",
+			"CREATE INDEX IF NOT EXISTS idx_documents_timestamp ON documents(timestamp);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_unique_content ON documents(content_hash, source, source_id);",
+		),
+	},
+	{
+		Version: 2,
+		Name:    "soft-delete documents",
+		// IF NOT EXISTS: the column was added at startup before migrations
+		Up: ExecMigration("ALTER TABLE documents ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN DEFAULT FALSE;"),
+	},
+	{
+		Version: 3,
+		Name:    "document language",
+		Up:      LanguageMigration("documents"),
+	},
+	{
+		Version: 4,
+		Name:    "document message count",
+		Up:      ExecMigration("ALTER TABLE documents ADD COLUMN IF NOT EXISTS message_count INTEGER NOT NULL DEFAULT 0;"),
+	},
+	{
+		Version: 5,
+		Name:    "embedding dry run marks",
+		Up:      ExecMigration("ALTER TABLE documents ADD COLUMN IF NOT EXISTS embedding_dry_run BOOLEAN NOT NULL DEFAULT FALSE;"),
+	},
+}
+
 func (s *PostgresStore) initSchema() error {
 	fmt.Println("Initializing database schema...")
-	
-	// Step 1: Create vector extension
-	fmt.Println("Creating vector extension...")
-	if _, err := s.db.Exec("CREATE EXTENSION IF NOT EXISTS vector;"); err != nil {
-		return fmt.Errorf("failed to create vector extension: %w", err)
-	}
-	
-	// Step 2: Create documents table
-	fmt.Println("Creating documents table...")
-	createTableSQL := `
-		CREATE TABLE IF NOT EXISTS documents (
-			id VARCHAR(255) PRIMARY KEY,
-			content TEXT NOT NULL,
-			source VARCHAR(50) NOT NULL,
-			source_id VARCHAR(255) NOT NULL,
-			title VARCHAR(500),
-			channel_id VARCHAR(255),
-			post_id VARCHAR(255),
-			user_id VARCHAR(255),
-			user_name VARCHAR(255),
-			timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
-			content_hash VARCHAR(64) NOT NULL,
-			embedding vector(1536),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		);
-	`
-	if _, err := s.db.Exec(createTableSQL); err != nil {
-		return fmt.Errorf("failed to create documents table: %w", err)
-	}
-	
-	// Step 3: Create indexes
-	fmt.Println("Creating indexes...")
-	indexes := []string{
-		"CREATE INDEX IF NOT EXISTS idx_documents_content_hash ON documents(content_hash);",
-		"CREATE INDEX IF NOT EXISTS idx_documents_source ON documents(source);",
-		"CREATE INDEX IF NOT EXISTS idx_documents_timestamp ON documents(timestamp);",
-		"CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_unique_content ON documents(content_hash, source, source_id);",
-	}
-	
-	for _, indexSQL := range indexes {
-		if _, err := s.db.Exec(indexSQL); err != nil {
-			return fmt.Errorf("failed to create index: %w", err)
-		}
+
+	if err := Migrate(context.Background(), s.db, "documents", documentMigrations); err != nil {
+		return err
 	}
-	
-	// Step 4: Create vector index (may fail if no embeddings exist yet)
+
+	// Not a migration: it may fail (e.g. on older pgvector with no embeddings
+	// yet), so it is retried on every start until it exists
 	fmt.Println("Creating vector index...")
 	vectorIndexSQL := "CREATE INDEX IF NOT EXISTS idx_documents_embedding ON documents USING ivfflat (embedding vector_cosine_ops);"
 	if _, err := s.db.Exec(vectorIndexSQL); err != nil {
@@ -117,18 +160,64 @@ func (s *PostgresStore) initSchema() error {
 	return nil
 }
 
+// EnablePerSourceIndexes creates a partial vector index per source and makes
+// SearchSimilar query each source separately, merging results by weight.
+// This keeps a large source from crowding a small one out of the results.
+func (s *PostgresStore) EnablePerSourceIndexes(ctx context.Context, weights map[string]float64) {
+	for source := range weights {
+		indexSQL := fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS idx_documents_embedding_%s ON documents USING ivfflat (embedding vector_cosine_ops) WHERE source = %s;",
+			sanitizeIdentifier(source), quoteLiteral(source))
+		if _, err := s.db.ExecContext(ctx, indexSQL); err != nil {
+			fmt.Printf("Warning: Could not create vector index for source %s: %v\n", source, err)
+		}
+	}
+
+	s.sourceWeights = weights
+}
+
+// SetDedupAcrossSourceID makes StoreDocument skip documents whose content
+// hash is already stored for the same source under a different source ID,
+// so identical content collected twice isn't cited twice
+func (s *PostgresStore) SetDedupAcrossSourceID(enabled bool) {
+	s.dedupAcrossSourceID = enabled
+}
+
 func (s *PostgresStore) StoreDocument(ctx context.Context, doc *Document) error {
+	_, err := s.StoreNewDocument(ctx, doc)
+	return err
+}
+
+// StoreNewDocument stores the document and reports whether a new row was
+// created. An existing row for the same content and source ID is updated;
+// with dedup across source IDs enabled, content already stored for the same
+// source is skipped.
+func (s *PostgresStore) StoreNewDocument(ctx context.Context, doc *Document) (bool, error) {
+	if s.dedupAcrossSourceID {
+		duplicateID, err := s.findDuplicateContent(ctx, doc)
+		if err != nil {
+			return false, err
+		}
+		if duplicateID != "" {
+			fmt.Printf("Skipping document %s: same content already stored as %s\n", doc.ID, duplicateID)
+			return false, nil
+		}
+	}
+
 	query := `
 		INSERT INTO documents (
 			id, content, source, source_id, title, channel_id, post_id,
-			user_id, user_name, timestamp, content_hash, embedding
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			user_id, user_name, timestamp, content_hash, embedding, language, message_count
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		ON CONFLICT (content_hash, source, source_id)
 		DO UPDATE SET
 			content = EXCLUDED.content,
 			title = EXCLUDED.title,
+			language = EXCLUDED.language,
+			message_count = EXCLUDED.message_count,
+			is_deleted = FALSE,
 			updated_at = NOW()
-		RETURNING id
+		RETURNING (xmax = 0)
 	`
 
 	var embeddingVector interface{}
@@ -138,7 +227,94 @@ func (s *PostgresStore) StoreDocument(ctx context.Context, doc *Document) error
 		embeddingVector = nil
 	}
 
+	var created bool
+	err := s.db.QueryRowContext(ctx, query,
+		doc.ID,
+		doc.Content,
+		doc.Source,
+		doc.SourceID,
+		doc.Title,
+		doc.ChannelID,
+		doc.PostID,
+		doc.UserID,
+		doc.UserName,
+		doc.Timestamp,
+		doc.ContentHash,
+		embeddingVector,
+		documentLanguage(doc),
+		doc.MessageCount,
+	).Scan(&created)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to store document: %w", err)
+	}
+
+	return created, nil
+}
+
+// findDuplicateContent returns the ID of a document with the same content
+// hash and source but a different source ID, or "" if there is none
+func (s *PostgresStore) findDuplicateContent(ctx context.Context, doc *Document) (string, error) {
+	query := `
+		SELECT id
+		FROM documents
+		WHERE content_hash = $1 AND source = $2 AND source_id <> $3 AND NOT is_deleted
+		LIMIT 1
+	`
+
 	var id string
+	err := s.db.QueryRowContext(ctx, query, doc.ContentHash, doc.Source, doc.SourceID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check for duplicate content: %w", err)
+	}
+
+	return id, nil
+}
+
+// ImportDocument upserts a document by ID, preserving the ID and any
+// embedding it carries. Without an embedding, an existing one is kept only
+// when the content is unchanged; otherwise the document is left without an
+// embedding so it is picked up for (re-)embedding. Reports whether the
+// document was newly created.
+func (s *PostgresStore) ImportDocument(ctx context.Context, doc *Document) (bool, error) {
+	query := `
+		INSERT INTO documents (
+			id, content, source, source_id, title, channel_id, post_id,
+			user_id, user_name, timestamp, content_hash, embedding, language, message_count
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (id)
+		DO UPDATE SET
+			content = EXCLUDED.content,
+			source = EXCLUDED.source,
+			source_id = EXCLUDED.source_id,
+			title = EXCLUDED.title,
+			channel_id = EXCLUDED.channel_id,
+			post_id = EXCLUDED.post_id,
+			user_id = EXCLUDED.user_id,
+			user_name = EXCLUDED.user_name,
+			timestamp = EXCLUDED.timestamp,
+			content_hash = EXCLUDED.content_hash,
+			language = EXCLUDED.language,
+			message_count = EXCLUDED.message_count,
+			embedding = CASE
+				WHEN EXCLUDED.embedding IS NOT NULL THEN EXCLUDED.embedding
+				WHEN documents.content_hash = EXCLUDED.content_hash THEN documents.embedding
+				ELSE NULL
+			END,
+			is_deleted = FALSE,
+			updated_at = NOW()
+		RETURNING (xmax = 0)
+	`
+
+	var embeddingVector interface{}
+	if len(doc.Embedding) > 0 {
+		embeddingVector = pgvector.NewVector(doc.Embedding)
+	}
+
+	var created bool
 	err := s.db.QueryRowContext(ctx, query,
 		doc.ID,
 		doc.Content,
@@ -152,19 +328,21 @@ func (s *PostgresStore) StoreDocument(ctx context.Context, doc *Document) error
 		doc.Timestamp,
 		doc.ContentHash,
 		embeddingVector,
-	).Scan(&id)
+		documentLanguage(doc),
+		doc.MessageCount,
+	).Scan(&created)
 
 	if err != nil {
-		return fmt.Errorf("failed to store document: %w", err)
+		return false, fmt.Errorf("failed to import document: %w", err)
 	}
 
-	return nil
+	return created, nil
 }
 
 func (s *PostgresStore) UpdateEmbedding(ctx context.Context, documentID string, embedding []float32) error {
 	query := `
 		UPDATE documents
-		SET embedding = $1, updated_at = NOW()
+		SET embedding = $1, embedding_dry_run = FALSE, updated_at = NOW()
 		WHERE id = $2
 	`
 
@@ -177,9 +355,39 @@ func (s *PostgresStore) UpdateEmbedding(ctx context.Context, documentID string,
 	return nil
 }
 
+// QueueReindex clears the embeddings of documents matching filter so the
+// embedding processor recomputes them, returning how many were queued.
+// Documents already waiting for an embedding aren't counted.
+func (s *PostgresStore) QueueReindex(ctx context.Context, filter DocumentFilter) (int64, error) {
+	conditions, args := filter.conditions(nil)
+
+	query := fmt.Sprintf(`
+		UPDATE documents
+		SET embedding = NULL, updated_at = NOW()
+		WHERE embedding IS NOT NULL AND NOT is_deleted%s
+	`, conditions)
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue documents for reindex: %w", err)
+	}
+
+	queued, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count documents queued for reindex: %w", err)
+	}
+
+	return queued, nil
+}
+
 func (s *PostgresStore) SearchSimilar(ctx context.Context, embedding []float32, limit int) ([]*Document, error) {
+	if len(s.sourceWeights) > 0 {
+		return s.searchSimilarPerSource(ctx, embedding, limit)
+	}
+
+
 	// First, let's check how many documents have embeddings
-	countQuery := `SELECT COUNT(*) FROM documents WHERE embedding IS NOT NULL`
+	countQuery := `SELECT COUNT(*) FROM documents WHERE embedding IS NOT NULL AND NOT is_deleted`
 	var totalWithEmbeddings int
 	err := s.db.QueryRowContext(ctx, countQuery).Scan(&totalWithEmbeddings)
 	if err != nil {
@@ -189,7 +397,7 @@ func (s *PostgresStore) SearchSimilar(ctx context.Context, embedding []float32,
 	}
 
 	// Count documents with non-zero embeddings
-	nonZeroQuery := `SELECT COUNT(*) FROM documents WHERE embedding IS NOT NULL AND (embedding <#> embedding) > 0`
+	nonZeroQuery := `SELECT COUNT(*) FROM documents WHERE embedding IS NOT NULL AND NOT is_deleted AND (embedding <#> embedding) > 0`
 	var totalNonZero int
 	err = s.db.QueryRowContext(ctx, nonZeroQuery).Scan(&totalNonZero)
 	if err != nil {
@@ -203,7 +411,7 @@ func (s *PostgresStore) SearchSimilar(ctx context.Context, embedding []float32,
 			   user_id, user_name, timestamp, content_hash, embedding,
 			   1 - (embedding <=> $1) as similarity
 		FROM documents
-		WHERE embedding IS NOT NULL 
+		WHERE embedding IS NOT NULL AND NOT is_deleted
 		ORDER BY embedding <=> $1
 		LIMIT $2
 	`
@@ -215,6 +423,89 @@ func (s *PostgresStore) SearchSimilar(ctx context.Context, embedding []float32,
 	}
 	defer rows.Close()
 
+	return scanSimilarDocuments(rows)
+}
+
+// searchSimilarPerSource searches each source's index separately and merges the results
+func (s *PostgresStore) searchSimilarPerSource(ctx context.Context, embedding []float32, limit int) ([]*Document, error) {
+	query := `
+		SELECT id, content, source, source_id, title, channel_id, post_id,
+			   user_id, user_name, timestamp, content_hash, embedding,
+			   1 - (embedding <=> $1) as similarity
+		FROM documents
+		WHERE embedding IS NOT NULL AND NOT is_deleted AND source = $3
+		ORDER BY embedding <=> $1
+		LIMIT $2
+	`
+
+	embeddingVector := pgvector.NewVector(embedding)
+	resultsBySource := make(map[string][]*Document)
+	for source := range s.sourceWeights {
+		rows, err := s.db.QueryContext(ctx, query, embeddingVector, limit, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search similar documents for source %s: %w", source, err)
+		}
+
+		documents, err := scanSimilarDocuments(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		resultsBySource[source] = documents
+	}
+
+	return MergeBySource(resultsBySource, s.sourceWeights, limit), nil
+}
+
+// MergeBySource combines per-source results (each ordered by similarity) into
+// a single list of at most limit documents. Every source with results is
+// guaranteed a share of the slots proportional to its weight; remaining slots
+// go to the highest weighted similarity regardless of source.
+func MergeBySource(resultsBySource map[string][]*Document, weights map[string]float64, limit int) []*Document {
+	sources := make([]string, 0, len(resultsBySource))
+	totalWeight := 0.0
+	for source, documents := range resultsBySource {
+		if len(documents) == 0 || weights[source] <= 0 {
+			continue
+		}
+		sources = append(sources, source)
+		totalWeight += weights[source]
+	}
+	sort.Strings(sources)
+
+	var merged, leftover []*Document
+	for _, source := range sources {
+		documents := resultsBySource[source]
+		quota := int(float64(limit) * weights[source] / totalWeight)
+		if quota > len(documents) {
+			quota = len(documents)
+		}
+		merged = append(merged, documents[:quota]...)
+		leftover = append(leftover, documents[quota:]...)
+	}
+
+	weighted := func(doc *Document) float64 {
+		return doc.Similarity * weights[doc.Source]
+	}
+
+	sort.SliceStable(leftover, func(i, j int) bool {
+		return weighted(leftover[i]) > weighted(leftover[j])
+	})
+	for _, doc := range leftover {
+		if len(merged) >= limit {
+			break
+		}
+		merged = append(merged, doc)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return weighted(merged[i]) > weighted(merged[j])
+	})
+	return merged
+}
+
+// scanSimilarDocuments scans rows returned by a similarity search
+func scanSimilarDocuments(rows *sql.Rows) ([]*Document, error) {
 	var documents []*Document
 	for rows.Next() {
 		doc := &Document{}
@@ -248,12 +539,89 @@ func (s *PostgresStore) SearchSimilar(ctx context.Context, embedding []float32,
 	return documents, nil
 }
 
+// GetDocument returns the full document with the given ID, without its
+// embedding, or ErrDocumentNotFound
+func (s *PostgresStore) GetDocument(ctx context.Context, id string) (*Document, error) {
+	query := `
+		SELECT id, content, source, source_id, title, channel_id, post_id,
+			   user_id, user_name, timestamp, content_hash, language, message_count, created_at, updated_at
+		FROM documents
+		WHERE id = $1 AND NOT is_deleted
+	`
+
+	doc := &Document{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&doc.ID,
+		&doc.Content,
+		&doc.Source,
+		&doc.SourceID,
+		&doc.Title,
+		&doc.ChannelID,
+		&doc.PostID,
+		&doc.UserID,
+		&doc.UserName,
+		&doc.Timestamp,
+		&doc.ContentHash,
+		&doc.Language,
+		&doc.MessageCount,
+		&doc.CreatedAt,
+		&doc.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// GetDocumentBySourceID returns the latest document stored for a source's
+// item, such as the Slab post a comment belongs to. Chunk documents of an
+// oversized item are skipped.
+func (s *PostgresStore) GetDocumentBySourceID(ctx context.Context, source, sourceID string) (*Document, error) {
+	query := `
+		SELECT id, content, source, source_id, title, channel_id, post_id,
+			   user_id, user_name, timestamp, content_hash, created_at, updated_at
+		FROM documents
+		WHERE source = $1 AND source_id = $2 AND id NOT LIKE '%\_chunk\_%' AND NOT is_deleted
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`
+
+	doc := &Document{}
+	err := s.db.QueryRowContext(ctx, query, source, sourceID).Scan(
+		&doc.ID,
+		&doc.Content,
+		&doc.Source,
+		&doc.SourceID,
+		&doc.Title,
+		&doc.ChannelID,
+		&doc.PostID,
+		&doc.UserID,
+		&doc.UserName,
+		&doc.Timestamp,
+		&doc.ContentHash,
+		&doc.CreatedAt,
+		&doc.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s %s", ErrDocumentNotFound, source, sourceID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document by source ID: %w", err)
+	}
+
+	return doc, nil
+}
+
 func (s *PostgresStore) GetDocumentsWithoutEmbeddings(ctx context.Context, limit int) ([]*Document, error) {
 	query := `
 		SELECT id, content, source, source_id, title, channel_id, post_id,
 			   user_id, user_name, timestamp, content_hash
 		FROM documents
-		WHERE embedding IS NULL
+		WHERE embedding IS NULL AND NOT embedding_dry_run AND NOT is_deleted
 		ORDER BY created_at ASC
 		LIMIT $1
 	`
@@ -264,9 +632,334 @@ func (s *PostgresStore) GetDocumentsWithoutEmbeddings(ctx context.Context, limit
 	}
 	defer rows.Close()
 
+	return scanPendingDocuments(rows)
+}
+
+// CountDocumentsWithoutEmbeddings counts the documents
+// GetDocumentsWithoutEmbeddings would return, without a limit
+func (s *PostgresStore) CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM documents
+		WHERE embedding IS NULL AND NOT embedding_dry_run AND NOT is_deleted
+	`
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count documents without embeddings: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkDryRun marks a document an embedding dry run has logged, so it isn't
+// returned as needing an embedding until the mark is cleared. The document
+// keeps no embedding.
+func (s *PostgresStore) MarkDryRun(ctx context.Context, id string) error {
+	query := `
+		UPDATE documents
+		SET embedding_dry_run = TRUE
+		WHERE id = $1 AND embedding IS NULL
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark dry run document: %w", err)
+	}
+
+	return nil
+}
+
+// ClearDryRunMarks clears every dry run mark, queueing the marked documents
+// to be embedded, and returns how many were cleared
+func (s *PostgresStore) ClearDryRunMarks(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE documents
+		SET embedding_dry_run = FALSE
+		WHERE embedding_dry_run
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear dry run marks: %w", err)
+	}
+
+	cleared, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count cleared dry run marks: %w", err)
+	}
+
+	return cleared, nil
+}
+
+// GetPlaceholderDocuments returns documents still holding the zero placeholder
+// embedding whose trimmed content is now at least minContentLength long, e.g.
+// a Slab post that was empty when first embedded and has since been edited
+func (s *PostgresStore) GetPlaceholderDocuments(ctx context.Context, minContentLength, limit int) ([]*Document, error) {
+	query := `
+		SELECT id, content, source, source_id, title, channel_id, post_id,
+			   user_id, user_name, timestamp, content_hash
+		FROM documents
+		WHERE embedding IS NOT NULL
+		  AND NOT is_deleted
+		  AND (embedding <#> embedding) = 0
+		  AND length(btrim(content)) >= $1
+		ORDER BY updated_at ASC
+		LIMIT $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, minContentLength, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get placeholder documents: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPendingDocuments(rows)
+}
+
+// RequeuePlaceholders clears the placeholder embeddings of the given documents
+// so the embedding processor picks them up again, returning how many were
+// queued. Documents embedded in the meantime are left alone.
+func (s *PostgresStore) RequeuePlaceholders(ctx context.Context, ids []string) (int64, error) {
+	query := `
+		UPDATE documents
+		SET embedding = NULL, updated_at = NOW()
+		WHERE id = ANY($1)
+		  AND embedding IS NOT NULL
+		  AND (embedding <#> embedding) = 0
+	`
+
+	result, err := s.db.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue placeholder documents: %w", err)
+	}
+
+	queued, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count requeued placeholder documents: %w", err)
+	}
+
+	return queued, nil
+}
+
+// scanPendingDocuments reads documents selected for embedding
+func scanPendingDocuments(rows *sql.Rows) ([]*Document, error) {
+	var documents []*Document
+	for rows.Next() {
+		doc := &Document{}
+
+		err := rows.Scan(
+			&doc.ID,
+			&doc.Content,
+			&doc.Source,
+			&doc.SourceID,
+			&doc.Title,
+			&doc.ChannelID,
+			&doc.PostID,
+			&doc.UserID,
+			&doc.UserName,
+			&doc.Timestamp,
+			&doc.ContentHash,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+
+		documents = append(documents, doc)
+	}
+
+	return documents, nil
+}
+
+// HealthCheck verifies the database connection is usable
+func (s *PostgresStore) HealthCheck(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+	return nil
+}
+
+// StoreQuerySample records a captured query, prompt context and answer
+func (s *PostgresStore) StoreQuerySample(ctx context.Context, sample *QuerySample) error {
+	query := `
+		INSERT INTO query_samples (query_id, query, context, answer, model)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := s.db.ExecContext(ctx, query, sample.QueryID, sample.Query, sample.Context, sample.Answer, sample.Model); err != nil {
+		return fmt.Errorf("failed to store query sample: %w", err)
+	}
+
+	return nil
+}
+
+// StoreFeedback records a rating of an answer
+func (s *PostgresStore) StoreFeedback(ctx context.Context, feedback *QueryFeedback) error {
+	query := `
+		INSERT INTO query_feedback (query, answer_hash, source_ids, rating, comment)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	sourceIDs := feedback.SourceIDs
+	if sourceIDs == nil {
+		sourceIDs = []string{}
+	}
+	if _, err := s.db.ExecContext(ctx, query, feedback.Query, feedback.AnswerHash, pq.Array(sourceIDs), feedback.Rating, feedback.Comment); err != nil {
+		return fmt.Errorf("failed to store feedback: %w", err)
+	}
+
+	return nil
+}
+
+// GetFeedbackStats counts stored ratings by value
+func (s *PostgresStore) GetFeedbackStats(ctx context.Context) (*FeedbackStats, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE rating = 1),
+			COUNT(*) FILTER (WHERE rating = 0),
+			COUNT(*) FILTER (WHERE rating = -1)
+		FROM query_feedback
+	`
+
+	stats := &FeedbackStats{}
+	if err := s.db.QueryRowContext(ctx, query).Scan(&stats.Positive, &stats.Neutral, &stats.Negative); err != nil {
+		return nil, fmt.Errorf("failed to get feedback stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetSourceStats counts the stored documents and their channels per source
+func (s *PostgresStore) GetSourceStats(ctx context.Context) ([]*SourceStats, error) {
+	query := `
+		SELECT
+			source,
+			COUNT(*),
+			COALESCE(array_agg(DISTINCT channel_id ORDER BY channel_id) FILTER (WHERE channel_id <> ''), '{}'),
+			MAX(created_at)
+		FROM documents
+		WHERE NOT is_deleted
+		GROUP BY source
+		ORDER BY source
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []*SourceStats{}
+	for rows.Next() {
+		source := &SourceStats{}
+		if err := rows.Scan(&source.Source, &source.Documents, pq.Array(&source.Channels), &source.LastIngestedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan source stats: %w", err)
+		}
+		stats = append(stats, source)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read source stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// SoftDeleteDocument marks a document, along with any chunk documents stored
+// for it, as deleted, returning ErrDocumentNotFound if none matched. Deleted
+// documents are kept for auditing but no longer searched, embedded or listed.
+func (s *PostgresStore) SoftDeleteDocument(ctx context.Context, id string) error {
+	return s.setDeleted(ctx, id, true)
+}
+
+// RestoreDocument undoes SoftDeleteDocument, returning ErrDocumentNotFound if
+// no document matched
+func (s *PostgresStore) RestoreDocument(ctx context.Context, id string) error {
+	return s.setDeleted(ctx, id, false)
+}
+
+func (s *PostgresStore) setDeleted(ctx context.Context, id string, deleted bool) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE documents SET is_deleted = $3, updated_at = NOW() WHERE id = $1 OR left(id, length($2)) = $2`,
+		id, id+"_chunk_", deleted)
+	if err != nil {
+		return fmt.Errorf("failed to update document deletion: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update document deletion: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+
+	return nil
+}
+
+// DeleteDocument permanently removes a document by ID, along with any chunk
+// documents stored for it, returning ErrDocumentNotFound if none matched.
+// Prefer SoftDeleteDocument, which keeps the document for auditing.
+func (s *PostgresStore) DeleteDocument(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM documents WHERE id = $1 OR left(id, length($2)) = $2`,
+		id, id+"_chunk_")
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+
+	return nil
+}
+
+// DeleteDocumentChunks deletes the id_chunk_N documents with N >= from, left
+// over when a document is rewritten with fewer chunks
+func (s *PostgresStore) DeleteDocumentChunks(ctx context.Context, id string, from int) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM documents
+		WHERE left(id, length($1)) = $1
+		  AND CASE WHEN substr(id, length($1) + 1) ~ '^[0-9]+$'
+			   THEN substr(id, length($1) + 1)::int >= $2
+			   ELSE false END
+	`, id+"_chunk_", from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete document chunks: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete document chunks: %w", err)
+	}
+	return rows, nil
+}
+
+// ListDocuments returns up to limit documents with IDs greater than afterID,
+// ordered by ID, for paging through the whole knowledge base
+func (s *PostgresStore) ListDocuments(ctx context.Context, filter DocumentFilter, afterID string, limit int, includeEmbeddings bool) ([]*Document, error) {
+	args := []interface{}{afterID}
+	conditions, args := filter.conditions(args)
+
+	query := fmt.Sprintf(`
+		SELECT id, content, source, source_id, title, channel_id, post_id,
+			   user_id, user_name, timestamp, content_hash, language, message_count, created_at, updated_at, %s
+		FROM documents
+		WHERE id > $1 AND NOT is_deleted%s
+		ORDER BY id
+		LIMIT $%d
+	`, embeddingColumn(includeEmbeddings), conditions, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
 	var documents []*Document
 	for rows.Next() {
 		doc := &Document{}
+		var embeddingVector *pgvector.Vector
 
 		err := rows.Scan(
 			&doc.ID,
@@ -280,17 +973,51 @@ func (s *PostgresStore) GetDocumentsWithoutEmbeddings(ctx context.Context, limit
 			&doc.UserName,
 			&doc.Timestamp,
 			&doc.ContentHash,
+			&doc.Language,
+			&doc.MessageCount,
+			&doc.CreatedAt,
+			&doc.UpdatedAt,
+			&embeddingVector,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan document: %w", err)
 		}
 
+		if embeddingVector != nil {
+			doc.Embedding = embeddingVector.Slice()
+		}
 		documents = append(documents, doc)
 	}
 
 	return documents, nil
 }
 
+// conditions appends SQL conditions for the filter, numbering placeholders after the existing args
+func (f DocumentFilter) conditions(args []interface{}) (string, []interface{}) {
+	var clauses []string
+	if f.Source != "" {
+		args = append(args, f.Source)
+		clauses = append(clauses, fmt.Sprintf(" AND source = $%d", len(args)))
+	}
+	if !f.After.IsZero() {
+		args = append(args, f.After)
+		clauses = append(clauses, fmt.Sprintf(" AND timestamp >= $%d", len(args)))
+	}
+	if !f.Before.IsZero() {
+		args = append(args, f.Before)
+		clauses = append(clauses, fmt.Sprintf(" AND timestamp < $%d", len(args)))
+	}
+	return strings.Join(clauses, ""), args
+}
+
+// embeddingColumn selects the embedding only when requested, to keep pages small
+func embeddingColumn(include bool) string {
+	if include {
+		return "embedding"
+	}
+	return "NULL::vector"
+}
+
 func (s *PostgresStore) Close() error {
 	return s.db.Close()
 }
@@ -300,6 +1027,24 @@ func (s *PostgresStore) DB() *sql.DB {
 	return s.db
 }
 
+// sanitizeIdentifier reduces a value to characters safe for use in an index name
+func sanitizeIdentifier(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// quoteLiteral quotes a value as a SQL string literal
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
 func HashContent(content string) string {
 	hash := sha256.Sum256([]byte(content))
 	return fmt.Sprintf("%x", hash)
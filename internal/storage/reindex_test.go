@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// storeEmbeddedDocuments stores documents with an embedding, deleting them when the test ends
+func storeEmbeddedDocuments(t *testing.T, store *PostgresStore, docs []*Document) {
+	t.Helper()
+	ctx := context.Background()
+
+	embedding := make([]float32, EmbeddingDimensions)
+	embedding[0] = 1
+	for _, doc := range docs {
+		doc.ContentHash = HashContent(doc.Content)
+		doc.Embedding = embedding
+		if _, err := store.ImportDocument(ctx, doc); err != nil {
+			t.Fatalf("Failed to store document %s: %v", doc.ID, err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, doc := range docs {
+			store.DeleteDocument(ctx, doc.ID)
+		}
+	})
+}
+
+func hasEmbedding(t *testing.T, store *PostgresStore, id string) bool {
+	t.Helper()
+
+	var embedded bool
+	err := store.DB().QueryRow("SELECT embedding IS NOT NULL FROM documents WHERE id = $1", id).Scan(&embedded)
+	if err != nil {
+		t.Fatalf("Failed to read document %s: %v", id, err)
+	}
+	return embedded
+}
+
+func TestPostgresStore_QueueReindexFiltered(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	// A source name unique to this run keeps other rows out of the filter
+	source := "reindex_" + time.Now().Format("150405.000000")
+	january := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	march := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	storeEmbeddedDocuments(t, store, []*Document{
+		{ID: "reindex_test_january", Content: "January notes", Source: source, SourceID: "1", Timestamp: january},
+		{ID: "reindex_test_march", Content: "March notes", Source: source, SourceID: "2", Timestamp: march},
+		{ID: "reindex_test_other_source", Content: "January notes elsewhere", Source: source + "_other", SourceID: "3", Timestamp: january},
+	})
+
+	queued, err := store.QueueReindex(ctx, DocumentFilter{
+		Source: source,
+		Before: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Failed to queue reindex: %v", err)
+	}
+	if queued != 1 {
+		t.Errorf("Expected 1 document queued, got %d", queued)
+	}
+
+	if hasEmbedding(t, store, "reindex_test_january") {
+		t.Errorf("Expected the matching document's embedding to be cleared")
+	}
+	if !hasEmbedding(t, store, "reindex_test_march") || !hasEmbedding(t, store, "reindex_test_other_source") {
+		t.Errorf("Expected documents outside the filter to keep their embeddings")
+	}
+
+	// Documents already waiting for an embedding aren't queued again
+	queued, err = store.QueueReindex(ctx, DocumentFilter{Source: source, Before: march})
+	if err != nil {
+		t.Fatalf("Failed to queue reindex: %v", err)
+	}
+	if queued != 0 {
+		t.Errorf("Expected no documents queued again, got %d", queued)
+	}
+}
+
+func TestPostgresStore_QueueReindexAll(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	source := "reindex_all_" + time.Now().Format("150405.000000")
+	storeEmbeddedDocuments(t, store, []*Document{
+		{ID: "reindex_all_test_1", Content: "Runbook one", Source: source, SourceID: "1", Timestamp: time.Now()},
+		{ID: "reindex_all_test_2", Content: "Runbook two", Source: source + "_other", SourceID: "2", Timestamp: time.Now()},
+	})
+
+	queued, err := store.QueueReindex(ctx, DocumentFilter{})
+	if err != nil {
+		t.Fatalf("Failed to queue reindex: %v", err)
+	}
+	if queued < 2 {
+		t.Errorf("Expected at least the 2 test documents queued, got %d", queued)
+	}
+
+	for _, id := range []string{"reindex_all_test_1", "reindex_all_test_2"} {
+		if hasEmbedding(t, store, id) {
+			t.Errorf("Expected document %s's embedding to be cleared", id)
+		}
+	}
+}
+
+func TestPostgresStore_RequeuePlaceholders(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	source := "placeholder_" + time.Now().Format("150405.000000")
+	docs := []*Document{
+		{ID: "placeholder_test_edited", Content: "The runbook was filled in after the page was created", Source: source, SourceID: "1", Timestamp: time.Now()},
+		{ID: "placeholder_test_short", Content: "  tbd  ", Source: source, SourceID: "2", Timestamp: time.Now()},
+		{ID: "placeholder_test_embedded", Content: "A document with a real embedding", Source: source, SourceID: "3", Timestamp: time.Now()},
+	}
+	storeEmbeddedDocuments(t, store, docs)
+	for _, doc := range docs[:2] {
+		if err := store.UpdateEmbedding(ctx, doc.ID, make([]float32, EmbeddingDimensions)); err != nil {
+			t.Fatalf("Failed to store placeholder for %s: %v", doc.ID, err)
+		}
+	}
+
+	placeholders, err := store.GetPlaceholderDocuments(ctx, 10, 1000)
+	if err != nil {
+		t.Fatalf("Failed to get placeholder documents: %v", err)
+	}
+	var found []string
+	for _, doc := range placeholders {
+		if doc.Source == source {
+			found = append(found, doc.ID)
+		}
+	}
+	if len(found) != 1 || found[0] != "placeholder_test_edited" {
+		t.Fatalf("Expected only the edited placeholder document, got %v", found)
+	}
+
+	queued, err := store.RequeuePlaceholders(ctx, []string{"placeholder_test_edited", "placeholder_test_embedded"})
+	if err != nil {
+		t.Fatalf("Failed to requeue placeholders: %v", err)
+	}
+	if queued != 1 {
+		t.Errorf("Expected 1 document requeued, got %d", queued)
+	}
+	if hasEmbedding(t, store, "placeholder_test_edited") {
+		t.Error("Expected the placeholder to be cleared")
+	}
+	if !hasEmbedding(t, store, "placeholder_test_embedded") || !hasEmbedding(t, store, "placeholder_test_short") {
+		t.Error("Expected real embeddings and short placeholders to be kept")
+	}
+}
+
+func TestPostgresStore_DryRunMarks(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	source := "dry_run_" + time.Now().Format("150405.000000")
+	doc := &Document{ID: "dry_run_test_doc", Content: "The runbook lives in the platform wiki", Source: source, SourceID: "1", Timestamp: time.Now()}
+	storeEmbeddedDocuments(t, store, []*Document{doc})
+	if _, err := store.QueueReindex(ctx, DocumentFilter{Source: source}); err != nil {
+		t.Fatalf("Failed to clear embedding: %v", err)
+	}
+
+	pending := func() bool {
+		documents, err := store.GetDocumentsWithoutEmbeddings(ctx, 1000)
+		if err != nil {
+			t.Fatalf("Failed to get documents without embeddings: %v", err)
+		}
+		for _, d := range documents {
+			if d.ID == doc.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	count := func() int {
+		n, err := store.CountDocumentsWithoutEmbeddings(ctx)
+		if err != nil {
+			t.Fatalf("Failed to count documents without embeddings: %v", err)
+		}
+		return n
+	}
+	before := count()
+
+	if err := store.MarkDryRun(ctx, doc.ID); err != nil {
+		t.Fatalf("Failed to mark dry run: %v", err)
+	}
+	if pending() || hasEmbedding(t, store, doc.ID) {
+		t.Fatal("Expected the marked document to be skipped without an embedding")
+	}
+	if after := count(); after != before-1 {
+		t.Errorf("Expected the backlog count to drop from %d to %d, got %d", before, before-1, after)
+	}
+
+	if _, err := store.ClearDryRunMarks(ctx); err != nil {
+		t.Fatalf("Failed to clear dry run marks: %v", err)
+	}
+	if !pending() {
+		t.Error("Expected the document to be queued for embedding once marks are cleared")
+	}
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func buildSourceResults(source string, count int, similarity float64) []*Document {
+	documents := make([]*Document, count)
+	for i := range documents {
+		documents[i] = &Document{
+			ID:         fmt.Sprintf("%s_%d", source, i),
+			Source:     source,
+			Similarity: similarity - float64(i)*0.001,
+		}
+	}
+	return documents
+}
+
+func TestMergeBySource_BalancedWhenOneSourceDominates(t *testing.T) {
+	results := map[string][]*Document{
+		"slack": buildSourceResults("slack", 100, 0.95),
+		"slab":  buildSourceResults("slab", 5, 0.80),
+	}
+	weights := map[string]float64{"slack": 1, "slab": 1}
+
+	merged := MergeBySource(results, weights, 10)
+
+	if len(merged) != 10 {
+		t.Fatalf("Expected 10 merged documents, got %d", len(merged))
+	}
+
+	counts := make(map[string]int)
+	for _, doc := range merged {
+		counts[doc.Source]++
+	}
+	if counts["slack"] != 5 || counts["slab"] != 5 {
+		t.Errorf("Expected balanced 5/5 split, got %v", counts)
+	}
+}
+
+func TestMergeBySource_FillsUnusedQuota(t *testing.T) {
+	results := map[string][]*Document{
+		"slack": buildSourceResults("slack", 20, 0.9),
+		"slab":  buildSourceResults("slab", 2, 0.8),
+	}
+	weights := map[string]float64{"slack": 1, "slab": 1}
+
+	merged := MergeBySource(results, weights, 10)
+
+	counts := make(map[string]int)
+	for _, doc := range merged {
+		counts[doc.Source]++
+	}
+	if len(merged) != 10 || counts["slab"] != 2 || counts["slack"] != 8 {
+		t.Errorf("Expected unused slab quota to be filled by slack (8/2), got %v", counts)
+	}
+}
+
+func TestMergeBySource_RespectsWeights(t *testing.T) {
+	results := map[string][]*Document{
+		"slack": buildSourceResults("slack", 20, 0.9),
+		"slab":  buildSourceResults("slab", 20, 0.9),
+	}
+	weights := map[string]float64{"slack": 3, "slab": 1}
+
+	merged := MergeBySource(results, weights, 8)
+
+	counts := make(map[string]int)
+	for _, doc := range merged {
+		counts[doc.Source]++
+	}
+	if counts["slack"] != 6 || counts["slab"] != 2 {
+		t.Errorf("Expected 6/2 split for 3:1 weights, got %v", counts)
+	}
+
+	// Results are ordered by weighted similarity
+	for i := 1; i < len(merged); i++ {
+		prev := merged[i-1].Similarity * weights[merged[i-1].Source]
+		curr := merged[i].Similarity * weights[merged[i].Source]
+		if curr > prev {
+			t.Errorf("Merged results not ordered by weighted similarity at index %d", i)
+		}
+	}
+}
+
+func TestMergeBySource_IgnoresUnweightedSources(t *testing.T) {
+	results := map[string][]*Document{
+		"slack":   buildSourceResults("slack", 3, 0.9),
+		"unknown": buildSourceResults("unknown", 3, 0.99),
+	}
+
+	merged := MergeBySource(results, map[string]float64{"slack": 1}, 10)
+
+	for _, doc := range merged {
+		if doc.Source == "unknown" {
+			t.Errorf("Expected documents from unweighted source to be excluded")
+		}
+	}
+}
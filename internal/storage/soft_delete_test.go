@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func containsDocument(documents []*Document, id string) bool {
+	for _, doc := range documents {
+		if doc.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPostgresStore_SoftDeleteAndRestore(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	// A direction no other test embeds along keeps these documents on top
+	embedding := make([]float32, EmbeddingDimensions)
+	embedding[EmbeddingDimensions-1] = 1
+
+	source := "soft_delete_" + time.Now().Format("150405.000000")
+	docs := []*Document{
+		{ID: "soft_delete_test", Content: "Retracted rollback notes", Embedding: embedding},
+		{ID: "soft_delete_test_chunk_1", Content: "Retracted rollback notes, part two", Embedding: embedding},
+		{ID: "soft_delete_test_pending", Content: "Retracted notes awaiting an embedding"},
+	}
+	for i, doc := range docs {
+		doc.Source = source
+		doc.SourceID = doc.ID
+		doc.Timestamp = time.Now().Add(time.Duration(i) * time.Second)
+		doc.ContentHash = HashContent(doc.Content)
+		if _, err := store.ImportDocument(ctx, doc); err != nil {
+			t.Fatalf("Failed to store document %s: %v", doc.ID, err)
+		}
+	}
+	t.Cleanup(func() {
+		store.DeleteDocument(ctx, "soft_delete_test")
+		store.DeleteDocument(ctx, "soft_delete_test_pending")
+	})
+
+	search := func() []*Document {
+		t.Helper()
+		results, err := store.SearchSimilar(ctx, embedding, 10)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		return results
+	}
+	pending := func() []*Document {
+		t.Helper()
+		results, err := store.GetDocumentsWithoutEmbeddings(ctx, 1000)
+		if err != nil {
+			t.Fatalf("Failed to get documents without embeddings: %v", err)
+		}
+		return results
+	}
+
+	if results := search(); !containsDocument(results, "soft_delete_test") || !containsDocument(results, "soft_delete_test_chunk_1") {
+		t.Fatal("Expected the documents to be searchable before deletion")
+	}
+
+	for _, id := range []string{"soft_delete_test", "soft_delete_test_pending"} {
+		if err := store.SoftDeleteDocument(ctx, id); err != nil {
+			t.Fatalf("Failed to soft-delete %s: %v", id, err)
+		}
+	}
+
+	if results := search(); containsDocument(results, "soft_delete_test") || containsDocument(results, "soft_delete_test_chunk_1") {
+		t.Error("Expected the deleted document and its chunks to drop out of search")
+	}
+	if containsDocument(pending(), "soft_delete_test_pending") {
+		t.Error("Expected the deleted document not to be queued for embedding")
+	}
+	if _, err := store.GetDocument(ctx, "soft_delete_test"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound for a deleted document, got %v", err)
+	}
+
+	// The row is kept for auditing
+	var deleted bool
+	if err := store.DB().QueryRow("SELECT is_deleted FROM documents WHERE id = $1", "soft_delete_test").Scan(&deleted); err != nil || !deleted {
+		t.Errorf("Expected the deleted row to be kept and flagged, got %v (%v)", deleted, err)
+	}
+
+	for _, id := range []string{"soft_delete_test", "soft_delete_test_pending"} {
+		if err := store.RestoreDocument(ctx, id); err != nil {
+			t.Fatalf("Failed to restore %s: %v", id, err)
+		}
+	}
+
+	if results := search(); !containsDocument(results, "soft_delete_test") || !containsDocument(results, "soft_delete_test_chunk_1") {
+		t.Error("Expected the restored document and its chunks to be searchable")
+	}
+	if !containsDocument(pending(), "soft_delete_test_pending") {
+		t.Error("Expected the restored document to be queued for embedding")
+	}
+
+	if err := store.SoftDeleteDocument(ctx, "soft_delete_test_missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound for an unknown document, got %v", err)
+	}
+}
+
+func TestPostgresStore_DeleteDocumentChunks(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	source := "chunk_delete_" + time.Now().Format("150405.000000")
+	var docs []*Document
+	for _, id := range []string{"chunk_delete_test", "chunk_delete_test_chunk_1", "chunk_delete_test_chunk_2", "chunk_delete_test_chunk_10", "chunk_delete_test_chunk_x"} {
+		docs = append(docs, &Document{ID: id, Content: "Chunk of the incident review " + id, Source: source, SourceID: id, Timestamp: time.Now()})
+	}
+	storeEmbeddedDocuments(t, store, docs)
+
+	removed, err := store.DeleteDocumentChunks(ctx, "chunk_delete_test", 2)
+	if err != nil {
+		t.Fatalf("Failed to delete chunks: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected chunks 2 and 10 to be deleted, got %d", removed)
+	}
+
+	for _, id := range []string{"chunk_delete_test", "chunk_delete_test_chunk_1", "chunk_delete_test_chunk_x"} {
+		if _, err := store.GetDocument(ctx, id); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", id, err)
+		}
+	}
+	for _, id := range []string{"chunk_delete_test_chunk_2", "chunk_delete_test_chunk_10"} {
+		if _, err := store.GetDocument(ctx, id); !errors.Is(err, ErrDocumentNotFound) {
+			t.Errorf("Expected %s to be deleted, got %v", id, err)
+		}
+	}
+}
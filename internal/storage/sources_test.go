@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPostgresStore_GetSourceStats(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	// A source name unique to this run keeps other rows out of its stats
+	source := "sources_" + time.Now().Format("150405.000000")
+	storeEmbeddedDocuments(t, store, []*Document{
+		{ID: "sources_test_1", Content: "Deploy notes", Source: source, SourceID: "1", ChannelID: "C2", Timestamp: time.Now()},
+		{ID: "sources_test_2", Content: "Rollback notes", Source: source, SourceID: "2", ChannelID: "C1", Timestamp: time.Now()},
+		{ID: "sources_test_3", Content: "More deploy notes", Source: source, SourceID: "3", ChannelID: "C2", Timestamp: time.Now()},
+		{ID: "sources_test_4", Content: "Notes without a channel", Source: source, SourceID: "4", Timestamp: time.Now()},
+	})
+
+	stats, err := store.GetSourceStats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get source stats: %v", err)
+	}
+
+	var found *SourceStats
+	for _, s := range stats {
+		if s.Source == source {
+			found = s
+		}
+	}
+	if found == nil {
+		t.Fatalf("Expected stats for source %s, got %+v", source, stats)
+	}
+	if found.Documents != 4 {
+		t.Errorf("Expected 4 documents, got %d", found.Documents)
+	}
+	if len(found.Channels) != 2 || found.Channels[0] != "C1" || found.Channels[1] != "C2" {
+		t.Errorf("Expected channels [C1 C2], got %v", found.Channels)
+	}
+	if time.Since(found.LastIngestedAt) > time.Minute {
+		t.Errorf("Expected a recent last ingestion, got %v", found.LastIngestedAt)
+	}
+}
@@ -2,25 +2,82 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrDocumentNotFound is returned when no document matches the given ID
+var ErrDocumentNotFound = errors.New("document not found")
+
+// EmbeddingDimensions is the size of the documents.embedding vector column
+const EmbeddingDimensions = 1536
+
 type Document struct {
-	ID          string    `json:"id"`
-	Content     string    `json:"content"`
-	Source      string    `json:"source"`      // "slack" or "slab"
-	SourceID    string    `json:"source_id"`   // Original ID from source (thread_ts for Slack threads)
-	Title       string    `json:"title,omitempty"`
-	ChannelID   string    `json:"channel_id,omitempty"`  // For Slack
-	PostID      string    `json:"post_id,omitempty"`     // For Slab comments
-	UserID      string    `json:"user_id"`
-	UserName    string    `json:"user_name,omitempty"`
-	Timestamp   time.Time `json:"timestamp"`
-	ContentHash string    `json:"content_hash"`
-	Embedding   []float32 `json:"embedding,omitempty"`
-	Similarity  float64   `json:"similarity,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           string    `json:"id"`
+	Content      string    `json:"content"`
+	Source       string    `json:"source"`    // "slack" or "slab"
+	SourceID     string    `json:"source_id"` // Original ID from source (thread_ts for Slack threads)
+	Title        string    `json:"title,omitempty"`
+	ChannelID    string    `json:"channel_id,omitempty"` // For Slack
+	PostID       string    `json:"post_id,omitempty"`    // For Slab comments
+	UserID       string    `json:"user_id"`
+	UserName     string    `json:"user_name,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+	ContentHash  string    `json:"content_hash"`
+	Language     string    `json:"language,omitempty"`      // ISO 639-1 code detected from the content, "" when unknown
+	MessageCount int       `json:"message_count,omitempty"` // Messages in the conversation the document covers, for summarized threads
+	Embedding    []float32 `json:"embedding,omitempty"`
+	Similarity   float64   `json:"similarity,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// QuerySample is a captured query with its prompt context and answer, kept for offline quality evaluation
+type QuerySample struct {
+	QueryID   string    `json:"query_id"`
+	Query     string    `json:"query"`
+	Context   string    `json:"context"`
+	Answer    string    `json:"answer"`
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QueryFeedback is a user's rating of an answer: -1 (thumbs down), 0 or +1 (thumbs up)
+type QueryFeedback struct {
+	Query      string    `json:"query"`
+	AnswerHash string    `json:"answer_hash"`
+	SourceIDs  []string  `json:"source_ids"`
+	Rating     int       `json:"rating"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FeedbackStats counts stored answer ratings
+type FeedbackStats struct {
+	Positive int64 `json:"positive"`
+	Neutral  int64 `json:"neutral"`
+	Negative int64 `json:"negative"`
+}
+
+// SourceStats summarizes the documents stored for one source
+type SourceStats struct {
+	Source    string   `json:"source"`
+	Documents int64    `json:"documents"`
+	Channels  []string `json:"channels"` // Distinct channel IDs, sorted
+	// When the newest document was first stored
+	LastIngestedAt time.Time `json:"last_ingested_at"`
+}
+
+// DocumentFilter restricts which documents are returned; zero values match everything
+type DocumentFilter struct {
+	Source string
+	After  time.Time
+	Before time.Time
+}
+
+// IsZero reports whether the filter matches every document
+func (f DocumentFilter) IsZero() bool {
+	return f.Source == "" && f.After.IsZero() && f.Before.IsZero()
 }
 
 type Store interface {
@@ -28,5 +85,8 @@ type Store interface {
 	UpdateEmbedding(ctx context.Context, documentID string, embedding []float32) error
 	SearchSimilar(ctx context.Context, embedding []float32, limit int) ([]*Document, error)
 	GetDocumentsWithoutEmbeddings(ctx context.Context, limit int) ([]*Document, error)
+	CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error)
+	GetDocument(ctx context.Context, id string) (*Document, error)
+	DeleteDocument(ctx context.Context, id string) error
 	Close() error
 }
\ No newline at end of file
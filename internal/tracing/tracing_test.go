@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup_DisabledWithoutEndpoint(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := Setup(context.Background(), "", "knowthis")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if otel.GetTracerProvider() != previous {
+		t.Error("Expected the tracer provider to be left alone without an endpoint")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected a no-op shutdown, got %v", err)
+	}
+
+	// Spans are still safe to start, and record nothing
+	_, span := Start(context.Background(), "noop")
+	if span.IsRecording() {
+		t.Error("Expected spans to be no-ops without an endpoint")
+	}
+	End(span, nil)
+}
+
+func TestEnd_RecordsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, ok := Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Start(context.Background(), "failed")
+	End(failed, errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("Expected no status for a successful span, got %v", spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "connection refused" || len(spans[1].Events()) != 1 {
+		t.Errorf("Expected the error recorded on the failed span, got %v with %d events", spans[1].Status(), len(spans[1].Events()))
+	}
+}
@@ -13,10 +13,16 @@ import (
 
 	"knowthis/internal/config"
 	"knowthis/internal/handlers"
+	"knowthis/internal/integrations/discord"
 	"knowthis/internal/integrations/slack"
+	"knowthis/internal/integrations/teams"
+	"knowthis/internal/jobs"
 	"knowthis/internal/logging"
+	"knowthis/internal/metrics"
 	"knowthis/internal/middleware"
 	"knowthis/internal/services"
+	"knowthis/internal/storage"
+	"knowthis/internal/tracing"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -24,12 +30,29 @@ import (
 )
 
 type ServiceBundle struct {
+	SlackDB                  *sql.DB
+	DocumentStore            *storage.PostgresStore
 	EmbeddingService         *services.EmbeddingService
 	RAGService               *services.RAGService
 	SlackStorage             *slack.SlackStorage
+	ChannelAllowlist         *slack.ChannelAllowlist
 	SlackHandler             *slack.SlackHandler
 	SlackEmbeddingProcessor  *slack.EmbeddingProcessor
+	EmbeddingProcessor       *jobs.EmbeddingProcessor
+	AnswerCache              *services.AnswerCache
 	QueryHandler             *handlers.QueryHandler
+	AdminHandler             *handlers.AdminHandler
+	ReadinessHandler         *handlers.ReadinessHandler
+	DocumentHandler          *handlers.DocumentHandler
+	SlackCommandHandler      *handlers.SlackCommandHandler
+	ChannelIngestHandler     *handlers.ChannelIngestHandler
+	DiscordHandler           *discord.DiscordHandler
+	NotionHandler            *handlers.NotionHandler
+	TeamsHandler             *teams.TeamsHandler
+	StatsHandler             *handlers.StatsHandler
+	ReindexHandler           *handlers.ReindexHandler
+	FeedbackHandler          *handlers.FeedbackHandler
+	SourcesHandler           *handlers.SourcesHandler
 	Config                   *config.Config
 }
 
@@ -48,9 +71,16 @@ func initializeServices() *ServiceBundle {
 			}
 			break
 		}
+		metrics.SetTokenPrices(cfg.TokenPrices)
 		
 		slog.Info("Initializing services...")
 		
+		pool := storage.PoolConfig{
+			MaxOpenConns:    cfg.DBMaxOpenConns,
+			MaxIdleConns:    cfg.DBMaxIdleConns,
+			ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		}
+
 		// Initialize database connection for Slack storage
 		var db *sql.DB
 		for {
@@ -61,6 +91,7 @@ func initializeServices() *ServiceBundle {
 				time.Sleep(30 * time.Second)
 				continue
 			}
+			storage.ConfigurePool(db, pool)
 			
 			// Test connection
 			if err = db.Ping(); err != nil {
@@ -81,12 +112,39 @@ func initializeServices() *ServiceBundle {
 			break
 		}
 		
+		// Initialize document store (documents table) with retry
+		var documentStore *storage.PostgresStore
+		for {
+			var err error
+			documentStore, err = storage.NewPostgresStore(cfg.DatabaseURL)
+			if err != nil {
+				slog.Error("Failed to initialize document store, retrying in 30s", "error", err)
+				time.Sleep(30 * time.Second)
+				continue
+			}
+			
+			if cfg.PerSourceIndexes {
+				documentStore.EnablePerSourceIndexes(context.Background(), cfg.SourceWeights)
+			}
+			documentStore.SetDedupAcrossSourceID(cfg.DedupAcrossSourceID)
+			documentStore.SetConnectionPool(pool)
+			break
+		}
+		
 		// Initialize embedding service with retry
 		var embeddingService *services.EmbeddingService
 		for {
-			embeddingService = services.NewEmbeddingService(cfg.OpenAIAPIKey)
-			if embeddingService == nil {
-				slog.Error("Failed to initialize embedding service, retrying in 30s")
+			var err error
+			embeddingService, err = services.NewEmbeddingService(cfg.OpenAIAPIKey, cfg.EmbeddingModel, cfg.EmbeddingDimensions, services.RetryPolicy{
+				MaxAttempts:    cfg.EmbeddingMaxAttempts,
+				BaseDelay:      cfg.EmbeddingRetryDelay,
+				AttemptTimeout: cfg.EmbeddingTimeout,
+			})
+			if err == nil && cfg.MultilingualEmbeddingModel != "" {
+				err = embeddingService.SetMultilingualModel(cfg.MultilingualEmbeddingModel)
+			}
+			if err != nil {
+				slog.Error("Failed to initialize embedding service, retrying in 30s", "error", err, "model", cfg.EmbeddingModel)
 				time.Sleep(30 * time.Second)
 				// Reload configuration on retry
 				cfg = config.Load()
@@ -97,27 +155,44 @@ func initializeServices() *ServiceBundle {
 				}
 				continue
 			}
+			slog.Info("Embedding service initialized", "model", embeddingService.Model())
 			break
 		}
 		
 		// Initialize Slack storage and handler
 		var slackStorage *slack.SlackStorage
+		var channelAllowlist *slack.ChannelAllowlist
 		var slackHandler *slack.SlackHandler
 		var slackEmbeddingProcessor *slack.EmbeddingProcessor
 		for {
 			slackStorage = slack.NewSlackStorage(db)
+			slackStorage.SetRetrievalGranularity(slack.RetrievalGranularity(cfg.RetrievalGranularity))
+			slackStorage.SetKeywordWeight(cfg.SearchKeywordWeight)
 			if err := slackStorage.InitSchema(); err != nil {
 				slog.Error("Failed to initialize Slack schema, retrying in 30s", "error", err)
 				time.Sleep(30 * time.Second)
 				continue
 			}
 			
-			slackHandler = slack.NewSlackHandler(cfg.SlackBotToken, slackStorage)
+			channelAllowlist = slack.NewChannelAllowlist(slackStorage, cfg.SlackChannelAllowlist)
+			if err := channelAllowlist.Load(context.Background()); err != nil {
+				slog.Error("Failed to load channel allowlist, retrying in 30s", "error", err)
+				time.Sleep(30 * time.Second)
+				continue
+			}
+			
+			slackHandler = slack.NewSlackHandler(cfg.SlackBotToken, slackStorage, channelAllowlist)
 			if slackHandler == nil {
 				slog.Error("Failed to initialize Slack handler, retrying in 30s")
 				time.Sleep(30 * time.Second)
 				continue
 			}
+			slackHandler.SetNotifyRetry(cfg.SlackNotifyMaxAttempts, cfg.SlackNotifyRetryDelay)
+			slackHandler.SetRateLimitRetries(cfg.SlackRateLimitRetries)
+			slackHandler.SetProfileEnrichment(cfg.ProfileEnrichment, cfg.ProfileTeamField)
+			if cfg.CanvasIngestion {
+				slackHandler.SetCanvasStore(documentStore)
+			}
 			
 			slackEmbeddingProcessor = slack.NewEmbeddingProcessor(slackStorage, embeddingService)
 			if slackEmbeddingProcessor == nil {
@@ -125,14 +200,57 @@ func initializeServices() *ServiceBundle {
 				time.Sleep(30 * time.Second)
 				continue
 			}
+			slackEmbeddingProcessor.SetAdaptiveInterval(cfg.EmbeddingIntervalMin, cfg.EmbeddingIntervalMax)
+			slackEmbeddingProcessor.SetQuoteTrimming(cfg.TrimQuotedContent)
+			slackEmbeddingProcessor.SetChunking(cfg.ChunkMaxWords, cfg.ChunkOverlapWords)
+			slackEmbeddingProcessor.SetConcurrency(cfg.EmbeddingConcurrency, cfg.EmbeddingRequestsPerSecond)
+			slackEmbeddingProcessor.SetDryRun(cfg.EmbeddingDryRun)
 			
 			break
 		}
 
+		// Tables created for another embedding size fail at the first insert
+		// or search, so don't start until they are migrated
+		if cfg.EmbeddingDimensionCheck {
+			for {
+				err := storage.CheckVectorDimensions(context.Background(), db, storage.EmbeddingDimensions,
+					storage.DocumentEmbeddingColumn, slack.ThreadEmbeddingColumn)
+				if err != nil {
+					slog.Error("Vector column dimensions don't match the embedding model, retrying in 30s", "error", err)
+					time.Sleep(30 * time.Second)
+					continue
+				}
+				break
+			}
+		}
+
+		// Initialize chat provider (OpenAI or any OpenAI-compatible API)
+		llmProvider := services.NewLLMProvider(cfg.ChatAPIKey, cfg.ChatBaseURL)
+		if cfg.ChatValidateOnStartup {
+			for {
+				if err := services.ValidateLLMProvider(context.Background(), llmProvider, cfg.ChatModel); err != nil {
+					slog.Error("Failed to reach chat provider, retrying in 30s", "error", err, "base_url", cfg.ChatBaseURL)
+					time.Sleep(30 * time.Second)
+					continue
+				}
+				slog.Info("Chat provider reachable", "model", cfg.ChatModel)
+				break
+			}
+		}
+
 		// Initialize RAG service with retry
 		var ragService *services.RAGService
+		var answerCache *services.AnswerCache
 		for {
-			ragService = services.NewRAGService(cfg.OpenAIAPIKey, slackStorage, embeddingService)
+			queryEmbedder := embeddingService.WithRetryPolicy(services.RetryPolicy{
+				MaxAttempts:    cfg.QueryEmbeddingMaxAttempts,
+				BaseDelay:      cfg.QueryEmbeddingRetryDelay,
+				AttemptTimeout: cfg.QueryEmbeddingTimeout,
+			})
+			if cfg.QueryEmbeddingCacheSize > 0 {
+				queryEmbedder.SetCache(services.NewEmbeddingCache(cfg.QueryEmbeddingCacheSize, cfg.QueryEmbeddingCacheTTL))
+			}
+			ragService = services.NewRAGService(llmProvider, cfg.ChatModel, slackStorage, queryEmbedder)
 			if ragService == nil {
 				slog.Error("Failed to initialize RAG service, retrying in 30s")
 				time.Sleep(30 * time.Second)
@@ -145,6 +263,46 @@ func initializeServices() *ServiceBundle {
 				}
 				continue
 			}
+			if cfg.MultilingualEmbeddingModel != "" {
+				ragService.SetLanguageRouting(queryEmbedder)
+			}
+			blockedPhrases := services.DefaultBlockedPhrases
+			if len(cfg.QualityBlockedPhrases) > 0 {
+				blockedPhrases = cfg.QualityBlockedPhrases
+			}
+			ragService.SetQualityFilter(services.QualityFilter{
+				MinChars:       cfg.QualityMinChars,
+				MinWords:       cfg.QualityMinWords,
+				BlockedPhrases: blockedPhrases,
+			})
+			ragService.SetSimilarityThresholds(services.SimilarityThresholds{
+				Primary:  cfg.RAGPrimaryThreshold,
+				Fallback: cfg.RAGFallbackThreshold,
+			})
+			ragService.SetTimeouts(services.Timeouts{
+				Query:      cfg.QueryTimeout,
+				Completion: cfg.CompletionTimeout,
+				Condense:   cfg.CondenseTimeout,
+			})
+			ragService.SetRequireAccessScope(cfg.AccessScopeHeader != "")
+			ragService.SetDedupContainedSources(cfg.DedupContainedSources)
+			ragService.SetSourceFallback(cfg.AnswerSourceFallback)
+			ragService.SetInlineCitationDates(cfg.InlineCitationDates)
+			ragService.SetPromptTokenBudget(cfg.PromptTokenBudget)
+			ragService.SetDocumentSearch(documentStore)
+			if cfg.SystemPrompt != "" {
+				ragService.SetSystemPrompt(cfg.SystemPrompt)
+			}
+			if cfg.QuerySampleRate > 0 {
+				ragService.SetQuerySampler(services.NewQuerySampler(cfg.QuerySampleRate, documentStore))
+			}
+			if cfg.AnswerCacheTTL > 0 {
+				answerCache = services.NewAnswerCache(cfg.AnswerCacheTTL, cfg.AnswerCacheSize)
+				ragService.SetAnswerCache(answerCache)
+			}
+			if cfg.ConversationTTL > 0 {
+				ragService.SetConversationStore(services.NewConversationStore(cfg.ConversationTTL, cfg.ConversationMaxTurns))
+			}
 			break
 		}
 		
@@ -159,23 +317,125 @@ func initializeServices() *ServiceBundle {
 				time.Sleep(30 * time.Second)
 				continue
 			}
+			queryHandler.SetAccessScopeHeader(cfg.AccessScopeHeader)
+			queryHandler.SetAllowedModels(append([]string{cfg.ChatModel}, cfg.ChatModelAllowlist...))
+			queryHandler.SetPermalinkResolver(slackHandler)
 			break
 		}
 		
+		adminHandler := handlers.NewAdminHandler(channelAllowlist, documentStore)
+		if answerCache != nil {
+			adminHandler.SetAnswerCache(answerCache)
+		}
+		adminHandler.SetWebhookVerifier("slack", func(signature, timestamp string, body []byte) error {
+			return middleware.VerifySlackRequest(cfg.SlackSigningSecret, signature, timestamp, body)
+		})
+		
+		documentHandler := handlers.NewDocumentHandler(documentStore)
+
+		slackCommandHandler := handlers.NewSlackCommandHandler(ragService)
+		slackCommandHandler.SetPermalinkResolver(slackHandler)
+		slackHandler.SetSummarizer(ragService)
+		slackHandler.SetLongThreadSummaries(documentStore, cfg.SlackThreadSummaryThreshold, cfg.SlackThreadSummarySegment)
+
+		// Discord thread collection is optional
+		var discordHandler *discord.DiscordHandler
+		if cfg.DiscordBotToken != "" {
+			discordHandler = discord.NewDiscordHandler(cfg.DiscordBotToken, documentStore)
+			discordHandler.SetContextMessages(cfg.DiscordContextMessages)
+			adminHandler.SetWebhookVerifier("discord", func(signature, timestamp string, body []byte) error {
+				return middleware.VerifyDiscordRequest(cfg.DiscordPublicKey, signature, timestamp, body)
+			})
+		}
+
+		// Notion page ingestion is optional
+		var notionHandler *handlers.NotionHandler
+		if cfg.NotionAPIToken != "" {
+			notionHandler = handlers.NewNotionHandler(cfg.NotionAPIToken, documentStore)
+			adminHandler.SetWebhookVerifier("notion", func(signature, timestamp string, body []byte) error {
+				return middleware.VerifyNotionRequest(cfg.NotionWebhookSecret, signature, body)
+			})
+		}
+
+		// Teams thread collection is optional
+		var teamsHandler *teams.TeamsHandler
+		if cfg.TeamsClientID != "" {
+			teamsHandler = teams.NewTeamsHandler(cfg.TeamsTenantID, cfg.TeamsClientID, cfg.TeamsClientSecret, documentStore)
+			adminHandler.SetWebhookVerifier("teams", func(signature, timestamp string, body []byte) error {
+				return middleware.VerifyTeamsRequest(cfg.TeamsWebhookSecret, signature, body)
+			})
+		}
+
+		// Embeds documents table content (Slab posts, canvases, imports)
+		embeddingProcessor := jobs.NewEmbeddingProcessor(documentStore, embeddingService)
+		embeddingProcessor.SetCommentParentContext(documentStore, cfg.CommentParentContextChars)
+		embeddingProcessor.SetPlaceholderSweep(documentStore, cfg.PlaceholderSweepInterval)
+		embeddingProcessor.SetDryRun(documentStore, cfg.EmbeddingDryRun)
+		embeddingProcessor.SetMaxChunksPerDocument(cfg.EmbeddingMaxChunksPerDocument)
+		if cfg.DocumentEmbeddingMaxBatchSize > 0 {
+			embeddingProcessor.SetAdaptive(cfg.DocumentEmbeddingMaxBatchSize, cfg.DocumentEmbeddingMinInterval)
+		}
+		statsHandler := handlers.NewStatsHandler(embeddingProcessor)
+		reindexHandler := handlers.NewReindexHandler(documentStore)
+		channelIngestHandler := handlers.NewChannelIngestHandler(slackHandler)
+		feedbackHandler := handlers.NewFeedbackHandler(documentStore)
+		sourcesHandler := handlers.NewSourcesHandler(slackStorage, documentStore)
+		
+		readinessHandler := handlers.NewReadinessHandler(map[string]services.HealthChecker{
+			"database": documentStore,
+			"openai":   embeddingService,
+		})
+		
 		slog.Info("All services initialized successfully")
 		
 		return &ServiceBundle{
+			SlackDB:                 db,
+			DocumentStore:           documentStore,
 			EmbeddingService:        embeddingService,
 			RAGService:              ragService,
 			SlackStorage:            slackStorage,
+			ChannelAllowlist:        channelAllowlist,
 			SlackHandler:            slackHandler,
 			SlackEmbeddingProcessor: slackEmbeddingProcessor,
+			EmbeddingProcessor:      embeddingProcessor,
+			AnswerCache:             answerCache,
 			QueryHandler:            queryHandler,
+			AdminHandler:            adminHandler,
+			ReadinessHandler:        readinessHandler,
+			DocumentHandler:         documentHandler,
+			SlackCommandHandler:     slackCommandHandler,
+			ChannelIngestHandler:    channelIngestHandler,
+			DiscordHandler:          discordHandler,
+			NotionHandler:           notionHandler,
+			TeamsHandler:            teamsHandler,
+			StatsHandler:            statsHandler,
+			ReindexHandler:          reindexHandler,
+			FeedbackHandler:         feedbackHandler,
+			SourcesHandler:          sourcesHandler,
 			Config:                  cfg,
 		}
 	}
 }
 
+// warmupServices pings dependencies before serving so the first query doesn't
+// pay connection setup. Failures only warn unless WARMUP_REQUIRED is set.
+func warmupServices(bundle *ServiceBundle) {
+	err := services.Warmup(context.Background(), map[string]services.HealthChecker{
+		"database": bundle.DocumentStore,
+		"openai":   bundle.EmbeddingService,
+		"slack":    bundle.SlackHandler,
+	}, bundle.Config.WarmupTimeout)
+	if err == nil {
+		return
+	}
+
+	if bundle.Config.WarmupRequired {
+		slog.Error("Warmup failed", "error", err)
+		os.Exit(1)
+	}
+	slog.Warn("Warmup incomplete, serving anyway", "error", err)
+}
+
 func main() {
 	// Setup structured logging
 	logging.SetupLogger()
@@ -184,13 +444,33 @@ func main() {
 	
 	// Initialize all services with retry logic (includes config validation)
 	services := initializeServices()
+	warmupServices(services)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), services.Config.OTLPEndpoint, services.Config.OTELServiceName)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Start background jobs
+	go metrics.TrackDatabaseConnections(ctx, services.SlackDB, services.DocumentStore.DB())
 	go services.SlackEmbeddingProcessor.Start(ctx)
+	go services.EmbeddingProcessor.Start(ctx)
+	if services.AnswerCache != nil {
+		go services.AnswerCache.Sweep(ctx)
+	}
+
+	if services.Config.BackfillSlackDocuments {
+		go func() {
+			if _, err := slack.BackfillDocuments(ctx, services.DocumentStore, services.SlackStorage); err != nil {
+				slog.Error("Failed to backfill Slack documents", "error", err)
+			}
+		}()
+	}
 	
 	// Note: Slack now uses message actions instead of Socket Mode
 	// No background goroutine needed - handled via HTTP endpoints
@@ -199,23 +479,89 @@ func main() {
 	router := mux.NewRouter()
 	
 	// Add middleware
+	router.Use(middleware.TracingMiddleware)
 	router.Use(middleware.LoggingMiddleware)
 	router.Use(middleware.MetricsMiddleware)
 	
+	// Trusted sources exempt from per-IP rate limiting
+	rateLimitBypass, err := middleware.ParseIPNets(services.Config.RateLimitBypass)
+	if err != nil {
+		slog.Error("Invalid rate limit bypass list", "error", err)
+		os.Exit(1)
+	}
+
+	apiKeys, err := middleware.ParseAPIKeys(services.Config.APIKeys)
+	if err != nil {
+		slog.Error("Invalid API keys", "error", err)
+		os.Exit(1)
+	}
+	if len(apiKeys) == 0 {
+		slog.Warn("API_KEYS is not set, the query API is open to anyone who can reach it")
+	}
+
 	// API routes with rate limiting
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	apiRouter.Use(middleware.APIRateLimitMiddleware())
-	apiRouter.HandleFunc("/query", services.QueryHandler.HandleQuery).Methods("POST")
+	if len(services.Config.CORSAllowedOrigins) > 0 {
+		// Ahead of rate limiting so browsers can read 429s; preflights need a
+		// route of their own to match, since the routes below only accept their method
+		apiRouter.Use(middleware.CORSMiddleware(middleware.CORSOptions{
+			AllowedOrigins:   services.Config.CORSAllowedOrigins,
+			AllowedMethods:   services.Config.CORSAllowedMethods,
+			AllowedHeaders:   services.Config.CORSAllowedHeaders,
+			AllowCredentials: services.Config.CORSAllowCredentials,
+			MaxAge:           services.Config.CORSMaxAge,
+		}))
+		apiRouter.PathPrefix("/").Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	apiRouter.Use(middleware.APIRateLimitMiddleware(services.Config.APIRateLimit, services.Config.APIBurst, services.Config.RateLimitIdleTTL, rateLimitBypass))
+	requireAdmin := middleware.AdminAuthMiddleware(services.Config.AdminAPIKey)
+	apiRouter.Handle("/reindex", requireAdmin(http.HandlerFunc(services.ReindexHandler.HandleReindex))).Methods("POST")
+	apiRouter.Handle("/sources", requireAdmin(http.HandlerFunc(services.SourcesHandler.HandleSources))).Methods("GET")
+
+	// Everything else under /api takes a client API key; reindex and sources,
+	// registered first, take the admin key instead
+	clientRouter := apiRouter.NewRoute().Subrouter()
+	clientRouter.Use(middleware.APIKeyAuthMiddleware(apiKeys))
+	clientRouter.HandleFunc("/query", services.QueryHandler.HandleQuery).Methods("POST")
+	clientRouter.HandleFunc("/query", services.QueryHandler.HandleQueryGet).Methods("GET")
+	clientRouter.HandleFunc("/query/feedback", services.FeedbackHandler.HandleFeedback).Methods("POST")
+	clientRouter.HandleFunc("/query/feedback/stats", services.FeedbackHandler.HandleFeedbackStats).Methods("GET")
+	clientRouter.HandleFunc("/documents/{id}", services.DocumentHandler.HandleGetDocument).Methods("GET")
+	clientRouter.HandleFunc("/stats", services.StatsHandler.HandleStats).Methods("GET")
 	
-	// Webhook routes with rate limiting (reserved for future integrations)
+	// Webhook, Slack and Discord requests share one bound on concurrent processing
+	// and the same body size limit
+	limitWebhookConcurrency := middleware.ConcurrencyLimitMiddleware(services.Config.WebhookMaxConcurrent, services.Config.WebhookRetryAfter)
+	limitWebhookBody := middleware.BodyLimitMiddleware(services.Config.WebhookMaxBodyBytes)
+
+	// Webhook routes with rate limiting
 	webhookRouter := router.PathPrefix("/webhook").Subrouter()
-	webhookRouter.Use(middleware.WebhookRateLimitMiddleware())
-	// Future integrations will be added here
+	webhookRouter.Use(middleware.WebhookRateLimitMiddleware(services.Config.WebhookRateLimit, services.Config.WebhookBurst, services.Config.RateLimitIdleTTL, rateLimitBypass))
+	webhookRouter.Use(limitWebhookConcurrency)
+	webhookRouter.Use(limitWebhookBody)
+	if services.NotionHandler != nil {
+		verifyNotion := middleware.NotionSignatureMiddleware(services.Config.NotionWebhookSecret)
+		webhookRouter.Handle("/notion", verifyNotion(http.HandlerFunc(services.NotionHandler.HandleWebhook))).Methods("POST")
+	}
+	if services.TeamsHandler != nil {
+		verifyTeams := middleware.TeamsSignatureMiddleware(services.Config.TeamsWebhookSecret)
+		webhookRouter.Handle("/teams", verifyTeams(http.HandlerFunc(services.TeamsHandler.HandleActivity))).Methods("POST")
+	}
 	
 	// Slack routes with rate limiting
 	slackRouter := router.PathPrefix("/slack").Subrouter()
-	slackRouter.Use(middleware.WebhookRateLimitMiddleware())
-	slackRouter.HandleFunc("/actions", services.SlackHandler.HandleMessageAction).Methods("POST")
+	slackRouter.Use(middleware.WebhookRateLimitMiddleware(services.Config.WebhookRateLimit, services.Config.WebhookBurst, services.Config.RateLimitIdleTTL, rateLimitBypass))
+	slackRouter.Use(limitWebhookConcurrency)
+	slackRouter.Use(limitWebhookBody)
+	verifySlack := middleware.SlackSignatureMiddleware(services.Config.SlackSigningSecret)
+	slackRouter.Handle("/actions", verifySlack(http.HandlerFunc(services.SlackHandler.HandleMessageAction))).Methods("POST")
+	slackRouter.Handle("/command", verifySlack(http.HandlerFunc(services.SlackCommandHandler.HandleCommand))).Methods("POST")
+
+	// Bulk channel ingestion (requires ADMIN_API_KEY)
+	slackRouter.Handle("/ingest-channel", requireAdmin(http.HandlerFunc(services.ChannelIngestHandler.HandleIngestChannel))).Methods("POST")
+	slackRouter.Handle("/ingest-channel/{id}", requireAdmin(http.HandlerFunc(services.ChannelIngestHandler.HandleIngestStatus))).Methods("GET")
 	
 	// Test endpoint for Slack actions (for debugging)
 	slackRouter.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
@@ -223,17 +569,35 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Slack actions endpoint is working"})
 	}).Methods("GET")
 	
+	// Discord routes, when Discord collection is enabled
+	if services.DiscordHandler != nil {
+		discordRouter := router.PathPrefix("/discord").Subrouter()
+		discordRouter.Use(middleware.WebhookRateLimitMiddleware(services.Config.WebhookRateLimit, services.Config.WebhookBurst, services.Config.RateLimitIdleTTL, rateLimitBypass))
+		discordRouter.Use(limitWebhookConcurrency)
+		discordRouter.Use(limitWebhookBody)
+		verifyDiscord := middleware.DiscordSignatureMiddleware(services.Config.DiscordPublicKey)
+		discordRouter.Handle("/interactions", verifyDiscord(http.HandlerFunc(services.DiscordHandler.HandleInteraction))).Methods("POST")
+	}
+
+	// Admin routes (require ADMIN_API_KEY)
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.AdminAuthMiddleware(services.Config.AdminAPIKey))
+	adminRouter.HandleFunc("/channels", services.AdminHandler.HandleListChannels).Methods("GET")
+	adminRouter.HandleFunc("/channels", services.AdminHandler.HandleAddChannel).Methods("POST")
+	adminRouter.HandleFunc("/channels/{id}", services.AdminHandler.HandleRemoveChannel).Methods("DELETE")
+	adminRouter.HandleFunc("/export", services.AdminHandler.HandleExport).Methods("GET")
+	adminRouter.HandleFunc("/import", services.AdminHandler.HandleImport).Methods("POST")
+	adminRouter.HandleFunc("/cache/flush", services.AdminHandler.HandleFlushCache).Methods("POST")
+	adminRouter.HandleFunc("/webhook/verify", services.AdminHandler.HandleVerifyWebhook).Methods("POST")
+	adminRouter.HandleFunc("/query/preview", services.QueryHandler.HandlePromptPreview).Methods("POST")
+	
 	// System routes
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}).Methods("GET")
 	
-	router.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Add readiness checks
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Ready"))
-	}).Methods("GET")
+	router.HandleFunc("/ready", services.ReadinessHandler.HandleReady).Methods("GET")
 	
 	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
@@ -266,6 +630,7 @@ func main() {
 	
 	// Stop embedding processors
 	services.SlackEmbeddingProcessor.Stop()
+	services.EmbeddingProcessor.Stop()
 	
 	// Shutdown server with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -276,5 +641,15 @@ func main() {
 		os.Exit(1)
 	}
 	
+	// Flush spans of the last requests
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	// Close document store once in-flight requests are done
+	if err := services.DocumentStore.Close(); err != nil {
+		slog.Error("Failed to close document store", "error", err)
+	}
+	
 	slog.Info("Server exited gracefully")
 }
\ No newline at end of file
@@ -143,6 +143,33 @@ func (m *mockIntegrationStore) GetDocumentsWithoutEmbeddings(ctx context.Context
 	return results, nil
 }
 
+func (m *mockIntegrationStore) CountDocumentsWithoutEmbeddings(ctx context.Context) (int, error) {
+	count := 0
+	for id := range m.documents {
+		if _, hasEmbedding := m.embeddings[id]; !hasEmbedding {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockIntegrationStore) GetDocument(ctx context.Context, id string) (*storage.Document, error) {
+	doc, exists := m.documents[id]
+	if !exists {
+		return nil, storage.ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+func (m *mockIntegrationStore) DeleteDocument(ctx context.Context, id string) error {
+	if _, exists := m.documents[id]; !exists {
+		return storage.ErrDocumentNotFound
+	}
+	delete(m.documents, id)
+	delete(m.embeddings, id)
+	return nil
+}
+
 func (m *mockIntegrationStore) Close() error {
 	return nil
 }